@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/amis"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/naming"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/report"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/upgrade"
+)
+
+// runCheck runs the check subcommand, reporting whether the nodeclasses run the newest eligible version.
+// It exits exitOutdated when any nodeclass is behind, so compliance jobs can alert on it.
+func runCheck(ctx context.Context, cs clients.Set, args []string) {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	outputFormat := fs.String("output", string(report.FormatText), "rendering of the check result: text or json")
+	requireProvenance := fs.Bool("require-provenance", false, "only count AMI versions whose provenance can be verified as eligible")
+	since := fs.String("since", "", "only count AMI versions created on or after this date (YYYY-MM-DD) as eligible")
+	until := fs.String("until", "", "only count AMI versions created on or before this date (YYYY-MM-DD) as eligible")
+	variant := fs.String("variant", "", "image variant to check against: standard or fips (defaults to the variant the nodeclasses use)")
+	maxCritical := fs.Int("max-critical", -1, "only count AMI versions with at most this many critical vulnerability findings as eligible (overrides the config file)")
+	maxHigh := fs.Int("max-high", -1, "only count AMI versions with at most this many high vulnerability findings as eligible (overrides the config file)")
+	awsOpts := addAWSFlags(fs)
+	fs.Parse(args)
+	cs = awsOpts.clients(cs)
+
+	format, err := report.ParseFormat(*outputFormat)
+	if err != nil {
+		fmt.Fprintf(errOut, "Error: %v\n", err)
+		exit(exitFailure)
+	}
+
+	cfg := loadConfig()
+	planner := newPlanner(cs, cfg)
+	if *requireProvenance && planner.Provenance == nil {
+		fmt.Fprintln(errOut, "Error: --require-provenance needs a provenance section in the config file")
+		exit(exitFailure)
+	}
+	if *variant != "" {
+		v, err := naming.ParseVariant(*variant)
+		if err != nil {
+			fmt.Fprintf(errOut, "Error: %v\n", err)
+			exit(exitFailure)
+		}
+		planner.Variant = &v
+	}
+	planner.Dates, err = versionDates(cfg.Versions, *since, *until, clock.Real.Now())
+	if err != nil {
+		fmt.Fprintf(errOut, "Error: %v\n", err)
+		exit(exitFailure)
+	}
+	findingsPolicy := vulnPolicy(cfg.Vulnerabilities, *maxCritical, *maxHigh)
+	if findingsPolicy.Enforced() && planner.Findings == nil {
+		fmt.Fprintln(errOut, "Error: finding limits need a vulnerabilities source in the config file")
+		exit(exitFailure)
+	}
+
+	approved := loadApprovals(ctx, cs, cfg)
+
+	discovery, err := planner.Discover(ctx)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	// Each AMI channel is checked against the versions its owner publishes
+	result := &upgrade.CheckResult{NodeClasses: []upgrade.NodeClassCheck{}}
+	var groups []checkGroup
+	for _, channel := range discovery.ChannelNames() {
+		scope := discovery.ForChannel(channel)
+		versions, err := planner.AllVersions(ctx, scope)
+		if err != nil {
+			if channel != "" {
+				err = fmt.Errorf("channel %s: %w", channel, err)
+			}
+			exitOnError(ctx, err)
+		}
+		scans, err := planner.ScanVersions(ctx, versions)
+		if err != nil {
+			exitOnError(ctx, err)
+		}
+
+		// Only versions the upgrade flow would let us select count
+		var eligible []amis.VersionItem
+		for _, v := range versions {
+			if result := planner.VerifyProvenance(v); *requireProvenance && result != nil && !result.Verified {
+				continue
+			}
+			if summary, ok := scans[v.Key()]; ok && findingsPolicy.Check(summary) != nil {
+				continue
+			}
+			if approved != nil && !approved.Approved(v.Version) {
+				continue
+			}
+			eligible = append(eligible, v)
+		}
+
+		result.NodeClasses = append(result.NodeClasses, planner.Check(scope, eligible).NodeClasses...)
+		for _, k8sVersion := range scope.KubernetesVersions() {
+			groups = append(groups, checkGroup{channel: channel, k8sVersion: k8sVersion})
+		}
+	}
+
+	if format == report.FormatJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		doc := struct {
+			UpToDate bool `json:"upToDate"`
+			*upgrade.CheckResult
+		}{result.UpToDate(), result}
+		if err := enc.Encode(doc); err != nil {
+			exitOnError(ctx, fmt.Errorf("failed to encode check result: %w", err))
+		}
+	} else {
+		printCheck(result, groups)
+	}
+
+	if !result.UpToDate() {
+		exit(exitOutdated)
+	}
+}
+
+// checkGroup is the Kubernetes version and AMI channel ("" for the default source) of a summary line
+type checkGroup struct {
+	channel    string
+	k8sVersion string
+}
+
+// printCheck renders the check result as a table followed by a summary per Kubernetes version and AMI
+// channel
+func printCheck(result *upgrade.CheckResult, groups []checkGroup) {
+	channels := slices.ContainsFunc(groups, func(g checkGroup) bool { return g.channel != "" })
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	if channels {
+		fmt.Fprintln(tw, "NODECLASS\tKUBERNETES\tCHANNEL\tCURRENT\tNEWEST ELIGIBLE\tNEWER")
+	} else {
+		fmt.Fprintln(tw, "NODECLASS\tKUBERNETES\tCURRENT\tNEWEST ELIGIBLE\tNEWER")
+	}
+	for _, c := range result.NodeClasses {
+		if channels {
+			channel := c.Channel
+			if channel == "" {
+				channel = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\n", c.NodeClass, c.K8sVersion, channel, displayVersion(c.Current), displayVersion(c.Newest), c.Newer)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\n", c.NodeClass, c.K8sVersion, displayVersion(c.Current), displayVersion(c.Newest), c.Newer)
+	}
+	tw.Flush()
+	fmt.Fprintln(out)
+
+	// Summarize each Kubernetes version and channel by its furthest-behind nodeclass
+	worst := make(map[checkGroup]upgrade.NodeClassCheck)
+	for _, c := range result.NodeClasses {
+		g := checkGroup{channel: c.Channel, k8sVersion: c.K8sVersion}
+		if w, seen := worst[g]; !seen || c.Newer > w.Newer || (w.UpToDate() && !c.UpToDate()) {
+			worst[g] = c
+		}
+	}
+	for _, g := range groups {
+		c := worst[g]
+		prefix := ""
+		switch {
+		case g.channel != "":
+			prefix = "Kubernetes " + g.k8sVersion + ", channel " + g.channel + ": "
+		case len(groups) > 1:
+			prefix = "Kubernetes " + g.k8sVersion + ": "
+		}
+		switch {
+		case c.UpToDate():
+			fmt.Fprintf(out, "✅ %sUp to date (%s)\n", prefix, displayVersion(c.Current))
+		case c.Newer == 1:
+			fmt.Fprintf(out, "⚠️  %s1 newer version available (newest %s, current %s)\n", prefix, displayVersion(c.Newest), displayVersion(c.Current))
+		default:
+			fmt.Fprintf(out, "⚠️  %s%d newer versions available (newest %s, current %s)\n", prefix, c.Newer, displayVersion(c.Newest), displayVersion(c.Current))
+		}
+	}
+}
+
+// displayVersion formats a version for display, e.g. v20251001, or "unknown" when empty
+func displayVersion(version string) string {
+	if version == "" {
+		return "unknown"
+	}
+	return "v" + version
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/config"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/confirmation"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/output"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/report"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/runstate"
+)
+
+// confirmationProvider creates the provider that gives the go-ahead to apply: the --confirm flag, or the
+// config file's provider, with --approval-token implying token-file. It exits on invalid settings.
+func confirmationProvider(cfg config.Confirmation, provider, tokenFile string) confirmation.Provider {
+	if tokenFile != "" {
+		if provider != "" && provider != confirmation.ProviderTokenFile {
+			fmt.Fprintf(errOut, "Error: --approval-token cannot be used with --confirm %s\n", provider)
+			exit(exitFailure)
+		}
+		cfg.Provider, cfg.TokenFile = confirmation.ProviderTokenFile, tokenFile
+	} else if provider != "" {
+		cfg.Provider = provider
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(errOut, "Error: %v\n", err)
+		exit(exitFailure)
+	}
+
+	switch cfg.Provider {
+	case confirmation.ProviderAuto:
+		return confirmation.Auto{}
+	case confirmation.ProviderTokenFile:
+		return confirmation.TokenFile{Path: cfg.TokenFile}
+	case confirmation.ProviderSlack:
+		return slackClient(cfg.Slack, "approvals")
+	default:
+		return confirmation.TTY{In: os.Stdin, Out: out}
+	}
+}
+
+// slackClient creates the Slack client of the channel, with the bot token from the environment, exiting
+// when there is none. use names what the token is needed for in the error.
+func slackClient(cfg config.SlackApproval, use string) confirmation.Slack {
+	env := cfg.TokenEnv
+	if env == "" {
+		env = config.DefaultSlackTokenEnv
+	}
+	token := os.Getenv(env)
+	redactor.Add(token)
+	if token == "" {
+		fmt.Fprintf(errOut, "Error: Slack %s need a bot token in $%s\n", use, env)
+		exit(exitFailure)
+	}
+	return confirmation.Slack{Token: token, Channel: cfg.Channel, Approvers: cfg.Approvers, Timeout: cfg.Timeout}
+}
+
+// confirmRequest describes the plans to approvers, with the IDs an approval token must name
+func confirmRequest(ctx context.Context, cs clients.Set, question string, plans []*plan.Plan) confirmation.Request {
+	req := confirmation.Request{Question: question, Operator: runOperator.String()}
+	req.Cluster, _ = nodeclasses.CurrentContext(ctx, cs.Kube)
+
+	var summary strings.Builder
+	for _, p := range plans {
+		id, err := runstate.PlanID(p)
+		if err != nil {
+			exitOnError(ctx, err)
+		}
+		req.PlanIDs = append(req.PlanIDs, id)
+		report.WritePlan(&summary, report.FormatText, p)
+	}
+	req.Summary = summary.String()
+	return req
+}
+
+// approve asks provider for the go-ahead and reports the decision. Declining at the terminal exits
+// successfully; other providers' refusals exit with ErrNotApproved's code.
+func approve(ctx context.Context, provider confirmation.Provider, req confirmation.Request) {
+	switch p := provider.(type) {
+	case confirmation.TokenFile:
+		fmt.Fprintf(out, "🔑 Checking the approval token %s for plans %s\n", p.Path, strings.Join(req.PlanIDs, ", "))
+	case confirmation.Slack:
+		fmt.Fprintf(out, "💬 Asked for approval in Slack channel %s; waiting for a reaction...\n", p.Channel)
+	}
+
+	d, err := provider.Confirm(ctx, req)
+	if err != nil {
+		if ctx.Err() != nil {
+			exitInterrupted(ctx)
+		}
+		exitOnError(ctx, fmt.Errorf("failed to get confirmation: %w", err))
+	}
+	e := output.Event{Type: "confirm", Message: "approved", Data: d}
+	if !d.Approved {
+		e.Level, e.Message = output.LevelWarn, d.Err().Error()
+	}
+	emit(e)
+
+	switch {
+	case d.Provider == confirmation.ProviderTTY && !d.Approved:
+		fmt.Fprintln(out, "Cancelled")
+		exit(0)
+	case !d.Approved:
+		exitOnError(ctx, d.Err())
+	case d.Provider != confirmation.ProviderTTY:
+		fmt.Fprintf(out, "✅ Approved by %s (%s)\n", d.By, d.Provider)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/config"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/confirmation"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/output"
+)
+
+func TestConfirmationProviderRedactsSlackToken(t *testing.T) {
+	// Not shaped like a Slack token, so only registering it redacts it
+	const token = "approvals-bot-s3cr3t"
+	t.Setenv("UPGRADE_AMI_TEST_SLACK_TOKEN", token)
+
+	cfg := config.Confirmation{Provider: confirmation.ProviderSlack}
+	cfg.Slack.Channel, cfg.Slack.TokenEnv = "#upgrades", "UPGRADE_AMI_TEST_SLACK_TOKEN"
+	provider, ok := confirmationProvider(cfg, "", "").(confirmation.Slack)
+	if !ok || provider.Token != token {
+		t.Fatalf("provider = %#v, want Slack with the token", provider)
+	}
+	if got := redactor.Redact("slack: not_authed for " + token); strings.Contains(got, token) || !strings.Contains(got, output.Redacted) {
+		t.Errorf("Redact() = %q, want the token redacted", got)
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/output"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/upgrade"
+)
+
+// How nodeclasses changed another way between planning and applying are resolved (--on-conflict)
+const (
+	conflictAsk    = "ask"    // ask the operator when the go-ahead is given at the terminal, abort otherwise
+	conflictRetake = "retake" // plan their changes again from their current state
+	conflictSkip   = "skip"   // leave them as the other change left them
+	conflictAbort  = "abort"  // stop the run
+)
+
+var conflictResolutions = []string{conflictAsk, conflictRetake, conflictSkip, conflictAbort}
+
+// checkConflictMode exits unless mode is one of conflictResolutions
+func checkConflictMode(mode string) {
+	for _, m := range conflictResolutions {
+		if mode == m {
+			return
+		}
+	}
+	fmt.Fprintf(errOut, "Error: --on-conflict must be one of %s\n", strings.Join(conflictResolutions, ", "))
+	exit(exitFailure)
+}
+
+// conflict is a planned change whose nodeclass was changed another way since the plan was made
+type conflict struct {
+	plan    int          // index of the plan of the change
+	Change  plan.Change  `json:"change"`
+	Current string       `json:"current,omitempty"` // AMI the nodeclass selects now
+	Deleted bool         `json:"deleted,omitempty"`
+	Retaken *plan.Change `json:"retaken,omitempty"` // the change planned again from the current state; nil when none is needed
+	Reason  string       `json:"reason,omitempty"`  // why no change is needed
+}
+
+// newConflict describes the planned change ch of plans[i], whose nodeclass is now nc (nil when deleted),
+// with the change retaking it would apply
+func newConflict(planner *upgrade.Planner, plans []*plan.Plan, i int, ch plan.Change, nc *nodeclasses.EC2NodeClass) conflict {
+	c := conflict{plan: i, Change: ch}
+	if nc == nil {
+		c.Deleted, c.Reason = true, "no longer exists"
+		return c
+	}
+	c.Current = nc.AMIName()
+	c.Retaken, c.Reason = planner.Retake(plans[i], ch, *nc)
+	return c
+}
+
+// findConflicts returns the conflicts of the planned changes of the named nodeclasses, or of every change
+// whose nodeclass no longer matches it when names is nil
+func findConflicts(planner *upgrade.Planner, plans []*plan.Plan, list nodeclasses.NodeClassList, names map[string]bool) []conflict {
+	current := make(map[string]*nodeclasses.EC2NodeClass, len(list.Items))
+	for i := range list.Items {
+		current[list.Items[i].Metadata.Name] = &list.Items[i]
+	}
+	var conflicts []conflict
+	for i, p := range plans {
+		// Compare returns an entry per change, in order
+		for j, e := range p.Compare(list).Entries {
+			conflicted := names[e.NodeClass]
+			if names == nil {
+				conflicted = e.Status == plan.DiffDiverged || e.Status == plan.DiffMissing
+			}
+			if conflicted {
+				conflicts = append(conflicts, newConflict(planner, plans, i, p.Changes[j], current[e.NodeClass]))
+			}
+		}
+	}
+	return conflicts
+}
+
+// resolveConflicts shows the nodeclasses changed another way, with the change planned from their current
+// state, and decides how to resolve them: by mode, or by asking the operator when mode is ask and the
+// go-ahead is given at the terminal (interactive). Unattended runs asked to ask abort.
+func resolveConflicts(ctx context.Context, conflicts []conflict, mode string, interactive bool) string {
+	fmt.Fprintf(errOut, "🔀 %d nodeclasses were changed another way since the plan was made:\n", len(conflicts))
+	for _, c := range conflicts {
+		fmt.Fprintf(errOut, "   %s\n", c.Change.NodeClass)
+		fmt.Fprintf(errOut, "     Planned: %s\n", describeChange(c.Change))
+		if c.Deleted {
+			fmt.Fprintln(errOut, "     Now:     deleted")
+		} else {
+			fmt.Fprintf(errOut, "     Now:     %s\n", c.Current)
+		}
+		if c.Retaken != nil {
+			fmt.Fprintf(errOut, "     Retake:  %s\n", describeChange(*c.Retaken))
+		} else {
+			fmt.Fprintf(errOut, "     Retake:  nothing to change (%s)\n", c.Reason)
+		}
+	}
+	fmt.Fprintln(errOut)
+
+	resolution := mode
+	if mode == conflictAsk && !interactive {
+		fmt.Fprintln(errOut, "   Not asking in an unattended run; pass --on-conflict retake or skip to resolve conflicts without a terminal")
+		resolution = conflictAbort
+	} else if mode == conflictAsk {
+		resolution = askConflict(ctx)
+	}
+	emit(output.Event{
+		Type:    "conflict",
+		Level:   output.LevelWarn,
+		Message: fmt.Sprintf("%d nodeclasses changed since the plan was made: %s", len(conflicts), resolution),
+		Data:    map[string]interface{}{"resolution": resolution, "conflicts": conflicts},
+	})
+	return resolution
+}
+
+// askConflict asks the operator how to resolve the conflicts, aborting unless they answer retake or skip
+func askConflict(ctx context.Context) string {
+	fmt.Fprint(out, "Retake the changes from the current state, skip these nodeclasses, or abort? (r/s/A): ")
+	answer := make(chan string, 1)
+	go func() {
+		var response string
+		fmt.Fscanln(os.Stdin, &response)
+		answer <- strings.ToLower(response)
+	}()
+
+	select {
+	case response := <-answer:
+		switch response {
+		case "r", conflictRetake:
+			return conflictRetake
+		case "s", conflictSkip:
+			return conflictSkip
+		}
+		return conflictAbort
+	case <-ctx.Done():
+		fmt.Fprintln(out)
+		exitOnError(ctx, ctx.Err())
+		return conflictAbort
+	}
+}
+
+// describeChange shows a change as "old → new", with the amiFamily it sets
+func describeChange(ch plan.Change) string {
+	s := ch.OldAMI + " → " + ch.NewAMI
+	if ch.NewAMIFamily != "" {
+		s += fmt.Sprintf(" (amiFamily %s)", ch.NewAMIFamily)
+	}
+	return s
+}
+
+// conflictNames names the nodeclasses of the conflicts
+func conflictNames(conflicts []conflict) string {
+	names := make([]string, len(conflicts))
+	for i, c := range conflicts {
+		names[i] = c.Change.NodeClass
+	}
+	return strings.Join(names, ", ")
+}
+
+// applyResolution updates the plans: the conflicting changes are replaced by their retaken changes when
+// resolution is retake, and the others moved to the plans' skipped nodeclasses
+func applyResolution(plans []*plan.Plan, conflicts []conflict, resolution string) {
+	type key struct {
+		plan      int
+		nodeClass string
+	}
+	resolved := make(map[key]conflict, len(conflicts))
+	for _, c := range conflicts {
+		resolved[key{c.plan, c.Change.NodeClass}] = c
+	}
+	for i, p := range plans {
+		var changes []plan.Change
+		for _, ch := range p.Changes {
+			c, ok := resolved[key{i, ch.NodeClass}]
+			switch {
+			case !ok:
+				changes = append(changes, ch)
+			case resolution == conflictRetake && c.Retaken != nil:
+				changes = append(changes, *c.Retaken)
+			case resolution == conflictRetake:
+				p.Skipped = append(p.Skipped, plan.Skipped{NodeClass: ch.NodeClass, Reason: "changed since the plan was made; " + c.Reason})
+			default:
+				p.Skipped = append(p.Skipped, plan.Skipped{NodeClass: ch.NodeClass, Reason: "changed since the plan was made; skipped"})
+			}
+		}
+		p.Changes = changes
+	}
+}
+
+// checkConflicts checks that the nodeclasses still match the plans before they are applied. Planned
+// nodeclasses changed another way in the meantime are resolved with resolveConflicts: their changes are
+// retaken or skipped and the plans' preconditions rebased on the current nodeclasses, or the run exits with
+// plan.ErrPreconditionFailed. Other changes to the nodeclasses, e.g. one added, exit as a stale plan. It
+// returns the number of changes left to apply.
+func checkConflicts(ctx context.Context, cs clients.Set, planner *upgrade.Planner, plans []*plan.Plan, mode string, interactive bool) int {
+	list, err := nodeclasses.GetEC2NodeClasses(ctx, cs.Kube)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	var stale error
+	for _, p := range plans {
+		if err := p.CheckPrecondition(list); err != nil && stale == nil {
+			stale = err
+		}
+	}
+	if stale == nil {
+		return countChanges(plans)
+	}
+	conflicts := findConflicts(planner, plans, list, nil)
+	if len(conflicts) == 0 {
+		exitOnError(ctx, stale)
+	}
+
+	resolution := resolveConflicts(ctx, conflicts, mode, interactive)
+	if resolution == conflictAbort {
+		exitOnError(ctx, fmt.Errorf("%w: %s changed another way", plan.ErrPreconditionFailed, conflictNames(conflicts)))
+	}
+	applyResolution(plans, conflicts, resolution)
+	for _, p := range plans {
+		p.Rebase(list)
+	}
+	printResolution(conflicts, resolution)
+	return countChanges(plans)
+}
+
+// countChanges returns the number of changes of the plans
+func countChanges(plans []*plan.Plan) int {
+	n := 0
+	for _, p := range plans {
+		n += len(p.Changes)
+	}
+	return n
+}
+
+// resolveApplyConflicts resolves the updates that failed with nodeclasses.ErrConflict because their
+// nodeclass was changed another way after the plans were checked. Retaken changes are applied with applier
+// and replace the failed results, and skipped nodeclasses are removed from the results; when the conflicts
+// were the only failures, the changes not attempted because of them are applied too. Aborting leaves the
+// updates failed. It returns the results and their error.
+func resolveApplyConflicts(ctx context.Context, cs clients.Set, planner *upgrade.Planner, applier *upgrade.Applier, plans []*plan.Plan, results []upgrade.ChangeResult, applyErr error, mode string, interactive bool) ([]upgrade.ChangeResult, error) {
+	names := make(map[string]bool)
+	otherFailures := false
+	for _, r := range results {
+		switch {
+		case errors.Is(r.Err, nodeclasses.ErrConflict):
+			names[r.NodeClass] = true
+		case r.Err != nil:
+			otherFailures = true
+		}
+	}
+	if len(names) == 0 {
+		return results, applyErr
+	}
+	list, err := nodeclasses.GetEC2NodeClasses(ctx, cs.Kube)
+	if err != nil {
+		fmt.Fprintf(errOut, "⚠️  Could not resolve the conflicting updates: %v\n", err)
+		return results, applyErr
+	}
+	conflicts := findConflicts(planner, plans, list, names)
+	resolution := resolveConflicts(ctx, conflicts, mode, interactive)
+	if resolution == conflictAbort {
+		return results, applyErr
+	}
+	applyResolution(plans, conflicts, resolution)
+	printResolution(conflicts, resolution)
+	fmt.Fprintln(out)
+
+	// The changes to apply now: the retaken ones, and those the conflicts kept from being attempted
+	pending := &plan.Plan{}
+	for _, c := range conflicts {
+		if resolution == conflictRetake && c.Retaken != nil {
+			pending.Changes = append(pending.Changes, *c.Retaken)
+		}
+	}
+	for _, r := range results {
+		if !r.Applied && !otherFailures {
+			pending.Changes = append(pending.Changes, r.Change)
+		}
+	}
+	retried := make(map[string]upgrade.ChangeResult)
+	var retryErr error
+	if len(pending.Changes) > 0 {
+		var retryResults []upgrade.ChangeResult
+		retryResults, retryErr = applier.Apply(ctx, pending)
+		for _, r := range retryResults {
+			retried[r.NodeClass] = r
+		}
+	}
+
+	resolved := make([]upgrade.ChangeResult, 0, len(results))
+	for _, r := range results {
+		if rr, ok := retried[r.NodeClass]; ok {
+			resolved = append(resolved, rr)
+		} else if !names[r.NodeClass] {
+			resolved = append(resolved, r)
+		}
+	}
+	if interrupted(retryErr) {
+		return resolved, retryErr
+	}
+	return resolved, upgrade.ResultsError(resolved)
+}
+
+// printResolution reports how the conflicts were resolved
+func printResolution(conflicts []conflict, resolution string) {
+	for _, c := range conflicts {
+		if resolution == conflictRetake && c.Retaken != nil {
+			fmt.Fprintf(out, "🔀 Retaking %s: %s\n", c.Change.NodeClass, describeChange(*c.Retaken))
+		} else {
+			fmt.Fprintf(out, "⏭️  Skipping %s (changed since the plan was made)\n", c.Change.NodeClass)
+		}
+	}
+}
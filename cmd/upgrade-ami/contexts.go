@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-isatty"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+)
+
+// contextVersionTimeout bounds how long the picker waits for each cluster to report its version, so an
+// unreachable cluster doesn't hold up the others
+const contextVersionTimeout = 5 * time.Second
+
+// selectContext points the Kubernetes client at the cluster to upgrade. A named context is used as is; otherwise,
+// when the kubeconfig has several contexts and the console is interactive, the user picks one, so the
+// current context is never used without being confirmed.
+func selectContext(ctx context.Context, cs clients.Set, name string) clients.Set {
+	switcher, ok := cs.Kube.(clients.ContextSwitcher)
+	if !ok {
+		if name != "" {
+			fmt.Fprintln(errOut, "Error: --context needs a kubeconfig-backed Kubernetes client")
+			exit(exitFailure)
+		}
+		return cs
+	}
+	if name != "" {
+		cs.Kube = switcher.WithContext(name)
+		fmt.Fprintf(out, "☸️  Using context %s\n", name)
+		fmt.Fprintln(out)
+		return cs
+	}
+	// Replayed sessions only know the commands that were recorded
+	if replaying() {
+		return cs
+	}
+
+	contexts, err := switcher.Contexts(ctx)
+	if err != nil {
+		fmt.Fprintf(errOut, "⚠️  %v\n", err)
+		return cs
+	}
+	if len(contexts) < 2 {
+		return cs
+	}
+	if !term.interactive || !isatty.IsTerminal(os.Stdin.Fd()) {
+		current := "none"
+		for _, c := range contexts {
+			if c.Current {
+				current = c.Name
+			}
+		}
+		fmt.Fprintf(errOut, "⚠️  The kubeconfig has %d contexts; using the current context (%s). Pass --context to choose.\n", len(contexts), current)
+		fmt.Fprintln(errOut)
+		return cs
+	}
+
+	fmt.Fprintln(out, "🔍 Detecting the Kubernetes version of each context...")
+	versions := contextVersions(ctx, switcher, contexts)
+
+	items := make([]list.Item, 0, len(contexts))
+	selected := 0
+	for i, c := range contexts {
+		items = append(items, contextItem{KubeContext: c, version: versions[i]})
+		if c.Current {
+			selected = i
+		}
+	}
+	choice := pickContext(ctx, items, selected)
+	if choice == nil {
+		fmt.Fprintln(out, "No context selected")
+		exit(0)
+	}
+	cs.Kube = switcher.WithContext(choice.Name)
+	fmt.Fprintf(out, "☸️  Using context %s (%s)\n", choice.Name, choice.Server)
+	fmt.Fprintln(out)
+	return cs
+}
+
+// contextVersions asks the cluster of every context for its Kubernetes version at once. Clusters that
+// don't answer in time get "unreachable".
+func contextVersions(ctx context.Context, switcher clients.ContextSwitcher, contexts []clients.KubeContext) []string {
+	versions := make([]string, len(contexts))
+	var wg sync.WaitGroup
+	for i, c := range contexts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, contextVersionTimeout)
+			defer cancel()
+			version, err := clients.ServerVersion(ctx, switcher.WithContext(c.Name))
+			if err != nil {
+				version = "unreachable"
+			}
+			versions[i] = version
+		}()
+	}
+	wg.Wait()
+	return versions
+}
+
+// contextItem is a kubeconfig context in the picker
+type contextItem struct {
+	clients.KubeContext
+	version string // Kubernetes version the cluster reports
+}
+
+func (i contextItem) FilterValue() string { return i.Name }
+
+type contextDelegate struct{}
+
+func (d contextDelegate) Height() int                             { return 2 }
+func (d contextDelegate) Spacing() int                            { return 0 }
+func (d contextDelegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd { return nil }
+func (d contextDelegate) Render(w io.Writer, m list.Model, index int, listItem list.Item) {
+	it, ok := listItem.(contextItem)
+	if !ok {
+		return
+	}
+
+	str := it.Name
+	if it.Current {
+		str += " (current)"
+	}
+	detail := fmt.Sprintf("  cluster %s - %s - Kubernetes %s", it.Cluster, it.Server, it.version)
+
+	if index == m.Index() {
+		fmt.Fprint(w, selectedItemStyle.Render("> "+str+"\n"+detail))
+	} else {
+		fmt.Fprint(w, itemStyle.Render(str+"\n"+detail))
+	}
+}
+
+type contextModel struct {
+	list     list.Model
+	choice   *contextItem
+	quitting bool
+}
+
+func (m contextModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m contextModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.list.SetWidth(msg.Width)
+		return m, nil
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c":
+			m.quitting = true
+			return m, tea.Quit
+
+		case "enter":
+			if i, ok := m.list.SelectedItem().(contextItem); ok {
+				m.choice = &i
+			}
+			return m, tea.Quit
+		}
+	}
+
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+func (m contextModel) View() string {
+	if m.quitting {
+		return ""
+	}
+	return "\n" + m.list.View()
+}
+
+// pickContext shows the contexts in a TUI list with the one at selected highlighted
+func pickContext(ctx context.Context, items []list.Item, selected int) *contextItem {
+	const defaultWidth = 20
+	l := list.New(items, contextDelegate{}, defaultWidth, 14)
+	l.Title = "Select the cluster to upgrade"
+	l.SetShowStatusBar(false)
+	l.SetFilteringEnabled(false)
+	l.Styles.Title = titleStyle
+	l.Styles.PaginationStyle = paginationStyle
+	l.Styles.HelpStyle = helpStyle
+	l.Select(selected)
+
+	program := tea.NewProgram(contextModel{list: l}, tea.WithAltScreen(), tea.WithContext(ctx))
+	finalModel, err := program.Run()
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+
+	if finalModel.(contextModel).quitting {
+		fmt.Fprintln(out, "Cancelled")
+		exit(0)
+	}
+	return finalModel.(contextModel).choice
+}
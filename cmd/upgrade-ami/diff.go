@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/report"
+)
+
+// runDiff runs the diff subcommand, comparing the cluster's nodeclasses with a plan file. It exits
+// non-zero unless every planned change has landed.
+func runDiff(ctx context.Context, cs clients.Set, args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	planFile := fs.String("plan", "", "plan document written by --save-plan (JSON or YAML)")
+	outputFormat := fs.String("output", string(report.FormatText), "rendering of the comparison: text or json")
+	fs.Parse(args)
+
+	if *planFile == "" {
+		fmt.Fprintln(errOut, "Error: --plan is required")
+		exit(exitFailure)
+	}
+	format, err := report.ParseFormat(*outputFormat)
+	if err != nil {
+		fmt.Fprintf(errOut, "Error: %v\n", err)
+		exit(exitFailure)
+	}
+
+	p, err := readPlanFile(*planFile)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	list, err := nodeclasses.GetEC2NodeClasses(ctx, cs.Kube)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	diff := p.Compare(list)
+
+	if format == report.FormatJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(diff); err != nil {
+			exitOnError(ctx, fmt.Errorf("failed to encode diff: %w", err))
+		}
+	} else {
+		printDiff(*planFile, p, diff)
+	}
+
+	if !diff.Matches() {
+		exit(exitPlanMismatch)
+	}
+}
+
+// printDiff renders the comparison as a table followed by a summary
+func printDiff(path string, p *plan.Plan, diff *plan.Diff) {
+	fmt.Fprintf(out, "📋 Plan v%s (%s) vs cluster:\n\n", p.Version, path)
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODECLASS\tSTATUS\tCURRENT AMI\tPLANNED AMI")
+	for _, e := range diff.Entries {
+		current := e.CurrentAMI
+		if e.Status == plan.DiffMissing {
+			current = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.NodeClass, e.Status, current, e.NewAMI)
+	}
+	tw.Flush()
+	fmt.Fprintln(out)
+
+	fmt.Fprintf(out, "✅ %d applied, ⏳ %d pending, ⚠️  %d diverged, ❌ %d missing\n",
+		diff.Count(plan.DiffApplied), diff.Count(plan.DiffPending), diff.Count(plan.DiffDiverged), diff.Count(plan.DiffMissing))
+	if len(diff.Unplanned) > 0 {
+		fmt.Fprintf(out, "Not in the plan: %s\n", strings.Join(diff.Unplanned, ", "))
+	}
+}
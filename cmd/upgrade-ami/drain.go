@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/output"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/pods"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/simulate"
+)
+
+// listDrainInputs lists the nodeclaims, the pods of every node and the PDBs a drain simulation needs
+func listDrainInputs(ctx context.Context, cs clients.Set) ([]nodeclasses.NodeClaimStatus, map[string]pods.PodList, pods.PodDisruptionBudgetList, error) {
+	statuses, err := nodeclasses.GetNodeClaimStatuses(ctx, cs.Kube, clock.Real.Now())
+	if err != nil {
+		return nil, nil, pods.PodDisruptionBudgetList{}, err
+	}
+	byNode, err := pods.GetPodsByNode(ctx, cs.Kube)
+	if err != nil {
+		return nil, nil, pods.PodDisruptionBudgetList{}, err
+	}
+	pdbs, err := pods.GetPodDisruptionBudgets(ctx, cs.Kube)
+	if err != nil {
+		return nil, nil, pods.PodDisruptionBudgetList{}, err
+	}
+	return statuses, byNode, pdbs, nil
+}
+
+// checkDrains simulates draining the nodes the plans would replace and reports those that would fail to
+// drain now, as a drain event. It only warns: PDBs and do-not-disrupt pods hold a rollout up rather than
+// fail it.
+func checkDrains(ctx context.Context, cs clients.Set, plans []*plan.Plan) {
+	fmt.Fprintln(out, "🔍 Simulating the drain of the nodes to replace...")
+	statuses, byNode, pdbs, err := listDrainInputs(ctx, cs)
+	if err != nil {
+		if ctx.Err() != nil {
+			exitOnError(ctx, err)
+		}
+		fmt.Fprintf(errOut, "⚠️  Not simulating drains: %v\n\n", err)
+		return
+	}
+	drains := simulate.Drains(plans, statuses, byNode, pdbs)
+	simulate.WriteDrains(out, drains)
+	fmt.Fprintln(out)
+
+	e := output.Event{Type: "drain", Message: fmt.Sprintf("%d nodes would drain", len(drains)), Data: drains}
+	var failing int
+	for _, d := range drains {
+		if !d.Drainable() {
+			failing++
+		}
+	}
+	if failing > 0 {
+		e.Level, e.Message = output.LevelWarn, fmt.Sprintf("%d of %d nodes would fail to drain", failing, len(drains))
+	}
+	emit(e)
+}
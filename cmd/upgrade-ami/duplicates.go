@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/amis"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/output"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/upgrade"
+)
+
+// addPinFlag registers the flag pinning nodeclasses to one image of a duplicated AMI name
+func addPinFlag(fs *flag.FlagSet) *string {
+	return fs.String("pin-duplicates", "", "when several images share the new AMI name, select one by ID instead of by name: newest, or the comma-separated image IDs to use")
+}
+
+// checkDuplicates warns about the new AMI names of the plan that several images of v have, listing their
+// IDs, and pins the changes to one of the images when pin is set (--pin-duplicates). It returns the IDs
+// pinned.
+func checkDuplicates(p *plan.Plan, v amis.VersionItem, pin string) []string {
+	dups := upgrade.Duplicates(p, v)
+	if len(dups) == 0 {
+		return nil
+	}
+	emit(output.Event{Type: "duplicates", Level: output.LevelWarn, Message: fmt.Sprintf("%d AMI names have several images", len(dups)), Data: dups})
+
+	for _, d := range dups {
+		fmt.Fprintf(errOut, "⚠️  %d images are named %s (%s); Karpenter selects the newest:\n", len(d.Images), d.Name, strings.Join(d.NodeClasses, ", "))
+		for i, image := range d.Images {
+			newest := ""
+			if i == 0 {
+				newest = "  (newest)"
+			}
+			fmt.Fprintf(errOut, "     %-21s  %s%s\n", image.ImageID, amis.FormatTime(image.CreationDate, displayLocation), newest)
+		}
+	}
+	if pin == "" {
+		fmt.Fprintln(errOut, "   Pass --pin-duplicates newest, or the image IDs to use, to select them by ID instead of by name")
+		fmt.Fprintln(errOut)
+		return nil
+	}
+
+	pinned := upgrade.Pin(p, dups, pin)
+	for _, ch := range p.Changes {
+		if ch.NewAMIID != "" {
+			fmt.Fprintf(out, "📌 Pinning %s to %s\n", ch.NodeClass, ch.NewAMIID)
+		}
+	}
+	fmt.Fprintln(out)
+	return pinned
+}
+
+// checkPinned exits when an image ID passed to --pin-duplicates belongs to no duplicated AMI name of the
+// plans, since the nodeclasses it was meant for would otherwise silently follow the name
+func checkPinned(ctx context.Context, pin string, pinned []string) {
+	for _, id := range upgrade.PinIDs(pin) {
+		if !slices.Contains(pinned, id) {
+			exitOnError(ctx, fmt.Errorf("failed to pin %s: it is not an image of a new AMI name several images have", id))
+		}
+	}
+}
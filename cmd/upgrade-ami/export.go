@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients/offline"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/retry"
+)
+
+// runExportAMIs runs the export-amis subcommand, writing the AMIs of the naming scheme to a catalog file
+// that amiCatalog or plan --ami-list can read where ec2:DescribeImages is not allowed
+func runExportAMIs(ctx context.Context, cs clients.Set, args []string) {
+	fs := flag.NewFlagSet("export-amis", flag.ExitOnError)
+	owners := fs.String("owner", "", "comma-separated AMI owner accounts to export (required)")
+	outputFile := fs.String("output", "", "write the catalog to this file instead of stdout")
+	awsOpts := addAWSFlags(fs)
+	fs.Parse(args)
+	cs = awsOpts.clients(cs)
+
+	if *owners == "" {
+		fmt.Fprintln(errOut, "Error: --owner is required")
+		exit(exitFailure)
+	}
+	cfg := loadConfig()
+	scheme, err := cfg.NamingScheme()
+	if err != nil {
+		fmt.Fprintf(errOut, "Error: %v\n", err)
+		exit(exitFailure)
+	}
+
+	// Only the AMIs the naming scheme recognizes can be offered, so the rest would only bloat the catalog
+	images := make(map[string][]clients.Image)
+	count := 0
+	for _, owner := range strings.Split(*owners, ",") {
+		owner = strings.TrimSpace(owner)
+		var described []clients.Image
+		err := retry.Do(ctx, retry.Default, func(ctx context.Context) error {
+			var err error
+			described, err = cs.EC2.DescribeImages(ctx, owner)
+			return err
+		})
+		if err != nil {
+			exitOnError(ctx, fmt.Errorf("failed to get AMIs of %s: %w", owner, err))
+		}
+		for _, image := range described {
+			if _, ok := scheme.Parse(image.Name); ok {
+				images[owner] = append(images[owner], image)
+				count++
+			}
+		}
+	}
+
+	if *outputFile == "" {
+		if err := offline.ExportImages(out, clock.Real.Now(), images); err != nil {
+			exitOnError(ctx, err)
+		}
+		return
+	}
+	f, err := os.Create(*outputFile)
+	if err != nil {
+		exitOnError(ctx, fmt.Errorf("failed to create catalog: %w", err))
+	}
+	err = offline.ExportImages(f, clock.Real.Now(), images)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write catalog: %w", closeErr)
+	}
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	fmt.Fprintf(out, "📚 Exported %d AMIs to %s\n", count, *outputFile)
+}
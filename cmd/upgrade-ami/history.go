@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/history"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+)
+
+// runHistory runs the history subcommand, reporting drift-resolution trends across runs
+func runHistory(ctx context.Context, cs clients.Set, args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	cluster := fs.String("cluster", "", "cluster (kubectl context) to report on (defaults to the current context)")
+	allClusters := fs.Bool("all-clusters", false, "report on runs from all clusters")
+	file := fs.String("file", "", "history file to read (defaults to ~/.upgrade-ami/history.json)")
+	fs.Parse(args)
+
+	path := *file
+	if path == "" {
+		var err error
+		path, err = history.DefaultPath()
+		if err != nil {
+			fmt.Fprintf(errOut, "Error: %v\n", err)
+			exit(1)
+		}
+	}
+
+	runs, err := history.Load(path)
+	if err != nil {
+		fmt.Fprintf(errOut, "Error: %v\n", err)
+		exit(1)
+	}
+
+	if !*allClusters && *cluster == "" {
+		*cluster, err = nodeclasses.CurrentContext(ctx, cs.Kube)
+		if err != nil {
+			fmt.Fprintf(errOut, "Error: %v\n", err)
+			exit(1)
+		}
+	}
+	if *allClusters {
+		*cluster = ""
+	}
+
+	summaries := history.MonthlySummaries(runs, *cluster)
+	if len(summaries) == 0 {
+		fmt.Fprintln(out, "No recorded runs found")
+		return
+	}
+
+	scope := *cluster
+	if scope == "" {
+		scope = "all clusters"
+	}
+	fmt.Fprintf(out, "📈 Drift Resolution Trends (%s)\n", scope)
+	fmt.Fprintln(out, strings.Repeat("=", 80))
+	fmt.Fprintf(out, "%-10s %6s %14s %10s\n", "Month", "Runs", "Replacements", "Median")
+
+	var longest time.Duration
+	for _, s := range summaries {
+		if s.Median > longest {
+			longest = s.Median
+		}
+	}
+	for _, s := range summaries {
+		bar := ""
+		if longest > 0 {
+			bar = strings.Repeat("█", int(30*s.Median/longest))
+		}
+		fmt.Fprintf(out, "%-10s %6d %14d %10s  %s\n", s.Month, s.Runs, s.Replacements, formatAge(s.Median), bar)
+	}
+	fmt.Fprintln(out, strings.Repeat("=", 80))
+
+	if trend := describeTrend(summaries); trend != "" {
+		fmt.Fprintln(out, trend)
+	}
+}
+
+// describeTrend compares the median replacement time of the latest month against the month before it
+func describeTrend(summaries []history.PeriodSummary) string {
+	if len(summaries) < 2 {
+		return ""
+	}
+
+	prev := summaries[len(summaries)-2]
+	cur := summaries[len(summaries)-1]
+	if prev.Median == 0 || cur.Median == 0 {
+		return ""
+	}
+
+	change := float64(cur.Median-prev.Median) / float64(prev.Median) * 100
+	direction := "up"
+	if change < 0 {
+		direction = "down"
+		change = -change
+	}
+
+	return fmt.Sprintf("Median node replacement time %s %.0f%% since %s (%s → %s)",
+		direction, change, prev.Month, formatAge(prev.Median), formatAge(cur.Median))
+}
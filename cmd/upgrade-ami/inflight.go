@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/inflight"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/output"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/runstate"
+)
+
+// inFlightGuard stops an upgrade before planning when an earlier rollout is still in flight on the cluster:
+// nodeclaims still drifted, or another run left unfinished
+type inFlightGuard struct {
+	force *bool
+}
+
+// addInFlightFlag registers --force-new-run, which lets an upgrade start on top of a rollout in flight
+func addInFlightFlag(fs *flag.FlagSet) inFlightGuard {
+	return inFlightGuard{
+		force: fs.Bool("force-new-run", false, "start the upgrade even when nodeclaims are still drifted from an earlier change or another run on the cluster is unfinished"),
+	}
+}
+
+// inFlightAction is what a run does about the rollout in flight on its cluster
+type inFlightAction int
+
+const (
+	inFlightNone    inFlightAction = iota // nothing is in flight
+	inFlightForced                        // the run goes on anyway with --force-new-run
+	inFlightIgnored                       // the run only reads, so the rollout is reported but doesn't stop it
+	inFlightRefused                       // the run stops
+)
+
+// decideInFlight returns what a run does about the rollout in flight; force wins over readOnly
+func decideInFlight(r *inflight.Rollout, force, readOnly bool) inFlightAction {
+	switch {
+	case !r.Active():
+		return inFlightNone
+	case force:
+		return inFlightForced
+	case readOnly:
+		return inFlightIgnored
+	default:
+		return inFlightRefused
+	}
+}
+
+// check detects the rollout in flight on the cluster and exits if it stops the run. resumed is the state of
+// the run of the plan being resumed, which is part of this run. A failure to check only warns.
+func (g inFlightGuard) check(ctx context.Context, cs clients.Set, runs *runstate.Store, resumed *runstate.State, readOnly bool) {
+	cluster, err := nodeclasses.CurrentContext(ctx, cs.Kube)
+	if err != nil {
+		fmt.Fprintf(errOut, "⚠️  Could not check for a rollout in flight: %v\n", err)
+		return
+	}
+	rollout, err := inflight.Detect(ctx, cs.Kube, runs, cluster, resumed, clock.Real.Now())
+	if err != nil {
+		if ctx.Err() != nil {
+			exitOnError(ctx, ctx.Err())
+		}
+		fmt.Fprintf(errOut, "⚠️  Could not check for a rollout in flight: %v\n", err)
+		return
+	}
+	action := decideInFlight(rollout, *g.force, readOnly)
+	if action == inFlightNone {
+		return
+	}
+	emit(output.Event{Type: "inflight", Level: output.LevelWarn, Message: rollout.Err().Error(), Data: rollout})
+	writeInFlight(errOut, rollout, action)
+	if action == inFlightRefused {
+		exitOnError(ctx, rollout.Err())
+	}
+}
+
+// writeInFlight describes the rollout in flight and what the run does about it
+func writeInFlight(w io.Writer, r *inflight.Rollout, action inFlightAction) {
+	fmt.Fprintf(w, "⚠️  A previous rollout is still in flight on %s:\n", r.Cluster)
+	if len(r.Drifted) > 0 {
+		fmt.Fprintf(w, "   %d nodeclaims are still drifted:\n", r.DriftedCount())
+		for _, name := range r.NodeClasses() {
+			label := name
+			if label == "" {
+				label = "(no nodeclass)"
+			}
+			fmt.Fprintf(w, "     %s: %d\n", label, r.Drifted[name])
+		}
+	}
+	for _, st := range r.Runs {
+		fmt.Fprintf(w, "   The run of plan %s started %s is unfinished (%d changes applied, last %s)\n",
+			shortPlanID(st.PlanID), displayTime(st.StartedAt), len(st.Completed), displayTime(st.UpdatedAt))
+	}
+	switch action {
+	case inFlightForced:
+		fmt.Fprintln(w, "   Starting a new run anyway (--force-new-run)")
+		fmt.Fprintln(w)
+	case inFlightIgnored:
+		fmt.Fprintln(w)
+	case inFlightRefused:
+		fmt.Fprintln(w, "   Follow it with --wait-only or upgrade-ami monitor, resume an unfinished run with its --plan, or pass --force-new-run to start another upgrade anyway")
+	}
+}
+
+// shortPlanID abbreviates a plan ID for display, e.g. "sha256:3f2a9c1d4b5e"
+func shortPlanID(id string) string {
+	const length = len("sha256:") + 12
+	if len(id) > length {
+		return id[:length]
+	}
+	return id
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/inflight"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/runstate"
+)
+
+func TestDecideInFlight(t *testing.T) {
+	active := &inflight.Rollout{Cluster: "prod", Drifted: map[string]int{"default": 2}}
+	tests := []struct {
+		name            string
+		rollout         *inflight.Rollout
+		force, readOnly bool
+		want            inFlightAction
+	}{
+		{"nothing in flight", &inflight.Rollout{Cluster: "prod"}, false, false, inFlightNone},
+		{"nothing in flight, forced", &inflight.Rollout{Cluster: "prod"}, true, false, inFlightNone},
+		{"drifted nodeclaims", active, false, false, inFlightRefused},
+		{"unfinished run", &inflight.Rollout{Cluster: "prod", Runs: []*runstate.State{{PlanID: "sha256:1"}}}, false, false, inFlightRefused},
+		{"forced", active, true, false, inFlightForced},
+		{"read-only", active, false, true, inFlightIgnored},
+		{"forced and read-only", active, true, true, inFlightForced},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decideInFlight(tt.rollout, tt.force, tt.readOnly); got != tt.want {
+				t.Errorf("decideInFlight() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteInFlight(t *testing.T) {
+	defer func(loc *time.Location) { displayLocation = loc }(displayLocation)
+	displayLocation = time.UTC
+
+	started := time.Date(2025, 10, 1, 22, 0, 0, 0, time.UTC)
+	rollout := &inflight.Rollout{
+		Cluster: "prod",
+		Drifted: map[string]int{"gpu": 1, "default": 2, "": 1},
+		Runs: []*runstate.State{{
+			PlanID:    "sha256:3f2a9c1d4b5e6f708192a3b4c5d6e7f8",
+			StartedAt: started,
+			UpdatedAt: started.Add(10 * time.Minute),
+			Completed: []string{"default"},
+		}},
+	}
+	details := "⚠️  A previous rollout is still in flight on prod:\n" +
+		"   4 nodeclaims are still drifted:\n" +
+		"     (no nodeclass): 1\n" +
+		"     default: 2\n" +
+		"     gpu: 1\n" +
+		"   The run of plan sha256:3f2a9c1d4b5e started " + displayTime(started) + " is unfinished (1 changes applied, last " + displayTime(started.Add(10*time.Minute)) + ")\n"
+
+	tests := []struct {
+		action inFlightAction
+		want   string
+	}{
+		{inFlightForced, details + "   Starting a new run anyway (--force-new-run)\n\n"},
+		{inFlightIgnored, details + "\n"},
+		{inFlightRefused, details + "   Follow it with --wait-only or upgrade-ami monitor, resume an unfinished run with its --plan, or pass --force-new-run to start another upgrade anyway\n"},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		writeInFlight(&b, rollout, tt.action)
+		if b.String() != tt.want {
+			t.Errorf("writeInFlight(%v) = %q, want %q", tt.action, b.String(), tt.want)
+		}
+	}
+}
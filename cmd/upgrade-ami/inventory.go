@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/inventory"
+)
+
+// runInventory runs the inventory subcommand, exporting the nodeclasses and what they run as CSV or JSON
+func runInventory(ctx context.Context, cs clients.Set, args []string) {
+	fs := flag.NewFlagSet("inventory", flag.ExitOnError)
+	var format string
+	fs.StringVar(&format, "output", "csv", "export format: csv or json")
+	fs.StringVar(&format, "o", "csv", "shorthand for --output")
+	awsOpts := addAWSFlags(fs)
+	fs.Parse(args)
+	cs = awsOpts.clients(cs)
+
+	if format != "csv" && format != "json" {
+		fmt.Fprintf(errOut, "Error: unknown inventory format %q (want csv or json)\n", format)
+		exit(exitFailure)
+	}
+
+	inv, err := inventory.Collect(ctx, cs, clock.Real.Now())
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	for _, warning := range inv.Warnings {
+		fmt.Fprintf(errOut, "⚠️  %s\n", warning)
+	}
+
+	if format == "json" {
+		err = inventory.WriteJSON(out, inv)
+	} else {
+		err = inventory.WriteCSV(out, inv)
+	}
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+}
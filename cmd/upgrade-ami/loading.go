@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-isatty"
+)
+
+// loadStep fetches one of the data sources the version picker needs
+type loadStep struct {
+	title    string // what is loaded, e.g. "EC2NodeClass objects"
+	after    int    // index of the step whose data this step needs, or -1
+	optional bool   // a failure only warns
+
+	// run fetches the data, returning a summary of it such as "12 found"
+	run func(ctx context.Context) (string, error)
+}
+
+// loadStatus is how far a step has got
+type loadStatus int
+
+const (
+	loadPending loadStatus = iota
+	loadRunning
+	loadDone
+	loadFailed
+	loadSkipped // the step it needs failed
+)
+
+// loadDoneMsg reports that a step finished
+type loadDoneMsg struct {
+	index   int
+	summary string
+	err     error
+}
+
+type loadModel struct {
+	ctx       context.Context
+	cancel    context.CancelFunc
+	steps     []loadStep
+	status    []loadStatus
+	summaries []string
+	errs      []error
+	spinner   spinner.Model
+	failed    error // the error of the required step that failed
+	finished  bool
+	quitting  bool
+}
+
+// start runs step i in a command, so the spinners keep turning while it waits on kubectl or AWS
+func (m loadModel) start(i int) tea.Cmd {
+	m.status[i] = loadRunning
+	step := m.steps[i]
+	return func() tea.Msg {
+		summary, err := step.run(m.ctx)
+		return loadDoneMsg{index: i, summary: summary, err: err}
+	}
+}
+
+func (m loadModel) Init() tea.Cmd {
+	cmds := []tea.Cmd{m.spinner.Tick}
+	for i, step := range m.steps {
+		if step.after < 0 {
+			cmds = append(cmds, m.start(i))
+		}
+	}
+	return tea.Batch(cmds...)
+}
+
+func (m loadModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			m.cancel()
+			m.quitting = true
+			return m, tea.Quit
+		}
+
+	case loadDoneMsg:
+		i := msg.index
+		m.summaries[i], m.errs[i] = msg.summary, msg.err
+		m.status[i] = loadDone
+		if msg.err != nil {
+			m.status[i] = loadFailed
+			if !m.steps[i].optional {
+				m.failed = msg.err
+				m.cancel()
+				m.finished = true
+				return m, tea.Quit
+			}
+		}
+
+		var cmds []tea.Cmd
+		for j, step := range m.steps {
+			if step.after != i {
+				continue
+			}
+			if msg.err != nil {
+				m.skip(j)
+				continue
+			}
+			cmds = append(cmds, m.start(j))
+		}
+		if len(cmds) == 0 && !m.loading() {
+			m.finished = true
+			return m, tea.Quit
+		}
+		return m, tea.Batch(cmds...)
+
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+	}
+	return m, nil
+}
+
+// skip marks step i and every step that needs it as skipped
+func (m loadModel) skip(i int) {
+	m.status[i] = loadSkipped
+	for j, step := range m.steps {
+		if step.after == i {
+			m.skip(j)
+		}
+	}
+}
+
+// loading reports whether any step is still waiting or running
+func (m loadModel) loading() bool {
+	for _, status := range m.status {
+		if status == loadPending || status == loadRunning {
+			return true
+		}
+	}
+	return false
+}
+
+// View shows a line per step while loading. The outcome is printed after the program exits, so it also
+// reaches the log and events files.
+func (m loadModel) View() string {
+	if m.finished || m.quitting {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n")
+	for i, step := range m.steps {
+		switch m.status[i] {
+		case loadRunning:
+			fmt.Fprintf(&b, "  %s Loading %s...\n", m.spinner.View(), step.title)
+		case loadPending:
+			fmt.Fprintf(&b, "  · %s\n", step.title)
+		default:
+			fmt.Fprintf(&b, "  %s\n", m.line(i))
+		}
+	}
+	if !term.unicode {
+		return asciiSymbols.Replace(b.String())
+	}
+	return b.String()
+}
+
+// line describes the outcome of a finished step
+func (m loadModel) line(i int) string {
+	step := m.steps[i]
+	switch m.status[i] {
+	case loadDone:
+		return fmt.Sprintf("✓ %s: %s", step.title, m.summaries[i])
+	case loadFailed:
+		return fmt.Sprintf("⚠️  %s: %v", step.title, m.errs[i])
+	case loadSkipped:
+		return fmt.Sprintf("⏭️  %s: skipped", step.title)
+	}
+	return ""
+}
+
+// loadSources runs the steps, each as soon as the step it needs has finished, showing a spinner per step
+// while the console is interactive. It exits when a required step fails or loading is cancelled; optional
+// failures are printed as warnings.
+func loadSources(ctx context.Context, steps []loadStep) {
+	m := loadModel{
+		steps:     steps,
+		status:    make([]loadStatus, len(steps)),
+		summaries: make([]string, len(steps)),
+		errs:      make([]error, len(steps)),
+	}
+	if !term.interactive || !isatty.IsTerminal(os.Stdin.Fd()) {
+		// Steps only need earlier steps, so running them in order honours every dependency
+		m.ctx = ctx
+		for i, step := range steps {
+			if step.after >= 0 && m.status[step.after] != loadDone {
+				m.status[i] = loadSkipped
+			} else {
+				m.summaries[i], m.errs[i] = step.run(ctx)
+				m.status[i] = loadDone
+				if m.errs[i] != nil {
+					if !step.optional {
+						exitOnError(ctx, m.errs[i])
+					}
+					m.status[i] = loadFailed
+				}
+			}
+			printLoadLine(m, i)
+		}
+		fmt.Fprintln(out)
+		return
+	}
+
+	m.ctx, m.cancel = context.WithCancel(ctx)
+	defer m.cancel()
+	m.spinner = spinner.New(spinner.WithSpinner(spinner.Dot))
+	if !term.unicode {
+		m.spinner = spinner.New(spinner.WithSpinner(spinner.Line))
+	}
+
+	finalModel, err := tea.NewProgram(m, tea.WithContext(ctx)).Run()
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	m = finalModel.(loadModel)
+	if m.quitting {
+		fmt.Fprintln(out, "Cancelled")
+		exit(0)
+	}
+	if m.failed != nil {
+		exitOnError(ctx, m.failed)
+	}
+	for i := range steps {
+		printLoadLine(m, i)
+	}
+	fmt.Fprintln(out)
+}
+
+// printLoadLine prints the outcome of step i, warnings to errOut
+func printLoadLine(m loadModel, i int) {
+	if m.status[i] == loadFailed {
+		fmt.Fprintln(errOut, m.line(i))
+		return
+	}
+	fmt.Fprintln(out, m.line(i))
+}
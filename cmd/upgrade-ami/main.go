@@ -0,0 +1,2017 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	_ "time/tzdata" // for the timeZone setting on systems without a time zone database
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/amis"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/approval"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/buildinfo"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/builds"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/cadence"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients/fixture"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients/offline"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/config"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/confirmation"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/cordon"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/freeze"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/history"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/inflight"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/naming"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/output"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/policy"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/prewarm"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/progress"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/provenance"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/release"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/report"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/requirements"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/rollout"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/runstate"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/selfupdate"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/share"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/surge"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/upgrade"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/validation"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/vulns"
+)
+
+var (
+	titleStyle        = lipgloss.NewStyle().MarginLeft(2)
+	itemStyle         = lipgloss.NewStyle().PaddingLeft(4)
+	selectedItemStyle = lipgloss.NewStyle().PaddingLeft(2).Foreground(lipgloss.Color("170"))
+	paginationStyle   = list.DefaultStyles().PaginationStyle.PaddingLeft(4)
+	helpStyle         = list.DefaultStyles().HelpStyle.PaddingLeft(4).PaddingBottom(1)
+	quitTextStyle     = lipgloss.NewStyle().Margin(1, 0, 2, 4)
+)
+
+type item struct {
+	version    string
+	k8sVersion string // Kubernetes version the AMI is built for
+	date       string
+	notes      []string // e.g. the provenance and vulnerability findings of the version
+	waitOnly   bool     // true for "just wait" option
+	header     bool     // true for the heading of a Kubernetes version group, which can't be selected
+}
+
+func (i item) FilterValue() string {
+	if i.waitOnly {
+		return "wait"
+	}
+	return i.version
+}
+
+func (i item) Title() string {
+	if i.waitOnly {
+		return "⏳ Just wait (monitor nodeclaims)"
+	}
+	if i.header {
+		return fmt.Sprintf("── Kubernetes %s ──", i.k8sVersion)
+	}
+	return i.version
+}
+
+func (i item) Description() string {
+	if i.waitOnly {
+		return "Monitor nodeclaim drift status without making changes"
+	}
+	return i.date
+}
+
+// key identifies the version among the versions of all Kubernetes versions
+func (i item) key() string {
+	return i.k8sVersion + "/" + i.version
+}
+
+var toggleAllKey = key.NewBinding(key.WithKeys("a"), key.WithHelp("a", "all k8s versions"))
+
+type model struct {
+	list     list.Model
+	items    []list.Item // versions for the detected Kubernetes version
+	allItems []list.Item // versions for all Kubernetes versions, grouped
+	showAll  bool
+	choice   *item
+	quitting bool
+}
+
+func (m model) Init() tea.Cmd {
+	return nil
+}
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.list.SetWidth(msg.Width)
+		return m, nil
+
+	case tea.KeyMsg:
+		switch keypress := msg.String(); keypress {
+		case "ctrl+c":
+			m.quitting = true
+			return m, tea.Quit
+
+		case "a":
+			m.showAll = !m.showAll
+			m.list.ResetSelected()
+			if m.showAll {
+				return m, m.list.SetItems(m.allItems)
+			}
+			return m, m.list.SetItems(m.items)
+
+		case "enter":
+			i, ok := m.list.SelectedItem().(item)
+			if ok && i.header {
+				return m, nil
+			}
+			if ok {
+				m.choice = &i
+			}
+			return m, tea.Quit
+		}
+	}
+
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+func (m model) View() string {
+	if m.quitting {
+		return ""
+	}
+	return "\n" + m.list.View()
+}
+
+func main() {
+	// Ctrl+C or SIGTERM cancels in-flight kubectl/aws calls so the run can wind down: history is recorded,
+	// a partial summary printed and exit hooks run. A second signal exits immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	cs := newClients()
+
+	// --timeout bounds the whole run, whichever subcommand it is
+	args, timeout, err := splitTimeout(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(errOut, "Error: %v\n", err)
+		exit(exitFailure)
+	}
+	ctx = withTimeout(ctx, timeout)
+
+	command := ""
+	if len(args) > 0 {
+		command = args[0]
+	}
+	switch command {
+	case "monitor":
+		runMonitor(ctx, cs, args[1:])
+	case "history":
+		runHistory(ctx, cs, args[1:])
+	case "version":
+		runVersion(args[1:])
+	case "self-update":
+		runSelfUpdate(ctx, args[1:])
+	case "preflight":
+		runPreflight(ctx, cs, args[1:])
+	case "report":
+		runReport(ctx, args[1:])
+	case "diff":
+		runDiff(ctx, cs, args[1:])
+	case "plan":
+		runPlan(ctx, cs, args[1:])
+	case "simulate":
+		runSimulate(ctx, cs, args[1:])
+	case "export-amis":
+		runExportAMIs(ctx, cs, args[1:])
+	case "inventory":
+		runInventory(ctx, cs, args[1:])
+	case "check":
+		runCheck(ctx, cs, args[1:])
+	case "status":
+		runStatus(ctx, cs, args[1:])
+	case "prune-amis":
+		runPruneAMIs(ctx, cs, args[1:])
+	default:
+		runUpgrade(ctx, cs, args)
+	}
+	if timedOut(runDeadline) {
+		// The run wound down after its --timeout elapsed, e.g. while waiting for nodeclaims
+		exit(exitTimedOut)
+	}
+	exit(0)
+}
+
+var (
+	exitHooksMu sync.Mutex
+	exitHooks   []func()
+)
+
+// onExit registers a hook that runs before the process exits, e.g. to flush a log or release a lock.
+// Hooks run most recent first, also when exiting after Ctrl+C or SIGTERM.
+func onExit(hook func()) {
+	exitHooksMu.Lock()
+	defer exitHooksMu.Unlock()
+	exitHooks = append(exitHooks, hook)
+}
+
+// exit runs the exit hooks and exits with code. Always exit through here instead of os.Exit.
+func exit(code int) {
+	exitHooksMu.Lock()
+	hooks := exitHooks
+	exitHooks = nil
+	exitHooksMu.Unlock()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
+	}
+	os.Exit(code)
+}
+
+// runVersion prints the build information of the binary
+func runVersion(args []string) {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the build information as JSON")
+	fs.Parse(args)
+
+	info := buildinfo.Get()
+	if *asJSON {
+		data, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			fmt.Fprintf(errOut, "Error: %v\n", err)
+			exit(exitFailure)
+		}
+		fmt.Fprintln(out, string(data))
+		return
+	}
+	fmt.Fprintf(out, "upgrade-ami %s\n", info)
+}
+
+// runSelfUpdate replaces the binary with the latest release
+func runSelfUpdate(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	check := fs.Bool("check", false, "only report whether a newer release is available")
+	force := fs.Bool("force", false, "install the latest release even if it is the running version")
+	fs.Parse(args)
+
+	cfg := loadConfig()
+	updater, err := selfupdate.New(cfg.Update.ReleasesURL, cfg.Update.PublicKey)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+
+	current := buildinfo.Get().Version
+	fmt.Fprintf(out, "🔍 Checking for updates (running %s)...\n", current)
+	release, err := updater.Latest(ctx)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+
+	if release.Tag == current && !*force {
+		fmt.Fprintf(out, "✅ Already up to date (%s)\n", current)
+		return
+	}
+	if *check {
+		fmt.Fprintf(out, "⬆️  %s is available; run upgrade-ami self-update to install it\n", release.Tag)
+		return
+	}
+
+	path, err := os.Executable()
+	if err == nil {
+		path, err = filepath.EvalSymlinks(path)
+	}
+	if err != nil {
+		exitOnError(ctx, fmt.Errorf("failed to locate the running binary: %w", err))
+	}
+
+	fmt.Fprintf(out, "⬇️  Installing %s to %s...\n", release.Tag, path)
+	if err := updater.Install(ctx, release, path); err != nil {
+		exitOnError(ctx, err)
+	}
+	fmt.Fprintf(out, "✅ Updated to %s\n", release.Tag)
+}
+
+// Environment variables that point the kubectl and aws clients at fixture directories
+const (
+	envRecordFixtures = "UPGRADE_AMI_RECORD_FIXTURES" // record every kubectl/aws invocation
+	envReplayFixtures = "UPGRADE_AMI_REPLAY_FIXTURES" // replay recorded invocations instead of running them
+)
+
+// envKubeClient chooses the Kubernetes client: client-go, the default, or kubectl to go through the kubectl
+// binary instead
+const envKubeClient = "UPGRADE_AMI_KUBE_CLIENT"
+
+// newClients returns the Kubernetes and AWS clients, or the kubectl and aws clients recording or replaying their
+// output when requested
+func newClients() clients.Set {
+	var exec clients.Executor
+	switch {
+	case os.Getenv(envReplayFixtures) != "":
+		exec = fixture.NewPlayer(os.Getenv(envReplayFixtures))
+	case os.Getenv(envRecordFixtures) != "":
+		exec = fixture.NewRecorder(os.Getenv(envRecordFixtures))
+	default:
+		cs := clients.Default()
+		switch kube := os.Getenv(envKubeClient); kube {
+		case "":
+		case "kubectl":
+			cs.Kube = clients.NewKubectl()
+		case "client-go":
+			cs.Kube = clients.NewKubernetes()
+		default:
+			fmt.Fprintf(errOut, "Error: %s must be kubectl or client-go, not %q\n", envKubeClient, kube)
+			exit(exitFailure)
+		}
+		return cs
+	}
+	return clients.Set{
+		Kube: &clients.Kubectl{Exec: exec},
+		EC2:  &clients.AWSCLI{Exec: exec},
+	}
+}
+
+// awsFlags choose the AWS region and profile instead of those of the AWS environment (AWS_REGION, AWS_PROFILE)
+type awsFlags struct {
+	region  *string
+	profile *string
+}
+
+// addAWSFlags registers the AWS region and profile flags on fs
+func addAWSFlags(fs *flag.FlagSet) awsFlags {
+	return awsFlags{
+		region:  fs.String("region", "", "AWS region to look up the AMIs in and call AWS in (default from AWS_REGION or the profile)"),
+		profile: fs.String("profile", "", "AWS shared config profile whose credentials and region to use (default from AWS_PROFILE)"),
+	}
+}
+
+// awsRegion is the --region of the run, also used for build manifests whose region isn't configured
+var awsRegion string
+
+// clients returns cs with its AWS client using the region and profile, or cs when neither flag is set
+func (f awsFlags) clients(cs clients.Set) clients.Set {
+	if *f.region == "" && *f.profile == "" {
+		return cs
+	}
+	selector, ok := cs.EC2.(clients.AWSSelector)
+	if !ok {
+		fmt.Fprintln(errOut, "Error: --region and --profile are not supported by the AWS client in use")
+		exit(exitFailure)
+	}
+	awsRegion = *f.region
+	cs.EC2 = selector.WithAWS(*f.region, *f.profile)
+	return cs
+}
+
+// envReadOnly turns on --read-only by default, e.g. in an auditor's shell profile
+const envReadOnly = "UPGRADE_AMI_READ_ONLY"
+
+// addReadOnlyFlag registers the flag that disables every mutating call
+func addReadOnlyFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("read-only", os.Getenv(envReadOnly) != "", "refuse every change to the cluster or AWS; plans and status only (default from "+envReadOnly+")")
+}
+
+// readOnlyClients wraps cs so that mutating calls fail when readOnly is set
+func readOnlyClients(cs clients.Set, readOnly bool) clients.Set {
+	if !readOnly {
+		return cs
+	}
+	fmt.Fprintln(out, "🔒 Read-only mode: no changes will be made")
+	fmt.Fprintln(out)
+	return clients.ReadOnly(cs)
+}
+
+// Exit codes let automation tell failure modes apart
+const (
+	exitFailure                = 1
+	exitOutdated               = 1 // check: a nodeclass is behind the newest eligible version
+	exitNoNodeClasses          = 3
+	exitAMIPatternUnrecognized = 4
+	exitVersionNotFound        = 5
+	exitPartialApply           = 6
+	exitToolNotFound           = 7
+	exitPlanStale              = 8
+	exitUnverifiedAMI          = 9
+	exitVulnerabilityPolicy    = 10
+	exitPlanMismatch           = 11
+	exitStaleNodes             = 12
+	exitUnapproved             = 13
+	exitPolicyDenied           = 14
+	exitChangeFreeze           = 15
+	exitNotApproved            = 16
+	exitNodePoolMismatch       = 17
+	exitOutsideWindow          = 18
+	exitValidationFailed       = 19
+	exitRolloutInFlight        = 20
+	exitTimedOut               = 21
+	exitCancelled              = 130
+)
+
+// exitCode derives the process exit code from an error
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return exitCancelled
+	case errors.Is(err, validation.ErrFailed):
+		// Checked first, as it wraps the error that failed the validation cluster
+		return exitValidationFailed
+	case errors.Is(err, nodeclasses.ErrNoNodeClasses):
+		return exitNoNodeClasses
+	case errors.Is(err, nodeclasses.ErrAMIPatternUnrecognized):
+		return exitAMIPatternUnrecognized
+	case errors.Is(err, amis.ErrVersionNotFound), errors.Is(err, release.ErrNotInManifest):
+		return exitVersionNotFound
+	case errors.Is(err, nodeclasses.ErrPartialApply):
+		return exitPartialApply
+	case errors.Is(err, clients.ErrToolNotFound):
+		return exitToolNotFound
+	case errors.Is(err, plan.ErrPreconditionFailed):
+		return exitPlanStale
+	case errors.Is(err, provenance.ErrUnverified):
+		return exitUnverifiedAMI
+	case errors.Is(err, vulns.ErrAboveThreshold), errors.Is(err, vulns.ErrNotScanned):
+		return exitVulnerabilityPolicy
+	case errors.Is(err, approval.ErrUnapproved):
+		return exitUnapproved
+	case errors.Is(err, policy.ErrDenied):
+		return exitPolicyDenied
+	case errors.Is(err, freeze.ErrFrozen):
+		return exitChangeFreeze
+	case errors.Is(err, confirmation.ErrNotApproved):
+		return exitNotApproved
+	case errors.Is(err, requirements.ErrMismatch):
+		return exitNodePoolMismatch
+	case errors.Is(err, rollout.ErrOutsideWindow):
+		return exitOutsideWindow
+	case errors.Is(err, inflight.ErrInFlight):
+		return exitRolloutInFlight
+	default:
+		return exitFailure
+	}
+}
+
+// loadConfig loads the config file, exiting on error
+func loadConfig() *config.Config {
+	path, err := config.DefaultPath()
+	if err != nil {
+		fmt.Fprintf(errOut, "Error: %v\n", err)
+		exit(exitFailure)
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		fmt.Fprintf(errOut, "Error: %v\n", err)
+		exit(exitFailure)
+	}
+	displayLocation, _ = cfg.Location() // validated by Load
+	registerSecrets(cfg)
+	return cfg
+}
+
+// newPlanner creates a planner with the naming scheme, AMI catalog or build manifests, provenance policy and findings source
+// from the config, exiting on error
+func newPlanner(cs clients.Set, cfg *config.Config) *upgrade.Planner {
+	scheme, err := cfg.NamingScheme()
+	if err != nil {
+		fmt.Fprintf(errOut, "Error: %v\n", err)
+		exit(exitFailure)
+	}
+
+	planner := upgrade.NewPlanner(cs, scheme)
+	planner.AMIFamilies, _ = cfg.VariantAMIFamilies() // validated by loadConfig
+	for _, ch := range cfg.Channels {
+		planner.Channels = append(planner.Channels, upgrade.Channel{Name: ch.Name, Owner: ch.Owner, NodeClasses: ch.NodeClasses})
+	}
+	if cfg.AMICatalog != "" {
+		catalog, err := offline.ReadImages(cfg.AMICatalog)
+		if err != nil {
+			fmt.Fprintf(errOut, "Error: %v\n", err)
+			exit(exitFailure)
+		}
+		planner.EC2 = catalog
+	}
+	if cfg.BuildManifests.Location != "" {
+		reader, _ := cs.EC2.(clients.ObjectReader)
+		lister, _ := cs.EC2.(clients.ObjectLister)
+		region := cfg.BuildManifests.ResolvedRegion(awsRegion)
+		if region == "" {
+			fmt.Fprintln(errOut, "Error: buildManifests.region is required in the config file unless --region or AWS_REGION is set")
+			exit(exitFailure)
+		}
+		planner.EC2 = &builds.Source{Location: cfg.BuildManifests.Location, Region: region, Reader: reader, Lister: lister}
+	}
+	if cfg.Provenance.Enabled() {
+		policy, err := provenance.New(cfg.Provenance.PipelineARNs, cfg.Provenance.PublicKey)
+		if err != nil {
+			fmt.Fprintf(errOut, "Error: %v\n", err)
+			exit(exitFailure)
+		}
+		policy.PipelineTag = cfg.Provenance.PipelineTag
+		policy.AttestationTag = cfg.Provenance.AttestationTag
+		planner.Provenance = policy
+	}
+
+	switch cfg.Vulnerabilities.Source {
+	case config.VulnSourceInspector:
+		scanner, ok := cs.EC2.(clients.FindingsScanner)
+		if !ok {
+			fmt.Fprintln(errOut, "Error: the EC2 client cannot read Inspector findings")
+			exit(exitFailure)
+		}
+		planner.Findings = vulns.Inspector{Scanner: scanner}
+	case config.VulnSourceFile:
+		planner.Findings = vulns.File{Path: cfg.Vulnerabilities.File}
+	}
+	return planner
+}
+
+// describeExport describes when an AMI catalog was exported, e.g. " (exported 2025-10-01 12:00 UTC, 3 days ago)"
+func describeExport(at time.Time) string {
+	if at.IsZero() {
+		return ""
+	}
+	days := int(clock.Real.Now().Sub(at).Hours() / 24)
+	return fmt.Sprintf(" (exported %s, %d days ago)", at.UTC().Format("2006-01-02 15:04 MST"), days)
+}
+
+// warnMixedOwners flags the nodeclasses whose selector terms name different AMI owners, since the version
+// chosen may not be published by all of them
+func warnMixedOwners(d *upgrade.Discovery) {
+	names := slices.Sorted(maps.Keys(d.MixedOwners))
+	for _, name := range names {
+		fmt.Fprintf(errOut, "⚠️  %s selects AMIs of several owners (%s); only the first term is upgraded, and the version may not be published by every owner\n",
+			name, strings.Join(d.MixedOwners[name], ", "))
+	}
+	if len(names) > 0 {
+		fmt.Fprintln(errOut)
+	}
+}
+
+// evaluatePolicies evaluates every plan against the Rego policies, printing their warnings and exiting when
+// a policy denies a plan
+func evaluatePolicies(ctx context.Context, cs clients.Set, paths []string, plans []*plan.Plan, created []time.Time) {
+	cluster, err := nodeclasses.CurrentContext(ctx, cs.Kube)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	evaluator := &policy.Evaluator{Exec: clients.OSExecutor{}, Paths: paths}
+	now := clock.Real.Now()
+
+	var denied []error
+	for i, p := range plans {
+		decision, err := evaluator.Evaluate(ctx, policy.NewInput(p, cluster, now, created[i]))
+		if err != nil {
+			exitOnError(ctx, err)
+		}
+		for _, msg := range decision.Warn {
+			fmt.Fprintf(errOut, "⚠️  Policy: %s\n", msg)
+		}
+		for _, msg := range decision.Deny {
+			fmt.Fprintf(errOut, "🛑 Policy: %s\n", msg)
+		}
+		if err := decision.Err(); err != nil {
+			denied = append(denied, fmt.Errorf("plan to v%s: %w", p.Version, err))
+		}
+	}
+	if len(denied) > 0 {
+		exitOnError(ctx, errors.Join(denied...))
+	}
+	fmt.Fprintln(out, "✅ Plans allowed by policy")
+	fmt.Fprintln(out)
+}
+
+// checkNodePools refuses to go on when a NodePool of a changed nodeclass allows no instances its new AMI
+// supports, unless allow is set. NodePools that can't be listed are not checked.
+func checkNodePools(ctx context.Context, cs clients.Set, scheme naming.Provider, plans []*plan.Plan, allow bool) {
+	pools, err := nodeclasses.GetNodePools(ctx, cs.Kube)
+	if err != nil {
+		if ctx.Err() != nil {
+			exitOnError(ctx, err)
+		}
+		fmt.Fprintf(errOut, "⚠️  Not checking NodePool requirements: %v\n\n", err)
+		return
+	}
+	var mismatches []requirements.Mismatch
+	for _, p := range plans {
+		mismatches = append(mismatches, requirements.Check(p, scheme, pools)...)
+	}
+	if len(mismatches) == 0 {
+		return
+	}
+
+	mark := "🛑"
+	if allow {
+		mark = "⚠️ "
+	}
+	for _, m := range mismatches {
+		fmt.Fprintf(errOut, "%s NodePool %s (nodeclass %s): %s\n", mark, m.NodePool, m.NodeClass, m.Reason)
+	}
+	err = requirements.Err(mismatches)
+	emit(output.Event{Type: "requirements", Level: output.LevelWarn, Message: err.Error(), Data: mismatches})
+	if !allow {
+		exitOnError(ctx, fmt.Errorf("%w (pass --allow-nodepool-mismatch to apply anyway)", err))
+	}
+	fmt.Fprintln(errOut)
+}
+
+// checkFreeze refuses to go on while a freeze window of the change calendar covers the cluster, unless an
+// exception ID is given. The decision is recorded as a freeze event.
+func checkFreeze(ctx context.Context, cs clients.Set, source, exception string) {
+	cluster, err := nodeclasses.CurrentContext(ctx, cs.Kube)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	reader, _ := cs.EC2.(clients.ObjectReader)
+	calendar, loadErr := freeze.Load(ctx, reader, source)
+	if loadErr != nil && ctx.Err() != nil {
+		exitOnError(ctx, loadErr)
+	}
+	decision := freeze.Decide(calendar, loadErr, cluster, clock.Real.Now(), exception)
+
+	e := output.Event{Type: "freeze", Message: "no change freeze in effect", Data: decision}
+	switch {
+	case !decision.Allowed:
+		e.Level, e.Message = output.LevelWarn, decision.Err().Error()
+	case loadErr != nil:
+		e.Level, e.Message = output.LevelWarn, fmt.Sprintf("change calendar unavailable; proceeding under exception %s", exception)
+		fmt.Fprintf(errOut, "⚠️  %v; proceeding under exception %s\n", loadErr, exception)
+	case len(decision.Windows) > 0:
+		e.Level, e.Message = output.LevelWarn, fmt.Sprintf("change freeze in effect; proceeding under exception %s", exception)
+		for _, w := range decision.Windows {
+			fmt.Fprintf(errOut, "⚠️  Change freeze %s until %s; proceeding under exception %s\n", w.Name, w.End.Local().Format("2006-01-02 15:04"), exception)
+		}
+	}
+	emit(e)
+	if err := decision.Err(); err != nil {
+		exitOnError(ctx, fmt.Errorf("%w (pass --freeze-exception with an approved exception ID to proceed)", err))
+	}
+}
+
+// loadApprovals fetches the approved versions list, exiting on error. It returns nil when none is configured.
+func loadApprovals(ctx context.Context, cs clients.Set, cfg *config.Config) *approval.List {
+	if cfg.Approvals == "" {
+		return nil
+	}
+	reader, _ := cs.EC2.(clients.ObjectReader)
+	approved, err := approval.Load(ctx, reader, cfg.Approvals)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	return approved
+}
+
+// checkApproval holds version to the approved versions list, if one is configured: an unapproved version stops
+// the run unless override (--override-approval) is set, which only warns. verb is what is refused, e.g. select.
+func checkApproval(ctx context.Context, approved *approval.List, version string, override bool, verb string) {
+	if approved == nil {
+		return
+	}
+	if err := approved.Check(version); err != nil {
+		if !override {
+			exitOnError(ctx, fmt.Errorf("cannot %s %s: %w (pass --override-approval to %s it anyway)", verb, version, err, verb))
+		}
+		fmt.Fprintf(errOut, "⚠️  %s: %v; approval overridden\n", version, err)
+	}
+}
+
+// checkPlanVersions holds the versions of plans read from a plan file to the checks a version picked in an
+// interactive run passes: the approved versions list, the provenance policy and the finding limits
+func checkPlanVersions(ctx context.Context, cs clients.Set, cfg *config.Config, planner *upgrade.Planner, plans []*plan.Plan, opts selectOptions) {
+	approved := loadApprovals(ctx, cs, cfg)
+	for _, p := range plans {
+		version := "v" + p.Version
+		checkApproval(ctx, approved, version, opts.overrideApproval, "apply")
+		if planner.Provenance == nil && planner.Findings == nil {
+			continue
+		}
+
+		vi, err := planner.PlanVersion(ctx, p)
+		if err != nil {
+			exitOnError(ctx, fmt.Errorf("failed to check %s: %w", version, err))
+		}
+		if result := planner.VerifyProvenance(vi); result != nil && !result.Verified {
+			if opts.requireProvenance {
+				exitOnError(ctx, fmt.Errorf("cannot apply %s: %w", version, result.Err()))
+			}
+			fmt.Fprintf(errOut, "⚠️  %s: %v\n", version, result.Err())
+		}
+		scans, err := planner.ScanVersions(ctx, []amis.VersionItem{vi})
+		if err != nil {
+			exitOnError(ctx, fmt.Errorf("failed to check %s: %w", version, err))
+		}
+		if summary, ok := scans[vi.Key()]; ok {
+			if err := opts.findingsPolicy.Check(summary); err != nil {
+				exitOnError(ctx, fmt.Errorf("cannot apply %s: %w", version, err))
+			}
+		}
+	}
+}
+
+// dateFlagLayout is the format of the --since and --until dates
+const dateFlagLayout = "2006-01-02"
+
+// versionDates builds the creation date range of the offered versions from the --since and --until dates
+// (whole UTC days) and the configured minimum age, whichever is stricter
+func versionDates(cfg config.Versions, since, until string, now time.Time) (amis.DateRange, error) {
+	var dates amis.DateRange
+	if since != "" {
+		t, err := time.Parse(dateFlagLayout, since)
+		if err != nil {
+			return dates, fmt.Errorf("invalid --since date %q (want YYYY-MM-DD)", since)
+		}
+		dates.Since = t
+	}
+	if until != "" {
+		t, err := time.Parse(dateFlagLayout, until)
+		if err != nil {
+			return dates, fmt.Errorf("invalid --until date %q (want YYYY-MM-DD)", until)
+		}
+		dates.Until = t.AddDate(0, 0, 1)
+	}
+	if cfg.MinAgeDays > 0 {
+		cutoff := now.AddDate(0, 0, -cfg.MinAgeDays)
+		if dates.Until.IsZero() || cutoff.Before(dates.Until) {
+			dates.Until = cutoff
+		}
+	}
+	if !dates.Since.IsZero() && !dates.Until.IsZero() && !dates.Since.Before(dates.Until) {
+		return dates, fmt.Errorf("no version can be created on or after %s and before %s",
+			displayTime(dates.Since), displayTime(dates.Until))
+	}
+	return dates, nil
+}
+
+// describeDates describes a creation date range, e.g. "on or after 2025-09-01 02:00 CEST and before
+// 2025-10-08 12:00 CEST"
+func describeDates(dates amis.DateRange) string {
+	var parts []string
+	if !dates.Since.IsZero() {
+		parts = append(parts, "on or after "+displayTime(dates.Since))
+	}
+	if !dates.Until.IsZero() {
+		parts = append(parts, "before "+displayTime(dates.Until))
+	}
+	return strings.Join(parts, " and ")
+}
+
+// displayLocation is the time zone AMI dates are shown in: the config's timeZone, or the local one
+var displayLocation = time.Local
+
+// displayTime formats t for display in the configured time zone
+func displayTime(t time.Time) string {
+	return t.In(displayLocation).Format(amis.DisplayLayout)
+}
+
+// versionDescription tells when a version was published: the date a date-based version names, and when its
+// newest AMI was created, e.g. "Version date: 2025-10-01 · Created: 2025-10-03 14:05 CEST"
+func versionDescription(vi amis.VersionItem) string {
+	created := "Created: " + amis.FormatTime(vi.CreationDate, displayLocation)
+	if date, ok := amis.VersionDate(vi.Version); ok {
+		return fmt.Sprintf("Version date: %s · %s", date.Format(dateFlagLayout), created)
+	}
+	return created
+}
+
+// vulnPolicy builds the findings policy from the config, overridden by non-negative flag values
+func vulnPolicy(cfg config.Vulnerabilities, maxCritical, maxHigh int) vulns.Policy {
+	policy := vulns.NoLimit
+	if cfg.MaxCritical != nil {
+		policy.MaxCritical = *cfg.MaxCritical
+	}
+	if cfg.MaxHigh != nil {
+		policy.MaxHigh = *cfg.MaxHigh
+	}
+	if maxCritical >= 0 {
+		policy.MaxCritical = maxCritical
+	}
+	if maxHigh >= 0 {
+		policy.MaxHigh = maxHigh
+	}
+	return policy
+}
+
+// exitOnError prints err and exits, reporting cancellation and timeouts distinctly from failures
+func exitOnError(ctx context.Context, err error) {
+	if ctx.Err() != nil {
+		fmt.Fprintln(out)
+		exitInterrupted(ctx)
+	}
+	fmt.Fprintf(errOut, "Error: %v\n", err)
+	exit(exitCode(err))
+}
+
+// writePlanFile writes the plan document to path, as YAML if the file name ends in .yaml or .yml
+// and as JSON otherwise
+func writePlanFile(path string, p *plan.Plan) error {
+	marshal := plan.Marshal
+	if isYAMLFile(path) {
+		marshal = plan.MarshalYAML
+	}
+	data, err := marshal(p)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	return nil
+}
+
+// groupPlanFile names the plan file of one Kubernetes version, and AMI channel if the plan has one, by
+// inserting them before the extension, e.g. plan-1.33.yaml or plan-beta-gpu-1.33.yaml for plan.yaml
+func groupPlanFile(path string, p *plan.Plan, k8sVersion string) string {
+	ext := filepath.Ext(path)
+	group := k8sVersion
+	if p.Channel != "" {
+		group = p.Channel + "-" + group
+	}
+	return strings.TrimSuffix(path, ext) + "-" + group + ext
+}
+
+// groupTitle heads the plan of one Kubernetes version, and AMI channel if the plan has one, among several
+func groupTitle(p *plan.Plan, k8sVersion string) string {
+	if p.Channel != "" {
+		return fmt.Sprintf("Kubernetes %s nodeclasses of channel %s:", k8sVersion, p.Channel)
+	}
+	return fmt.Sprintf("Kubernetes %s nodeclasses:", k8sVersion)
+}
+
+// readPlanFile reads a plan document written by writePlanFile
+func readPlanFile(path string) (*plan.Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+	if isYAMLFile(path) {
+		return plan.UnmarshalYAML(data)
+	}
+	return plan.Unmarshal(data)
+}
+
+// isYAMLFile reports whether path names a YAML file
+func isYAMLFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// confirm asks a yes/no question on stdin, returning false if the answer is not yes or ctx is cancelled
+func confirm(ctx context.Context, question string) bool {
+	d, err := confirmation.TTY{In: os.Stdin, Out: out}.Confirm(ctx, confirmation.Request{Question: question})
+	return err == nil && d.Approved
+}
+
+// runUpgrade runs the interactive upgrade flow
+func runUpgrade(ctx context.Context, cs clients.Set, args []string) {
+	fs := flag.NewFlagSet("upgrade-ami", flag.ExitOnError)
+	verify := fs.Bool("verify-termination", false, "verify via EC2 that instances of replaced nodeclaims reach terminated state")
+	showPods := fs.Bool("show-pods", false, "list the pods (with owners and evictability) still running on drifted nodes while waiting")
+	outputFormat := fs.String("output", string(report.FormatText), "rendering of the dry-run summary and final report: text or json")
+	reportFile := fs.String("report-file", "", "also write the final report as JSON to this file, e.g. to compare runs with upgrade-ami report diff")
+	concurrency := fs.Int("concurrency", upgrade.DefaultConcurrency, "number of nodeclasses to update at once")
+	planFile := fs.String("plan", "", "apply this plan document written by --save-plan instead of picking a version; resumes an interrupted run of the same plan")
+	savePlan := fs.String("save-plan", "", "write the plan document to this file (YAML for .yaml/.yml, JSON otherwise) before asking for confirmation")
+	continueOnError := fs.Bool("continue-on-error", false, "keep updating the remaining nodeclasses after one fails")
+	atomic := fs.Bool("atomic", false, "if any nodeclass update fails, revert the nodeclasses this run updated so no mix of old and new AMIs is left behind")
+	requireProvenance := fs.Bool("require-provenance", false, "refuse to select AMI versions whose provenance cannot be verified")
+	since := fs.String("since", "", "only offer AMI versions created on or after this date (YYYY-MM-DD)")
+	until := fs.String("until", "", "only offer AMI versions created on or before this date (YYYY-MM-DD)")
+	allK8sVersions := fs.Bool("all-k8s-versions", false, "list AMI versions of every Kubernetes version in the picker (toggle with 'a'), e.g. to plan a minor version upgrade")
+	variant := fs.String("variant", "", "image variant to upgrade to: standard or fips (defaults to the variant the nodeclasses use)")
+	maxCritical := fs.Int("max-critical", -1, "refuse AMI versions with more critical vulnerability findings (overrides the config file)")
+	maxHigh := fs.Int("max-high", -1, "refuse AMI versions with more high vulnerability findings (overrides the config file)")
+	prewarmNodes := fs.Int("prewarm", 0, "launch this many nodes per nodeclass on the new AMI and pull the configured images onto them before applying")
+	surgeFlag := fs.String("surge", "", "temporarily raise the limits of the affected nodepools by this percentage (e.g. 20%) until the run ends")
+	cordonNodes := fs.Bool("cordon", false, "after applying, cordon each node of the changed nodeclasses as soon as Karpenter marks its nodeclaim drifted, so no new pods land on nodes about to be replaced")
+	skipWait := fs.Bool("skip-wait", false, "exit after applying the changes instead of monitoring the nodeclaims, e.g. when another system watches the rollout")
+	noShare := fs.Bool("no-share", false, "don't share the selected AMIs with the accounts configured under sharing")
+	waitOnly := fs.Bool("wait-only", false, "skip version selection and only monitor nodeclaim drift, like the picker's \"Just wait\" item")
+	allowMismatch := fs.Bool("allow-nodepool-mismatch", false, "apply even when a NodePool of a changed nodeclass allows no instances the new AMI supports (e.g. a GPU AMI without GPU instance families)")
+	confirmWith := fs.String("confirm", "", "how the go-ahead to apply is given: "+strings.Join(confirmation.Providers, ", ")+" (overrides the config file; tty by default)")
+	approvalToken := fs.String("approval-token", "", "approve with this approval token file naming the plan IDs (implies --confirm token-file)")
+	freezeException := fs.String("freeze-exception", "", "ID of the approved change exception to apply under during a change freeze window")
+	overrideApproval := fs.Bool("override-approval", false, "allow selecting, or applying with --plan, AMI versions that are not on the approved versions list")
+	releaseFlag := fs.String("release", "", "upgrade to the AMI version the release manifest lists for this platform release (e.g. 6.2.1) instead of picking one")
+	includeSkipped := fs.Bool("include-skipped", false, "plan nodeclasses annotated with upgrade-ami/skip: \"true\" like any other")
+	kubeContext := fs.String("context", "", "kubeconfig context of the cluster to upgrade (when the kubeconfig has several contexts, a picker asks otherwise)")
+	readOnly := addReadOnlyFlag(fs)
+	awsOpts := addAWSFlags(fs)
+	poll := addPollFlag(fs)
+	outputs := addOutputFlags(fs)
+	session := addSessionFlags(fs)
+	statusAddr := addStatusFlag(fs)
+	statusConfigMap := addConfigMapFlag(fs)
+	pin := addPinFlag(fs)
+	monitorScope := addMonitorScopeFlag(fs)
+	rolloutOpts := addRolloutFlags(fs)
+	inFlight := addInFlightFlag(fs)
+	skipValidation := fs.Bool("skip-validation", false, "apply without trying the version on the validation cluster of the config first")
+	maxUnavailable := fs.Int("max-unavailable", 0, "delete the drifted nodeclaims of the changed nodeclasses while monitoring, keeping at most this many per nodeclass unavailable at once, instead of leaving the pace to Karpenter's disruption budgets alone")
+	onConflict := fs.String("on-conflict", conflictAsk, "what to do with planned nodeclasses changed another way before they are updated: "+strings.Join(conflictResolutions, ", ")+" (ask prompts when the go-ahead is given at the terminal and aborts otherwise)")
+	simulateDrain := fs.Bool("simulate-drain", false, "before asking for confirmation, simulate draining the nodes to replace and report those that would fail to drain now (PDBs, do-not-disrupt and unmanaged pods)")
+	fs.Parse(args)
+	window := rolloutOpts.check(*planFile)
+	if *rolloutOpts.daemon {
+		// Each slice is a run of its own, which attaches the outputs and sessions itself
+		runDaemon(ctx, cs, *planFile, *kubeContext, rolloutOpts, *window, args)
+		return
+	}
+	outputs.attach()
+	cs = session.clients(cs)
+	cs = awsOpts.clients(cs)
+	cs = readOnlyClients(cs, *readOnly)
+	strategy := parsePollStrategy(*poll)
+	display := displayOptions{showPods: *showPods}
+
+	format, err := report.ParseFormat(*outputFormat)
+	if err != nil {
+		fmt.Fprintf(errOut, "Error: %v\n", err)
+		exit(exitFailure)
+	}
+	checkMonitorScope(*monitorScope)
+	checkConflictMode(*onConflict)
+	if *skipWait && *waitOnly {
+		fmt.Fprintln(errOut, "Error: --skip-wait and --wait-only cannot be combined")
+		exit(exitFailure)
+	}
+	if *atomic && *continueOnError {
+		fmt.Fprintln(errOut, "Error: --atomic and --continue-on-error cannot be combined")
+		exit(exitFailure)
+	}
+	if *cordonNodes && *waitOnly {
+		fmt.Fprintln(errOut, "Error: --cordon and --wait-only cannot be combined")
+		exit(exitFailure)
+	}
+	if *maxUnavailable < 0 {
+		fmt.Fprintln(errOut, "Error: --max-unavailable must not be negative")
+		exit(exitFailure)
+	}
+	if *maxUnavailable > 0 && (*waitOnly || *skipWait) {
+		fmt.Fprintln(errOut, "Error: --max-unavailable cannot be combined with --wait-only or --skip-wait")
+		exit(exitFailure)
+	}
+	if *releaseFlag != "" && *waitOnly {
+		fmt.Fprintln(errOut, "Error: --release and --wait-only cannot be combined")
+		exit(exitFailure)
+	}
+	if *planFile != "" && (*waitOnly || *releaseFlag != "") {
+		fmt.Fprintln(errOut, "Error: --plan cannot be combined with --wait-only or --release")
+		exit(exitFailure)
+	}
+	var surgePercent float64
+	if *surgeFlag != "" {
+		if surgePercent, err = surge.ParsePercent(*surgeFlag); err != nil {
+			fmt.Fprintf(errOut, "Error: %v\n", err)
+			exit(exitFailure)
+		}
+	}
+
+	checkWindow(ctx, window)
+	cs = selectContext(ctx, cs, *kubeContext)
+	checkPreflight(ctx, cs)
+	op := resolveOperator(ctx, cs)
+	serveStatus(ctx, cs, *statusAddr)
+	if *waitOnly {
+		monitorDrift(ctx, cs, strategy, *verify, display)
+		return
+	}
+	cfg := loadConfig()
+	confirmer := confirmationProvider(cfg.Confirmation, *confirmWith, *approvalToken)
+	planner := newPlanner(cs, cfg)
+	if *requireProvenance && planner.Provenance == nil {
+		fmt.Fprintln(errOut, "Error: --require-provenance needs a provenance section in the config file")
+		exit(exitFailure)
+	}
+	if *variant != "" {
+		v, err := naming.ParseVariant(*variant)
+		if err != nil {
+			fmt.Fprintf(errOut, "Error: %v\n", err)
+			exit(exitFailure)
+		}
+		planner.Variant = &v
+	}
+	planner.IncludeSkipped = *includeSkipped
+	planner.Dates, err = versionDates(cfg.Versions, *since, *until, clock.Real.Now())
+	if err != nil {
+		fmt.Fprintf(errOut, "Error: %v\n", err)
+		exit(exitFailure)
+	}
+	findingsPolicy := vulnPolicy(cfg.Vulnerabilities, *maxCritical, *maxHigh)
+	if findingsPolicy.Enforced() && planner.Findings == nil {
+		fmt.Fprintln(errOut, "Error: finding limits need a vulnerabilities source in the config file")
+		exit(exitFailure)
+	}
+	runs := runStore()
+	opts := selectOptions{
+		findingsPolicy:    findingsPolicy,
+		requireProvenance: *requireProvenance,
+		allK8sVersions:    *allK8sVersions,
+		overrideApproval:  *overrideApproval,
+		release:           *releaseFlag,
+		pin:               *pin,
+		strategy:          strategy,
+		verify:            *verify,
+		display:           display,
+	}
+	var sel *selection
+	var later int // changes left for later slices
+	if *planFile != "" {
+		sel = loadPlan(ctx, cs, *planFile, runs)
+		checkPlanVersions(ctx, cs, cfg, planner, sel.plans, opts)
+		inFlight.check(ctx, cs, runs, sel.resumed, *readOnly)
+		if *rolloutOpts.slices > 0 {
+			later = sliceRollout(ctx, sel, runs, *rolloutOpts.slices)
+		}
+	} else {
+		inFlight.check(ctx, cs, runs, nil, *readOnly)
+		sel = selectVersions(ctx, cs, cfg, planner, opts)
+	}
+	plans, k8sVersions, shared, created := sel.plans, sel.k8sVersions, sel.shared, sel.created
+
+	// Dry run: collect all changes first
+	var changes int
+	for i, plan := range plans {
+		if len(plans) > 1 {
+			fmt.Fprintln(out, groupTitle(plan, k8sVersions[i]))
+		}
+		for _, skipped := range plan.Skipped {
+			fmt.Fprintf(out, "⚠️  Skipping %s (%s)\n", skipped.NodeClass, skipped.Reason)
+		}
+		// A plan built elsewhere with the plan subcommand keeps its author
+		if plan.CreatedBy == "" {
+			plan.CreatedBy = op.String()
+		}
+
+		emit(output.Event{Type: "plan", Message: fmt.Sprintf("%d changes to v%s", len(plan.Changes), plan.Version), Data: plan})
+
+		// Display dry run summary
+		if err := report.WritePlan(out, format, plan); err != nil {
+			exitOnError(ctx, err)
+		}
+		fmt.Fprintln(out)
+		if *savePlan != "" {
+			path := *savePlan
+			if len(plans) > 1 {
+				path = groupPlanFile(path, plan, k8sVersions[i])
+			}
+			if err := writePlanFile(path, plan); err != nil {
+				exitOnError(ctx, err)
+			}
+			fmt.Fprintf(out, "📄 Plan written to %s\n\n", path)
+		}
+		changes += len(plan.Changes)
+	}
+
+	runProgress.Planned(plans)
+	showPreviousRun(ctx, cs, plans)
+
+	shareAccounts := cfg.Sharing.Accounts
+	if *noShare || len(shared) == 0 {
+		shareAccounts = nil
+	}
+	if len(shareAccounts) > 0 {
+		fmt.Fprintf(out, "🤝 %d AMIs will be shared with accounts %s\n\n", len(shared), strings.Join(shareAccounts, ", "))
+	}
+
+	if len(cfg.Policy.Paths) > 0 {
+		evaluatePolicies(ctx, cs, cfg.Policy.Paths, plans, created)
+	}
+	checkNodePools(ctx, cs, planner.Naming, plans, *allowMismatch)
+	if *simulateDrain {
+		checkDrains(ctx, cs, plans)
+	}
+
+	if *readOnly {
+		fmt.Fprintln(out, "🔒 Read-only mode: not applying the plan")
+		return
+	}
+
+	if cfg.FreezeCalendar != "" {
+		checkFreeze(ctx, cs, cfg.FreezeCalendar, *freezeException)
+	}
+
+	if *statusConfigMap == "" {
+		*statusConfigMap = cfg.StatusConfigMap
+	}
+	publishStatus(ctx, cs, *statusConfigMap)
+
+	// Ask for confirmation
+	runProgress.SetPhase(progress.PhaseConfirming)
+	approve(ctx, confirmer, confirmRequest(ctx, cs, "Apply changes?", plans))
+
+	if cfg.Validation.Enabled() && *skipValidation {
+		fmt.Fprintf(errOut, "⚠️  Not validating on %s first (--skip-validation)\n\n", cfg.Validation.Context)
+	} else if cfg.Validation.Enabled() {
+		runProgress.SetPhase(progress.PhaseValidating)
+		validateFirst(ctx, cs, planner, cfg.Validation, plans, op, strategy)
+	}
+
+	// The nodeclasses may have changed while the plans were waiting for confirmation
+	_, interactive := confirmer.(confirmation.TTY)
+	changes = checkConflicts(ctx, cs, planner, plans, *onConflict, interactive)
+
+	if len(shareAccounts) > 0 {
+		shareImages(ctx, cs, shared, shareAccounts)
+	}
+	if *prewarmNodes > 0 {
+		startPrewarm(ctx, cs, cfg.Prewarm, *prewarmNodes, plans)
+	}
+	if surgePercent > 0 {
+		raiseLimits(ctx, cs, surgePercent, plans)
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "🚀 Applying %d changes (%d at a time)...\n", changes, max(*concurrency, 1))
+	runProgress.SetPhase(progress.PhaseApplying)
+	run := history.Run{Command: "upgrade", StartedAt: clock.Real.Now()}
+	run.ID = history.NewRunID(run.StartedAt)
+	fmt.Fprintf(out, "🏷️  Run %s\n", run.ID)
+	fmt.Fprintln(out)
+
+	// Apply the changes, recording each one so an interrupted run can be resumed with --plan
+	applier := upgrade.NewApplier(cs.Kube)
+	applier.Concurrency = *concurrency
+	applier.ContinueOnError = *continueOnError
+	applier.Annotations = operatorAnnotations(op, run.ID)
+	tracker := trackRun(ctx, cs, runs, sel)
+	var warnOnce sync.Once
+	applier.OnApplied = func(ch plan.Change) {
+		runProgress.Updated(ch.NodeClass)
+		if tracker == nil {
+			return
+		}
+		if err := tracker.Completed(ch.NodeClass); err != nil {
+			warnOnce.Do(func() { fmt.Fprintf(errOut, "⚠️  %v; this run cannot be resumed\n", err) })
+		}
+	}
+	results, applyErr := applier.ApplyAll(ctx, plans)
+	if applyErr != nil && !interrupted(applyErr) {
+		results, applyErr = resolveApplyConflicts(ctx, cs, planner, applier, plans, results, applyErr, *onConflict, interactive)
+	}
+	if tracker != nil && !interrupted(applyErr) {
+		// Reverted changes leave nothing to resume
+		if err := tracker.Finish(applyErr != nil && *atomic); err != nil {
+			fmt.Fprintf(errOut, "⚠️  %v\n", err)
+		}
+	}
+	printApplyResults(results)
+	emitApplyResults(plans, results, applyErr)
+	run.Changes = runChanges(plans, results)
+	if interrupted(applyErr) {
+		recordRun(context.WithoutCancel(ctx), upgrade.NewMonitor(cs), run, nil)
+		fmt.Fprintf(out, "\n%s; remaining nodeclasses were not updated\n", interruption(ctx))
+		cancelled := report.NewForPlans(plans, results, nil)
+		cancelled.Operator = op.String()
+		cancelled.RunID = run.ID
+		cancelled.StartedAt, cancelled.FinishedAt = run.StartedAt, clock.Real.Now()
+		if err := report.WriteReport(out, format, cancelled); err != nil {
+			fmt.Fprintf(errOut, "⚠️  Failed to write report: %v\n", err)
+		}
+		writeReportFile(*reportFile, cancelled)
+		if timedOut(ctx) {
+			exit(exitTimedOut)
+		}
+		exit(exitCancelled)
+	}
+
+	if applyErr != nil && *atomic {
+		printFailureSummary(applyErr)
+		run.Reverted = revertApply(ctx, applier, plans, results)
+		recordRun(ctx, upgrade.NewMonitor(cs), run, nil)
+		exit(exitCode(applyErr))
+	}
+	if applyErr != nil {
+		// Still wait for the nodeclasses that were updated, but report the failure through the exit code
+		printFailureSummary(applyErr)
+	} else {
+		fmt.Fprintln(out, "✅ All nodeclasses updated successfully!")
+	}
+	fmt.Fprintln(out)
+	tagRun(ctx, cs, run.ID, results, false)
+	if *cordonNodes {
+		cordonDrifted(ctx, cs, results)
+	}
+
+	// Wait for nodeclaims to become undrifted, unless something else watches the rollout
+	var monitored *upgrade.Result
+	if *skipWait {
+		fmt.Fprintln(out, "⏭️  Not waiting for nodeclaims to become undrifted (--skip-wait)")
+		recordRun(ctx, upgrade.NewMonitor(cs), run, nil)
+	} else {
+		fmt.Fprintln(out, "⏳ Waiting for nodeclaims to become undrifted...")
+		fmt.Fprintln(out, "Press Ctrl+C to skip waiting")
+		opts := nodeclasses.MonitorOptions{Cadence: strategy}
+		scopeMonitor(&opts, *monitorScope, plans, run.StartedAt)
+		fmt.Fprintln(out)
+		monitored = waitForNodeClaims(ctx, cs, run, opts, *verify, display, newThrottle(cs, *maxUnavailable, results, run.StartedAt))
+		tagRun(ctx, cs, run.ID, results, true)
+		checkNodeLabels(ctx, cs, results, run.StartedAt)
+	}
+
+	fmt.Fprintln(out)
+	runProgress.SetPhase(progress.PhaseDone)
+	final := report.NewForPlans(plans, results, monitored)
+	final.Operator = op.String()
+	final.RunID = run.ID
+	final.StartedAt = run.StartedAt
+	finishReport(ctx, cs, final)
+	emit(output.Event{Type: "report", Data: final})
+	if err := report.WriteReport(out, format, final); err != nil {
+		fmt.Fprintf(errOut, "⚠️  Failed to write report: %v\n", err)
+	}
+	writeReportFile(*reportFile, final)
+	if later > 0 && applyErr == nil {
+		fmt.Fprintf(out, "\n📅 %d changes are left for the next slices, which the next runs with --plan %s apply\n", later, *planFile)
+	}
+
+	if applyErr != nil {
+		exit(exitCode(applyErr))
+	}
+}
+
+// selection is the outcome of version selection: a plan per Kubernetes version of the cluster
+type selection struct {
+	plans       []*plan.Plan
+	k8sVersions []string       // Kubernetes version of each plan
+	shared      []amis.AMIInfo // AMIs to share with the configured accounts
+	created     []time.Time    // creation date of each plan's version; zero if unknown
+
+	// resumed is the state of the interrupted run of a plan file being resumed, and planID the ID of the
+	// plan file, which the remaining changes are recorded under
+	resumed *runstate.State
+	planID  string
+
+	// total is the number of changes of the plan file, and tracked the plans whose run state is recorded
+	// when only a slice of them is applied
+	total   int
+	tracked []*plan.Plan
+}
+
+// runStore returns the store of run states, or nil if there is no home directory to keep it in or the
+// run is replayed
+func runStore() *runstate.Store {
+	if replaying() {
+		return nil
+	}
+	dir, err := runstate.DefaultDir()
+	if err != nil {
+		fmt.Fprintf(errOut, "⚠️  %v; runs cannot be resumed\n", err)
+		return nil
+	}
+	return &runstate.Store{Dir: dir}
+}
+
+// loadPlan reads the plan document to apply. When a run of the same plan on this cluster was interrupted,
+// the nodeclasses that already carry their planned AMI are skipped and the rest of the plan is resumed;
+// otherwise the cluster must still match the plan's precondition.
+func loadPlan(ctx context.Context, cs clients.Set, path string, runs *runstate.Store) *selection {
+	p, err := readPlanFile(path)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	fmt.Fprintf(out, "📄 Plan %s: v%s, %d changes\n", path, p.Version, len(p.Changes))
+	fmt.Fprintln(out)
+	list, err := nodeclasses.GetEC2NodeClasses(ctx, cs.Kube)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	sel := &selection{plans: []*plan.Plan{p}, k8sVersions: []string{p.K8sVersion}, created: []time.Time{{}}, total: len(p.Changes)}
+
+	var st *runstate.State
+	if runs != nil {
+		cluster, err := nodeclasses.CurrentContext(ctx, cs.Kube)
+		if err != nil {
+			exitOnError(ctx, err)
+		}
+		if sel.planID, err = runstate.PlanID(p); err != nil {
+			exitOnError(ctx, err)
+		}
+		if st, err = runs.Load(sel.planID, cluster); err != nil {
+			exitOnError(ctx, err)
+		}
+	}
+	if st == nil {
+		if err := p.CheckPrecondition(list); err != nil {
+			exitOnError(ctx, err)
+		}
+		return sel
+	}
+
+	rest, done, err := runstate.Resume(p, st, list)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	fmt.Fprintf(out, "↪️  Resuming the run started %s: %d of %d changes already applied\n",
+		st.StartedAt.Local().Format("2006-01-02 15:04"), len(done), len(p.Changes))
+	for _, name := range done {
+		fmt.Fprintf(out, "⏭️  Skipping %s (already on the planned AMI)\n", name)
+	}
+	fmt.Fprintln(out)
+	if len(rest.Changes) == 0 {
+		fmt.Fprintln(out, "✅ Every change of the plan is applied")
+		if err := runs.Remove(st.PlanID, st.Cluster); err != nil {
+			fmt.Fprintf(errOut, "⚠️  %v\n", err)
+		}
+		exit(0)
+	}
+	sel.plans[0], sel.resumed = rest, st
+	return sel
+}
+
+// trackRun starts recording the changes the run applies. It returns nil when runs can't be recorded.
+func trackRun(ctx context.Context, cs clients.Set, runs *runstate.Store, sel *selection) *runstate.Tracker {
+	if runs == nil {
+		return nil
+	}
+	cluster, err := nodeclasses.CurrentContext(ctx, cs.Kube)
+	if err != nil {
+		fmt.Fprintf(errOut, "⚠️  %v; this run cannot be resumed\n", err)
+		return nil
+	}
+	tracked := sel.plans
+	if sel.tracked != nil {
+		tracked = sel.tracked
+	}
+	plans := make(map[string]*plan.Plan, len(tracked))
+	states := make(map[string]*runstate.State)
+	for _, p := range tracked {
+		id := sel.planID
+		if id == "" {
+			if id, err = runstate.PlanID(p); err != nil {
+				fmt.Fprintf(errOut, "⚠️  %v; this run cannot be resumed\n", err)
+				return nil
+			}
+		}
+		plans[id] = p
+	}
+	if sel.resumed != nil {
+		states[sel.planID] = sel.resumed
+	}
+	return runstate.NewTracker(*runs, clock.Real.Now, cluster, plans, states)
+}
+
+// selectOptions are the flags that shape version selection
+type selectOptions struct {
+	findingsPolicy    vulns.Policy
+	requireProvenance bool
+	allK8sVersions    bool
+	overrideApproval  bool
+	release           string // platform release whose AMI version is used instead of the picker
+	pin               string // --pin-duplicates
+
+	// monitoring for the picker's "Just wait" item
+	strategy cadence.Strategy
+	verify   bool
+	display  displayOptions
+}
+
+// selectVersions discovers the nodeclasses and the AMI versions available to them, and plans the version
+// picked, or listed by the release manifest, for each Kubernetes version
+func selectVersions(ctx context.Context, cs clients.Set, cfg *config.Config, planner *upgrade.Planner, opts selectOptions) *selection {
+	if opts.release != "" && cfg.Releases.Manifest == "" {
+		fmt.Fprintln(errOut, "Error: --release needs a releases.manifest in the config file")
+		exit(exitFailure)
+	}
+	if catalog, ok := planner.EC2.(*offline.EC2Client); ok {
+		fmt.Fprintf(out, "📚 Listing AMIs from the catalog %s%s\n", cfg.AMICatalog, describeExport(catalog.ExportedAt))
+	}
+	if manifests, ok := planner.EC2.(*builds.Source); ok {
+		fmt.Fprintf(out, "📚 Listing AMIs from the build manifests at %s (%s)\n", manifests.Location, manifests.Region)
+	}
+	if !planner.Dates.Since.IsZero() || !planner.Dates.Until.IsZero() {
+		fmt.Fprintf(out, "🕒 Only offering versions created %s\n", describeDates(planner.Dates))
+	}
+
+	// Load everything the picker needs at once, rather than one source after the other
+	src := selectSources{versions: make(map[string][]amis.VersionItem), scans: make(map[string]map[string]vulns.Summary)}
+	reader, _ := cs.EC2.(clients.ObjectReader)
+	var steps []loadStep
+	if opts.release != "" {
+		steps = append(steps, loadStep{title: "release manifest", after: -1, run: func(ctx context.Context) (string, error) {
+			var err error
+			if src.manifest, err = release.Load(ctx, reader, cfg.Releases.Manifest); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d releases in %s", len(src.manifest.Releases), cfg.Releases.Manifest), nil
+		}})
+	}
+	if cfg.Approvals != "" {
+		steps = append(steps, loadStep{title: "approved versions", after: -1, run: func(ctx context.Context) (string, error) {
+			var err error
+			if src.approved, err = approval.Load(ctx, reader, cfg.Approvals); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d approved", len(src.approved.Versions)), nil
+		}})
+	}
+	discover := len(steps)
+	steps = append(steps, loadStep{title: "EC2NodeClass objects", after: -1, run: func(ctx context.Context) (string, error) {
+		var err error
+		if src.discovery, err = planner.Discover(ctx); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d found", len(src.discovery.NodeClasses.Items)), nil
+	}})
+	query := len(steps)
+	steps = append(steps, loadStep{title: "AMI versions", after: discover, run: func(ctx context.Context) (string, error) {
+		// Each AMI channel is planned against the versions its owner publishes
+		channels := src.discovery.ChannelNames()
+		var total int
+		for _, channel := range channels {
+			versions, err := planner.AllVersions(ctx, src.discovery.ForChannel(channel))
+			if err != nil {
+				if channel != "" {
+					err = fmt.Errorf("channel %s: %w", channel, err)
+				}
+				return "", err
+			}
+			src.versions[channel] = versions
+			total += len(versions)
+		}
+		if len(channels) > 1 {
+			return fmt.Sprintf("%d available in %d channels", total, len(channels)), nil
+		}
+		return fmt.Sprintf("%d available", total), nil
+	}})
+	if planner.Findings != nil {
+		steps = append(steps, loadStep{title: "vulnerability findings", after: query, optional: !opts.findingsPolicy.Enforced(), run: func(ctx context.Context) (string, error) {
+			var total int
+			for channel, versions := range src.versions {
+				scans, err := planner.ScanVersions(ctx, versions)
+				if err != nil {
+					return "", err
+				}
+				src.scans[channel] = scans
+				total += len(scans)
+			}
+			return fmt.Sprintf("%d versions scanned", total), nil
+		}})
+	}
+	loadSources(ctx, steps)
+
+	// Display found nodeclasses
+	discovery := src.discovery
+	fmt.Fprintln(out, "Found EC2NodeClass objects:")
+	for _, nc := range discovery.NodeClasses.Items {
+		if len(nc.Spec.AMISelectorTerms) == 0 {
+			continue
+		}
+		if channel, ok := discovery.Channels[nc.Metadata.Name]; ok {
+			fmt.Fprintf(out, "  - %s (AMI: %s, channel: %s)\n", nc.Metadata.Name, nc.AMIName(), channel)
+		} else {
+			fmt.Fprintf(out, "  - %s (AMI: %s)\n", nc.Metadata.Name, nc.AMIName())
+		}
+	}
+	fmt.Fprintln(out)
+
+	// Plan each AMI channel separately, against the versions its owner publishes
+	sel := &selection{}
+	var pinned []string
+	for _, channel := range discovery.ChannelNames() {
+		pinned = append(pinned, planChannel(ctx, cs, planner, opts, src, channel, sel)...)
+	}
+	checkPinned(ctx, opts.pin, pinned)
+	return sel
+}
+
+// selectSources is what version selection loads before the picker: the nodeclasses, the AMI versions and
+// vulnerability findings of each AMI channel, and the release manifest and approved versions when used
+type selectSources struct {
+	discovery *upgrade.Discovery
+	versions  map[string][]amis.VersionItem       // channel -> versions
+	scans     map[string]map[string]vulns.Summary // channel -> VersionItem.Key -> findings
+	manifest  *release.Manifest
+	approved  *approval.List
+}
+
+// planChannel plans the version picked, or listed by the release manifest, for each Kubernetes version of
+// the nodeclasses tracking the AMI channel ("" for the default source), adding the plans to sel. It returns
+// the image IDs pinned with --pin-duplicates.
+func planChannel(ctx context.Context, cs clients.Set, planner *upgrade.Planner, opts selectOptions, src selectSources, channel string, sel *selection) []string {
+	discovery := src.discovery.ForChannel(channel)
+	versionItems, scans, manifest, approved := src.versions[channel], src.scans[channel], src.manifest, src.approved
+
+	k8sVersions := discovery.KubernetesVersions()
+	if len(k8sVersions) > 1 {
+		// Mid control plane upgrade: each Kubernetes version gets its own plan
+		counts := make([]string, 0, len(k8sVersions))
+		for _, v := range k8sVersions {
+			counts = append(counts, fmt.Sprintf("%s (%d nodeclasses)", v, len(discovery.Group(v).NodeClasses.Items)))
+		}
+		fmt.Fprintf(out, "📋 Detected Kubernetes Versions: %s\n", strings.Join(counts, ", "))
+	} else if len(k8sVersions) == 1 {
+		fmt.Fprintf(out, "📋 Detected Kubernetes Version: %s\n", discovery.K8sVersion)
+	}
+	fmt.Fprintf(out, "📋 Image Variant: %s\n", naming.VariantName(discovery.Variant))
+	fmt.Fprintln(out)
+
+	if channel != "" {
+		fmt.Fprintf(out, "🔍 Owner ID: %s (channel %s, %d nodeclasses)\n", discovery.OwnerID, channel, len(discovery.NodeClasses.Items))
+	} else {
+		fmt.Fprintf(out, "🔍 Owner ID: %s\n", discovery.OwnerID)
+	}
+	fmt.Fprintln(out)
+	warnMixedOwners(discovery)
+
+	// Convert to items for bubbletea, with the "just wait" option at the top
+	allItems := []list.Item{item{waitOnly: true}}
+	verified := make(map[string]*provenance.Result) // item key -> provenance, when checked
+	scanned := make(map[string]vulns.Summary)       // item key -> findings, when scanned
+	versionByKey := make(map[string]amis.VersionItem)
+	for i, vi := range versionItems {
+		it := item{
+			version:    fmt.Sprintf("v%s", vi.Version),
+			k8sVersion: vi.K8sVersion,
+			date:       versionDescription(vi),
+		}
+		versionByKey[it.key()] = vi
+		if result := planner.VerifyProvenance(vi); result != nil {
+			verified[it.key()] = result
+			it.notes = append(it.notes, provenanceNote(*result, opts.requireProvenance))
+		}
+		if summary, ok := scans[vi.Key()]; ok {
+			scanned[it.key()] = summary
+			it.notes = append(it.notes, findingsNote(summary, opts.findingsPolicy))
+		}
+		if approved != nil {
+			it.notes = append(it.notes, approvalNote(approved.Approved(vi.Version), opts.overrideApproval))
+		}
+		if note := testsNote(vi); note != "" {
+			it.notes = append(it.notes, note)
+		}
+
+		if i == 0 || versionItems[i-1].K8sVersion != vi.K8sVersion {
+			allItems = append(allItems, item{k8sVersion: vi.K8sVersion, header: true})
+		}
+		allItems = append(allItems, it)
+	}
+
+	// Pick a version for each Kubernetes version the nodeclasses use, and plan each group separately
+	var pinned []string
+	for _, k8sVersion := range k8sVersions {
+		group, title := discovery, "Available AMI Versions"
+		if len(k8sVersions) > 1 {
+			group = discovery.Group(k8sVersion)
+			title = fmt.Sprintf("Available AMI Versions for Kubernetes %s (%d nodeclasses)", k8sVersion, len(group.NodeClasses.Items))
+		}
+		if channel != "" {
+			title += fmt.Sprintf(" in channel %s", channel)
+		}
+
+		items := []list.Item{item{waitOnly: true}}
+		for _, it := range allItems {
+			if it := it.(item); !it.waitOnly && !it.header && it.k8sVersion == k8sVersion {
+				items = append(items, it)
+			}
+		}
+		// Without --all-k8s-versions, keep failing as before when the detected version has no AMIs
+		if len(items) == 1 && !opts.allK8sVersions {
+			exitOnError(ctx, fmt.Errorf("kubernetes %s: %w (use --all-k8s-versions to list other versions)", k8sVersion, amis.ErrVersionNotFound))
+		}
+
+		var selected *item
+		if manifest != nil {
+			selected = releaseItem(ctx, manifest, opts.release, k8sVersion, items)
+		} else {
+			fmt.Fprintln(out, "Select a version:")
+			fmt.Fprintln(out)
+			selected = pickVersion(ctx, title, items, allItems, opts.allK8sVersions)
+		}
+		if selected == nil {
+			fmt.Fprintln(out, "No version selected")
+			exit(0)
+		}
+
+		// Check if "just wait" was selected
+		if selected.waitOnly {
+			fmt.Fprintln(out)
+			monitorDrift(ctx, cs, opts.strategy, opts.verify, opts.display)
+			exit(0)
+		}
+
+		selectedVersion := selected.version
+		if result := verified[selected.key()]; result != nil && !result.Verified {
+			if opts.requireProvenance {
+				exitOnError(ctx, fmt.Errorf("cannot select %s: %w", selectedVersion, result.Err()))
+			}
+			fmt.Fprintf(errOut, "⚠️  %s: %v\n", selectedVersion, result.Err())
+		}
+		if summary, ok := scanned[selected.key()]; ok {
+			if err := opts.findingsPolicy.Check(summary); err != nil {
+				exitOnError(ctx, fmt.Errorf("cannot select %s: %w", selectedVersion, err))
+			}
+		}
+		checkApproval(ctx, approved, selectedVersion, opts.overrideApproval, "select")
+
+		// Remove 'v' prefix to get the date or semantic version
+		version := strings.TrimPrefix(selectedVersion, "v")
+
+		fmt.Fprintf(out, "\n✅ Selected version: %s\n", selectedVersion)
+		targetK8sVersion := ""
+		if selected.k8sVersion != k8sVersion {
+			targetK8sVersion = selected.k8sVersion
+			fmt.Fprintf(out, "⬆️  Moving nodes from Kubernetes %s to %s AMIs\n", k8sVersion, targetK8sVersion)
+			if amis.CompareK8sVersions(targetK8sVersion, k8sVersion) > 0 {
+				fmt.Fprintf(errOut, "⚠️  Nodes must not be newer than the control plane: upgrade it to %s first\n", targetK8sVersion)
+			}
+		}
+		fmt.Fprintln(out)
+
+		p := planner.PlanTo(group, targetK8sVersion, version)
+		planner.CheckPublished(p, versionByKey[selected.key()])
+		pinned = append(pinned, checkDuplicates(p, versionByKey[selected.key()], opts.pin)...)
+		sel.plans = append(sel.plans, p)
+		sel.created = append(sel.created, versionByKey[selected.key()].Created)
+		sel.shared = append(sel.shared, share.Images(p, versionByKey[selected.key()])...)
+		sel.k8sVersions = append(sel.k8sVersions, k8sVersion)
+	}
+
+	// Nodeclasses with unrecognized AMI names belong to no Kubernetes version, so no group plan reports them
+	if len(k8sVersions) > 1 {
+		for _, nc := range discovery.NodeClasses.Items {
+			if _, ok := discovery.K8sVersions[nc.Metadata.Name]; !ok && len(nc.Spec.AMISelectorTerms) > 0 {
+				fmt.Fprintf(out, "⚠️  Skipping %s (could not parse AMI name)\n", nc.Metadata.Name)
+			}
+		}
+	}
+	return pinned
+}
+
+// revertApply moves the nodeclasses the failed apply attempted back to their old AMIs (--atomic), reporting
+// whether every one of them was reverted
+func revertApply(ctx context.Context, applier *upgrade.Applier, plans []*plan.Plan, results []upgrade.ChangeResult) bool {
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "↩️  Reverting the nodeclasses updated in this run (--atomic)...")
+	reverted, err := applier.Revert(ctx, results)
+	e := output.Event{Type: "revert", Message: "all updated nodeclasses reverted", Data: report.NewForPlans(plans, reverted, nil).Items}
+	if err != nil {
+		e.Level, e.Message = output.LevelWarn, err.Error()
+	}
+	emit(e)
+
+	for _, r := range reverted {
+		if r.Err != nil {
+			fmt.Fprintf(errOut, "⚠️  Failed to revert %s to %s: %v\n", r.NodeClass, r.NewAMI, r.Err)
+			continue
+		}
+		fmt.Fprintf(out, "↩️  Reverted %s to %s\n", r.NodeClass, r.NewAMI)
+	}
+	if err != nil {
+		fmt.Fprintf(errOut, "\n🛑 Not every nodeclass could be reverted; restore the ones above by hand\n")
+		return false
+	}
+	fmt.Fprintln(out, "✅ No nodeclass was left changed")
+	return true
+}
+
+// cordonDrifted cordons the nodes of the updated nodeclasses as their nodeclaims drift (--cordon). Failures
+// only warn, since Karpenter replaces the nodes either way.
+func cordonDrifted(ctx context.Context, cs clients.Set, results []upgrade.ChangeResult) {
+	var updated []string
+	for _, r := range results {
+		if r.Applied && r.Err == nil {
+			updated = append(updated, r.NodeClass)
+		}
+	}
+	if len(updated) == 0 {
+		return
+	}
+
+	fmt.Fprintf(out, "🚧 Cordoning the old-AMI nodes of %d nodeclasses as their nodeclaims drift (up to %s)...\n", len(updated), cordon.DefaultTimeout)
+	result, err := cordon.New(cs.Kube).Drifted(ctx, updated, func(node string) {
+		fmt.Fprintf(out, "🚧 Cordoned %s\n", node)
+	})
+	if result != nil {
+		e := output.Event{Type: "cordon", Message: fmt.Sprintf("%d nodes cordoned", len(result.Cordoned)), Data: result}
+		if err != nil {
+			e.Level = output.LevelWarn
+		}
+		emit(e)
+	}
+	switch {
+	case ctx.Err() != nil:
+		fmt.Fprintf(out, "%s; no further nodes are cordoned\n", interruption(ctx))
+	case err != nil:
+		fmt.Fprintf(errOut, "⚠️  %v\n", err)
+	}
+	if result != nil {
+		if len(result.Undrifted) > 0 {
+			fmt.Fprintf(out, "⏭️  Not cordoned, no drift detected: %s\n", strings.Join(result.Undrifted, ", "))
+		}
+		fmt.Fprintf(out, "✅ %d nodes cordoned\n", len(result.Cordoned))
+	}
+	fmt.Fprintln(out)
+}
+
+// shareImages grants the accounts launch permission on the AMIs. Failures only warn, since the cluster
+// being upgraded doesn't need the permissions.
+func shareImages(ctx context.Context, cs clients.Set, images []amis.AMIInfo, accounts []string) {
+	sharer, ok := cs.EC2.(clients.ImageSharer)
+	if !ok {
+		fmt.Fprintln(errOut, "⚠️  The EC2 client cannot share images; not sharing the AMIs")
+		return
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "🤝 Sharing %d AMIs with %d accounts...\n", len(images), len(accounts))
+	err := share.Grant(ctx, sharer, images, accounts)
+	switch {
+	case ctx.Err() != nil:
+		exitOnError(ctx, ctx.Err())
+	case err != nil:
+		fmt.Fprintf(errOut, "⚠️  %v; applying anyway\n", err)
+	default:
+		fmt.Fprintln(out, "✅ AMIs shared")
+	}
+}
+
+// startPrewarm launches pre-warmed nodes for the plans and waits for them to pull the configured images.
+// A timeout only warns, since the rollout works without pre-warming. The nodes are removed on exit.
+func startPrewarm(ctx context.Context, cs clients.Set, cfg config.Prewarm, nodes int, plans []*plan.Plan) {
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "🔥 Pre-warming %d nodes per nodeclass on the new AMIs...\n", nodes)
+	session, err := prewarm.New(cs.Kube, nodes, cfg.Images).Start(ctx, plans)
+	if err != nil {
+		exitOnError(ctx, fmt.Errorf("failed to pre-warm nodes: %w", err))
+	}
+	onExit(func() { cleanupPrewarm(ctx, session) })
+	for _, name := range session.Skipped {
+		fmt.Fprintf(out, "⏭️  No nodepool uses %s; not pre-warming it\n", name)
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = prewarm.DefaultTimeout
+	}
+	err = session.Wait(ctx, timeout, func(done, total int) {
+		fmt.Fprintf(out, "   %d/%d nodes ready\n", done, total)
+	})
+	switch {
+	case ctx.Err() != nil:
+		exitOnError(ctx, ctx.Err())
+	case err != nil:
+		fmt.Fprintf(errOut, "⚠️  %v; applying anyway\n", err)
+	default:
+		fmt.Fprintln(out, "✅ Pre-warmed nodes are ready")
+	}
+}
+
+// cleanupPrewarm removes the pre-warmed nodes and their temporary objects
+func cleanupPrewarm(ctx context.Context, session *prewarm.Session) {
+	fmt.Fprintln(out, "🧹 Removing pre-warmed nodes...")
+	if err := session.Cleanup(context.WithoutCancel(ctx)); err != nil {
+		fmt.Fprintf(errOut, "⚠️  Failed to remove pre-warm objects (labelled %s): %v\n", prewarm.Label, err)
+	}
+}
+
+// raiseLimits raises the limits of the nodepools of the changed nodeclasses by percent, restoring them on exit
+func raiseLimits(ctx context.Context, cs clients.Set, percent float64, plans []*plan.Plan) {
+	var changed []string
+	for _, p := range plans {
+		for _, ch := range p.Changes {
+			changed = append(changed, ch.NodeClass)
+		}
+	}
+
+	s, err := surge.Raise(ctx, cs.Kube, changed, percent)
+	if s != nil {
+		onExit(func() {
+			for _, r := range s.Raised {
+				fmt.Fprintf(out, "📉 Restoring limits of nodepool %s\n", r.NodePool)
+			}
+			if err := s.Restore(context.WithoutCancel(ctx)); err != nil {
+				fmt.Fprintf(errOut, "⚠️  Failed to restore nodepool limits: %v\n", err)
+			}
+		})
+		for _, r := range s.Raised {
+			fmt.Fprintf(out, "📈 Raised limits of nodepool %s by %g%%: %s\n", r.NodePool, percent, formatLimits(r.Original, r.Surged))
+		}
+	}
+	if err != nil {
+		exitOnError(ctx, fmt.Errorf("failed to raise nodepool limits: %w", err))
+	}
+}
+
+// formatLimits describes raised limits, e.g. "cpu 1000 → 1200, memory 1000Gi → 1200Gi"
+func formatLimits(original, surged map[string]string) string {
+	resources := slices.Sorted(maps.Keys(original))
+	parts := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		parts = append(parts, fmt.Sprintf("%s %s → %s", resource, original[resource], surged[resource]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// pickVersion runs the version picker, returning the chosen item or nil if none was chosen. It exits
+// if the picker is cancelled.
+func pickVersion(ctx context.Context, title string, items, allItems []list.Item, showAll bool) *item {
+	const defaultWidth = 20
+	l := list.New(items, itemDelegate{}, defaultWidth, 14)
+	if showAll {
+		l.SetItems(allItems)
+	}
+	l.Title = title
+	l.SetShowStatusBar(false)
+	l.SetFilteringEnabled(false)
+	l.Styles.Title = titleStyle
+	l.Styles.PaginationStyle = paginationStyle
+	l.Styles.HelpStyle = helpStyle
+	l.AdditionalShortHelpKeys = func() []key.Binding { return []key.Binding{toggleAllKey} }
+
+	m := model{list: l, items: items, allItems: allItems, showAll: showAll}
+	program := tea.NewProgram(m, tea.WithAltScreen(), tea.WithContext(ctx))
+
+	finalModel, err := program.Run()
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+
+	if finalModel.(model).quitting {
+		fmt.Fprintln(out, "Cancelled")
+		exit(0)
+	}
+	return finalModel.(model).choice
+}
+
+// releaseItem returns the version the manifest lists for the release and Kubernetes version, exiting when
+// it is not among the offered versions
+func releaseItem(ctx context.Context, manifest *release.Manifest, name, k8sVersion string, items []list.Item) *item {
+	version, err := manifest.AMIVersion(name, k8sVersion)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	for _, it := range items {
+		if it := it.(item); !it.waitOnly && it.version == "v"+version {
+			fmt.Fprintf(out, "📦 Release %s uses AMI version %s for Kubernetes %s\n", name, it.version, k8sVersion)
+			fmt.Fprintln(out)
+			return &it
+		}
+	}
+	exitOnError(ctx, fmt.Errorf("release %s: AMI version v%s for Kubernetes %s is not offered: %w", name, version, k8sVersion, amis.ErrVersionNotFound))
+	return nil
+}
+
+// printApplyResults reports the outcome of each nodeclass update once all of them have finished
+func printApplyResults(results []upgrade.ChangeResult) {
+	for _, r := range results {
+		switch {
+		case !r.Applied:
+			fmt.Fprintf(out, "⏭️  Not updated %s\n", r.NodeClass)
+			continue
+		case r.Err != nil:
+			fmt.Fprintf(errOut, "⚠️  Failed to update %s: %v\n", r.NodeClass, r.Err)
+		default:
+			fmt.Fprintf(out, "✅ Updated %s\n", r.NodeClass)
+		}
+		fmt.Fprintf(out, "   Old: %s\n", r.OldAMI)
+		fmt.Fprintf(out, "   New: %s\n", r.NewAMI)
+		if r.NewAMIFamily != "" {
+			fmt.Fprintf(out, "   amiFamily: %s\n", r.NewAMIFamily)
+		}
+		fmt.Fprintln(out)
+	}
+}
+
+// printFailureSummary lists the failed updates and the ones skipped because of them
+func printFailureSummary(applyErr error) {
+	var failures *nodeclasses.ApplyError
+	if !errors.As(applyErr, &failures) {
+		fmt.Fprintf(errOut, "⚠️  %v\n", applyErr)
+		return
+	}
+
+	fmt.Fprintf(errOut, "❌ %d of %d nodeclass updates failed:\n",
+		len(failures.Failed), len(failures.Failed)+failures.Succeeded+failures.NotAttempted)
+	for _, item := range failures.Failed {
+		fmt.Fprintf(errOut, "   - %s: %v\n", item.NodeClass, item.Err)
+	}
+	if failures.NotAttempted > 0 {
+		fmt.Fprintf(errOut, "   %d updates were not attempted after the failure; re-run with --continue-on-error to apply them regardless\n",
+			failures.NotAttempted)
+	}
+}
+
+// emitApplyResults sends the outcome of every change as an "apply" event
+func emitApplyResults(plans []*plan.Plan, results []upgrade.ChangeResult, applyErr error) {
+	items := report.NewForPlans(plans, results, nil).Items
+	runProgress.Applied(items)
+	e := output.Event{Type: "apply", Message: "all nodeclasses updated", Data: items}
+	if applyErr != nil {
+		e.Level, e.Message = output.LevelWarn, applyErr.Error()
+	}
+	emit(e)
+}
+
+// provenanceNote describes the provenance of a version in the picker
+func provenanceNote(result provenance.Result, required bool) string {
+	switch {
+	case result.Verified:
+		return fmt.Sprintf("✓ verified (%s)", result.Method)
+	case required:
+		return "🛑 unverified"
+	default:
+		return "⚠️ unverified"
+	}
+}
+
+// approvalNote describes whether a version is on the approved versions list in the picker
+func approvalNote(ok, override bool) string {
+	switch {
+	case ok:
+		return "✓ approved"
+	case override:
+		return "⚠️ unapproved"
+	default:
+		return "🛑 unapproved"
+	}
+}
+
+// testsNote describes the image pipeline's test results of a version in the picker, when its images come
+// from build manifests reporting them: failed when any image's tests failed, passed when all passed
+func testsNote(vi amis.VersionItem) string {
+	reported, failed, other := 0, 0, ""
+	for _, image := range vi.Images {
+		status, ok := image.Tags[builds.TagTestStatus]
+		switch {
+		case !ok:
+			continue
+		case status == builds.TestsFailed:
+			failed++
+		case status != builds.TestsPassed && other == "":
+			other = status
+		}
+		reported++
+	}
+	switch {
+	case reported == 0:
+		return ""
+	case failed > 0:
+		return fmt.Sprintf("🛑 tests failed (%d of %d images)", failed, len(vi.Images))
+	case other != "":
+		return "⏳ tests " + other
+	case reported < len(vi.Images):
+		return fmt.Sprintf("⚠️ tests passed (%d of %d images)", reported, len(vi.Images))
+	default:
+		return "✓ tests passed"
+	}
+}
+
+// findingsNote describes the vulnerability findings of a version in the picker
+func findingsNote(summary vulns.Summary, policy vulns.Policy) string {
+	if policy.Check(summary) != nil {
+		return "🛑 " + summary.String()
+	}
+	return "🛡️ " + summary.String()
+}
+
+type itemDelegate struct{}
+
+func (d itemDelegate) Height() int                             { return 1 }
+func (d itemDelegate) Spacing() int                            { return 0 }
+func (d itemDelegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd { return nil }
+func (d itemDelegate) Render(w io.Writer, m list.Model, index int, listItem list.Item) {
+	it, ok := listItem.(item)
+	if !ok {
+		return
+	}
+
+	if it.header {
+		fmt.Fprint(w, itemStyle.Render(it.Title()))
+		return
+	}
+
+	str := fmt.Sprintf("%s - %s", it.version, it.Description())
+	for _, note := range it.notes {
+		str += "  " + note
+	}
+
+	if index == m.Index() {
+		str = "> " + str
+		fmt.Fprint(w, selectedItemStyle.Render(str))
+	} else {
+		fmt.Fprint(w, itemStyle.Render(str))
+	}
+}
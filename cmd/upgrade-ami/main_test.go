@@ -0,0 +1,75 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+)
+
+func TestNewClientsKubeClient(t *testing.T) {
+	// kubectl on the PATH doesn't make it the default
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "kubectl"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+	t.Setenv(envReplayFixtures, "")
+	t.Setenv(envRecordFixtures, "")
+
+	tests := []struct {
+		env     string
+		kubectl bool
+	}{
+		{"", false},
+		{"client-go", false},
+		{"kubectl", true},
+	}
+	for _, tt := range tests {
+		t.Run(cmp.Or(tt.env, "unset"), func(t *testing.T) {
+			t.Setenv(envKubeClient, tt.env)
+			switch kube := newClients().Kube.(type) {
+			case *clients.Kubectl:
+				if !tt.kubectl {
+					t.Errorf("Kube = kubectl, want client-go")
+				}
+			case *clients.Kubernetes:
+				if tt.kubectl {
+					t.Errorf("Kube = client-go, want kubectl")
+				}
+			default:
+				t.Errorf("Kube = %T", kube)
+			}
+		})
+	}
+}
+
+func TestCheckRecordTools(t *testing.T) {
+	tests := []struct {
+		name    string
+		tools   []string
+		wantErr bool
+	}{
+		{"both", []string{"kubectl", "aws"}, false},
+		{"no aws", []string{"kubectl"}, true},
+		{"no kubectl", []string{"aws"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range tt.tools {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), 0o755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			t.Setenv("PATH", dir)
+			err := checkRecordTools()
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, clients.ErrToolNotFound)) {
+				t.Errorf("checkRecordTools() error = %v, want ErrToolNotFound %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,585 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/cadence"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/history"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/output"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/pods"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/progress"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/throttle"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/upgrade"
+)
+
+// runMonitor runs the standalone monitor subcommand
+func runMonitor(ctx context.Context, cs clients.Set, args []string) {
+	fs := flag.NewFlagSet("monitor", flag.ExitOnError)
+	nodeClass := fs.String("nodeclass", "", "only monitor nodeclaims belonging to this nodeclass")
+	untilClean := fs.Bool("until-clean", false, "exit once all monitored nodeclaims are undrifted")
+	var timeout time.Duration
+	fs.DurationVar(&timeout, "timeout", 0, "stop monitoring after this duration, e.g. 1h (0 means no limit); given before monitor, --timeout bounds the whole run instead")
+	fs.DurationVar(&timeout, "wait", 0, "alias of --timeout")
+	verify := fs.Bool("verify-termination", false, "verify via EC2 that instances of replaced nodeclaims reach terminated state")
+	showPods := fs.Bool("show-pods", false, "list the pods (with owners and evictability) still running on drifted nodes")
+	readOnly := addReadOnlyFlag(fs)
+	awsOpts := addAWSFlags(fs)
+	poll := addPollFlag(fs)
+	outputs := addOutputFlags(fs)
+	session := addSessionFlags(fs)
+	statusAddr := addStatusFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: upgrade-ami monitor [--nodeclass NAME] [--until-clean] [--timeout DURATION] [--verify-termination] [--show-pods] [--read-only] [--region REGION] [--profile PROFILE] [--poll STRATEGY] [--log-file PATH] [--events-file PATH] [--status-addr ADDR] [--record FILE | --replay FILE]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	outputs.attach()
+	cs = session.clients(cs)
+	cs = awsOpts.clients(cs)
+	cs = readOnlyClients(cs, *readOnly)
+	checkPreflight(ctx, cs)
+	resolveOperator(ctx, cs)
+	serveStatus(ctx, cs, *statusAddr)
+
+	opts := nodeclasses.MonitorOptions{
+		Cadence:    parsePollStrategy(*poll),
+		NodeClass:  *nodeClass,
+		UntilClean: *untilClean,
+		Timeout:    timeout,
+	}
+
+	result, err := monitorAndRecord(ctx, cs, history.Run{Command: "monitor"}, opts, displayOptions{showPods: *showPods}, nil)
+	switch {
+	case errors.Is(err, nodeclasses.ErrMonitorStopped):
+		fmt.Fprintln(out, "\nStopped monitoring")
+	case errors.Is(err, nodeclasses.ErrMonitorTimeout):
+		fmt.Fprintf(errOut, "\n⚠️  %v\n", err)
+		exit(1)
+	case err != nil:
+		fmt.Fprintf(errOut, "\n⚠️  Error monitoring nodeclaims: %v\n", err)
+		exit(1)
+	case *untilClean:
+		fmt.Fprintln(out, "\n✅ All nodeclaims are now undrifted!")
+	}
+
+	if *verify && !verifyTermination(ctx, cs, result.Resolutions) {
+		exit(1)
+	}
+}
+
+// terminationTimeout is how long replaced instances get to reach the terminated state
+const terminationTimeout = 10 * time.Minute
+
+// verifyTermination checks that the instances behind replaced nodeclaims have terminated,
+// reporting any that did not and returning false if orphans were found
+func verifyTermination(ctx context.Context, cs clients.Set, resolutions []history.Resolution) bool {
+	if ctx.Err() != nil {
+		fmt.Fprintln(out, "Skipping termination verification (interrupted)")
+		return true
+	}
+
+	fmt.Fprintln(out, "\n🔍 Verifying EC2 termination of replaced instances...")
+	report, err := upgrade.NewMonitor(cs).VerifyTermination(ctx, resolutions, terminationTimeout, 15*time.Second)
+	if err != nil {
+		fmt.Fprintf(errOut, "⚠️  %v\n", err)
+		return false
+	}
+	for _, err := range report.Skipped {
+		fmt.Fprintf(errOut, "⚠️  Skipping %v\n", err)
+	}
+
+	if report.Checked == 0 {
+		fmt.Fprintln(out, "No replaced instances to verify")
+		return true
+	}
+
+	if len(report.Orphans) == 0 {
+		fmt.Fprintf(out, "✅ All %d replaced instances are terminated\n", report.Checked)
+		return true
+	}
+
+	fmt.Fprintf(out, "⚠️  %d replaced instances have not terminated (possible orphans still billing):\n", len(report.Orphans))
+	for _, o := range report.Orphans {
+		fmt.Fprintf(out, "   %s (state: %s, nodeclaim: %s)\n", o.InstanceID, o.State, o.NodeClaim)
+	}
+	return false
+}
+
+// formatAge formats a duration similar to kubectl age format
+func formatAge(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+	if d < time.Hour {
+		minutes := int(d.Minutes())
+		seconds := int(d.Seconds()) % 60
+		if seconds == 0 {
+			return fmt.Sprintf("%dm", minutes)
+		}
+		return fmt.Sprintf("%dm%ds", minutes, seconds)
+	}
+	if d < 24*time.Hour {
+		hours := int(d.Hours())
+		minutes := int(d.Minutes()) % 60
+		if minutes == 0 {
+			return fmt.Sprintf("%dh", hours)
+		}
+		return fmt.Sprintf("%dh%dm", hours, minutes)
+	}
+	days := int(d.Hours() / 24)
+	hours := int(d.Hours()) % 24
+	if hours == 0 {
+		return fmt.Sprintf("%dd", days)
+	}
+	return fmt.Sprintf("%dd%dh", days, hours)
+}
+
+// collectPodsOnDriftedNodes looks up the pods keeping each drifted node busy, keyed by node name.
+// Lookup failures are reported inline by the caller as missing entries.
+func collectPodsOnDriftedNodes(ctx context.Context, cs clients.Set, statuses []nodeclasses.NodeClaimStatus) map[string][]pods.PodInfo {
+	podsByNode := make(map[string][]pods.PodInfo)
+
+	pdbs, err := pods.GetPodDisruptionBudgets(ctx, cs.Kube)
+	if err != nil {
+		return podsByNode
+	}
+
+	// Storage details only add warnings, so lookup failures are not fatal
+	localClaims, _ := pods.GetLocalClaims(ctx, cs.Kube)
+
+	for _, status := range statuses {
+		if !status.Drifted || status.NodeName == "" {
+			continue
+		}
+		nodePods, err := pods.GetPodsOnNode(ctx, cs.Kube, status.NodeName)
+		if err != nil {
+			continue
+		}
+		usage, _ := pods.GetVolumeUsage(ctx, cs.Kube, status.NodeName)
+		storage := pods.StorageInfo{LocalClaims: localClaims, EmptyDirUsage: usage}
+		podsByNode[status.NodeName] = pods.Describe(nodePods, pdbs, storage)
+	}
+
+	return podsByNode
+}
+
+// monitorSnapshot is everything the monitor displays for one poll
+type monitorSnapshot struct {
+	upgrade.Snapshot
+	podsByNode map[string][]pods.PodInfo // nil unless pods are shown
+}
+
+// timelineLength is the number of most recent disruptions shown in the monitor
+const timelineLength = 10
+
+// printNodeClaimStatuses clears the screen and displays the drift status of each nodeclaim
+// along with replacement statistics and the disruption timeline seen so far
+func printNodeClaimStatuses(snap monitorSnapshot) {
+	statuses := snap.Statuses
+
+	term.clearScreen()
+	fmt.Fprintln(out, "📊 NodeClaim Drift Status")
+	fmt.Fprintln(out, strings.Repeat("=", 80))
+
+	if len(statuses) == 0 {
+		fmt.Fprintln(out, "No nodeclaims found")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Press Ctrl+C to exit")
+		return
+	}
+
+	driftedCount, orphanedCount := 0, 0
+	for _, status := range statuses {
+		statusIcon := "✅"
+		statusText := "Undrifted"
+		if status.Drifted {
+			statusIcon = "⚠️"
+			statusText = "Drifted"
+			if status.Reason != "" {
+				statusText += fmt.Sprintf(" (%s)", status.Reason)
+			}
+			if status.BlockedBy != "" {
+				statusText += fmt.Sprintf(" - blocked: %s", status.BlockedBy)
+			}
+			driftedCount++
+		}
+		ageStr := formatAge(status.Age)
+		nodeClass := status.NodeClass
+		if status.Orphaned {
+			nodeClass = orphanedNodeClass(status.NodeClass)
+			orphanedCount++
+		}
+		fmt.Fprintf(out, "%s %s (NodeClass: %s, Age: %s)\n", statusIcon, status.Name, nodeClass, ageStr)
+		fmt.Fprintf(out, "   Status: %s\n", statusText)
+		if status.Orphaned {
+			fmt.Fprintln(out, "   ⚠️  Orphaned: its nodeclass no longer exists; restore the nodeclass or delete the nodeclaim")
+		}
+		fmt.Fprintf(out, "   Progress: %s\n", conditionLadder(status))
+		if snap.podsByNode != nil && status.Drifted {
+			printPods(snap.podsByNode, status.NodeName)
+		}
+		fmt.Fprintln(out)
+	}
+
+	if len(snap.Disruptions) > 0 {
+		printTimeline(snap.Disruptions)
+	}
+
+	fmt.Fprintln(out, strings.Repeat("=", 80))
+	if stats := replacementStats(snap.Resolutions); stats != "" {
+		fmt.Fprintf(out, "⏱️  Replacement time: %s\n", stats)
+	}
+	if orphanedCount > 0 {
+		fmt.Fprintf(out, "⚠️  %d nodeclaims reference nodeclasses that no longer exist\n", orphanedCount)
+	}
+	if driftedCount > 0 {
+		fmt.Fprintf(out, "⏳ Waiting... (%d/%d nodeclaims still drifted)\n", driftedCount, len(statuses))
+	} else {
+		fmt.Fprintln(out, "✅ All nodeclaims are undrifted!")
+	}
+	fmt.Fprintln(out, "Press Ctrl+C to exit")
+}
+
+// addPollFlag registers the flag selecting how often the monitor polls
+func addPollFlag(fs *flag.FlagSet) *string {
+	return fs.String("poll", "fixed:5s", "monitoring cadence: fixed[:INTERVAL], exponential[:MIN-MAX] or watch[:RESYNC]")
+}
+
+// Nodeclaims an upgrade monitors after applying (--monitor-scope)
+const (
+	scopeRun         = "run"          // nodeclaims of the nodeclasses the plans change
+	scopeBeforeApply = "before-apply" // nodeclaims created before the apply started
+	scopeAll         = "all"          // every nodeclaim, including scale-ups of unrelated nodeclasses
+)
+
+// monitorScopes lists the --monitor-scope values
+var monitorScopes = []string{scopeRun, scopeBeforeApply, scopeAll}
+
+// addMonitorScopeFlag registers the flag choosing the nodeclaims an upgrade monitors
+func addMonitorScopeFlag(fs *flag.FlagSet) *string {
+	return fs.String("monitor-scope", scopeRun, "nodeclaims to monitor after applying: "+strings.Join(monitorScopes, ", ")+" (run: those of the changed nodeclasses; before-apply: those created before the apply)")
+}
+
+// checkMonitorScope exits unless scope is a --monitor-scope value
+func checkMonitorScope(scope string) {
+	if !slices.Contains(monitorScopes, scope) {
+		fmt.Fprintf(errOut, "Error: unknown --monitor-scope %q (want %s)\n", scope, strings.Join(monitorScopes, ", "))
+		exit(exitFailure)
+	}
+}
+
+// scopeMonitor limits opts to the nodeclaims of scope, given the plans of the run and when they were applied
+func scopeMonitor(opts *nodeclasses.MonitorOptions, scope string, plans []*plan.Plan, appliedAt time.Time) {
+	switch scope {
+	case scopeRun:
+		for _, p := range plans {
+			for _, ch := range p.Changes {
+				opts.NodeClasses = append(opts.NodeClasses, ch.NodeClass)
+			}
+		}
+		fmt.Fprintf(out, "🔍 Monitoring the nodeclaims of the %d nodeclasses in this run (--monitor-scope all monitors every nodeclaim)\n", len(opts.NodeClasses))
+	case scopeBeforeApply:
+		opts.CreatedBefore = appliedAt
+		fmt.Fprintf(out, "🔍 Monitoring the nodeclaims created before %s (--monitor-scope all monitors every nodeclaim)\n", appliedAt.Format(time.RFC3339))
+	}
+}
+
+// parsePollStrategy parses the --poll flag, exiting on error
+func parsePollStrategy(spec string) cadence.Strategy {
+	strategy, err := cadence.Parse(spec)
+	if err != nil {
+		fmt.Fprintf(errOut, "Error: %v\n", err)
+		exit(exitFailure)
+	}
+	return strategy
+}
+
+// displayOptions controls what the monitor shows besides the nodeclaim statuses
+type displayOptions struct {
+	showPods bool // list pods on drifted nodes
+}
+
+// monitorAndRecord monitors nodeclaims until done or interrupted, recording run with the drift resolutions in the
+// history file. Cancelling ctx (Ctrl+C) stops monitoring gracefully so the observed resolutions are still recorded.
+// A non-nil throttled deletes drifted nodeclaims after each poll.
+func monitorAndRecord(ctx context.Context, cs clients.Set, run history.Run, opts nodeclasses.MonitorOptions, display displayOptions, throttled *throttle.Throttle) (*upgrade.Result, error) {
+	monitor := upgrade.NewMonitor(cs)
+	runProgress.SetPhase(progress.PhaseMonitoring)
+	result, err := monitor.Run(ctx, opts, func(s upgrade.Snapshot) {
+		summary := summarize(s)
+		runProgress.Polled(s.Statuses, summary.Replaced)
+		emit(output.Event{Time: s.At, Type: "poll", Message: summary.String(), Data: summary})
+
+		snap := monitorSnapshot{Snapshot: s}
+		if !term.interactive {
+			// Clear-screen dumps wreck log aggregation, so emit one line per poll instead
+			printStatusLine(snap)
+		} else {
+			if display.showPods {
+				snap.podsByNode = collectPodsOnDriftedNodes(ctx, cs, s.Statuses)
+			}
+			printNodeClaimStatuses(snap)
+		}
+		if throttled != nil {
+			stepThrottle(ctx, throttled, s)
+		}
+	})
+
+	printReplacementSummary(result.Resolutions)
+	printDisruptionSummary(result.Disruptions)
+	// Record even when interrupted, so don't let the cancellation abort the write
+	recordRun(context.WithoutCancel(ctx), monitor, run, result)
+	return result, err
+}
+
+// recordRun appends this run to the history file, with the drift resolutions of result unless it is nil
+func recordRun(ctx context.Context, monitor *upgrade.Monitor, run history.Run, result *upgrade.Result) {
+	// A replayed rollout didn't happen
+	if replaying() {
+		return
+	}
+	path, err := history.DefaultPath()
+	if err != nil {
+		fmt.Fprintf(errOut, "⚠️  Failed to record run history: %v\n", err)
+		return
+	}
+
+	if run.Operator == "" && !runOperator.IsZero() {
+		run.Operator = runOperator.String()
+	}
+	if err := monitor.Record(ctx, path, run, result); err != nil {
+		fmt.Fprintf(errOut, "⚠️  %v\n", err)
+	}
+}
+
+// printPods lists the pods on a drifted node with their owners and evictability
+func printPods(podsByNode map[string][]pods.PodInfo, nodeName string) {
+	nodePods, ok := podsByNode[nodeName]
+	switch {
+	case nodeName == "":
+		fmt.Fprintln(out, "   Pods: node not registered")
+		return
+	case !ok:
+		fmt.Fprintln(out, "   Pods: unavailable")
+		return
+	case len(nodePods) == 0:
+		fmt.Fprintln(out, "   Pods: none (only DaemonSet or completed pods)")
+		return
+	}
+
+	coordinated := 0
+	for _, p := range nodePods {
+		if p.NeedsCoordination() {
+			coordinated++
+		}
+	}
+	if coordinated > 0 {
+		fmt.Fprintf(out, "   🛑 %d pods need coordination beyond a normal drain (StatefulSet or node-local data)\n", coordinated)
+	}
+
+	fmt.Fprintf(out, "   Pods (%d):\n", len(nodePods))
+	for _, p := range nodePods {
+		eviction := "evictable"
+		if !p.Evictable {
+			eviction = "not evictable: " + p.Note
+		}
+		fmt.Fprintf(out, "     - %s/%s (%s) %s\n", p.Namespace, p.Name, p.Owner, eviction)
+		if p.StatefulSet {
+			fmt.Fprintln(out, "       🛑 StatefulSet pod")
+		}
+		for _, storage := range p.LocalStorage {
+			fmt.Fprintf(out, "       🛑 node-local data: %s\n", storage)
+		}
+	}
+}
+
+// pollSummary counts the nodeclaims of a monitor poll by state
+type pollSummary struct {
+	Total    int `json:"total"`
+	Drifted  int `json:"drifted"`
+	Ready    int `json:"ready"`
+	Replaced int `json:"replaced"`
+	Blocked  int `json:"blocked"`
+	Orphaned int `json:"orphaned,omitempty"`
+}
+
+// summarize counts the nodeclaims of a snapshot by state
+func summarize(snap upgrade.Snapshot) pollSummary {
+	s := pollSummary{Total: len(snap.Statuses), Replaced: len(history.ReplacementDurations(snap.Resolutions))}
+	for _, status := range snap.Statuses {
+		if status.Drifted {
+			s.Drifted++
+		}
+		if status.BlockedBy != "" {
+			s.Blocked++
+		}
+		if status.Orphaned {
+			s.Orphaned++
+		}
+		if status.Conditions["Ready"] {
+			s.Ready++
+		}
+	}
+	return s
+}
+
+// String formats the summary as in "drifted=4/20 ready=16 replaced=3 blocked=1", followed by
+// "orphaned=N" when nodeclaims reference missing nodeclasses
+func (s pollSummary) String() string {
+	line := fmt.Sprintf("drifted=%d/%d ready=%d replaced=%d blocked=%d", s.Drifted, s.Total, s.Ready, s.Replaced, s.Blocked)
+	if s.Orphaned > 0 {
+		line += fmt.Sprintf(" orphaned=%d", s.Orphaned)
+	}
+	return line
+}
+
+// orphanedNodeClass describes the nodeclass an orphaned nodeclaim references, e.g. "gpu (missing)"
+func orphanedNodeClass(name string) string {
+	if name == "" {
+		return "none"
+	}
+	return name + " (missing)"
+}
+
+// printStatusLine prints a single-line status summary for non-interactive output,
+// e.g. "12:03:15 drifted=4/20 ready=16 replaced=3 blocked=1"
+func printStatusLine(snap monitorSnapshot) {
+	fmt.Fprintf(out, "%s %s\n", snap.At.Format("15:04:05"), summarize(snap.Snapshot))
+}
+
+// printTimeline shows the most recent Karpenter disruptions, marking consolidation separately from drift
+func printTimeline(disruptions []nodeclasses.DisruptionEvent) {
+	fmt.Fprintln(out, strings.Repeat("-", 80))
+	fmt.Fprintln(out, "🕒 Disruption Timeline")
+
+	start := 0
+	if len(disruptions) > timelineLength {
+		start = len(disruptions) - timelineLength
+	}
+	for _, d := range disruptions[start:] {
+		cause := "drift"
+		if d.IsConsolidation() {
+			cause = "consolidation (not part of this rollout)"
+		} else if d.Reason != "Drifted" {
+			cause = strings.ToLower(d.Reason)
+		}
+		fmt.Fprintf(out, "   %s %s/%s - %s\n", d.Time.Local().Format("15:04:05"), d.Kind, d.Name, cause)
+	}
+}
+
+// printDisruptionSummary prints how many disruptions during monitoring were caused by drift versus consolidation
+func printDisruptionSummary(disruptions []nodeclasses.DisruptionEvent) {
+	if len(disruptions) == 0 {
+		return
+	}
+
+	consolidations := 0
+	for _, d := range disruptions {
+		if d.IsConsolidation() {
+			consolidations++
+		}
+	}
+
+	fmt.Fprintf(out, "Disruptions while monitoring: %d total, %d from consolidation\n", len(disruptions), consolidations)
+}
+
+// replacementStats formats p50/p95 replacement durations, or "" when nothing has been replaced yet
+func replacementStats(resolutions []history.Resolution) string {
+	durations := history.ReplacementDurations(resolutions)
+	if len(durations) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("p50 %s, p95 %s (%d replaced)",
+		formatAge(history.Percentile(durations, 50)),
+		formatAge(history.Percentile(durations, 95)),
+		len(durations))
+}
+
+// printReplacementSummary prints the final replacement duration statistics of a monitoring run
+func printReplacementSummary(resolutions []history.Resolution) {
+	durations := history.ReplacementDurations(resolutions)
+	if len(durations) == 0 {
+		return
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "📊 Replacement Summary")
+	fmt.Fprintln(out, strings.Repeat("=", 80))
+	fmt.Fprintf(out, "Nodes replaced: %d\n", len(durations))
+	fmt.Fprintf(out, "p50:            %s\n", formatAge(history.Percentile(durations, 50)))
+	fmt.Fprintf(out, "p95:            %s\n", formatAge(history.Percentile(durations, 95)))
+	fmt.Fprintf(out, "Max:            %s\n", formatAge(history.Percentile(durations, 100)))
+	fmt.Fprintln(out, strings.Repeat("=", 80))
+}
+
+// conditionLadder renders the lifecycle stages of a nodeclaim, e.g. "✓ Launched → ✓ Registered → · Initialized → · Ready".
+// Drifted nodeclaims show their way out (Drifted, Terminating) instead of their way in.
+func conditionLadder(status nodeclasses.NodeClaimStatus) string {
+	type step struct {
+		name string
+		done bool
+	}
+
+	var steps []step
+	if status.Drifted || status.Terminating {
+		steps = []step{
+			{"Drifted", status.Drifted},
+			{"Terminating", status.Terminating},
+		}
+	} else {
+		for _, condition := range nodeclasses.LaunchConditions {
+			steps = append(steps, step{condition, status.Conditions[condition]})
+		}
+	}
+
+	parts := make([]string, len(steps))
+	for i, s := range steps {
+		mark := "·"
+		if s.done {
+			mark = "✓"
+		}
+		parts[i] = mark + " " + s.name
+	}
+	return strings.Join(parts, " → ")
+}
+
+// monitorDrift monitors nodeclaim drift without applying anything, until the user stops it
+func monitorDrift(ctx context.Context, cs clients.Set, strategy cadence.Strategy, verify bool, display displayOptions) {
+	fmt.Fprintln(out, "⏳ Monitoring nodeclaim drift status...")
+	fmt.Fprintln(out, "Press Ctrl+C to stop monitoring")
+	fmt.Fprintln(out)
+	waitForNodeClaims(ctx, cs, history.Run{Command: "upgrade"}, nodeclasses.MonitorOptions{Cadence: strategy}, verify, display, nil)
+}
+
+// waitForNodeClaims waits for the nodeclaims opts selects to become undrifted and displays status, returning
+// what was observed. run is recorded in the history file with the observed resolutions.
+func waitForNodeClaims(ctx context.Context, cs clients.Set, run history.Run, opts nodeclasses.MonitorOptions, verify bool, display displayOptions, throttled *throttle.Throttle) *upgrade.Result {
+	opts.UntilClean = true
+	result, err := monitorAndRecord(ctx, cs, run, opts, display, throttled)
+
+	switch {
+	case errors.Is(err, nodeclasses.ErrMonitorStopped) && timedOut(ctx):
+		fmt.Fprintf(out, "\n%s; stopped waiting\n", interruption(ctx))
+	case errors.Is(err, nodeclasses.ErrMonitorStopped):
+		fmt.Fprintln(out, "\nStopped waiting")
+	case err != nil:
+		fmt.Fprintf(errOut, "\n⚠️  Error monitoring nodeclaims: %v\n", err)
+		return result
+	default:
+		fmt.Fprintln(out, "\n✅ All nodeclaims are now undrifted!")
+	}
+
+	if verify {
+		verifyTermination(ctx, cs, result.Resolutions)
+	}
+	return result
+}
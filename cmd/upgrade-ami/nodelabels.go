@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodelabels"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/output"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/upgrade"
+)
+
+// checkNodeLabels verifies that the replacement nodes of the updated nodeclasses carry the labels and taints
+// of their NodePools' templates, flagging those that don't. It only warns: the nodes are running by now, and
+// whether the missing labels matter depends on the workloads.
+func checkNodeLabels(ctx context.Context, cs clients.Set, results []upgrade.ChangeResult, since time.Time) {
+	var updated []string
+	for _, r := range results {
+		if r.Applied && r.Err == nil {
+			updated = append(updated, r.NodeClass)
+		}
+	}
+	if len(updated) == 0 || ctx.Err() != nil {
+		return
+	}
+
+	pools, err := nodeclasses.GetNodePools(ctx, cs.Kube)
+	if err != nil {
+		fmt.Fprintf(errOut, "⚠️  Not checking the labels and taints of the replacement nodes: %v\n", err)
+		return
+	}
+	statuses, err := nodeclasses.GetNodeClaimStatuses(ctx, cs.Kube, clock.Real.Now())
+	if err != nil {
+		fmt.Fprintf(errOut, "⚠️  Not checking the labels and taints of the replacement nodes: %v\n", err)
+		return
+	}
+	nodes, err := nodeclasses.GetNodes(ctx, cs.Kube)
+	if err != nil {
+		fmt.Fprintf(errOut, "⚠️  Not checking the labels and taints of the replacement nodes: %v\n", err)
+		return
+	}
+
+	result := nodelabels.Check(pools, statuses, nodes, updated, since)
+	if result.Checked == 0 {
+		return
+	}
+	e := output.Event{Type: "labels", Message: fmt.Sprintf("%d of %d replacement nodes lack NodePool labels or taints", len(result.Discrepancies), result.Checked), Data: result}
+	if len(result.Discrepancies) > 0 {
+		e.Level = output.LevelWarn
+	}
+	emit(e)
+
+	if len(result.Discrepancies) == 0 {
+		fmt.Fprintf(out, "✅ The %d replacement nodes carry the labels and taints of their NodePools\n", result.Checked)
+		return
+	}
+	fmt.Fprintf(errOut, "⚠️  %d of %d replacement nodes lack labels or taints of their NodePool's template; check the new AMI's bootstrap:\n", len(result.Discrepancies), result.Checked)
+	for _, d := range result.Discrepancies {
+		var missing []string
+		if len(d.MissingLabels) > 0 {
+			missing = append(missing, "labels "+strings.Join(d.MissingLabels, ", "))
+		}
+		if len(d.MissingTaints) > 0 {
+			missing = append(missing, "taints "+strings.Join(d.MissingTaints, ", "))
+		}
+		fmt.Fprintf(errOut, "   %s (nodepool %s): %s\n", d.Node, d.NodePool, strings.Join(missing, "; "))
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/operator"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/output"
+)
+
+// runOperator is who runs the tool, set by resolveOperator and stamped into the run history
+var runOperator operator.Operator
+
+// resolveOperator looks up who runs the tool, shows it and remembers it for the run history
+func resolveOperator(ctx context.Context, cs clients.Set) operator.Operator {
+	runOperator = operator.Resolve(ctx, cs)
+	emit(output.Event{Type: "operator", Message: runOperator.String(), Data: runOperator})
+	fmt.Fprintf(out, "👤 Operator: %s\n", runOperator)
+	fmt.Fprintln(out)
+	return runOperator
+}
+
+// operatorAnnotations returns the annotations recording who updated a nodeclass, when and in which run
+func operatorAnnotations(op operator.Operator, runID string) map[string]string {
+	return map[string]string{
+		nodeclasses.UpdatedByAnnotation: op.String(),
+		nodeclasses.UpdatedAtAnnotation: clock.Real.Now().UTC().Format(time.RFC3339),
+		nodeclasses.RunIDAnnotation:     runID,
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/config"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/output"
+)
+
+var (
+	// sinks receives all user-facing output, with secrets redacted; the terminal is always attached,
+	// with the ASCII fallback when the console needs it
+	sinks = newSinks()
+
+	// out and errOut are where the CLI writes text; warnings and errors go to errOut
+	out, errOut = output.Writer(sinks, output.LevelInfo), output.Writer(sinks, output.LevelWarn)
+)
+
+// redactor removes secrets from the output sinks and the files the CLI writes, e.g. --report-file
+var redactor = newRedactor()
+
+// secretEnv are the environment variables whose values are redacted wherever they appear; the Slack
+// token variables set in the config file are added when it is loaded
+var secretEnv = []string{"AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", config.DefaultSlackTokenEnv}
+
+// newRedactor creates the redactor with the secrets of secretEnv registered
+func newRedactor() *output.Redactor {
+	r := &output.Redactor{}
+	for _, name := range secretEnv {
+		r.Add(os.Getenv(name))
+	}
+	return r
+}
+
+// registerSecrets redacts the secrets the config file points to from then on
+func registerSecrets(cfg *config.Config) {
+	for _, env := range []string{cfg.Confirmation.Slack.TokenEnv, cfg.Notifications.Slack.TokenEnv} {
+		if env != "" {
+			redactor.Add(os.Getenv(env))
+		}
+	}
+	// The URL of a webhook is its credential
+	redactor.Add(cfg.Notifications.Webhook)
+}
+
+// newSinks creates the redacting sinks with the terminal attached, closing them on exit so files are flushed
+func newSinks() *output.Multi {
+	m := &output.Multi{Redactor: redactor}
+	m.Add(output.Terminal{Out: term.writer(os.Stdout), Err: term.writer(os.Stderr)})
+	onExit(func() { m.Close() })
+	return m
+}
+
+// emit sends a structured event to the sinks
+func emit(e output.Event) {
+	if e.Level == "" {
+		e.Level = output.LevelInfo
+	}
+	sinks.Event(e)
+}
+
+// outputFlags select the sinks attached besides the terminal
+type outputFlags struct {
+	logFile    *string
+	eventsFile *string
+}
+
+// addOutputFlags registers the sink flags on fs
+func addOutputFlags(fs *flag.FlagSet) outputFlags {
+	return outputFlags{
+		logFile:    fs.String("log-file", "", "also append all output to this file, one timestamped line at a time"),
+		eventsFile: fs.String("events-file", "", "also append output and structured events (plan, apply, poll, report) to this file as JSON lines"),
+	}
+}
+
+// attach opens the requested files and attaches their sinks, exiting on error
+func (f outputFlags) attach() {
+	if *f.logFile != "" {
+		file := openOutputFile(*f.logFile)
+		sinks.Add(output.NewLog(file, clock.Real))
+	}
+	if *f.eventsFile != "" {
+		file := openOutputFile(*f.eventsFile)
+		sinks.Add(output.NewJSONLines(file, clock.Real))
+	}
+}
+
+// openOutputFile opens path for appending, exiting on error
+func openOutputFile(path string) *os.File {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		fmt.Fprintf(errOut, "Error: failed to open output file: %v\n", err)
+		exit(exitFailure)
+	}
+	return file
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/amis"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/approval"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients/offline"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/naming"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/operator"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/report"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/runstate"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/upgrade"
+)
+
+// runPlan runs the plan subcommand, building the plan document for a version without applying it. With
+// exported nodeclasses and images it needs no access to the cluster or AWS, so plans for air-gapped
+// clusters can be built elsewhere and applied there with --plan.
+func runPlan(ctx context.Context, cs clients.Set, args []string) {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	fromFile := fs.String("from-file", "", "read the nodeclasses from this `kubectl get ec2nodeclass -o json` export (- for stdin) instead of the cluster")
+	amiList := fs.String("ami-list", "", "read the AMIs from this `aws ec2 describe-images --output json` export (- for stdin) instead of AWS")
+	version := fs.String("version", "", "AMI version to plan, e.g. v20251001 (defaults to the newest approved version of each Kubernetes version)")
+	overrideApproval := fs.Bool("override-approval", false, "allow planning an AMI version that is not on the approved versions list")
+	variant := fs.String("variant", "", "image variant to upgrade to: standard or fips (defaults to the variant the nodeclasses use)")
+	includeSkipped := fs.Bool("include-skipped", false, "plan nodeclasses annotated with upgrade-ami/skip: \"true\" like any other")
+	outputFormat := fs.String("output", string(report.FormatText), "rendering of the plan: text or json")
+	savePlan := fs.String("save-plan", "", "write the plan document to this file (YAML for .yaml/.yml, JSON otherwise)")
+	pin := addPinFlag(fs)
+	awsOpts := addAWSFlags(fs)
+	fs.Parse(args)
+	cs = awsOpts.clients(cs)
+
+	format, err := report.ParseFormat(*outputFormat)
+	if err != nil {
+		fmt.Fprintf(errOut, "Error: %v\n", err)
+		exit(exitFailure)
+	}
+	if *fromFile == offline.Stdin && *amiList == offline.Stdin {
+		fmt.Fprintln(errOut, "Error: only one of --from-file and --ami-list can read stdin")
+		exit(exitFailure)
+	}
+	if *fromFile != "" {
+		kube, err := offline.ReadNodeClasses(*fromFile)
+		if err != nil {
+			exitOnError(ctx, err)
+		}
+		cs.Kube = kube
+	}
+
+	cfg := loadConfig()
+	if *amiList != "" {
+		cfg.AMICatalog, cfg.BuildManifests.Location = "", "" // the flag takes precedence
+	}
+	planner := newPlanner(cs, cfg)
+	if *amiList != "" {
+		images, err := offline.ReadImages(*amiList)
+		if err != nil {
+			exitOnError(ctx, err)
+		}
+		planner.EC2 = images
+	}
+	planner.IncludeSkipped = *includeSkipped
+	if *variant != "" {
+		v, err := naming.ParseVariant(*variant)
+		if err != nil {
+			fmt.Fprintf(errOut, "Error: %v\n", err)
+			exit(exitFailure)
+		}
+		planner.Variant = &v
+	}
+
+	discovery, err := planner.Discover(ctx)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	warnMixedOwners(discovery)
+	createdBy := operator.Resolve(ctx, cs).String()
+
+	approved := loadApprovals(ctx, cs, cfg)
+	plans, k8sVersions := planChannels(ctx, planner, discovery, strings.TrimPrefix(*version, "v"), approved, *overrideApproval, *pin, createdBy)
+	for i, p := range plans {
+		if len(plans) > 1 {
+			fmt.Fprintln(out, groupTitle(p, k8sVersions[i]))
+		}
+		writePlan(ctx, p, format, *savePlan, k8sVersions[i], len(plans) > 1)
+	}
+}
+
+// planChannels plans every AMI channel and Kubernetes version of the discovery to version, or to the newest
+// approved version published for each when it is empty, returning the plans and the Kubernetes version of each.
+// A version that is not approved is refused unless override is set. Every plan is built before any is written,
+// so a --pin-duplicates ID matching no image leaves none written.
+func planChannels(ctx context.Context, planner *upgrade.Planner, discovery *upgrade.Discovery, version string, approved *approval.List, override bool, pin, createdBy string) ([]*plan.Plan, []string) {
+	var plans []*plan.Plan
+	var k8sVersions []string
+	var pinned []string
+	// Each AMI channel is planned against the versions its owner publishes
+	for _, channel := range discovery.ChannelNames() {
+		scope := discovery.ForChannel(channel)
+		versions, err := planner.AllVersions(ctx, scope)
+		if err != nil {
+			if channel != "" {
+				err = fmt.Errorf("channel %s: %w", channel, err)
+			}
+			exitOnError(ctx, err)
+		}
+		groups := scope.KubernetesVersions()
+		for _, k8sVersion := range groups {
+			group := scope
+			if len(groups) > 1 {
+				group = scope.Group(k8sVersion)
+			}
+			selected, err := planVersion(versions, k8sVersion, version, approved)
+			if err != nil {
+				exitOnError(ctx, err)
+			}
+			checkApproval(ctx, approved, "v"+selected.Version, override, "plan")
+
+			p := planner.PlanTo(group, "", selected.Version)
+			planner.CheckPublished(p, selected)
+			pinned = append(pinned, checkDuplicates(p, selected, pin)...)
+			p.CreatedBy = createdBy
+			plans = append(plans, p)
+			k8sVersions = append(k8sVersions, k8sVersion)
+		}
+	}
+	checkPinned(ctx, pin, pinned)
+	return plans, k8sVersions
+}
+
+// planVersion returns version if it is published for the Kubernetes version, or the newest version published
+// for it that is on the approved list, if any, when version is empty
+func planVersion(versions []amis.VersionItem, k8sVersion, version string, approved *approval.List) (amis.VersionItem, error) {
+	for _, v := range versions {
+		if v.K8sVersion != k8sVersion {
+			continue
+		}
+		if version == "" && (approved == nil || approved.Approved(v.Version)) || v.Version == version {
+			return v, nil
+		}
+	}
+	if version == "" && approved != nil {
+		return amis.VersionItem{}, fmt.Errorf("kubernetes %s: no published version is approved: %w (pass --version with --override-approval to plan one anyway)", k8sVersion, amis.ErrVersionNotFound)
+	}
+	if version == "" {
+		return amis.VersionItem{}, fmt.Errorf("kubernetes %s: %w", k8sVersion, amis.ErrVersionNotFound)
+	}
+	return amis.VersionItem{}, fmt.Errorf("kubernetes %s: v%s: %w", k8sVersion, version, amis.ErrVersionNotFound)
+}
+
+// writePlan prints the plan and its skipped nodeclasses, and saves it when path is set. The plan of one
+// Kubernetes version among several is saved under a file name of its own.
+func writePlan(ctx context.Context, p *plan.Plan, format report.Format, path, k8sVersion string, grouped bool) {
+	for _, skipped := range p.Skipped {
+		fmt.Fprintf(errOut, "⚠️  Skipping %s (%s)\n", skipped.NodeClass, skipped.Reason)
+	}
+	if err := report.WritePlan(out, format, p); err != nil {
+		exitOnError(ctx, err)
+	}
+	fmt.Fprintln(out)
+	if format == report.FormatText {
+		// Approval tokens name the plans they approve by ID
+		id, err := runstate.PlanID(p)
+		if err != nil {
+			exitOnError(ctx, err)
+		}
+		fmt.Fprintf(out, "🔑 Plan ID: %s\n\n", id)
+	}
+	if path == "" {
+		return
+	}
+	if grouped {
+		path = groupPlanFile(path, p, k8sVersion)
+	}
+	if err := writePlanFile(path, p); err != nil {
+		exitOnError(ctx, err)
+	}
+	fmt.Fprintf(out, "📄 Plan written to %s\n\n", path)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/amis"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/approval"
+)
+
+func TestPlanVersion(t *testing.T) {
+	// Newest first, as AllVersions returns them
+	versions := []amis.VersionItem{
+		{Version: "20251101", K8sVersion: "1.33"},
+		{Version: "20251001", K8sVersion: "1.33"},
+		{Version: "20251001", K8sVersion: "1.32"},
+		{Version: "20250901", K8sVersion: "1.33"},
+	}
+	approved, err := approval.Parse([]byte(`{"versions": ["v20251001", "20250901"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	none, err := approval.Parse([]byte(`{"versions": []}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		k8sVersion string
+		version    string
+		approved   *approval.List
+		want       string
+		wantErr    error
+	}{
+		{"newest", "1.33", "", nil, "20251101", nil},
+		{"newest approved", "1.33", "", approved, "20251001", nil},
+		{"explicit version, whether approved or not", "1.33", "20251101", approved, "20251101", nil},
+		{"other kubernetes version", "1.32", "", approved, "20251001", nil},
+		{"none approved", "1.33", "", none, "", amis.ErrVersionNotFound},
+		{"unpublished version", "1.32", "20251101", nil, "", amis.ErrVersionNotFound},
+		{"unpublished kubernetes version", "1.34", "", nil, "", amis.ErrVersionNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := planVersion(versions, tt.k8sVersion, tt.version, tt.approved)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("planVersion() error = %v, want %v", err, tt.wantErr)
+			}
+			if got.Version != tt.want {
+				t.Errorf("planVersion() = %q, want %q", got.Version, tt.want)
+			}
+		})
+	}
+}
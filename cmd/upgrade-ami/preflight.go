@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/preflight"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/report"
+)
+
+// runPreflight runs the preflight subcommand, checking the environment without changing anything
+func runPreflight(ctx context.Context, cs clients.Set, args []string) {
+	fs := flag.NewFlagSet("preflight", flag.ExitOnError)
+	outputFormat := fs.String("output", string(report.FormatText), "rendering of the check results: text or json")
+	awsOpts := addAWSFlags(fs)
+	fs.Parse(args)
+	cs = awsOpts.clients(cs)
+
+	format, err := report.ParseFormat(*outputFormat)
+	if err != nil {
+		fmt.Fprintf(errOut, "Error: %v\n", err)
+		exit(exitFailure)
+	}
+
+	result := preflight.Run(ctx, preflight.Checks(cs))
+	if err := result.Write(out, format); err != nil {
+		fmt.Fprintf(errOut, "Error: %v\n", err)
+		exit(exitFailure)
+	}
+	if err := result.Err(); err != nil {
+		exit(exitCode(err))
+	}
+}
+
+// checkPreflight runs the preflight checks before an upgrade or monitor run, exiting if any fail
+func checkPreflight(ctx context.Context, cs clients.Set) {
+	// Replayed sessions never run the binaries or reach a cluster
+	if replaying() {
+		return
+	}
+
+	result := preflight.Run(ctx, preflight.Checks(cs))
+	fmt.Fprintln(out, "🔧 Preflight checks:")
+	if err := result.Write(out, report.FormatText); err != nil {
+		exitOnError(ctx, err)
+	}
+	fmt.Fprintln(out)
+
+	if err := result.Err(); err != nil {
+		exitOnError(ctx, err)
+	}
+}
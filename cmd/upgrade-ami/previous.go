@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/history"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/output"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/report"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/upgrade"
+)
+
+// runChanges returns the outcome of each change of the run as it is recorded in the history file
+func runChanges(plans []*plan.Plan, results []upgrade.ChangeResult) []history.Change {
+	items := report.NewForPlans(plans, results, nil).Items
+	changes := make([]history.Change, 0, len(items))
+	for _, item := range items {
+		changes = append(changes, history.Change{
+			NodeClass: item.NodeClass,
+			OldAMI:    item.OldAMI,
+			NewAMI:    item.NewAMI,
+			Status:    item.Status,
+			Error:     item.Error,
+		})
+	}
+	return changes
+}
+
+// showPreviousRun compares the plans with the last upgrade recorded for the cluster before they are
+// confirmed: the nodeclasses moved a second time, how long the previous rollout took and the nodeclasses
+// whose update failed then. Nothing is shown when the cluster has no recorded upgrade.
+func showPreviousRun(ctx context.Context, cs clients.Set, plans []*plan.Plan) {
+	// The history of the machine replaying a session is unrelated to it
+	if replaying() {
+		return
+	}
+	path, err := history.DefaultPath()
+	if err != nil {
+		return
+	}
+	runs, err := history.Load(path)
+	if err != nil {
+		fmt.Fprintf(errOut, "⚠️  Not comparing with the previous run: %v\n\n", err)
+		return
+	}
+	cluster, err := nodeclasses.CurrentContext(ctx, cs.Kube)
+	if err != nil {
+		return
+	}
+	prev := history.LastUpgrade(runs, cluster)
+	if prev == nil {
+		return
+	}
+
+	var moving []string
+	for _, p := range plans {
+		for _, ch := range p.Changes {
+			moving = append(moving, ch.NodeClass)
+		}
+	}
+	c := history.Compare(prev, moving)
+	emit(output.Event{Type: "previous", Message: fmt.Sprintf("%d nodeclasses moved again, %d failed last time", len(c.Repeated), len(c.Failed)), Data: c})
+
+	when := fmt.Sprintf("%s, %s ago", prev.StartedAt.Local().Format("2006-01-02 15:04"), formatAge(clock.Real.Now().Sub(prev.FinishedAt)))
+	if prev.Operator != "" {
+		when += ", by " + prev.Operator
+	}
+	if prev.ID != "" {
+		when += ", run " + prev.ID
+	}
+	fmt.Fprintf(out, "🔁 Compared with the last run on %s (%s):\n", cluster, when)
+	replaced := len(history.ReplacementDurations(prev.Resolutions))
+	switch {
+	case prev.Reverted:
+		fmt.Fprintln(out, "   The rollout was reverted after a failed update (--atomic)")
+	case prev.Monitored:
+		fmt.Fprintf(out, "   The rollout took %s (%d nodes replaced)\n", formatAge(prev.Duration()), replaced)
+	default:
+		fmt.Fprintln(out, "   The rollout was not waited for")
+	}
+
+	if len(c.Repeated) == 0 {
+		fmt.Fprintln(out, "   No nodeclass is moved a second time")
+	} else {
+		fmt.Fprintf(out, "   Moved a second time (%d):\n", len(c.Repeated))
+		for _, ch := range c.Repeated {
+			fmt.Fprintf(out, "     %s: last moved %s → %s\n", ch.NodeClass, ch.OldAMI, ch.NewAMI)
+		}
+	}
+
+	if len(c.Failed) > 0 {
+		retried := make(map[string]bool, len(moving))
+		for _, name := range moving {
+			retried[name] = true
+		}
+		fmt.Fprintf(errOut, "   ⚠️  Failed last time (%d):\n", len(c.Failed))
+		for _, ch := range c.Failed {
+			note := "not in this plan"
+			if retried[ch.NodeClass] {
+				note = "retried now"
+			}
+			fmt.Fprintf(errOut, "     %s (%s): %s\n", ch.NodeClass, note, strings.TrimSpace(ch.Error))
+		}
+	}
+	fmt.Fprintln(out)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/progress"
+)
+
+// runProgress is the state of the run, served over HTTP with --status-addr
+var runProgress = progress.New(clock.Real)
+
+// addStatusFlag registers the flag serving the run's progress over HTTP
+func addStatusFlag(fs *flag.FlagSet) *string {
+	return fs.String("status-addr", "", "serve the run's progress as JSON on http://ADDR/status while it runs, e.g. localhost:8089")
+}
+
+// serveStatus serves the run's progress on addr until the tool exits, exiting if it cannot listen. Nothing
+// is served when addr is empty.
+func serveStatus(ctx context.Context, cs clients.Set, addr string) {
+	if addr == "" {
+		return
+	}
+	cluster, _ := nodeclasses.CurrentContext(ctx, cs.Kube)
+	runProgress.SetRun(cluster, runOperator.String())
+	srv, err := progress.Serve(addr, runProgress)
+	if err != nil {
+		fmt.Fprintf(errOut, "Error: %v\n", err)
+		exit(exitFailure)
+	}
+	onExit(func() { srv.Close() })
+	fmt.Fprintf(out, "📡 Serving the run status on http://%s/status\n", srv.Addr)
+	fmt.Fprintln(out)
+}
+
+// addConfigMapFlag registers the flag publishing the run's progress to a ConfigMap
+func addConfigMapFlag(fs *flag.FlagSet) *string {
+	return fs.String("status-configmap", "", "publish the plans and the run's progress to a ConfigMap, NAMESPACE or NAMESPACE/NAME (overrides the config file; name defaults to "+progress.DefaultConfigMapName+")")
+}
+
+// publishStatus keeps the ConfigMap ref (NAMESPACE[/NAME]) up to date with the run's progress until the tool
+// exits, writing it a last time on exit. Nothing is published when ref is empty; publishing failures only
+// warn.
+func publishStatus(ctx context.Context, cs clients.Set, ref string) {
+	if ref == "" {
+		return
+	}
+	namespace, name, err := progress.ParseConfigMap(ref)
+	if err != nil {
+		fmt.Fprintf(errOut, "Error: %v\n", err)
+		exit(exitFailure)
+	}
+	cluster, _ := nodeclasses.CurrentContext(ctx, cs.Kube)
+	runProgress.SetRun(cluster, runOperator.String())
+	cm := progress.ConfigMap{Kube: cs.Kube, Namespace: namespace, Name: name}
+
+	publishCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	var warnOnce sync.Once
+	go func() {
+		defer close(done)
+		cm.Run(publishCtx, runProgress, progress.DefaultPublishInterval, func(err error) {
+			warnOnce.Do(func() { fmt.Fprintf(errOut, "⚠️  %v\n", err) })
+		})
+	}()
+	onExit(func() {
+		stop()
+		<-done
+		if runProgress.Status().Phase != progress.PhaseDone {
+			runProgress.SetPhase(progress.PhaseStopped)
+		}
+		// The run may have been cancelled, so the last write gets a context of its own
+		finalCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		if err := cm.Publish(finalCtx, runProgress); err != nil {
+			fmt.Fprintf(errOut, "⚠️  %v\n", err)
+		}
+	})
+	fmt.Fprintf(out, "📡 Publishing the run status to ConfigMap %s/%s\n", namespace, name)
+	fmt.Fprintln(out)
+}
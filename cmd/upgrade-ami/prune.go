@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/amis"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/prune"
+)
+
+// runPruneAMIs runs the prune-amis subcommand, deregistering old AMIs that no cluster of the configured
+// contexts uses, together with their snapshots
+func runPruneAMIs(ctx context.Context, cs clients.Set, args []string) {
+	fs := flag.NewFlagSet("prune-amis", flag.ExitOnError)
+	keep := fs.Int("keep", prune.DefaultKeep, "number of newest versions of each Kubernetes version and variant to keep, used or not")
+	dryRun := fs.Bool("dry-run", false, "only list the AMIs and snapshots that would be removed")
+	owner := fs.String("owner", "", "AMI owner account to prune (defaults to the owners the nodeclasses select from)")
+	contextList := fs.String("contexts", "", "comma-separated kubeconfig contexts of every cluster using the AMIs (defaults to contexts in the config file, or the current context)")
+	readOnly := addReadOnlyFlag(fs)
+	awsOpts := addAWSFlags(fs)
+	fs.Parse(args)
+	cs = awsOpts.clients(cs)
+	cs = readOnlyClients(cs, *readOnly)
+
+	if *keep < 1 {
+		fmt.Fprintln(errOut, "Error: --keep must be at least 1")
+		exit(exitFailure)
+	}
+
+	cfg := loadConfig()
+	scheme, err := cfg.NamingScheme()
+	if err != nil {
+		fmt.Fprintf(errOut, "Error: %v\n", err)
+		exit(exitFailure)
+	}
+	contexts := cfg.Contexts
+	if *contextList != "" {
+		contexts = strings.Split(*contextList, ",")
+	}
+
+	// An AMI is only unused if every cluster that could run it was checked, so any failure aborts
+	refs := prune.NewReferences()
+	if len(contexts) == 0 {
+		if err := refs.Collect(ctx, cs.Kube); err != nil {
+			exitOnError(ctx, err)
+		}
+		fmt.Fprintf(errOut, "⚠️  No contexts configured; only AMIs used by the current cluster (%s) are kept\n", refs.Clusters[0])
+	} else {
+		switcher, ok := cs.Kube.(clients.ContextSwitcher)
+		if !ok {
+			fmt.Fprintln(errOut, "Error: checking other contexts needs a kubeconfig-backed Kubernetes client")
+			exit(exitFailure)
+		}
+		for _, name := range contexts {
+			if err := refs.Collect(ctx, switcher.WithContext(strings.TrimSpace(name))); err != nil {
+				exitOnError(ctx, err)
+			}
+		}
+	}
+	fmt.Fprintf(out, "🔍 Checked %d clusters: %s\n", len(refs.Clusters), strings.Join(refs.Clusters, ", "))
+
+	owners := make([]string, 0, len(refs.Owners))
+	for o := range refs.Owners {
+		owners = append(owners, o)
+	}
+	sort.Strings(owners)
+	if *owner != "" {
+		owners = []string{*owner}
+	}
+	if len(owners) == 0 {
+		fmt.Fprintln(errOut, "Error: no nodeclass names an AMI owner; pass --owner")
+		exit(exitFailure)
+	}
+
+	var images []amis.AMIInfo
+	for _, o := range owners {
+		found, err := amis.GetAvailableAMIs(ctx, cs.EC2, o)
+		if err != nil {
+			exitOnError(ctx, err)
+		}
+		images = append(images, found...)
+	}
+	selection, err := prune.Select(scheme, images, refs, *keep)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	snapshots := selection.Snapshots()
+
+	referenced := 0
+	for _, d := range selection.Kept {
+		if d.Reason == prune.ReasonReferenced {
+			referenced++
+		}
+	}
+	fmt.Fprintf(out, "📋 Keeping %d AMIs: %d of the newest %d versions per Kubernetes version and variant, %d still in use\n",
+		len(selection.Kept), len(selection.Kept)-referenced, *keep, referenced)
+	fmt.Fprintln(out)
+
+	if len(selection.Pruned) == 0 {
+		fmt.Fprintln(out, "✅ Nothing to prune")
+		return
+	}
+	printPrune(selection)
+	fmt.Fprintf(out, "🧹 %d AMIs and %d snapshots to remove\n", len(selection.Pruned), len(snapshots))
+
+	switch {
+	case *dryRun:
+		fmt.Fprintln(out, "Dry run: nothing was removed")
+		return
+	case *readOnly:
+		fmt.Fprintln(out, "🔒 Read-only mode: nothing was removed")
+		return
+	}
+
+	remover, ok := cs.EC2.(clients.ImageRemover)
+	if !ok {
+		fmt.Fprintln(errOut, "Error: the EC2 client cannot deregister images")
+		exit(exitFailure)
+	}
+	if !confirm(ctx, fmt.Sprintf("Deregister %d AMIs and delete %d snapshots?", len(selection.Pruned), len(snapshots))) {
+		if ctx.Err() != nil {
+			exitInterrupted(ctx)
+		}
+		fmt.Fprintln(out, "Cancelled")
+		exit(0)
+	}
+
+	if err := prune.Remove(ctx, remover, selection); err != nil {
+		exitOnError(ctx, err)
+	}
+	fmt.Fprintf(out, "✅ Removed %d AMIs and %d snapshots\n", len(selection.Pruned), len(snapshots))
+}
+
+// printPrune lists the AMIs to remove with their snapshots
+func printPrune(selection *prune.Selection) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "AMI\tNAME\tCREATED\tSNAPSHOTS")
+	for _, d := range selection.Pruned {
+		snapshots := strings.Join(d.AMI.Snapshots, ",")
+		if snapshots == "" {
+			snapshots = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", d.AMI.ImageID, d.AMI.Name, amis.FormatTime(d.AMI.CreationDate, displayLocation), snapshots)
+	}
+	tw.Flush()
+	fmt.Fprintln(out)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/report"
+)
+
+// runReport runs the report subcommand, whose only subcommand, diff, compares the JSON reports of two runs
+func runReport(ctx context.Context, args []string) {
+	if len(args) == 0 || args[0] != "diff" {
+		fmt.Fprintln(errOut, "Usage: upgrade-ami report diff [--output text|json] OLD.json NEW.json")
+		exit(exitFailure)
+	}
+	fs := flag.NewFlagSet("report diff", flag.ExitOnError)
+	outputFormat := fs.String("output", string(report.FormatText), "rendering of the comparison: text or json")
+	fs.Parse(args[1:])
+
+	format, err := report.ParseFormat(*outputFormat)
+	if err != nil {
+		fmt.Fprintf(errOut, "Error: %v\n", err)
+		exit(exitFailure)
+	}
+	if fs.NArg() != 2 {
+		fmt.Fprintln(errOut, "Error: report diff takes the old and the new report, e.g. upgrade-ami report diff q2.json q3.json")
+		exit(exitFailure)
+	}
+	old, err := report.ReadFile(fs.Arg(0))
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	r, err := report.ReadFile(fs.Arg(1))
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	if err := report.WriteDiff(out, format, report.Compare(old, r)); err != nil {
+		exitOnError(ctx, err)
+	}
+}
+
+// finishReport records when the run of r finished and, unless the run is replayed, the nodeclaims it left
+// behind. A fleet that can't be listed only warns, since the rest of the report stands.
+func finishReport(ctx context.Context, cs clients.Set, r *report.Report) {
+	r.FinishedAt = clock.Real.Now()
+	if replaying() {
+		return
+	}
+	statuses, err := nodeclasses.GetNodeClaimStatuses(ctx, cs.Kube, r.FinishedAt)
+	if err != nil {
+		fmt.Fprintf(errOut, "⚠️  The report has no fleet: %v\n", err)
+		return
+	}
+	r.Fleet = report.Fleet(statuses)
+}
+
+// writeReportFile writes the JSON report to path (--report-file), for report diff to compare later. Like
+// the output, the file has its secrets redacted, e.g. a token quoted in an apply error.
+func writeReportFile(path string, r *report.Report) {
+	if path == "" {
+		return
+	}
+	var b strings.Builder
+	err := report.WriteReport(&b, report.FormatJSON, r)
+	if err == nil {
+		err = os.WriteFile(path, []byte(redactor.Redact(b.String())), 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(errOut, "⚠️  Failed to write the report to %s: %v\n", path, err)
+		return
+	}
+	fmt.Fprintf(out, "📄 Report written to %s\n", path)
+}
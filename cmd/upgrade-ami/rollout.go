@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/config"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/confirmation"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/output"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/rollout"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/runstate"
+)
+
+// rolloutFlags are the flags spreading a plan over maintenance windows
+type rolloutFlags struct {
+	slices *int
+	window *string
+	daemon *bool
+	gate   *string
+}
+
+// Modes of --gate
+const (
+	gateNone   = "none"
+	gateManual = "manual"
+)
+
+// addRolloutFlags registers the flags spreading a plan over maintenance windows
+func addRolloutFlags(fs *flag.FlagSet) rolloutFlags {
+	return rolloutFlags{
+		slices: fs.Int("slices", 0, "split the plan's changes into this many slices and only apply the next one, e.g. 3 for a third of the nodeclasses per maintenance window (needs --plan)"),
+		window: fs.String("window", "", "only apply inside this daily maintenance window, local time, e.g. 22:00-04:00; outside it the run exits, or waits for it with --daemon"),
+		daemon: fs.Bool("daemon", false, "keep running, applying the next slice in each maintenance window until the whole plan is applied (needs --plan, --slices and --window)"),
+		gate:   fs.String("gate", gateNone, "with --daemon, what the next slice waits for once one is applied: none, or manual for an acknowledgement in the Slack channel of notifications.slack, or at the terminal without one"),
+	}
+}
+
+// check validates the combination of the flags, exiting on invalid ones, and returns the window if set
+func (f rolloutFlags) check(planFile string) *rollout.Window {
+	switch {
+	case *f.slices < 0:
+		fmt.Fprintln(errOut, "Error: --slices must be positive")
+		exit(exitFailure)
+	case *f.slices > 0 && planFile == "":
+		fmt.Fprintln(errOut, "Error: --slices needs --plan, so each slice resumes the same plan")
+		exit(exitFailure)
+	case *f.daemon && (*f.slices == 0 || *f.window == ""):
+		fmt.Fprintln(errOut, "Error: --daemon needs --plan, --slices and --window")
+		exit(exitFailure)
+	case *f.gate != gateNone && *f.gate != gateManual:
+		fmt.Fprintf(errOut, "Error: unknown --gate %q (want %s or %s)\n", *f.gate, gateNone, gateManual)
+		exit(exitFailure)
+	case *f.gate == gateManual && !*f.daemon:
+		fmt.Fprintln(errOut, "Error: --gate manual needs --daemon, which starts the slices it gates")
+		exit(exitFailure)
+	}
+	if *f.window == "" {
+		return nil
+	}
+	w, err := rollout.ParseWindow(*f.window)
+	if err != nil {
+		fmt.Fprintf(errOut, "Error: %v\n", err)
+		exit(exitFailure)
+	}
+	return &w
+}
+
+// checkWindow refuses to go on outside the maintenance window
+func checkWindow(ctx context.Context, w *rollout.Window) {
+	if w == nil {
+		return
+	}
+	now := clock.Real.Now()
+	if start, _ := w.Next(now); start.After(now) {
+		exitOnError(ctx, fmt.Errorf("%w %s; the next one opens %s", rollout.ErrOutsideWindow, w, start.Format("2006-01-02 15:04")))
+	}
+}
+
+// sliceRollout narrows the plan of sel to its next slice of changes, the whole plan file being split into
+// slices. It returns how many changes are left for later slices.
+func sliceRollout(ctx context.Context, sel *selection, runs *runstate.Store, slices int) int {
+	if runs == nil {
+		exitOnError(ctx, errors.New("--slices needs the run state to resume the next slice, which can't be kept"))
+	}
+	p := sel.plans[0]
+	size := rollout.SliceSize(sel.total, slices)
+	slice := rollout.Slice(p, size)
+	done := sel.total - len(p.Changes)
+	fmt.Fprintf(out, "📅 Slice %d of %d: applying %d of the %d remaining changes\n", done/size+1, slices, len(slice.Changes), len(p.Changes))
+	fmt.Fprintln(out)
+	// The run state covers the whole remainder, so it is kept until the last slice is applied
+	sel.tracked = sel.plans
+	sel.plans = []*plan.Plan{slice}
+	return len(p.Changes) - len(slice.Changes)
+}
+
+// runDaemon applies the plan file one slice per maintenance window until every change of it is applied.
+// Each slice is a run of its own, started with args less --daemon and --gate, so it is recorded, reported
+// and can be resumed like any other run. Each applied slice is announced to the configured notifications,
+// and with --gate manual the next one waits for an acknowledgement.
+func runDaemon(ctx context.Context, cs clients.Set, planFile, kubeContext string, opts rolloutFlags, w rollout.Window, args []string) {
+	if switcher, ok := cs.Kube.(clients.ContextSwitcher); ok && kubeContext != "" {
+		cs.Kube = switcher.WithContext(kubeContext)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		exitOnError(ctx, fmt.Errorf("failed to start the slices: %w", err))
+	}
+	args = withoutFlag(withoutFlag(args, "daemon", false), "gate", true)
+	cp := newCheckpoint(loadConfig().Notifications, *opts.gate == gateManual)
+
+	for {
+		before := planDiff(ctx, cs, planFile)
+		if before.Matches() {
+			fmt.Fprintln(out, "✅ Every change of the plan is applied")
+			return
+		}
+		start, end := w.Next(clock.Real.Now())
+		if wait := time.Until(start); wait > 0 {
+			fmt.Fprintf(out, "🌙 Waiting for the maintenance window %s, opening %s\n", w, start.Format("2006-01-02 15:04"))
+			sleepUntil(ctx, wait)
+		}
+
+		cmd := exec.CommandContext(ctx, exe, args...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		// Interrupt rather than kill the slice, so it winds down like a run cancelled at the terminal
+		cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+		err := cmd.Run()
+		if ctx.Err() != nil {
+			exitInterrupted(ctx)
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exit(exitErr.ExitCode())
+		}
+		if err != nil {
+			exitOnError(ctx, fmt.Errorf("failed to run slice: %w", err))
+		}
+
+		after := planDiff(ctx, cs, planFile)
+		cp.reached(ctx, cs, sliceApplied(before, after, *opts.slices))
+
+		// One slice per window: the next starts in the next window even if this one is still open
+		if after.Matches() {
+			continue
+		}
+		if wait := time.Until(end); wait > 0 {
+			fmt.Fprintf(out, "🌙 Slice applied; waiting for the window to close at %s\n", end.Format("2006-01-02 15:04"))
+			sleepUntil(ctx, wait)
+		}
+	}
+}
+
+// planDiff compares the plan file with the cluster
+func planDiff(ctx context.Context, cs clients.Set, path string) *plan.Diff {
+	p, err := readPlanFile(path)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	list, err := nodeclasses.GetEC2NodeClasses(ctx, cs.Kube)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	return p.Compare(list)
+}
+
+// checkpoint announces each applied slice of a --daemon rollout and, with --gate manual, waits for an
+// acknowledgement before the next one
+type checkpoint struct {
+	notifiers []confirmation.Notifier
+	gate      confirmation.Provider // nil unless the next slice is gated
+}
+
+// newCheckpoint creates the notifiers configured under notifications and, if gate is set, the provider
+// acknowledging the next slice: the Slack channel of the notifications, or the terminal without one
+func newCheckpoint(cfg config.Notifications, gate bool) checkpoint {
+	var cp checkpoint
+	if gate {
+		cp.gate = confirmation.TTY{In: os.Stdin, Out: out}
+	}
+	if cfg.Slack.Channel != "" {
+		slack := slackClient(cfg.Slack, "notifications")
+		cp.notifiers = append(cp.notifiers, slack)
+		if gate {
+			cp.gate = slack
+		}
+	}
+	if cfg.Webhook != "" {
+		cp.notifiers = append(cp.notifiers, confirmation.Webhook{URL: cfg.Webhook})
+	}
+	return cp
+}
+
+// boundary is a slice boundary of a --daemon rollout
+type boundary struct {
+	confirmation.Notification
+	next string // the question acknowledging the next slice; empty after the last one
+}
+
+// sliceApplied describes the slice applied between the before and after comparisons of the plan file,
+// which is split into slices
+func sliceApplied(before, after *plan.Diff, slices int) boundary {
+	total, applied := len(after.Entries), after.Count(plan.DiffApplied)
+	size := rollout.SliceSize(total, slices)
+	slice := min((applied+size-1)/max(size, 1), slices)
+
+	var b boundary
+	b.Title = fmt.Sprintf("Slice %d of %d applied: %d of %d changes done", slice, slices, applied, total)
+	var summary strings.Builder
+	for i, e := range after.Entries {
+		if e.Status == plan.DiffApplied && (i >= len(before.Entries) || before.Entries[i].Status != plan.DiffApplied) {
+			fmt.Fprintf(&summary, "%s: %s → %s\n", e.NodeClass, e.OldAMI, e.NewAMI)
+		}
+	}
+	b.Summary = summary.String()
+	if applied < total {
+		b.next = fmt.Sprintf("Start slice %d of %d (%d of %d changes left)?", slice+1, slices, total-applied, total)
+	}
+	return b
+}
+
+// reached sends the notifications of the boundary and, if the next slice is gated, waits for its
+// acknowledgement, exiting unless it is given. Notifications that fail are only warned about.
+func (c checkpoint) reached(ctx context.Context, cs clients.Set, b boundary) {
+	b.Cluster, _ = nodeclasses.CurrentContext(ctx, cs.Kube)
+	fmt.Fprintf(out, "📅 %s\n", b.Title)
+	emit(output.Event{Type: "slice", Message: b.Title, Data: b.Notification})
+	for _, n := range c.notifiers {
+		if err := n.Notify(ctx, b.Notification); err != nil {
+			fmt.Fprintf(errOut, "⚠️  %v\n", err)
+		}
+	}
+	if c.gate == nil || b.next == "" {
+		return
+	}
+	approve(ctx, c.gate, confirmation.Request{Question: b.next, Summary: b.Title + "\n" + b.Summary, Cluster: b.Cluster})
+}
+
+// sleepUntil waits for d, exiting when ctx is cancelled
+func sleepUntil(ctx context.Context, d time.Duration) {
+	select {
+	case <-clock.Real.After(d):
+	case <-ctx.Done():
+		exitInterrupted(ctx)
+	}
+}
+
+// withoutFlag returns args without the flag name, in any of its -name, --name and --name=value spellings.
+// The value of a flag that takes one may also be the next argument.
+func withoutFlag(args []string, name string, takesValue bool) []string {
+	var kept []string
+	for i := 0; i < len(args); i++ {
+		flagName, _, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !strings.HasPrefix(args[i], "-") || flagName != name {
+			kept = append(kept, args[i])
+			continue
+		}
+		if takesValue && !hasValue {
+			i++
+		}
+	}
+	return kept
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+)
+
+// diff compares a plan of the nodeclasses with the cluster, those in applied using their planned AMI
+func diff(nodeClasses []string, applied ...string) *plan.Diff {
+	d := &plan.Diff{}
+	for _, name := range nodeClasses {
+		e := plan.DiffEntry{NodeClass: name, Status: plan.DiffPending, OldAMI: "domino-eks-1.33-v20251001", NewAMI: "domino-eks-1.33-v20251101"}
+		if slices.Contains(applied, name) {
+			e.Status = plan.DiffApplied
+		}
+		d.Entries = append(d.Entries, e)
+	}
+	return d
+}
+
+func TestSliceApplied(t *testing.T) {
+	nodeClasses := []string{"a", "b", "c", "d", "e"}
+	tests := []struct {
+		name          string
+		before, after *plan.Diff
+		wantTitle     string
+		wantSummary   string
+		wantNext      string
+	}{
+		{
+			name:        "first slice",
+			before:      diff(nodeClasses),
+			after:       diff(nodeClasses, "a", "b"),
+			wantTitle:   "Slice 1 of 3 applied: 2 of 5 changes done",
+			wantSummary: "a: domino-eks-1.33-v20251001 → domino-eks-1.33-v20251101\nb: domino-eks-1.33-v20251001 → domino-eks-1.33-v20251101\n",
+			wantNext:    "Start slice 2 of 3 (3 of 5 changes left)?",
+		},
+		{
+			name:        "middle slice",
+			before:      diff(nodeClasses, "a", "b"),
+			after:       diff(nodeClasses, "a", "b", "c", "d"),
+			wantTitle:   "Slice 2 of 3 applied: 4 of 5 changes done",
+			wantSummary: "c: domino-eks-1.33-v20251001 → domino-eks-1.33-v20251101\nd: domino-eks-1.33-v20251001 → domino-eks-1.33-v20251101\n",
+			wantNext:    "Start slice 3 of 3 (1 of 5 changes left)?",
+		},
+		{
+			name:        "last slice",
+			before:      diff(nodeClasses, "a", "b", "c", "d"),
+			after:       diff(nodeClasses, nodeClasses...),
+			wantTitle:   "Slice 3 of 3 applied: 5 of 5 changes done",
+			wantSummary: "e: domino-eks-1.33-v20251001 → domino-eks-1.33-v20251101\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := sliceApplied(tt.before, tt.after, 3)
+			if b.Title != tt.wantTitle {
+				t.Errorf("title = %q, want %q", b.Title, tt.wantTitle)
+			}
+			if b.Summary != tt.wantSummary {
+				t.Errorf("summary = %q, want %q", b.Summary, tt.wantSummary)
+			}
+			if b.next != tt.wantNext {
+				t.Errorf("next = %q, want %q", b.next, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestWithoutFlag(t *testing.T) {
+	args := []string{"--plan", "plan.yaml", "--daemon", "--gate", "manual", "-slices=3", "--gate=none", "-daemon=true"}
+	got := withoutFlag(withoutFlag(args, "daemon", false), "gate", true)
+	if want := []string{"--plan", "plan.yaml", "-slices=3"}; !slices.Equal(got, want) {
+		t.Errorf("withoutFlag() = %q, want %q", got, want)
+	}
+}
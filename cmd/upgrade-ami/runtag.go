@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/output"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/runtag"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/upgrade"
+)
+
+// tagRun annotates the nodeclaims of the updated nodeclasses and their nodes with the run ID: the ones about
+// to be replaced right after applying, and their replacements once the rollout settled. Failures only warn,
+// since the annotations only help tracing the run afterwards.
+func tagRun(ctx context.Context, cs clients.Set, runID string, results []upgrade.ChangeResult, replacements bool) {
+	var updated []string
+	for _, r := range results {
+		if r.Applied && r.Err == nil {
+			updated = append(updated, r.NodeClass)
+		}
+	}
+	if len(updated) == 0 || ctx.Err() != nil {
+		return
+	}
+
+	result, err := runtag.New(cs.Kube).Tag(ctx, runID, updated)
+	if result != nil {
+		e := output.Event{Type: "tag", Message: fmt.Sprintf("%d nodeclaims and %d nodes annotated with run %s", len(result.NodeClaims), len(result.Nodes), runID), Data: result}
+		if err != nil {
+			e.Level = output.LevelWarn
+		}
+		emit(e)
+		if len(result.NodeClaims) > 0 {
+			which := "nodeclaims to replace"
+			if replacements {
+				which = "replacement nodeclaims"
+			}
+			fmt.Fprintf(out, "🏷️  Annotated %d %s and %d nodes with run %s\n", len(result.NodeClaims), which, len(result.Nodes), runID)
+		}
+	}
+	if err != nil && ctx.Err() == nil {
+		fmt.Fprintf(errOut, "⚠️  Failed to annotate the nodes of run %s: %v\n", runID, err)
+	}
+}
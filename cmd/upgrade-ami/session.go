@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients/fixture"
+)
+
+// replayingSession is set when the run replays a session archive (--replay)
+var replayingSession bool
+
+// replaying reports whether kubectl and aws output is replayed instead of coming from a cluster and AWS.
+// Nothing is changed then, and nothing the run learns is persisted as if it had happened.
+func replaying() bool {
+	return replayingSession || os.Getenv(envReplayFixtures) != ""
+}
+
+// sessionFlags record the cluster and AWS responses of a run into a session archive, or replay one
+type sessionFlags struct {
+	record *string
+	replay *string
+}
+
+// addSessionFlags registers the session flags on fs
+func addSessionFlags(fs *flag.FlagSet) sessionFlags {
+	return sessionFlags{
+		record: fs.String("record", "", "record every cluster and AWS response of this run into this session archive (.tar); the run goes through kubectl and the aws CLI, which must be on the PATH"),
+		replay: fs.String("replay", "", "re-run against the responses recorded in this session archive instead of the cluster and AWS"),
+	}
+}
+
+// clients returns clients that record into or replay from the session archive, or cs when neither flag
+// is set. Archives hold kubectl and aws invocations, so either flag swaps the client-go and aws-sdk-go-v2
+// clients of cs for the kubectl and aws CLI ones. A recording is archived on exit, so interrupted runs are
+// captured too.
+func (f sessionFlags) clients(cs clients.Set) clients.Set {
+	if *f.record == "" && *f.replay == "" {
+		return cs
+	}
+	if *f.record != "" && *f.replay != "" {
+		fmt.Fprintln(errOut, "Error: --record and --replay cannot be combined")
+		exit(exitFailure)
+	}
+	if *f.record != "" {
+		if err := checkRecordTools(); err != nil {
+			fmt.Fprintf(errOut, "Error: %v\n", err)
+			exit(exitToolNotFound)
+		}
+	}
+	dir, err := os.MkdirTemp("", "upgrade-ami-session-")
+	if err != nil {
+		fmt.Fprintf(errOut, "Error: failed to create session directory: %v\n", err)
+		exit(exitFailure)
+	}
+	onExit(func() { os.RemoveAll(dir) })
+
+	var exec clients.Executor
+	if *f.record != "" {
+		exec = fixture.NewRecorder(dir)
+		path := *f.record
+		onExit(func() {
+			if err := fixture.WriteArchive(dir, path); err != nil {
+				fmt.Fprintf(errOut, "⚠️  %v\n", err)
+				return
+			}
+			fmt.Fprintf(out, "📼 Session recorded to %s\n", path)
+		})
+	} else {
+		if err := fixture.ExtractArchive(*f.replay, dir); err != nil {
+			fmt.Fprintf(errOut, "Error: %v\n", err)
+			exit(exitFailure)
+		}
+		exec = fixture.NewPlayer(dir)
+		replayingSession = true
+		fmt.Fprintf(out, "📼 Replaying session %s: the cluster and AWS are not contacted\n", *f.replay)
+		fmt.Fprintln(out)
+	}
+	return clients.Set{
+		Kube: &clients.Kubectl{Exec: exec},
+		EC2:  &clients.AWSCLI{Exec: exec},
+	}
+}
+
+// recordTools are the binaries a recorded run calls the cluster and AWS through
+var recordTools = []string{"kubectl", "aws"}
+
+// checkRecordTools fails with clients.ErrToolNotFound unless every binary a recording runs is on the PATH, so a
+// missing one stops the run before anything is recorded rather than at its first call
+func checkRecordTools() error {
+	for _, name := range recordTools {
+		if _, err := exec.LookPath(name); err != nil {
+			return fmt.Errorf("%w: --record runs %s in place of the built-in clients, but it is not installed or not on your PATH", clients.ErrToolNotFound, name)
+		}
+	}
+	return nil
+}
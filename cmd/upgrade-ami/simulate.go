@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/history"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/naming"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/operator"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/report"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/simulate"
+)
+
+// runSimulate runs the simulate subcommand: it plans the upgrade to a version like plan does, then
+// estimates which nodeclaims the plans would replace and how long that would take from the NodePools'
+// disruption budgets and past runs. The clients are read-only whatever the flags, so nothing is changed.
+func runSimulate(ctx context.Context, cs clients.Set, args []string) {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	version := fs.String("target-version", "", "AMI version to simulate upgrading to, e.g. v20251001 (defaults to the newest approved version of each Kubernetes version)")
+	variant := fs.String("variant", "", "image variant to upgrade to: standard or fips (defaults to the variant the nodeclasses use)")
+	includeSkipped := fs.Bool("include-skipped", false, "plan nodeclasses annotated with upgrade-ami/skip: \"true\" like any other")
+	historyFile := fs.String("history-file", "", "history file to take past replacement times from (defaults to ~/.upgrade-ami/history.json)")
+	outputFormat := fs.String("output", string(report.FormatText), "rendering of the simulation: text or json")
+	pin := addPinFlag(fs)
+	awsOpts := addAWSFlags(fs)
+	fs.Parse(args)
+	cs = awsOpts.clients(cs)
+
+	format, err := report.ParseFormat(*outputFormat)
+	if err != nil {
+		fmt.Fprintf(errOut, "Error: %v\n", err)
+		exit(exitFailure)
+	}
+	cs = clients.ReadOnly(cs)
+
+	cfg := loadConfig()
+	planner := newPlanner(cs, cfg)
+	planner.IncludeSkipped = *includeSkipped
+	if *variant != "" {
+		v, err := naming.ParseVariant(*variant)
+		if err != nil {
+			fmt.Fprintf(errOut, "Error: %v\n", err)
+			exit(exitFailure)
+		}
+		planner.Variant = &v
+	}
+
+	discovery, err := planner.Discover(ctx)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	warnMixedOwners(discovery)
+	createdBy := operator.Resolve(ctx, cs).String()
+	// Simulating changes nothing, so a version that is not approved only warns
+	plans, k8sVersions := planChannels(ctx, planner, discovery, strings.TrimPrefix(*version, "v"), loadApprovals(ctx, cs, cfg), true, *pin, createdBy)
+
+	cluster, err := nodeclasses.CurrentContext(ctx, cs.Kube)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	statuses, byNode, pdbs, err := listDrainInputs(ctx, cs)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	pools, err := nodeclasses.GetNodePools(ctx, cs.Kube)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	// Without past runs the replacement time is assumed, so a missing history only warns
+	var runs []history.Run
+	path := *historyFile
+	if path == "" {
+		path, err = history.DefaultPath()
+	}
+	if err == nil {
+		runs, err = history.Load(path)
+	}
+	if err != nil {
+		fmt.Fprintf(errOut, "⚠️  Not using past replacement times: %v\n", err)
+	}
+
+	result := simulate.Simulate(simulate.Input{
+		Cluster:    cluster,
+		Plans:      plans,
+		Naming:     planner.Naming,
+		NodeClaims: statuses,
+		NodePools:  pools,
+		History:    runs,
+		Pods:       byNode,
+		PDBs:       pdbs,
+	})
+	if format == report.FormatText {
+		for i, p := range plans {
+			if len(plans) > 1 {
+				fmt.Fprintln(out, groupTitle(p, k8sVersions[i]))
+			}
+			writePlan(ctx, p, format, "", k8sVersions[i], len(plans) > 1)
+		}
+	}
+	if err := simulate.Write(out, format, result); err != nil {
+		exitOnError(ctx, err)
+	}
+}
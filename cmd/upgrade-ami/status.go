@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/report"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/status"
+)
+
+// runStatus runs the status subcommand, comparing the AMIs the nodeclasses select with the AMIs their nodes
+// run. It exits exitStaleNodes when a nodeclass's nodes never rolled to its selected AMIs.
+func runStatus(ctx context.Context, cs clients.Set, args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	outputFormat := fs.String("output", string(report.FormatText), "rendering of the status: text or json")
+	staleAfter := fs.Duration("stale-after", status.DefaultStaleAfter, "flag nodeclasses whose nodes still run other AMIs this long after being flagged as drifted")
+	awsOpts := addAWSFlags(fs)
+	fs.Parse(args)
+	cs = awsOpts.clients(cs)
+
+	format, err := report.ParseFormat(*outputFormat)
+	if err != nil {
+		fmt.Fprintf(errOut, "Error: %v\n", err)
+		exit(exitFailure)
+	}
+
+	st, err := status.Collect(ctx, cs, clock.Real.Now(), *staleAfter)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	for _, warning := range st.Warnings {
+		fmt.Fprintf(errOut, "⚠️  %s\n", warning)
+	}
+
+	if format == report.FormatJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(st); err != nil {
+			exitOnError(ctx, fmt.Errorf("failed to encode status: %w", err))
+		}
+	} else {
+		printStatus(st)
+	}
+
+	if len(st.Stale()) > 0 {
+		exit(exitStaleNodes)
+	}
+}
+
+// printStatus renders the status as a table, the AMIs outdated nodes run and a summary
+func printStatus(st *status.Status) {
+	fmt.Fprintf(out, "📊 Node AMIs of %s:\n\n", st.Cluster)
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODECLASS\tSTATE\tSELECTOR\tNODES\tOUTDATED\tDRIFTED SINCE")
+	for _, nc := range st.NodeClasses {
+		since := "-"
+		if !nc.DriftedSince.IsZero() {
+			since = formatAge(st.GeneratedAt.Sub(nc.DriftedSince)) + " ago"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\n", nc.Name, nc.State, nc.AMISelector, nc.Nodes, nc.Outdated, since)
+	}
+	tw.Flush()
+	fmt.Fprintln(out)
+
+	for _, nc := range st.NodeClasses {
+		if nc.Outdated == 0 {
+			continue
+		}
+		ids := make([]string, 0, len(nc.OutdatedAMIs))
+		for id := range nc.OutdatedAMIs {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			name := st.AMINames[id]
+			if name == "" {
+				name = "unknown AMI"
+			}
+			fmt.Fprintf(out, "  %s: %d nodes on %s (%s)\n", nc.Name, nc.OutdatedAMIs[id], id, name)
+		}
+		if nc.Undrifted > 0 {
+			fmt.Fprintf(out, "  %s: %d of them not flagged as drifted by Karpenter\n", nc.Name, nc.Undrifted)
+		}
+	}
+
+	if stale := st.Stale(); len(stale) > 0 {
+		fmt.Fprintf(out, "\n⚠️  Nodes never rolled to the selected AMIs (drifted over %s ago, or not flagged as drifted): %s\n", formatAge(st.StaleAfter), strings.Join(stale, ", "))
+	} else {
+		fmt.Fprintln(out, "✅ No stale nodeclasses")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+	"github.com/muesli/termenv"
+)
+
+// envASCII forces plain ASCII output, e.g. for consoles or log pipelines that mangle emoji
+const envASCII = "UPGRADE_AMI_ASCII"
+
+// terminal describes what the console attached to stdout can display
+type terminal struct {
+	output      *termenv.Output
+	interactive bool // stdout is a terminal that understands escape sequences, so the screen can be redrawn
+	unicode     bool // emoji and other non-ASCII symbols render
+}
+
+var term = detectTerminal()
+
+// detectTerminal inspects stdout and the environment. On Windows it switches the console to
+// escape sequence processing, restoring it on exit.
+func detectTerminal() terminal {
+	t := terminal{output: termenv.NewOutput(os.Stdout), unicode: unicodeSupported()}
+
+	if isatty.IsTerminal(os.Stdout.Fd()) && os.Getenv("TERM") != "dumb" {
+		restore, err := termenv.EnableVirtualTerminalProcessing(t.output)
+		if err == nil {
+			t.interactive = true
+			onExit(func() { restore() })
+		}
+	}
+	return t
+}
+
+// unicodeSupported guesses whether the console renders emoji, from the platform and locale
+func unicodeSupported() bool {
+	if os.Getenv(envASCII) != "" {
+		return false
+	}
+	switch os.Getenv("TERM") {
+	case "dumb", "linux": // the Linux virtual console has no emoji glyphs
+		return false
+	}
+
+	if runtime.GOOS == "windows" {
+		// The legacy console host can't render emoji; Windows Terminal and VS Code can
+		return os.Getenv("WT_SESSION") != "" || os.Getenv("TERM_PROGRAM") != ""
+	}
+
+	// The first locale variable that is set decides, as in setlocale(3)
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if locale := os.Getenv(name); locale != "" {
+			locale = strings.ToLower(locale)
+			return strings.Contains(locale, "utf-8") || strings.Contains(locale, "utf8")
+		}
+	}
+	return true
+}
+
+// clearScreen clears the terminal and moves the cursor to the top left
+func (t terminal) clearScreen() {
+	t.output.ClearScreen()
+}
+
+// writer returns w, translating symbols to ASCII if the console can't render them
+func (t terminal) writer(w io.Writer) io.Writer {
+	if t.unicode {
+		return w
+	}
+	return asciiWriter{w}
+}
+
+// asciiSymbols maps the symbols the CLI prints to ASCII stand-ins. Emoji with a variation
+// selector come before their bare form so the selector is replaced too.
+var asciiSymbols = strings.NewReplacer(
+	"⚠️", "[!]", "⚠", "[!]",
+	"✅", "[ok]", "❌", "[x]",
+	"🛑", "[x]", "🛡️", "*",
+	"⏭️", "[-]", "↩️", "<-", "↪️", ">>",
+	"⏱️", "*", "⬆️", "*", "⬇️", "*",
+	"🔍", "*", "🔒", "*", "📋", "*", "📊", "*", "📈", "*", "📉", "*", "📄", "*", "🕒", "*", "🔧", "*", "🚀", "*", "⏳", "*", "🔥", "*", "🧹", "*", "🤝", "*", "☸️", "*", "📦", "*", "📚", "*", "📼", "*", "🚧", "*", "🔁", "*", "🔀", "*", "👤", "*", "💬", "*", "🔑", "*", "📡", "*", "📌", "*", "🧪", "*", "📅", "*", "🌙", "*", "🏷️", "*",
+	"✓", "+", "·", "-", "→", "->", "█", "#", "─", "-",
+)
+
+// asciiWriter replaces non-ASCII symbols before writing
+type asciiWriter struct {
+	w io.Writer
+}
+
+func (a asciiWriter) Write(p []byte) (int, error) {
+	if _, err := asciiSymbols.WriteString(a.w, string(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// TestASCIISymbols checks that every string the CLI prints is plain ASCII once asciiSymbols has replaced
+// its symbols, so the ASCII fallback doesn't show mojibake on consoles without emoji
+func TestASCIISymbols(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	for _, path := range files {
+		if strings.HasSuffix(path, "_test.go") || path == "term.go" {
+			continue
+		}
+		f, err := parser.ParseFile(fset, path, nil, parser.SkipObjectResolution)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			lit, ok := n.(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return true
+			}
+			s, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				t.Fatalf("%s: %v", fset.Position(lit.Pos()), err)
+			}
+			replaced := asciiSymbols.Replace(s)
+			if i := strings.IndexFunc(replaced, func(r rune) bool { return r > unicode.MaxASCII }); i >= 0 {
+				symbol := []rune(replaced[i:])[0]
+				t.Errorf("%s: %q has no ASCII replacement in asciiSymbols", fset.Position(lit.Pos()), string(symbol))
+			}
+			return true
+		})
+	}
+}
+
+func TestASCIIWriter(t *testing.T) {
+	var b strings.Builder
+	w := asciiWriter{w: &b}
+	text := "↪️  Resuming: ⚠️ 2 → 3 ✅\n"
+	n, err := w.Write([]byte(text))
+	if err != nil || n != len(text) {
+		t.Fatalf("Write() = %d, %v; want %d", n, err, len(text))
+	}
+	if want := ">>  Resuming: [!] 2 -> 3 [ok]\n"; b.String() != want {
+		t.Errorf("wrote %q, want %q", b.String(), want)
+	}
+}
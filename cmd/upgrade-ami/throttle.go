@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/output"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/throttle"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/upgrade"
+)
+
+// newThrottle returns the throttle replacing the drifted nodeclaims of the updated nodeclasses up to
+// maxUnavailable at a time (--max-unavailable), or nil when the flag is off or nothing was updated
+func newThrottle(cs clients.Set, maxUnavailable int, results []upgrade.ChangeResult, since time.Time) *throttle.Throttle {
+	if maxUnavailable <= 0 {
+		return nil
+	}
+	var updated []string
+	for _, r := range results {
+		if r.Applied && r.Err == nil {
+			updated = append(updated, r.NodeClass)
+		}
+	}
+	if len(updated) == 0 {
+		return nil
+	}
+	fmt.Fprintf(out, "🔁 Replacing the drifted nodeclaims of %s, at most %d unavailable per nodeclass (--max-unavailable)\n", strings.Join(updated, ", "), maxUnavailable)
+	return throttle.New(cs.Kube, maxUnavailable, updated, since)
+}
+
+// stepThrottle deletes the drifted nodeclaims the throttle has room for after a poll. Failures only warn,
+// since Karpenter replaces drifted nodeclaims either way.
+func stepThrottle(ctx context.Context, t *throttle.Throttle, s upgrade.Snapshot) {
+	deleted, err := t.Step(ctx, s.Statuses)
+	if len(deleted) > 0 {
+		message := fmt.Sprintf("replacing %s", strings.Join(deleted, ", "))
+		fmt.Fprintf(out, "🔁 Replacing %s\n", strings.Join(deleted, ", "))
+		emit(output.Event{Time: s.At, Type: "replace", Message: message, Data: map[string]any{"nodeClaims": deleted, "maxUnavailable": t.MaxUnavailable}})
+	}
+	if err != nil && ctx.Err() == nil {
+		fmt.Fprintf(errOut, "⚠️  %v\n", err)
+		emit(output.Event{Time: s.At, Type: "replace", Level: output.LevelWarn, Message: err.Error()})
+	}
+}
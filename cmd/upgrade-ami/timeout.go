@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// runTimeout is the --timeout of the run, reported when it elapses
+	runTimeout time.Duration
+	// runDeadline is the context --timeout ends, to report a run that wound down after it elapsed
+	runDeadline = context.Background()
+)
+
+// splitTimeout takes the --timeout DURATION that bounds the whole run out of the command line args, where
+// it may be given before the subcommand (upgrade-ami --timeout 2h plan) or among its flags (upgrade-ami plan
+// --timeout 2h), and returns the other args. Args after a -- terminator are left alone, as are those of the
+// monitor subcommand, whose own --timeout only bounds the monitoring.
+func splitTimeout(args []string) ([]string, time.Duration, error) {
+	var rest []string
+	var timeout time.Duration
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || (arg == "monitor" && len(rest) == 0) {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "timeout" {
+			rest = append(rest, arg)
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(args) {
+				return nil, 0, errors.New("--timeout needs a duration, e.g. 2h")
+			}
+			i++
+			value = args[i]
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid --timeout %q: want a duration, e.g. 2h", value)
+		}
+		if d < 0 {
+			return nil, 0, fmt.Errorf("--timeout must not be negative, got %s", d)
+		}
+		timeout = d
+	}
+	return rest, timeout, nil
+}
+
+// withTimeout returns ctx cancelled once the --timeout of the run elapses, or ctx when there is no timeout
+func withTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	if timeout == 0 {
+		return ctx
+	}
+	runTimeout = timeout
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	onExit(cancel)
+	runDeadline = ctx
+	return ctx
+}
+
+// interrupted reports whether err ends a run cancelled by Ctrl+C, SIGTERM or its --timeout
+func interrupted(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// timedOut reports whether ctx ended because the --timeout of the run elapsed
+func timedOut(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
+
+// interruption describes why ctx ended, e.g. "Cancelled"
+func interruption(ctx context.Context) string {
+	if timedOut(ctx) {
+		return fmt.Sprintf("⏱️  Timed out after %s (--timeout)", runTimeout)
+	}
+	return "Cancelled"
+}
+
+// exitInterrupted exits a run whose ctx ended: with exitTimedOut when its --timeout elapsed and
+// exitCancelled after Ctrl+C or SIGTERM
+func exitInterrupted(ctx context.Context) {
+	fmt.Fprintln(out, interruption(ctx))
+	if timedOut(ctx) {
+		exit(exitTimedOut)
+	}
+	exit(exitCancelled)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSplitTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantArgs []string
+		want     time.Duration
+		wantErr  bool
+	}{
+		{"none", []string{"plan", "--version", "20251101"}, []string{"plan", "--version", "20251101"}, 0, false},
+		{"before the subcommand", []string{"--timeout", "2h", "plan"}, []string{"plan"}, 2 * time.Hour, false},
+		{"among the subcommand's flags", []string{"status", "-timeout=90s", "--output", "json"}, []string{"status", "--output", "json"}, 90 * time.Second, false},
+		{"upgrade without a subcommand", []string{"--plan", "plan.yaml", "--timeout=1h", "--daemon"}, []string{"--plan", "plan.yaml", "--daemon"}, time.Hour, false},
+		{"monitor's timeout is its own", []string{"monitor", "--until-clean", "--timeout", "1h"}, []string{"monitor", "--until-clean", "--timeout", "1h"}, 0, false},
+		{"before monitor", []string{"--timeout", "2h", "monitor", "--timeout", "1h"}, []string{"monitor", "--timeout", "1h"}, 2 * time.Hour, false},
+		{"upgrade flag value named monitor", []string{"--context", "monitor", "--timeout", "1h"}, []string{"--context", "monitor"}, time.Hour, false},
+		{"last one wins", []string{"--timeout", "1h", "plan", "--timeout", "30m"}, []string{"plan"}, 30 * time.Minute, false},
+		{"after the terminator", []string{"report", "--", "--timeout", "1h"}, []string{"report", "--", "--timeout", "1h"}, 0, false},
+		{"missing value", []string{"plan", "--timeout"}, nil, 0, true},
+		{"invalid", []string{"--timeout", "2 hours", "plan"}, nil, 0, true},
+		{"negative", []string{"--timeout=-1m"}, nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, timeout, err := splitTimeout(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitTimeout() error = %v, want error %v", err, tt.wantErr)
+			}
+			if timeout != tt.want || !slices.Equal(args, tt.wantArgs) {
+				t.Errorf("splitTimeout() = %q, %s; want %q, %s", args, timeout, tt.wantArgs, tt.want)
+			}
+		})
+	}
+}
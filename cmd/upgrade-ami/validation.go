@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/cadence"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/config"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/history"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/operator"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/output"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/upgrade"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/validation"
+)
+
+// validateFirst applies the version of the plans to the validation cluster, waits for the nodeclaims of the
+// nodeclasses it updates there to be replaced and runs the smoke test against it. It exits unless the smoke
+// test passes, so the plans are only applied to the cluster being upgraded once the version proved itself.
+func validateFirst(ctx context.Context, cs clients.Set, planner *upgrade.Planner, v config.Validation, plans []*plan.Plan, op operator.Operator, strategy cadence.Strategy) {
+	if replaying() {
+		fmt.Fprintln(out, "⏭️  Not validating a replayed rollout")
+		fmt.Fprintln(out)
+		return
+	}
+	version, err := validationVersion(plans)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	switcher, ok := cs.Kube.(clients.ContextSwitcher)
+	if !ok {
+		exitOnError(ctx, errors.New("validation needs a kubeconfig-backed Kubernetes client to reach the validation context"))
+	}
+	vcs := cs
+	vcs.Kube = switcher.WithContext(v.Context)
+	timeout := v.Timeout
+	if timeout <= 0 {
+		timeout = validation.DefaultTimeout
+	}
+
+	fmt.Fprintf(out, "🧪 Validating v%s on %s before applying it here...\n", version, v.Context)
+	vp := *planner
+	vp.Kube = vcs.Kube
+	discovery, err := vp.Discover(ctx)
+	if err != nil {
+		exitOnError(ctx, fmt.Errorf("%w on %s: %w", validation.ErrFailed, v.Context, err))
+	}
+	vplans, _ := planChannels(ctx, &vp, discovery, version, nil, false, "", op.String())
+
+	run := history.Run{Command: "validate", StartedAt: clock.Real.Now()}
+	run.ID = history.NewRunID(run.StartedAt)
+	applier := upgrade.NewApplier(vcs.Kube)
+	applier.Annotations = operatorAnnotations(op, run.ID)
+	results, err := applier.ApplyAll(ctx, vplans)
+	run.Changes = runChanges(vplans, results)
+	if err != nil {
+		recordRun(context.WithoutCancel(ctx), upgrade.NewMonitor(vcs), run, nil)
+		if ctx.Err() != nil {
+			exitOnError(ctx, err)
+		}
+		exitOnError(ctx, fmt.Errorf("%w: failed to update the nodeclasses of %s: %w", validation.ErrFailed, v.Context, err))
+	}
+	var updated []string
+	for _, r := range results {
+		if r.Applied {
+			updated = append(updated, r.NodeClass)
+		}
+	}
+	if len(updated) > 0 {
+		fmt.Fprintf(out, "✅ Updated %s on %s\n", strings.Join(updated, ", "), v.Context)
+		tagRun(ctx, vcs, run.ID, results, false)
+		fmt.Fprintf(out, "⏳ Waiting up to %s for their nodeclaims to be replaced...\n", timeout)
+		result, err := waitForReplacements(ctx, vcs, updated, run.StartedAt, timeout, strategy)
+		run.Monitored = true
+		recordRun(context.WithoutCancel(ctx), upgrade.NewMonitor(vcs), run, result)
+		if err != nil {
+			exitOnError(ctx, fmt.Errorf("%w on %s: %w", validation.ErrFailed, v.Context, err))
+		}
+		tagRun(ctx, vcs, run.ID, results, true)
+	} else {
+		fmt.Fprintf(out, "✅ %s already runs v%s\n", v.Context, version)
+	}
+
+	fmt.Fprintf(out, "🧪 Running the smoke test: %s\n", v.Command)
+	test := validation.SmokeTest{
+		Command: v.Command,
+		Env:     validation.Env(v.Context, version, run.ID),
+		Timeout: timeout,
+		Stdout:  out,
+		Stderr:  errOut,
+	}
+	err = test.Run(ctx)
+	e := output.Event{Type: "validation", Message: fmt.Sprintf("v%s passed the smoke test on %s", version, v.Context), Data: map[string]string{"context": v.Context, "version": version, "runID": run.ID}}
+	if err != nil {
+		e.Level, e.Message = output.LevelWarn, err.Error()
+	}
+	emit(e)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	fmt.Fprintf(out, "✅ v%s passed the smoke test on %s\n", version, v.Context)
+	fmt.Fprintln(out)
+}
+
+// validationVersion returns the version the plans upgrade to, which the validation cluster is upgraded to
+// first. Plans of a mixed cluster may move to different versions, which can't be validated as one.
+func validationVersion(plans []*plan.Plan) (string, error) {
+	var versions []string
+	for _, p := range plans {
+		if !slices.Contains(versions, p.Version) {
+			versions = append(versions, p.Version)
+		}
+	}
+	switch len(versions) {
+	case 0:
+		return "", errors.New("there is no version to validate")
+	case 1:
+		return versions[0], nil
+	}
+	return "", fmt.Errorf("the plans move to several versions (v%s) but the validation cluster can only try one; pass --target-version", strings.Join(versions, ", v"))
+}
+
+// waitForReplacements monitors the nodeclaims of the nodeclasses until every one of them was launched after
+// the apply, is ready and is not drifted, printing how many are left as that changes
+func waitForReplacements(ctx context.Context, cs clients.Set, nodeClasses []string, appliedAt time.Time, timeout time.Duration, strategy cadence.Strategy) (*upgrade.Result, error) {
+	rolled, stop := context.WithCancel(ctx)
+	defer stop()
+	deadline, cancel := context.WithTimeout(rolled, timeout)
+	defer cancel()
+
+	last := -1
+	opts := nodeclasses.MonitorOptions{Cadence: strategy, NodeClasses: nodeClasses}
+	result, err := upgrade.NewMonitor(cs).Run(deadline, opts, func(s upgrade.Snapshot) {
+		left := 0
+		for _, status := range s.Statuses {
+			if status.Drifted || status.Terminating || !status.Created.After(appliedAt) || !status.Conditions["Ready"] {
+				left++
+			}
+		}
+		if left != last {
+			fmt.Fprintf(out, "   %d of %d nodeclaims left to replace\n", left, len(s.Statuses))
+			last = left
+		}
+		if left == 0 {
+			stop()
+		}
+	})
+	switch {
+	case ctx.Err() != nil:
+		return result, ctx.Err()
+	case rolled.Err() != nil:
+		return result, nil
+	case deadline.Err() != nil:
+		return result, fmt.Errorf("the nodeclaims were not replaced within %s", timeout)
+	}
+	return result, err
+}
@@ -1,46 +1,54 @@
 package amis
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"os/exec"
-	"regexp"
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/naming"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/retry"
 )
 
+// ErrVersionNotFound is returned when no AMI version matches the requested criteria
+var ErrVersionNotFound = errors.New("no matching AMI versions found")
+
 // AMIInfo represents information about an AMI
 type AMIInfo struct {
 	Name         string
 	ImageID      string
 	CreationDate string
+	Tags         map[string]string
+	Snapshots    []string // IDs of the EBS snapshots backing the AMI
 }
 
-// GetAvailableAMIs retrieves all AMIs owned by the specified owner ID
-func GetAvailableAMIs(ownerID string) ([]AMIInfo, error) {
-	cmd := exec.Command("aws", "ec2", "describe-images",
-		"--owners", ownerID,
-		"--query", "Images[*].[Name,ImageId,CreationDate]",
-		"--output", "text",
-	)
+// describeRetryPolicy bounds the retries of the AMI query
+var describeRetryPolicy = retry.Default.WithBudget(time.Minute)
 
-	output, err := cmd.Output()
+// GetAvailableAMIs retrieves all AMIs owned by the specified owner ID, retrying throttling and transient failures
+func GetAvailableAMIs(ctx context.Context, ec2 clients.EC2Client, ownerID string) ([]AMIInfo, error) {
+	var images []clients.Image
+	err := retry.Do(ctx, describeRetryPolicy, func(ctx context.Context) error {
+		var err error
+		images, err = ec2.DescribeImages(ctx, ownerID)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get AMIs: %w", err)
 	}
 
 	var amis []AMIInfo
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-
-	for _, line := range lines {
-		parts := strings.Fields(line)
-		if len(parts) >= 3 {
-			amis = append(amis, AMIInfo{
-				Name:         parts[0],
-				ImageID:      parts[1],
-				CreationDate: parts[2],
-			})
-		}
+	for _, image := range images {
+		amis = append(amis, AMIInfo{
+			Name:         image.Name,
+			ImageID:      image.ImageID,
+			CreationDate: image.CreationDate,
+			Tags:         image.Tags,
+			Snapshots:    image.Snapshots,
+		})
 	}
 
 	return amis, nil
@@ -48,59 +56,114 @@ func GetAvailableAMIs(ownerID string) ([]AMIInfo, error) {
 
 // VersionItem represents a version with its creation date
 type VersionItem struct {
-	Version string
-	Date    string
+	Version      string
+	K8sVersion   string    // the Kubernetes version the AMIs are built for
+	Created      time.Time // creation date of the newest AMI of the version; zero if no date was recognized
+	CreationDate string    // the newest creation date as EC2 reported it
+	Images       []AMIInfo // the AMIs published for the version, one per nodegroup
+}
+
+// Key identifies the version among the versions of all Kubernetes versions, e.g. "1.33/20251001"
+func (v VersionItem) Key() string {
+	return v.K8sVersion + "/" + v.Version
+}
+
+// DateRange limits versions to those created within it, e.g. to versions old enough to have soaked.
+// Zero bounds are open.
+type DateRange struct {
+	Since time.Time // inclusive
+	Until time.Time // exclusive
+}
+
+// Contains reports whether t lies within the range
+func (r DateRange) Contains(t time.Time) bool {
+	return (r.Since.IsZero() || !t.Before(r.Since)) && (r.Until.IsZero() || t.Before(r.Until))
+}
+
+// bounded reports whether the range limits anything
+func (r DateRange) bounded() bool {
+	return !r.Since.IsZero() || !r.Until.IsZero()
 }
 
-// ExtractVersions filters AMIs and extracts unique versions for the given k8s version
-func ExtractVersions(amis []AMIInfo, k8sVersion string) ([]VersionItem, error) {
-	versionSet := make(map[string]string) // version -> date
-	patternWithNodegroup := regexp.MustCompile(`^domino-eks-.*-` + regexp.QuoteMeta(k8sVersion) + `-v([0-9]{8})$`)
-	patternWithoutNodegroup := regexp.MustCompile(`^domino-eks-` + regexp.QuoteMeta(k8sVersion) + `-v([0-9]{8})$`)
+// ExtractVersions filters AMIs named according to the naming scheme and extracts unique versions for the given
+// k8s version and image variant, newest first. An empty k8sVersion extracts the versions of every Kubernetes
+// version, grouped by Kubernetes version, newest first. Images of other variants are never offered, so a FIPS
+// cluster only sees FIPS versions and vice versa. Versions whose newest AMI was not created within dates are
+// left out, as are versions without a parseable creation date when dates is bounded.
+func ExtractVersions(scheme naming.Provider, amis []AMIInfo, k8sVersion, variant string, dates DateRange) ([]VersionItem, error) {
+	type groupKey struct{ k8sVersion, version string }
+	type creation struct {
+		time time.Time // zero if not recognized
+		raw  string
+	}
+	created := make(map[groupKey]creation) // most recent creation date
+	images := make(map[groupKey][]AMIInfo) // AMIs of the version
 
 	for _, ami := range amis {
-		// Try pattern with nodegroup first
-		matches := patternWithNodegroup.FindStringSubmatch(ami.Name)
-		if len(matches) != 2 {
-			// Try pattern without nodegroup
-			matches = patternWithoutNodegroup.FindStringSubmatch(ami.Name)
+		// Names that don't contain the k8s version can't match; skip them before running the regex
+		if !strings.Contains(ami.Name, k8sVersion) {
+			continue
+		}
+		fields, ok := scheme.Parse(ami.Name)
+		if !ok || fields.Variant != variant || fields.Version == "" {
+			continue
+		}
+		if k8sVersion != "" && fields.K8sVersion != k8sVersion {
+			continue
 		}
 
-		if len(matches) == 2 {
-			version := matches[1]
-			// Keep the most recent date for each version
-			if existingDate, exists := versionSet[version]; !exists || ami.CreationDate > existingDate {
-				versionSet[version] = ami.CreationDate
+		key := groupKey{fields.K8sVersion, fields.Version}
+		images[key] = append(images[key], ami)
+		// Keep the most recent date for each version; unrecognized dates only when no other is known
+		t, _ := ami.Created()
+		if existing, exists := created[key]; !exists || t.After(existing.time) ||
+			(existing.time.IsZero() && t.IsZero() && ami.CreationDate > existing.raw) {
+			created[key] = creation{t, ami.CreationDate}
+		}
+	}
+
+	if dates.bounded() {
+		for key, c := range created {
+			if c.time.IsZero() || !dates.Contains(c.time) {
+				delete(created, key)
 			}
 		}
 	}
 
-	if len(versionSet) == 0 {
-		return nil, fmt.Errorf("no matching AMI versions found")
+	if len(created) == 0 {
+		return nil, ErrVersionNotFound
 	}
 
-	// Convert to slice
-	var versionItems []VersionItem
-	for version, dateStr := range versionSet {
-		versionItems = append(versionItems, VersionItem{
-			Version: version,
-			Date:    ParseDate(dateStr),
+	// Parse each version once for sorting
+	type keyedItem struct {
+		key  versionKey
+		item VersionItem
+	}
+	keyed := make([]keyedItem, 0, len(created))
+	for group, c := range created {
+		keyed = append(keyed, keyedItem{
+			key: parseVersion(group.version),
+			item: VersionItem{
+				Version:      group.version,
+				K8sVersion:   group.k8sVersion,
+				Created:      c.time,
+				CreationDate: c.raw,
+				Images:       images[group],
+			},
 		})
 	}
 
-	// Sort by version descending
-	sort.Slice(versionItems, func(i, j int) bool {
-		return versionItems[i].Version > versionItems[j].Version
+	// Sort by Kubernetes version, then version, descending
+	sort.Slice(keyed, func(i, j int) bool {
+		if c := CompareK8sVersions(keyed[i].item.K8sVersion, keyed[j].item.K8sVersion); c != 0 {
+			return c > 0
+		}
+		return keyed[i].key.compare(keyed[j].key) > 0
 	})
 
-	return versionItems, nil
-}
-
-// ParseDate formats a date string
-func ParseDate(dateStr string) string {
-	t, err := time.Parse("2006-01-02T15:04:05.000Z", dateStr)
-	if err != nil {
-		return dateStr
+	versionItems := make([]VersionItem, len(keyed))
+	for i, k := range keyed {
+		versionItems[i] = k.item
 	}
-	return t.Format("2006-01-02 15:04")
+	return versionItems, nil
 }
@@ -0,0 +1,69 @@
+package amis
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/naming"
+)
+
+// benchmarkImages returns n AMIs like those of a busy image owner: several nodegroups, Kubernetes
+// versions and variants, date and semantic versions, and some names of other images
+func benchmarkImages(n int) []AMIInfo {
+	nodegroups := []string{"", "gpu", "gpu-large", "mem-opt-x2", "compute"}
+	k8sVersions := []string{"1.31", "1.32", "1.33", "1.34"}
+	variants := []string{"", "fips-"}
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	images := make([]AMIInfo, 0, n)
+	for i := 0; len(images) < n; i++ {
+		created := start.Add(time.Duration(i) * time.Hour)
+		var version string
+		if i%3 == 0 {
+			version = fmt.Sprintf("%d.%d.%d", i/1000, i/100%10, i%100)
+		} else {
+			version = created.Format("20060102")
+		}
+		prefix := "domino-eks-"
+		if ng := nodegroups[i%len(nodegroups)]; ng != "" {
+			prefix += ng + "-"
+		}
+		name := fmt.Sprintf("%s%s-%sv%s", prefix, k8sVersions[i%len(k8sVersions)], variants[i%7%len(variants)], version)
+		if i%11 == 0 {
+			name = fmt.Sprintf("amazon-eks-node-al2023-x86_64-standard-1.33-v%s", created.Format("20060102"))
+		}
+		images = append(images, AMIInfo{
+			Name:         name,
+			ImageID:      fmt.Sprintf("ami-%017x", i),
+			CreationDate: created.Format(time.RFC3339Nano),
+		})
+	}
+	return images
+}
+
+func BenchmarkExtractVersions(b *testing.B) {
+	images := benchmarkImages(50000)
+	recent := DateRange{Since: time.Date(2028, 6, 1, 0, 0, 0, 0, time.UTC)}
+	benchmarks := []struct {
+		name       string
+		k8sVersion string
+		variant    string
+		dates      DateRange
+	}{
+		{"OneK8sVersion", "1.33", naming.VariantStandard, DateRange{}},
+		{"AllK8sVersions", "", naming.VariantStandard, DateRange{}},
+		{"FIPS", "1.33", naming.VariantFIPS, DateRange{}},
+		{"DateRange", "1.33", naming.VariantStandard, recent},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := ExtractVersions(naming.Default, images, bm.k8sVersion, bm.variant, bm.dates); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
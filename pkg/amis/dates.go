@@ -0,0 +1,62 @@
+package amis
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dateLayouts are the timestamp formats AWS and AMI catalogs report creation dates in, tried in order.
+// Timestamps without a zone are UTC, as EC2 reports them.
+var dateLayouts = []string{
+	time.RFC3339Nano,                      // 2025-10-01T12:03:04.000Z, 2025-10-01T12:03:04+02:00
+	"2006-01-02T15:04:05.999999999Z0700",  // 2025-10-01T12:03:04.000+0000
+	"2006-01-02 15:04:05.999999999Z07:00", // 2025-10-01 12:03:04Z
+	"2006-01-02T15:04:05.999999999",       // 2025-10-01T12:03:04
+	"2006-01-02 15:04:05.999999999",       // 2025-10-01 12:03:04
+	"2006-01-02",                          // 2025-10-01
+}
+
+// DisplayLayout is the format dates are shown to the operator in, with the zone they are shown in
+const DisplayLayout = "2006-01-02 15:04 MST"
+
+// ParseTime parses a creation date in any of the RFC 3339 variants AWS reports, with or without fractional
+// seconds and zone
+func ParseTime(s string) (time.Time, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", s)
+}
+
+// FormatTime formats a creation date for display in loc, e.g. the operator's local time zone. Dates that
+// can't be parsed are shown as reported, marked as unrecognized.
+func FormatTime(s string, loc *time.Location) string {
+	if s == "" {
+		return "unknown"
+	}
+	t, err := ParseTime(s)
+	if err != nil {
+		return s + " (unrecognized date)"
+	}
+	return t.In(loc).Format(DisplayLayout)
+}
+
+// VersionDate returns the date a date-based version (e.g. "20251001") names, in UTC. Other versions, such
+// as semantic versions, name no date.
+func VersionDate(version string) (time.Time, bool) {
+	if parseVersion(version).rank != rankDate {
+		return time.Time{}, false
+	}
+	t, err := time.Parse("20060102", version)
+	return t, err == nil
+}
+
+// Created returns when the AMI was created, or false when EC2 reported no date the tool recognizes
+func (a AMIInfo) Created() (time.Time, bool) {
+	t, err := ParseTime(a.CreationDate)
+	return t, err == nil
+}
@@ -0,0 +1,143 @@
+package amis
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	datePattern   = regexp.MustCompile(`^[0-9]{8}$`)
+	semverPattern = regexp.MustCompile(`^([0-9]+)\.([0-9]+)\.([0-9]+)(?:-(.+))?$`)
+)
+
+// Version formats, in ascending sort order
+const (
+	rankOther = iota
+	rankDate
+	rankSemver
+)
+
+// versionKey is a version parsed for comparison, so sorting doesn't re-run the patterns per comparison
+type versionKey struct {
+	raw    string
+	rank   int
+	parts  [3]int // major, minor, patch of semantic versions
+	suffix string // pre-release or build suffix of semantic versions
+}
+
+// parseVersion classifies and parses a version for comparison
+func parseVersion(v string) versionKey {
+	if m := semverPattern.FindStringSubmatch(v); m != nil {
+		key := versionKey{raw: v, rank: rankSemver, suffix: m[4]}
+		for i := range key.parts {
+			key.parts[i], _ = strconv.Atoi(m[i+1])
+		}
+		return key
+	}
+	if datePattern.MatchString(v) {
+		return versionKey{raw: v, rank: rankDate}
+	}
+	return versionKey{raw: v, rank: rankOther}
+}
+
+// compare orders two parsed versions, returning -1, 0 or 1
+func (a versionKey) compare(b versionKey) int {
+	if a.rank != b.rank {
+		return compareInts(a.rank, b.rank)
+	}
+	if a.rank != rankSemver {
+		// Dates compare chronologically as strings
+		return strings.Compare(a.raw, b.raw)
+	}
+
+	for i := range a.parts {
+		if c := compareInts(a.parts[i], b.parts[i]); c != 0 {
+			return c
+		}
+	}
+	// A release sorts after its pre-releases
+	switch {
+	case a.suffix == b.suffix:
+		return 0
+	case a.suffix == "":
+		return 1
+	case b.suffix == "":
+		return -1
+	}
+	if c := comparePrerelease(a.suffix, b.suffix); c != 0 {
+		return c
+	}
+	// Suffixes differing only in build metadata still get a stable order
+	return strings.Compare(a.suffix, b.suffix)
+}
+
+// comparePrerelease orders pre-release suffixes by semver precedence, ignoring build metadata after
+// a "+": dot-separated identifiers compare one by one, numeric identifiers numerically and below
+// alphanumeric ones, and a shorter list of otherwise equal identifiers first (rc.2 < rc.10 < rc.10.1)
+func comparePrerelease(a, b string) int {
+	a, _, _ = strings.Cut(a, "+")
+	b, _, _ = strings.Cut(b, "+")
+	x, y := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(x) && i < len(y); i++ {
+		if c := compareIdentifiers(x[i], y[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(x), len(y))
+}
+
+// compareIdentifiers orders two pre-release identifiers, returning -1, 0 or 1
+func compareIdentifiers(a, b string) int {
+	x, errX := strconv.ParseUint(a, 10, 64)
+	y, errY := strconv.ParseUint(b, 10, 64)
+	switch {
+	case errX == nil && errY == nil:
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case errX == nil:
+		return -1
+	case errY == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// CompareVersions orders AMI versions, returning -1, 0 or 1. Date versions (20251001) compare
+// chronologically and semantic versions (1.4.2) numerically. Semantic versions sort after
+// dates since they come from the newer image pipeline; anything else compares as a string.
+func CompareVersions(a, b string) int {
+	return parseVersion(a).compare(parseVersion(b))
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// CompareK8sVersions orders Kubernetes versions such as 1.9 and 1.33 numerically, returning -1, 0 or 1
+func CompareK8sVersions(a, b string) int {
+	aMajor, aMinor, _ := strings.Cut(a, ".")
+	bMajor, bMinor, _ := strings.Cut(b, ".")
+	for _, pair := range [][2]string{{aMajor, bMajor}, {aMinor, bMinor}} {
+		x, errX := strconv.Atoi(pair[0])
+		y, errY := strconv.Atoi(pair[1])
+		if errX != nil || errY != nil {
+			return strings.Compare(a, b)
+		}
+		if c := compareInts(x, y); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
@@ -0,0 +1,85 @@
+package amis
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"20251001", "20251101", -1},
+		{"20251101", "20251101", 0},
+		{"1.4.2", "1.4.10", -1},
+		{"1.10.0", "1.9.9", 1},
+		{"2.0.0", "1.99.99", 1},
+		{"20251101", "1.0.0", -1},
+		{"latest", "20250101", -1},
+
+		// A release sorts after its pre-releases
+		{"1.4.2-rc.1", "1.4.2", -1},
+		{"1.4.2", "1.4.2-rc.1", 1},
+		{"1.4.2-rc.1", "1.4.1", 1},
+
+		// Numeric identifiers compare as numbers
+		{"1.4.2-rc.2", "1.4.2-rc.10", -1},
+		{"1.4.2-rc.10", "1.4.2-rc.2", 1},
+		{"1.4.2-9", "1.4.2-10", -1},
+
+		// Numeric identifiers rank below alphanumeric ones
+		{"1.4.2-1", "1.4.2-alpha", -1},
+		{"1.4.2-rc.1", "1.4.2-rc.beta", -1},
+		{"1.4.2-rc.beta", "1.4.2-rc.1", 1},
+
+		// Alphanumeric identifiers compare as strings
+		{"1.4.2-alpha", "1.4.2-beta", -1},
+		{"1.4.2-beta.2", "1.4.2-rc.1", -1},
+
+		// A longer list of otherwise equal identifiers sorts last
+		{"1.4.2-rc", "1.4.2-rc.1", -1},
+		{"1.4.2-rc.10", "1.4.2-rc.10.1", -1},
+
+		// Build metadata doesn't take precedence over the pre-release
+		{"1.4.2-rc.2+b9", "1.4.2-rc.10+b1", -1},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCompareVersionsSemverPrecedence(t *testing.T) {
+	// The precedence example of the semver specification, shuffled
+	want := []string{
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2",
+		"1.0.0-beta.11", "1.0.0-rc.1", "1.0.0",
+	}
+	got := []string{
+		"1.0.0-rc.1", "1.0.0-beta.11", "1.0.0", "1.0.0-alpha.beta", "1.0.0-beta.2",
+		"1.0.0-alpha", "1.0.0-beta", "1.0.0-alpha.1",
+	}
+	slices.SortFunc(got, CompareVersions)
+	if !slices.Equal(got, want) {
+		t.Errorf("sorted = %v, want %v", got, want)
+	}
+}
+
+func TestCompareK8sVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.9", "1.33", -1},
+		{"1.33", "1.33", 0},
+		{"1.34", "1.33", 1},
+		{"2.0", "1.99", 1},
+	}
+	for _, tt := range tests {
+		if got := CompareK8sVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareK8sVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
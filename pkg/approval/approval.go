@@ -0,0 +1,61 @@
+// Package approval reads the allow-list of AMI versions release engineering approved, which upgrades are
+// held to unless the approval is explicitly overridden
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/remote"
+)
+
+// ErrUnapproved is returned when an AMI version is not on the allow-list
+var ErrUnapproved = errors.New("AMI version is not approved")
+
+// List is the allow-list of approved AMI versions, e.g.
+//
+//	{"versions": ["20250901", "20251001"]}
+type List struct {
+	Versions []string `json:"versions"`
+
+	approved map[string]bool
+}
+
+// Parse decodes an allow-list document
+func Parse(data []byte) (*List, error) {
+	var l List
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("failed to parse approved versions: %w", err)
+	}
+	l.approved = make(map[string]bool, len(l.Versions))
+	for _, v := range l.Versions {
+		l.approved[strings.TrimPrefix(v, "v")] = true
+	}
+	return &l, nil
+}
+
+// Load fetches and decodes the allow-list at source (see remote.Fetch)
+func Load(ctx context.Context, reader clients.ObjectReader, source string) (*List, error) {
+	data, err := remote.Fetch(ctx, reader, source)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Approved reports whether the AMI version, with or without a "v" prefix, is on the allow-list
+func (l *List) Approved(version string) bool {
+	return l.approved[strings.TrimPrefix(version, "v")]
+}
+
+// Check fails with ErrUnapproved when the version is not on the allow-list
+func (l *List) Check(version string) error {
+	if !l.Approved(version) {
+		return ErrUnapproved
+	}
+	return nil
+}
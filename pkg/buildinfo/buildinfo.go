@@ -0,0 +1,73 @@
+// Package buildinfo identifies the build of the tool, so cluster changes can be tied to the exact binary that made them.
+//
+// Release builds set the variables with ldflags:
+//
+//	go build -ldflags "-X github.com/ddl-r-abdulaziz/upgrade-ami/pkg/buildinfo.Version=v1.2.3 \
+//	  -X github.com/ddl-r-abdulaziz/upgrade-ami/pkg/buildinfo.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/ddl-r-abdulaziz/upgrade-ami/pkg/buildinfo.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/upgrade-ami
+package buildinfo
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time with -ldflags "-X ..."
+var (
+	Version = "dev"
+	Commit  = ""
+	Date    = ""
+)
+
+// Info describes a build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	GoVersion string `json:"goVersion"`
+	Modified  bool   `json:"modified,omitempty"` // built from a working tree with uncommitted changes
+}
+
+// Get returns the build information, falling back to the VCS details Go embeds when ldflags were not set
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, Date: Date, GoVersion: runtime.Version()}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+
+	return info
+}
+
+// String formats the build information on one line, e.g. "v1.2.3 (commit 0123abc, built 2025-10-01T12:00:00Z, go1.24.4)"
+func (i Info) String() string {
+	commit := i.Commit
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	if commit == "" {
+		commit = "unknown"
+	}
+	if i.Modified {
+		commit += "-dirty"
+	}
+	date := i.Date
+	if date == "" {
+		date = "unknown"
+	}
+	return fmt.Sprintf("%s (commit %s, built %s, %s)", i.Version, commit, date, i.GoVersion)
+}
@@ -0,0 +1,179 @@
+// Package builds lists AMIs from the manifests an image pipeline publishes per build, e.g. to S3, in place of
+// ec2:DescribeImages. Each manifest names the image of one build, its ID per region, checksums and the
+// pipeline's test results, which are passed on as image tags so the picker can show them next to each
+// version.
+package builds
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/remote"
+)
+
+// ErrUnsupported is returned for the EC2 calls build manifests cannot answer
+var ErrUnsupported = errors.New("not available from build manifests")
+
+// Tags the images listed from manifests carry
+const (
+	TagTestStatus  = "upgrade-ami/test-status"  // Tests.Status
+	TagTestSummary = "upgrade-ami/test-summary" // Tests.Summary
+	TagTestURL     = "upgrade-ami/test-url"     // Tests.URL
+)
+
+// Test statuses with a meaning of their own; pipelines may report others, e.g. running
+const (
+	TestsPassed = "passed"
+	TestsFailed = "failed"
+)
+
+// fetchConcurrency bounds how many manifests are read at once
+const fetchConcurrency = 8
+
+// Manifest describes the image one build produced
+type Manifest struct {
+	Name      string            `json:"name"`      // AMI name, e.g. domino-eks-1.33-v20251001
+	CreatedAt time.Time         `json:"createdAt"` // when the build finished
+	AMIs      map[string]string `json:"amis"`      // region -> image ID
+	Checksums map[string]string `json:"checksums,omitempty"`
+	Tests     *Tests            `json:"tests,omitempty"` // nil when the pipeline reported none
+}
+
+// Tests are the results of the pipeline's tests of a build
+type Tests struct {
+	Status  string `json:"status"`            // passed, failed, or e.g. running
+	Summary string `json:"summary,omitempty"` // e.g. 412 passed, 0 failed
+	URL     string `json:"url,omitempty"`     // where the results are published
+}
+
+// Source lists the images of the build manifests at Location as an EC2Client. The manifests are read on
+// the first call and kept.
+type Source struct {
+	Location string // s3://bucket/prefix/ URL, or directory, holding one JSON manifest per build
+	Region   string // region whose image IDs are listed; manifests without one are left out
+	Reader   clients.ObjectReader
+	Lister   clients.ObjectLister
+
+	mu        sync.Mutex
+	manifests []Manifest
+}
+
+// Manifests returns the manifests at the location, reading them on the first call
+func (s *Source) Manifests(ctx context.Context) ([]Manifest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.manifests != nil {
+		return s.manifests, nil
+	}
+	manifests, err := Load(ctx, s.Reader, s.Lister, s.Location)
+	if err != nil {
+		return nil, err
+	}
+	s.manifests = manifests
+	return manifests, nil
+}
+
+// DescribeImages returns an image per manifest with an image ID in the region, whatever the owner: the
+// manifests are those of the pipeline the nodeclasses are upgraded from
+func (s *Source) DescribeImages(ctx context.Context, _ string) ([]clients.Image, error) {
+	manifests, err := s.Manifests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]clients.Image, 0, len(manifests))
+	for _, m := range manifests {
+		id, ok := m.AMIs[s.Region]
+		if !ok {
+			continue
+		}
+		image := clients.Image{
+			Name:         m.Name,
+			ImageID:      id,
+			CreationDate: m.CreatedAt.UTC().Format("2006-01-02T15:04:05.000Z"),
+		}
+		if m.Tests != nil {
+			image.Tags = map[string]string{TagTestStatus: m.Tests.Status}
+			if m.Tests.Summary != "" {
+				image.Tags[TagTestSummary] = m.Tests.Summary
+			}
+			if m.Tests.URL != "" {
+				image.Tags[TagTestURL] = m.Tests.URL
+			}
+		}
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+// DescribeInstanceStates fails: the manifests know nothing about instances
+func (s *Source) DescribeInstanceStates(context.Context, string, []string) (map[string]string, error) {
+	return nil, fmt.Errorf("describe instance states: %w", ErrUnsupported)
+}
+
+// Load reads the JSON manifests under location: the .json objects under an s3://bucket/prefix/ URL, read
+// through lister and reader, or the .json files of a directory. They are returned by name.
+func Load(ctx context.Context, reader clients.ObjectReader, lister clients.ObjectLister, location string) ([]Manifest, error) {
+	var paths []string
+	if strings.HasPrefix(location, "s3://") {
+		if lister == nil {
+			return nil, fmt.Errorf("failed to list build manifests at %s: the AWS client cannot list S3 objects", location)
+		}
+		urls, err := lister.ListObjects(ctx, location)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list build manifests at %s: %w", location, err)
+		}
+		for _, url := range urls {
+			if strings.HasSuffix(url, ".json") {
+				paths = append(paths, url)
+			}
+		}
+	} else {
+		matches, err := filepath.Glob(filepath.Join(location, "*.json"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list build manifests at %s: %w", location, err)
+		}
+		if _, err := os.Stat(location); err != nil {
+			return nil, fmt.Errorf("failed to list build manifests at %s: %w", location, err)
+		}
+		paths = matches
+	}
+
+	manifests := make([]Manifest, len(paths))
+	var g errgroup.Group
+	g.SetLimit(fetchConcurrency)
+	for i, path := range paths {
+		g.Go(func() error {
+			data, err := remote.Fetch(ctx, reader, path)
+			if err != nil {
+				return err
+			}
+			var m Manifest
+			if err := json.Unmarshal(data, &m); err != nil {
+				return fmt.Errorf("failed to parse build manifest %s: %w", path, err)
+			}
+			if m.Name == "" || len(m.AMIs) == 0 {
+				return fmt.Errorf("invalid build manifest %s: name and amis are required", path)
+			}
+			manifests[i] = m
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].Name < manifests[j].Name })
+	return manifests, nil
+}
@@ -0,0 +1,123 @@
+// Package cadence decides how often the drift monitor polls the API server: at a fixed interval,
+// backing off exponentially while nothing changes, or driven by a watch with a periodic resync.
+// Small clusters get snappy updates while large ones are not polled harder than needed.
+package cadence
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Strategy decides when to poll next. Strategies are stateless so one can drive several pollers.
+type Strategy interface {
+	// Next returns how long to wait before the next poll, given the previous wait (zero before the
+	// first one) and whether the last poll saw a change
+	Next(prev time.Duration, changed bool) time.Duration
+}
+
+// Fixed polls at a constant interval
+type Fixed struct {
+	Interval time.Duration
+}
+
+// Next returns the interval
+func (f Fixed) Next(time.Duration, bool) time.Duration { return f.Interval }
+
+// Exponential polls at Min after a change and backs off by Factor, up to Max, while nothing changes
+type Exponential struct {
+	Min    time.Duration
+	Max    time.Duration
+	Factor float64
+}
+
+// Next resets the delay after a change and grows it otherwise
+func (e Exponential) Next(prev time.Duration, changed bool) time.Duration {
+	if changed || prev == 0 {
+		return e.Min
+	}
+	return min(max(time.Duration(float64(prev)*e.Factor), e.Min), e.Max)
+}
+
+// Watch polls as soon as the watched nodeclaims change, but no more often than MinInterval, and every
+// Resync regardless, so missed watch events are eventually caught up. Clients that cannot watch
+// fall back to polling every Resync.
+type Watch struct {
+	MinInterval time.Duration
+	Resync      time.Duration
+}
+
+// Next returns the resync interval; watch events trigger earlier polls
+func (w Watch) Next(time.Duration, bool) time.Duration { return w.Resync }
+
+// Defaults used when a strategy is named without parameters
+const (
+	DefaultInterval    = 5 * time.Second
+	DefaultMaxInterval = time.Minute
+	DefaultResync      = 5 * time.Minute
+)
+
+// Parse builds a strategy from a spec:
+//
+//	fixed[:INTERVAL]          e.g. fixed:10s
+//	exponential[:MIN-MAX]     e.g. exponential:2s-1m, doubling while nothing changes
+//	watch[:RESYNC]            e.g. watch:5m
+func Parse(spec string) (Strategy, error) {
+	name, arg, hasArg := strings.Cut(spec, ":")
+	switch name {
+	case "fixed":
+		interval := DefaultInterval
+		if hasArg {
+			d, err := parseDuration(arg)
+			if err != nil {
+				return nil, err
+			}
+			interval = d
+		}
+		return Fixed{Interval: interval}, nil
+
+	case "exponential":
+		lo, hi := DefaultInterval, DefaultMaxInterval
+		if hasArg {
+			minArg, maxArg, ok := strings.Cut(arg, "-")
+			if !ok {
+				return nil, fmt.Errorf("invalid poll strategy %q: want exponential:MIN-MAX", spec)
+			}
+			var err error
+			if lo, err = parseDuration(minArg); err != nil {
+				return nil, err
+			}
+			if hi, err = parseDuration(maxArg); err != nil {
+				return nil, err
+			}
+			if hi < lo {
+				return nil, fmt.Errorf("invalid poll strategy %q: maximum is below minimum", spec)
+			}
+		}
+		return Exponential{Min: lo, Max: hi, Factor: 2}, nil
+
+	case "watch":
+		resync := DefaultResync
+		if hasArg {
+			d, err := parseDuration(arg)
+			if err != nil {
+				return nil, err
+			}
+			resync = d
+		}
+		return Watch{MinInterval: time.Second, Resync: resync}, nil
+	}
+	return nil, fmt.Errorf("unknown poll strategy %q (want fixed, exponential or watch)", spec)
+}
+
+// parseDuration parses a positive duration
+func parseDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid poll interval %q: %w", s, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid poll interval %q: must be positive", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,320 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/inspector2"
+	inspectortypes "github.com/aws/aws-sdk-go-v2/service/inspector2/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// instanceFilterSize is how many instance IDs are sent in one describe-instances filter; EC2 limits the
+// values of a filter to 200
+const instanceFilterSize = 200
+
+// AWS is an EC2Client that calls the AWS APIs with aws-sdk-go-v2, so the aws binary is not needed. It loads
+// the shared configuration the aws CLI would (environment, ~/.aws/config and credentials, instance roles) on
+// the first call.
+type AWS struct {
+	Region   string // region to call; the AWS environment's when empty
+	Profile  string // shared config profile to use; the AWS environment's when empty
+	readOnly bool   // mutating calls fail with ErrReadOnly
+
+	mu     sync.Mutex
+	config *aws.Config // nil until the first call
+}
+
+// NewAWS creates an aws-sdk-go-v2-backed EC2Client using the default AWS configuration
+func NewAWS() *AWS {
+	return &AWS{}
+}
+
+// WithAWS returns a client using region and profile, read-only if a is; empty values keep a's
+func (a *AWS) WithAWS(region, profile string) EC2Client {
+	c := &AWS{Region: a.Region, Profile: a.Profile, readOnly: a.readOnly}
+	if region != "" {
+		c.Region = region
+	}
+	if profile != "" {
+		c.Profile = profile
+	}
+	return c
+}
+
+// load reads the AWS configuration on the first call. A failed attempt is not kept, so a configuration fixed
+// in the meantime is picked up by the next call.
+func (a *AWS) load(ctx context.Context) (aws.Config, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.config != nil {
+		return *a.config, nil
+	}
+	var opts []func(*config.LoadOptions) error
+	if a.Region != "" {
+		opts = append(opts, config.WithRegion(a.Region))
+	}
+	if a.Profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(a.Profile))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	a.config = &cfg
+	return cfg, nil
+}
+
+// ec2 returns an EC2 API client
+func (a *AWS) ec2(ctx context.Context, optFns ...func(*ec2.Options)) (*ec2.Client, error) {
+	cfg, err := a.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ec2.NewFromConfig(cfg, optFns...), nil
+}
+
+// WhoAmI returns the ARN of the identity the AWS credentials belong to
+func (a *AWS) WhoAmI(ctx context.Context) (string, error) {
+	cfg, err := a.load(ctx)
+	if err != nil {
+		return "", err
+	}
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get caller identity: %w", err)
+	}
+	return aws.ToString(identity.Arn), nil
+}
+
+// DescribeImages returns all images owned by ownerID
+func (a *AWS) DescribeImages(ctx context.Context, ownerID string) ([]Image, error) {
+	client, err := a.ec2(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []Image
+	pages := ec2.NewDescribeImagesPaginator(client, &ec2.DescribeImagesInput{Owners: []string{ownerID}})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe images of %s: %w", ownerID, err)
+		}
+		for _, described := range page.Images {
+			images = append(images, image(described))
+		}
+	}
+	return images, nil
+}
+
+// image converts an EC2 image to an Image
+func image(described ec2types.Image) Image {
+	image := Image{
+		Name:         aws.ToString(described.Name),
+		ImageID:      aws.ToString(described.ImageId),
+		CreationDate: aws.ToString(described.CreationDate),
+	}
+	if len(described.Tags) > 0 {
+		image.Tags = make(map[string]string, len(described.Tags))
+		for _, tag := range described.Tags {
+			image.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+	}
+	for _, mapping := range described.BlockDeviceMappings {
+		if mapping.Ebs != nil && mapping.Ebs.SnapshotId != nil {
+			image.Snapshots = append(image.Snapshots, *mapping.Ebs.SnapshotId)
+		}
+	}
+	return image
+}
+
+// DescribeInstanceStates returns the state of each known instance in region
+func (a *AWS) DescribeInstanceStates(ctx context.Context, region string, instanceIDs []string) (map[string]string, error) {
+	client, err := a.ec2(ctx, func(o *ec2.Options) {
+		if region != "" {
+			o.Region = region
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	states := make(map[string]string)
+	for start := 0; start < len(instanceIDs); start += instanceFilterSize {
+		batch := instanceIDs[start:min(start+instanceFilterSize, len(instanceIDs))]
+		// Filter instead of InstanceIds so unknown (long terminated) instances don't fail the call
+		input := &ec2.DescribeInstancesInput{
+			Filters: []ec2types.Filter{{Name: aws.String("instance-id"), Values: batch}},
+		}
+		pages := ec2.NewDescribeInstancesPaginator(client, input)
+		for pages.HasMorePages() {
+			page, err := pages.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe instances in %s: %w", region, err)
+			}
+			for _, reservation := range page.Reservations {
+				for _, instance := range reservation.Instances {
+					if instance.InstanceId != nil && instance.State != nil {
+						states[*instance.InstanceId] = string(instance.State.Name)
+					}
+				}
+			}
+		}
+	}
+	return states, nil
+}
+
+// DeregisterImage deregisters the image
+func (a *AWS) DeregisterImage(ctx context.Context, imageID string) error {
+	if a.readOnly {
+		return fmt.Errorf("%w: deregister-image", ErrReadOnly)
+	}
+	client, err := a.ec2(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := client.DeregisterImage(ctx, &ec2.DeregisterImageInput{ImageId: aws.String(imageID)}); err != nil {
+		return fmt.Errorf("failed to deregister image %s: %w", imageID, err)
+	}
+	return nil
+}
+
+// DeleteSnapshot deletes the snapshot
+func (a *AWS) DeleteSnapshot(ctx context.Context, snapshotID string) error {
+	if a.readOnly {
+		return fmt.Errorf("%w: delete-snapshot", ErrReadOnly)
+	}
+	client, err := a.ec2(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := client.DeleteSnapshot(ctx, &ec2.DeleteSnapshotInput{SnapshotId: aws.String(snapshotID)}); err != nil {
+		return fmt.Errorf("failed to delete snapshot %s: %w", snapshotID, err)
+	}
+	return nil
+}
+
+// ShareImage adds launch permissions for the accounts to the image
+func (a *AWS) ShareImage(ctx context.Context, imageID string, accounts []string) error {
+	if a.readOnly {
+		return fmt.Errorf("%w: modify-image-attribute", ErrReadOnly)
+	}
+	client, err := a.ec2(ctx)
+	if err != nil {
+		return err
+	}
+	permissions := &ec2types.LaunchPermissionModifications{}
+	for _, account := range accounts {
+		permissions.Add = append(permissions.Add, ec2types.LaunchPermission{UserId: aws.String(account)})
+	}
+	_, err = client.ModifyImageAttribute(ctx, &ec2.ModifyImageAttributeInput{
+		ImageId:          aws.String(imageID),
+		LaunchPermission: permissions,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to share image %s: %w", imageID, err)
+	}
+	return nil
+}
+
+// ReadObject downloads the S3 object
+func (a *AWS) ReadObject(ctx context.Context, url string) ([]byte, error) {
+	bucket, key, err := parseS3URL(url)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return nil, fmt.Errorf("invalid S3 URL %q (want s3://bucket/key)", url)
+	}
+	cfg, err := a.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	object, err := s3.NewFromConfig(cfg).GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", url, err)
+	}
+	defer object.Body.Close()
+	data, err := io.ReadAll(object.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", url, err)
+	}
+	return data, nil
+}
+
+// ListObjects lists the keys under the prefix, paging through them all
+func (a *AWS) ListObjects(ctx context.Context, prefix string) ([]string, error) {
+	bucket, keyPrefix, err := parseS3URL(prefix)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := a.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(keyPrefix)}
+	pages := s3.NewListObjectsV2Paginator(s3.NewFromConfig(cfg), input)
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", prefix, err)
+		}
+		for _, object := range page.Contents {
+			urls = append(urls, "s3://"+bucket+"/"+aws.ToString(object.Key))
+		}
+	}
+	return urls, nil
+}
+
+// parseS3URL splits an s3://bucket/key URL into its bucket and key
+func parseS3URL(url string) (bucket, key string, err error) {
+	bucket, key, _ = strings.Cut(strings.TrimPrefix(url, "s3://"), "/")
+	if !strings.HasPrefix(url, "s3://") || bucket == "" {
+		return "", "", fmt.Errorf("invalid S3 URL %q (want s3://bucket/prefix)", url)
+	}
+	return bucket, key, nil
+}
+
+// AMIFindings returns Inspector's active finding counts per AMI, aggregated over the instances launched from it
+func (a *AWS) AMIFindings(ctx context.Context) (map[string]SeverityCounts, error) {
+	cfg, err := a.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	findings := make(map[string]SeverityCounts)
+	input := &inspector2.ListFindingAggregationsInput{AggregationType: inspectortypes.AggregationTypeAmi}
+	pages := inspector2.NewListFindingAggregationsPaginator(inspector2.NewFromConfig(cfg), input)
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list Inspector findings by AMI: %w", err)
+		}
+		for _, response := range page.Responses {
+			member, ok := response.(*inspectortypes.AggregationResponseMemberAmiAggregation)
+			if !ok {
+				return nil, fmt.Errorf("%w: list-finding-aggregations: %T instead of an AMI aggregation", ErrUnexpectedSchema, response)
+			}
+			agg := member.Value
+			var counts SeverityCounts
+			if agg.SeverityCounts != nil {
+				counts.Critical = int(aws.ToInt64(agg.SeverityCounts.Critical))
+				counts.High = int(aws.ToInt64(agg.SeverityCounts.High))
+			}
+			findings[aws.ToString(agg.Ami)] = counts
+		}
+	}
+	return findings, nil
+}
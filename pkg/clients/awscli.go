@@ -0,0 +1,212 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// AWSCLI is an EC2Client that shells out to the aws binary
+type AWSCLI struct {
+	Exec    Executor
+	Region  string // --region of every command that doesn't name one; the AWS environment's when empty
+	Profile string // --profile of every command; the AWS environment's when empty
+}
+
+// NewAWSCLI creates an aws CLI-backed EC2Client that runs aws as a local process
+func NewAWSCLI() *AWSCLI {
+	return &AWSCLI{Exec: OSExecutor{}}
+}
+
+// WithAWS returns a client using region and profile; empty values keep a's
+func (a *AWSCLI) WithAWS(region, profile string) EC2Client {
+	c := *a
+	if region != "" {
+		c.Region = region
+	}
+	if profile != "" {
+		c.Profile = profile
+	}
+	return &c
+}
+
+// run executes aws with args, followed by the region and profile options when they are set
+func (a *AWSCLI) run(ctx context.Context, args ...string) ([]byte, error) {
+	if a.Region != "" && !slices.Contains(args, "--region") {
+		args = append(args, "--region", a.Region)
+	}
+	if a.Profile != "" {
+		args = append(args, "--profile", a.Profile)
+	}
+	return a.Exec.Output(ctx, Command{Name: "aws", Args: args})
+}
+
+// WhoAmI returns the ARN of the identity the AWS credentials belong to
+func (a *AWSCLI) WhoAmI(ctx context.Context) (string, error) {
+	output, err := a.run(ctx, "sts", "get-caller-identity", "--query", "Arn", "--output", "text")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// DescribeImages returns all images owned by ownerID
+func (a *AWSCLI) DescribeImages(ctx context.Context, ownerID string) ([]Image, error) {
+	output, err := a.run(ctx, "ec2", "describe-images",
+		"--owners", ownerID,
+		"--query", "Images[*].{Name:Name,ImageId:ImageId,CreationDate:CreationDate,Tags:Tags,Snapshots:BlockDeviceMappings[].Ebs.SnapshotId}",
+		"--output", "json",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var described []struct {
+		Name         string `json:"Name"`
+		ImageID      string `json:"ImageId"`
+		CreationDate string `json:"CreationDate"`
+		Tags         []struct {
+			Key   string `json:"Key"`
+			Value string `json:"Value"`
+		} `json:"Tags"`
+		Snapshots []string `json:"Snapshots"`
+	}
+	if err := json.Unmarshal(output, &described); err != nil {
+		return nil, fmt.Errorf("%w: describe-images: %v", ErrUnexpectedSchema, err)
+	}
+
+	images := make([]Image, 0, len(described))
+	for _, d := range described {
+		image := Image{Name: d.Name, ImageID: d.ImageID, CreationDate: d.CreationDate, Snapshots: d.Snapshots}
+		if len(d.Tags) > 0 {
+			image.Tags = make(map[string]string, len(d.Tags))
+			for _, tag := range d.Tags {
+				image.Tags[tag.Key] = tag.Value
+			}
+		}
+		images = append(images, image)
+	}
+
+	return images, nil
+}
+
+// DescribeInstanceStates returns the state of each known instance in region
+func (a *AWSCLI) DescribeInstanceStates(ctx context.Context, region string, instanceIDs []string) (map[string]string, error) {
+	// Filter instead of --instance-ids so unknown (long terminated) instances don't fail the call
+	output, err := a.run(ctx, "ec2", "describe-instances",
+		"--region", region,
+		"--filters", "Name=instance-id,Values="+strings.Join(instanceIDs, ","),
+		"--query", "Reservations[*].Instances[*].[InstanceId,State.Name]",
+		"--output", "text",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		parts := strings.Fields(line)
+		if len(parts) >= 2 {
+			states[parts[0]] = parts[1]
+		}
+	}
+	return states, nil
+}
+
+// DeregisterImage deregisters the image
+func (a *AWSCLI) DeregisterImage(ctx context.Context, imageID string) error {
+	_, err := a.run(ctx, "ec2", "deregister-image", "--image-id", imageID)
+	return err
+}
+
+// DeleteSnapshot deletes the snapshot
+func (a *AWSCLI) DeleteSnapshot(ctx context.Context, snapshotID string) error {
+	_, err := a.run(ctx, "ec2", "delete-snapshot", "--snapshot-id", snapshotID)
+	return err
+}
+
+// ShareImage adds launch permissions for the accounts to the image
+func (a *AWSCLI) ShareImage(ctx context.Context, imageID string, accounts []string) error {
+	type userID struct {
+		UserID string `json:"UserId"`
+	}
+	permission := struct {
+		Add []userID `json:"Add"`
+	}{}
+	for _, account := range accounts {
+		permission.Add = append(permission.Add, userID{account})
+	}
+	data, err := json.Marshal(permission)
+	if err != nil {
+		return fmt.Errorf("failed to encode launch permission: %w", err)
+	}
+	_, err = a.run(ctx, "ec2", "modify-image-attribute", "--image-id", imageID, "--launch-permission", string(data))
+	return err
+}
+
+// ReadObject downloads the S3 object to stdout
+func (a *AWSCLI) ReadObject(ctx context.Context, url string) ([]byte, error) {
+	return a.run(ctx, "s3", "cp", url, "-")
+}
+
+// ListObjects lists the keys under the prefix with list-objects-v2, which pages through them all
+func (a *AWSCLI) ListObjects(ctx context.Context, prefix string) ([]string, error) {
+	bucket, keyPrefix, err := parseS3URL(prefix)
+	if err != nil {
+		return nil, err
+	}
+	output, err := a.run(ctx, "s3api", "list-objects-v2",
+		"--bucket", bucket,
+		"--prefix", keyPrefix,
+		"--query", "Contents[].Key",
+		"--output", "json",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	if err := json.Unmarshal(output, &keys); err != nil {
+		return nil, fmt.Errorf("%w: list-objects-v2: %v", ErrUnexpectedSchema, err)
+	}
+	urls := make([]string, 0, len(keys))
+	for _, key := range keys {
+		urls = append(urls, "s3://"+bucket+"/"+key)
+	}
+	return urls, nil
+}
+
+// AMIFindings returns Inspector's active finding counts per AMI, aggregated over the instances launched from it
+func (a *AWSCLI) AMIFindings(ctx context.Context) (map[string]SeverityCounts, error) {
+	output, err := a.run(ctx, "inspector2", "list-finding-aggregations",
+		"--aggregation-type", "AMI",
+		"--output", "json",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var aggregations struct {
+		Responses []struct {
+			AMIAggregation struct {
+				AMI            string `json:"ami"`
+				SeverityCounts struct {
+					Critical int `json:"critical"`
+					High     int `json:"high"`
+				} `json:"severityCounts"`
+			} `json:"amiAggregation"`
+		} `json:"responses"`
+	}
+	if err := json.Unmarshal(output, &aggregations); err != nil {
+		return nil, fmt.Errorf("%w: list-finding-aggregations: %v", ErrUnexpectedSchema, err)
+	}
+
+	findings := make(map[string]SeverityCounts, len(aggregations.Responses))
+	for _, r := range aggregations.Responses {
+		agg := r.AMIAggregation
+		findings[agg.AMI] = SeverityCounts{Critical: agg.SeverityCounts.Critical, High: agg.SeverityCounts.High}
+	}
+	return findings, nil
+}
@@ -0,0 +1,149 @@
+package clients
+
+import (
+	"context"
+	"io"
+)
+
+// ListOptions narrows down a list request
+type ListOptions struct {
+	AllNamespaces bool
+	FieldSelector string // e.g. "spec.nodeName=ip-10-0-0-1"
+}
+
+// KubeClient provides access to the Kubernetes resources the tool reads and writes.
+// Objects are exchanged as JSON so that callers own the decoding of the fields they need.
+type KubeClient interface {
+	// Get returns a single object of the given resource type (e.g. "ec2nodeclass") as JSON
+	Get(ctx context.Context, resource, name string) ([]byte, error)
+	// List streams a list ({"items": [...]}) of the given resource type as JSON; decode it with DecodeItems.
+	// Errors that happen while streaming are reported by Close.
+	List(ctx context.Context, resource string, opts ListOptions) (io.ReadCloser, error)
+	// Apply creates or updates the object described by the JSON manifest
+	Apply(ctx context.Context, manifest []byte) error
+	// GetRaw performs a GET request against a raw API server path
+	GetRaw(ctx context.Context, path string) ([]byte, error)
+	// CurrentContext returns the name of the kubeconfig context in use
+	CurrentContext(ctx context.Context) (string, error)
+}
+
+// Watcher is implemented by KubeClients that can watch a resource type for changes
+type Watcher interface {
+	// Watch streams a JSON object per change to objects of the given resource type, until ctx is cancelled
+	// or the server ends the watch. Errors that happen while streaming are reported by Close.
+	Watch(ctx context.Context, resource string) (io.ReadCloser, error)
+}
+
+// Deleter is implemented by KubeClients that can delete objects
+type Deleter interface {
+	// Delete removes the named object of the given resource type without waiting for it to be gone.
+	// Deleting an object that does not exist is not an error.
+	Delete(ctx context.Context, resource, name string) error
+}
+
+// Cordoner is implemented by KubeClients that can mark nodes unschedulable
+type Cordoner interface {
+	// Cordon marks the node unschedulable, so no new pods are placed on it; its running pods stay
+	Cordon(ctx context.Context, node string) error
+}
+
+// Annotator is implemented by KubeClients that can annotate objects
+type Annotator interface {
+	// Annotate sets the annotations on the named object of the given resource type, overwriting their
+	// values if they are set already; its other annotations stay
+	Annotate(ctx context.Context, resource, name string, annotations map[string]string) error
+}
+
+// ContextSwitcher is implemented by KubeClients that can reach the clusters of the other contexts of the
+// kubeconfig
+type ContextSwitcher interface {
+	// WithContext returns a client of the same kind for the cluster of the named context
+	WithContext(name string) KubeClient
+	// Contexts lists the contexts of the kubeconfig
+	Contexts(ctx context.Context) ([]KubeContext, error)
+}
+
+// Identifier is implemented by clients that can tell whom the cluster or AWS authenticates them as
+type Identifier interface {
+	// WhoAmI returns the authenticated identity: the Kubernetes username, or the caller's ARN for AWS
+	WhoAmI(ctx context.Context) (string, error)
+}
+
+// Image describes an EC2 machine image
+type Image struct {
+	Name         string
+	ImageID      string
+	CreationDate string
+	Tags         map[string]string
+	Snapshots    []string // IDs of the EBS snapshots backing the image
+}
+
+// EC2Client provides access to the EC2 APIs the tool uses
+type EC2Client interface {
+	// DescribeImages returns all images owned by the given owner ID
+	DescribeImages(ctx context.Context, ownerID string) ([]Image, error)
+	// DescribeInstanceStates returns the state name of each known instance in region by ID
+	DescribeInstanceStates(ctx context.Context, region string, instanceIDs []string) (map[string]string, error)
+}
+
+// AWSSelector is implemented by EC2Clients that can call AWS with another region or profile than the AWS
+// environment names
+type AWSSelector interface {
+	// WithAWS returns a client of the same kind using the region and profile; empty values keep the client's
+	WithAWS(region, profile string) EC2Client
+}
+
+// SeverityCounts are the numbers of vulnerability findings by severity
+type SeverityCounts struct {
+	Critical int
+	High     int
+}
+
+// FindingsScanner is implemented by EC2Clients that can report Amazon Inspector findings per AMI
+type FindingsScanner interface {
+	// AMIFindings returns the active finding counts of every AMI Inspector has findings for, by image ID
+	AMIFindings(ctx context.Context) (map[string]SeverityCounts, error)
+}
+
+// ImageRemover is implemented by EC2Clients that can delete images
+type ImageRemover interface {
+	// DeregisterImage deregisters the image; its snapshots are kept
+	DeregisterImage(ctx context.Context, imageID string) error
+	// DeleteSnapshot deletes an EBS snapshot
+	DeleteSnapshot(ctx context.Context, snapshotID string) error
+}
+
+// ImageSharer is implemented by EC2Clients that can share images with other accounts
+type ImageSharer interface {
+	// ShareImage grants the accounts launch permission on the image; accounts that have it already keep it
+	ShareImage(ctx context.Context, imageID string, accounts []string) error
+}
+
+// ObjectReader is implemented by EC2Clients that can also read S3 objects, e.g. documents the tool is
+// configured to fetch from a bucket
+type ObjectReader interface {
+	// ReadObject returns the content of the object at an s3://bucket/key URL
+	ReadObject(ctx context.Context, url string) ([]byte, error)
+}
+
+// ObjectLister is implemented by EC2Clients that can also list S3 objects, e.g. the build manifests an image
+// pipeline publishes
+type ObjectLister interface {
+	// ListObjects returns the s3://bucket/key URLs of the objects under an s3://bucket/prefix URL
+	ListObjects(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Set bundles the clients used by the tool
+type Set struct {
+	Kube KubeClient
+	EC2  EC2Client
+}
+
+// Default returns clients talking to the API server with client-go and calling the AWS APIs with
+// aws-sdk-go-v2. The kubectl-backed client is opt-in, see NewKubectl.
+func Default() Set {
+	return Set{
+		Kube: NewKubernetes(),
+		EC2:  NewAWS(),
+	}
+}
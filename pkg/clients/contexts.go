@@ -0,0 +1,72 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// KubeContext is a context of the kubeconfig
+type KubeContext struct {
+	Name    string
+	Cluster string // name of the cluster entry the context uses
+	Server  string // API server URL of the cluster
+	Current bool   // the kubeconfig's current context
+}
+
+// kubeconfig is the part of kubectl config view's output that describes contexts
+type kubeconfig struct {
+	CurrentContext string `json:"current-context"`
+	Contexts       []struct {
+		Name    string `json:"name"`
+		Context struct {
+			Cluster string `json:"cluster"`
+		} `json:"context"`
+	} `json:"contexts"`
+	Clusters []struct {
+		Name    string `json:"name"`
+		Cluster struct {
+			Server string `json:"server"`
+		} `json:"cluster"`
+	} `json:"clusters"`
+}
+
+// Contexts lists the contexts of the kubeconfig in the order kubectl reports them
+func (k *Kubectl) Contexts(ctx context.Context) ([]KubeContext, error) {
+	output, err := k.Exec.Output(ctx, Command{Name: "kubectl", Args: []string{"config", "view", "-o", "json"}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubeconfig: %w", err)
+	}
+	var config kubeconfig
+	if err := json.Unmarshal(output, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse kubeconfig: %w", err)
+	}
+
+	servers := make(map[string]string, len(config.Clusters))
+	for _, c := range config.Clusters {
+		servers[c.Name] = c.Cluster.Server
+	}
+	contexts := make([]KubeContext, 0, len(config.Contexts))
+	for _, c := range config.Contexts {
+		contexts = append(contexts, KubeContext{
+			Name:    c.Name,
+			Cluster: c.Context.Cluster,
+			Server:  servers[c.Context.Cluster],
+			Current: c.Name == config.CurrentContext,
+		})
+	}
+	return contexts, nil
+}
+
+// ServerVersion returns the Kubernetes version of kube's API server, e.g. "v1.33.1-eks-1234"
+func ServerVersion(ctx context.Context, kube KubeClient) (string, error) {
+	output, err := kube.GetRaw(ctx, "/version")
+	if err != nil {
+		return "", fmt.Errorf("failed to get API server version: %w", err)
+	}
+	var server kubeVersion
+	if err := json.Unmarshal(output, &server); err != nil {
+		return "", fmt.Errorf("failed to parse API server version: %w", err)
+	}
+	return server.GitVersion, nil
+}
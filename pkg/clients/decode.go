@@ -0,0 +1,96 @@
+package clients
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrUnexpectedSchema is returned when API output does not have the shape the tool relies on,
+// e.g. after a CRD or API version change
+var ErrUnexpectedSchema = errors.New("unexpected API response schema")
+
+// Validator is implemented by decoded objects that can check the fields the tool relies on
+type Validator interface {
+	Validate() error
+}
+
+// DecodeItems streams the items of a list response ({"items": [...]}) from r, decoding one item at a time
+// into a T and passing it to fn, so the whole list is never held in memory as JSON.
+//
+// The list envelope is decoded strictly: unknown top-level fields fail with ErrUnexpectedSchema. Unknown
+// fields inside items are ignored, since the API server adds fields across versions, but items implementing
+// Validator must pass validation. r is always closed; a Close error (e.g. a failed kubectl) takes precedence
+// over decoding errors, since it is usually their cause.
+func DecodeItems[T any](r io.ReadCloser, fn func(T) error) (err error) {
+	defer func() {
+		if closeErr := r.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}()
+
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("failed to decode list: %w", err)
+		}
+
+		switch key {
+		case "items":
+			if err := decodeArray(dec, fn); err != nil {
+				return err
+			}
+		case "apiVersion", "kind", "metadata":
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return fmt.Errorf("failed to decode list: %w", err)
+			}
+		default:
+			return fmt.Errorf("%w: unknown list field %v", ErrUnexpectedSchema, key)
+		}
+	}
+
+	return expectDelim(dec, '}')
+}
+
+// decodeArray decodes the elements of a JSON array one at a time, validating each
+func decodeArray[T any](dec *json.Decoder, fn func(T) error) error {
+	if err := expectDelim(dec, '['); err != nil {
+		return err
+	}
+
+	for i := 0; dec.More(); i++ {
+		var item T
+		if err := dec.Decode(&item); err != nil {
+			return fmt.Errorf("failed to decode list item %d: %w", i, err)
+		}
+		if v, ok := any(item).(Validator); ok {
+			if err := v.Validate(); err != nil {
+				return fmt.Errorf("%w: list item %d: %v", ErrUnexpectedSchema, i, err)
+			}
+		}
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(dec, ']')
+}
+
+// expectDelim reads the next token and checks that it is the given delimiter
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("failed to decode list: %w", err)
+	}
+	if tok != want {
+		return fmt.Errorf("%w: expected %v, got %v", ErrUnexpectedSchema, want, tok)
+	}
+	return nil
+}
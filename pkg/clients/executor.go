@@ -0,0 +1,137 @@
+package clients
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// ErrToolNotFound is returned when a command's binary is not installed or not on the PATH
+var ErrToolNotFound = errors.New("required binary not found")
+
+// Command is an external command invocation
+type Command struct {
+	Name  string
+	Args  []string
+	Stdin []byte // nil for no input
+}
+
+// Label names the command in errors, e.g. "kubectl get" or "aws ec2 describe-images":
+// the binary followed by up to two leading non-flag arguments
+func (c Command) Label() string {
+	parts := []string{c.Name}
+	for _, arg := range c.Args {
+		if len(parts) == 3 || strings.HasPrefix(arg, "-") {
+			break
+		}
+		parts = append(parts, arg)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Executor runs external commands. The kubectl and aws CLI clients run everything through an
+// Executor so that their output can be recorded and replayed (see package fixture).
+type Executor interface {
+	// Output runs the command to completion and returns its stdout; errors include its stderr
+	Output(ctx context.Context, cmd Command) ([]byte, error)
+	// Stream starts the command and returns its stdout. Close waits for the command and reports its failure;
+	// closing before the output was read to the end stops the command.
+	Stream(ctx context.Context, cmd Command) (io.ReadCloser, error)
+}
+
+// OSExecutor runs commands as local processes
+type OSExecutor struct{}
+
+// Output runs the command and returns its stdout
+func (OSExecutor) Output(ctx context.Context, c Command) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, c.Name, c.Args...)
+	if c.Stdin != nil {
+		cmd.Stdin = bytes.NewReader(c.Stdin)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, commandError(c, err, &stderr)
+	}
+	return output, nil
+}
+
+// Stream starts the command and returns its stdout
+func (OSExecutor) Stream(ctx context.Context, c Command) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	cmd := exec.CommandContext(ctx, c.Name, c.Args...)
+	if c.Stdin != nil {
+		cmd.Stdin = bytes.NewReader(c.Stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("%s: %w", c.Label(), err)
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, notFoundError(c)
+		}
+		return nil, fmt.Errorf("%s: %w", c.Label(), err)
+	}
+	return &stream{Reader: stdout, command: c, cmd: cmd, cancel: cancel, stderr: &stderr}, nil
+}
+
+// notFoundError tells the user how to fix a missing binary instead of reporting an opaque exec failure
+func notFoundError(c Command) error {
+	return fmt.Errorf("%w: %s is not installed or not on your PATH; install it and try again", ErrToolNotFound, c.Name)
+}
+
+// commandError describes a failed command, including its stderr if any
+func commandError(c Command, err error, stderr *bytes.Buffer) error {
+	if errors.Is(err, exec.ErrNotFound) {
+		return notFoundError(c)
+	}
+	msg := strings.TrimSpace(stderr.String())
+	if msg == "" {
+		return fmt.Errorf("%s: %w", c.Label(), err)
+	}
+	return fmt.Errorf("%s: %w: %s", c.Label(), err, msg)
+}
+
+// stream is the stdout of a running command
+type stream struct {
+	io.Reader
+	command Command
+	cmd     *exec.Cmd
+	cancel  context.CancelFunc
+	stderr  *bytes.Buffer
+	done    bool // stdout was read to the end
+}
+
+func (s *stream) Read(p []byte) (int, error) {
+	n, err := s.Reader.Read(p)
+	if err == io.EOF {
+		s.done = true
+	}
+	return n, err
+}
+
+// Close waits for the command to exit, stopping it first if the output was not read to the end
+func (s *stream) Close() error {
+	if !s.done {
+		s.cancel()
+	}
+	err := s.cmd.Wait()
+	s.cancel()
+	if err != nil && s.done {
+		return commandError(s.command, err, s.stderr)
+	}
+	return nil
+}
@@ -0,0 +1,405 @@
+// Package fake provides in-memory implementations of the clients interfaces for tests and dry runs
+package fake
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+)
+
+// KubeClient is an in-memory KubeClient. Objects are stored per resource type as decoded JSON.
+type KubeClient struct {
+	mu sync.Mutex
+
+	Objects map[string][]map[string]interface{} // resource -> objects
+	Raw     map[string][]byte                   // raw API path -> response
+	Context string                              // returned by CurrentContext
+	User    string                              // returned by WhoAmI
+	Err     error                               // when set, every call fails with it
+	Applied [][]byte                            // manifests passed to Apply, in order
+}
+
+// NewKubeClient creates an empty fake KubeClient
+func NewKubeClient() *KubeClient {
+	return &KubeClient{
+		Objects: make(map[string][]map[string]interface{}),
+		Raw:     make(map[string][]byte),
+		Context: "fake",
+	}
+}
+
+// Add stores an object given as JSON under resource
+func (f *KubeClient) Add(resource string, objectJSON string) error {
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(objectJSON), &obj); err != nil {
+		return fmt.Errorf("invalid object JSON: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Objects[resource] = append(f.Objects[resource], obj)
+	return nil
+}
+
+// Get returns the named object of resource
+func (f *KubeClient) Get(_ context.Context, resource, name string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	for _, obj := range f.Objects[resource] {
+		if lookup(obj, "metadata.name") == name {
+			return json.Marshal(obj)
+		}
+	}
+	return nil, fmt.Errorf("%s %q not found", resource, name)
+}
+
+// List returns the objects of resource matching the field selector
+func (f *KubeClient) List(_ context.Context, resource string, opts clients.ListOptions) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	items := []map[string]interface{}{}
+	for _, obj := range f.Objects[resource] {
+		if matchesFieldSelector(obj, opts.FieldSelector) {
+			items = append(items, obj)
+		}
+	}
+	data, err := json.Marshal(map[string]interface{}{"items": items})
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Apply records the manifest and replaces the stored object with the same kind and name
+func (f *KubeClient) Apply(_ context.Context, manifest []byte) error {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(manifest, &obj); err != nil {
+		return fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	f.Applied = append(f.Applied, manifest)
+
+	for resource, objects := range f.Objects {
+		for i, existing := range objects {
+			if lookup(existing, "kind") == lookup(obj, "kind") &&
+				lookup(existing, "metadata.name") == lookup(obj, "metadata.name") {
+				f.Objects[resource][i] = obj
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// Delete removes the named object of resource, if it exists
+func (f *KubeClient) Delete(_ context.Context, resource, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	objects := f.Objects[resource]
+	for i, obj := range objects {
+		if lookup(obj, "metadata.name") == name {
+			f.Objects[resource] = append(objects[:i:i], objects[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+// Cordon sets spec.unschedulable of the named "nodes" object
+func (f *KubeClient) Cordon(_ context.Context, node string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	for _, obj := range f.Objects["nodes"] {
+		if lookup(obj, "metadata.name") == node {
+			spec, ok := obj["spec"].(map[string]interface{})
+			if !ok {
+				spec = make(map[string]interface{})
+				obj["spec"] = spec
+			}
+			spec["unschedulable"] = true
+			return nil
+		}
+	}
+	return fmt.Errorf("node %q not found", node)
+}
+
+// Annotate sets metadata.annotations of the named object
+func (f *KubeClient) Annotate(_ context.Context, resource, name string, annotations map[string]string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	for _, obj := range f.Objects[resource] {
+		if lookup(obj, "metadata.name") != name {
+			continue
+		}
+		metadata, ok := obj["metadata"].(map[string]interface{})
+		if !ok {
+			metadata = make(map[string]interface{})
+			obj["metadata"] = metadata
+		}
+		existing, ok := metadata["annotations"].(map[string]interface{})
+		if !ok {
+			existing = make(map[string]interface{})
+			metadata["annotations"] = existing
+		}
+		for key, value := range annotations {
+			existing[key] = value
+		}
+		return nil
+	}
+	return fmt.Errorf("%s %q not found", resource, name)
+}
+
+// GetRaw returns the canned response for path
+func (f *KubeClient) GetRaw(_ context.Context, path string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	data, ok := f.Raw[path]
+	if !ok {
+		return nil, fmt.Errorf("no raw response for %s", path)
+	}
+	return data, nil
+}
+
+// CurrentContext returns the configured context name
+func (f *KubeClient) CurrentContext(_ context.Context) (string, error) {
+	if f.Err != nil {
+		return "", f.Err
+	}
+	return f.Context, nil
+}
+
+// WhoAmI returns the configured user
+func (f *KubeClient) WhoAmI(_ context.Context) (string, error) {
+	if f.Err != nil {
+		return "", f.Err
+	}
+	return f.User, nil
+}
+
+// matchesFieldSelector supports comma-separated key=value and key!=value terms on dotted paths
+func matchesFieldSelector(obj map[string]interface{}, selector string) bool {
+	if selector == "" {
+		return true
+	}
+
+	for _, term := range strings.Split(selector, ",") {
+		if key, value, ok := strings.Cut(term, "!="); ok {
+			if lookup(obj, key) == value {
+				return false
+			}
+			continue
+		}
+		key, value, _ := strings.Cut(term, "=")
+		if lookup(obj, key) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup returns the string at a dotted path like "metadata.name", or "" if absent
+func lookup(obj map[string]interface{}, path string) string {
+	var current interface{} = obj
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		current = m[part]
+	}
+	s, _ := current.(string)
+	return s
+}
+
+// EC2Client is an in-memory EC2Client
+type EC2Client struct {
+	mu sync.Mutex
+
+	Images         map[string][]clients.Image        // owner ID -> images
+	InstanceStates map[string]string                 // instance ID -> state name
+	Findings       map[string]clients.SeverityCounts // image ID -> Inspector finding counts
+	Err            error                             // when set, every call fails with it
+	Deregistered   []string                          // image IDs passed to DeregisterImage, in order
+	Deleted        []string                          // snapshot IDs passed to DeleteSnapshot, in order
+	Shared         map[string][]string               // image ID -> accounts with launch permission
+	Objects        map[string][]byte                 // s3:// URL -> object content
+	CallerARN      string                            // returned by WhoAmI
+}
+
+// NewEC2Client creates an empty fake EC2Client
+func NewEC2Client() *EC2Client {
+	return &EC2Client{
+		Images:         make(map[string][]clients.Image),
+		InstanceStates: make(map[string]string),
+		Findings:       make(map[string]clients.SeverityCounts),
+		Shared:         make(map[string][]string),
+		Objects:        make(map[string][]byte),
+	}
+}
+
+// WhoAmI returns the configured caller ARN
+func (f *EC2Client) WhoAmI(_ context.Context) (string, error) {
+	if f.Err != nil {
+		return "", f.Err
+	}
+	return f.CallerARN, nil
+}
+
+// DescribeImages returns the images registered for ownerID
+func (f *EC2Client) DescribeImages(_ context.Context, ownerID string) ([]clients.Image, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	return append([]clients.Image(nil), f.Images[ownerID]...), nil
+}
+
+// DescribeInstanceStates returns the states of the known instances among instanceIDs
+func (f *EC2Client) DescribeInstanceStates(_ context.Context, _ string, instanceIDs []string) (map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	states := make(map[string]string)
+	for _, id := range instanceIDs {
+		if state, ok := f.InstanceStates[id]; ok {
+			states[id] = state
+		}
+	}
+	return states, nil
+}
+
+// AMIFindings returns the registered finding counts
+func (f *EC2Client) AMIFindings(_ context.Context) (map[string]clients.SeverityCounts, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	findings := make(map[string]clients.SeverityCounts, len(f.Findings))
+	for id, counts := range f.Findings {
+		findings[id] = counts
+	}
+	return findings, nil
+}
+
+// DeregisterImage removes the image from every owner's images
+func (f *EC2Client) DeregisterImage(_ context.Context, imageID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	for owner, images := range f.Images {
+		f.Images[owner] = slices.DeleteFunc(images, func(image clients.Image) bool {
+			return image.ImageID == imageID
+		})
+	}
+	f.Deregistered = append(f.Deregistered, imageID)
+	return nil
+}
+
+// DeleteSnapshot records the snapshot as deleted
+func (f *EC2Client) DeleteSnapshot(_ context.Context, snapshotID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	f.Deleted = append(f.Deleted, snapshotID)
+	return nil
+}
+
+// ShareImage records the launch permissions of the accounts on the image
+func (f *EC2Client) ShareImage(_ context.Context, imageID string, accounts []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	for _, account := range accounts {
+		if !slices.Contains(f.Shared[imageID], account) {
+			f.Shared[imageID] = append(f.Shared[imageID], account)
+		}
+	}
+	return nil
+}
+
+// ListObjects returns the URLs of the registered objects under prefix, sorted
+func (f *EC2Client) ListObjects(_ context.Context, prefix string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	var urls []string
+	for url := range f.Objects {
+		if strings.HasPrefix(url, prefix) {
+			urls = append(urls, url)
+		}
+	}
+	slices.Sort(urls)
+	return urls, nil
+}
+
+// ReadObject returns the registered object content
+func (f *EC2Client) ReadObject(_ context.Context, url string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	data, ok := f.Objects[url]
+	if !ok {
+		return nil, fmt.Errorf("no such object: %s", url)
+	}
+	return append([]byte(nil), data...), nil
+}
@@ -0,0 +1,85 @@
+package fixture
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WriteArchive packs the fixture files in dir into a tar archive at path, so a recorded session can be
+// passed around as one file
+func WriteArchive(dir, path string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read fixture directory: %w", err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create session archive: %w", err)
+	}
+	tw := tar.NewWriter(f)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err == nil {
+			err = tw.WriteHeader(&tar.Header{Name: entry.Name(), Mode: 0o644, Size: int64(len(data))})
+		}
+		if err == nil {
+			_, err = tw.Write(data)
+		}
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write session archive: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write session archive: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write session archive: %w", err)
+	}
+	return nil
+}
+
+// ExtractArchive unpacks the fixture files of a tar archive written by WriteArchive into dir. Entries that
+// are not fixture files, or that would land outside dir, are rejected.
+func ExtractArchive(path, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open session archive: %w", err)
+	}
+	defer f.Close()
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create fixture directory: %w", err)
+	}
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read session archive %s: %w", path, err)
+		}
+		name := header.Name
+		if header.Typeflag != tar.TypeReg || strings.ContainsAny(name, `/\`) || filepath.Ext(name) != ".json" {
+			return fmt.Errorf("session archive %s: unexpected entry %q", path, name)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("failed to read session archive %s: %w", path, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			return fmt.Errorf("failed to write fixture: %w", err)
+		}
+	}
+}
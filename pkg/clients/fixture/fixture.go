@@ -0,0 +1,213 @@
+// Package fixture records the output of kubectl and aws CLI invocations to files and replays them,
+// so tests and demos can run the real clients without a live cluster or AWS account
+package fixture
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+)
+
+// ErrNoFixture is returned by a Player for commands that were never recorded
+var ErrNoFixture = errors.New("no recorded fixture")
+
+// Response is one recorded outcome of a command
+type Response struct {
+	Stdout string `json:"stdout"`
+	Error  string `json:"error,omitempty"` // error message of a failed command
+}
+
+// File holds every recorded response of one command, in the order they were recorded.
+// Repeated invocations (e.g. polling nodeclaims) replay the responses in order.
+type File struct {
+	Command   string     `json:"command"`
+	Args      []string   `json:"args"`
+	Stdin     string     `json:"stdin,omitempty"`
+	Responses []Response `json:"responses"`
+}
+
+// Key identifies a command by its name, arguments and input, and names its fixture file
+func Key(cmd clients.Command) string {
+	h := sha256.New()
+	h.Write([]byte(cmd.Name))
+	for _, arg := range cmd.Args {
+		h.Write([]byte{0})
+		h.Write([]byte(arg))
+	}
+	h.Write([]byte{0})
+	h.Write(cmd.Stdin)
+	return strings.ReplaceAll(cmd.Label(), " ", "-") + "-" + hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// path returns the fixture file of cmd in dir
+func path(dir string, cmd clients.Command) string {
+	return filepath.Join(dir, Key(cmd)+".json")
+}
+
+// Recorder is an Executor that runs commands with another Executor and records their output in Dir
+type Recorder struct {
+	Exec clients.Executor
+	Dir  string
+
+	mu sync.Mutex
+}
+
+// NewRecorder creates a Recorder that runs commands as local processes and records into dir
+func NewRecorder(dir string) *Recorder {
+	return &Recorder{Exec: clients.OSExecutor{}, Dir: dir}
+}
+
+// Output runs the command and records its outcome
+func (r *Recorder) Output(ctx context.Context, cmd clients.Command) ([]byte, error) {
+	output, err := r.Exec.Output(ctx, cmd)
+	if recErr := r.record(cmd, output, err); recErr != nil {
+		return nil, recErr
+	}
+	return output, err
+}
+
+// Stream runs the command to completion and records its outcome. The output is buffered, so
+// recording loses the memory benefit of streaming.
+func (r *Recorder) Stream(ctx context.Context, cmd clients.Command) (io.ReadCloser, error) {
+	var output []byte
+	stream, err := r.Exec.Stream(ctx, cmd)
+	if err == nil {
+		output, err = io.ReadAll(stream)
+		if closeErr := stream.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+	if recErr := r.record(cmd, output, err); recErr != nil {
+		return nil, recErr
+	}
+	return replay(output, err), nil
+}
+
+// record appends a response to the fixture file of cmd
+func (r *Recorder) record(cmd clients.Command, output []byte, cmdErr error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := os.MkdirAll(r.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create fixture directory: %w", err)
+	}
+
+	p := path(r.Dir, cmd)
+	file, err := load(p)
+	if errors.Is(err, os.ErrNotExist) {
+		file = &File{Command: cmd.Name, Args: cmd.Args, Stdin: string(cmd.Stdin)}
+	} else if err != nil {
+		return err
+	}
+
+	resp := Response{Stdout: string(output)}
+	if cmdErr != nil {
+		resp.Error = cmdErr.Error()
+	}
+	file.Responses = append(file.Responses, resp)
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode fixture: %w", err)
+	}
+	if err := os.WriteFile(p, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write fixture: %w", err)
+	}
+	return nil
+}
+
+// Player is an Executor that replays the responses recorded in Dir instead of running commands
+type Player struct {
+	Dir string
+
+	mu    sync.Mutex
+	calls map[string]int // fixture key -> invocations so far
+}
+
+// NewPlayer creates a Player that replays the fixtures in dir
+func NewPlayer(dir string) *Player {
+	return &Player{Dir: dir, calls: make(map[string]int)}
+}
+
+// Output returns the next recorded response of the command
+func (p *Player) Output(_ context.Context, cmd clients.Command) ([]byte, error) {
+	resp, err := p.next(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return []byte(resp.Stdout), nil
+}
+
+// Stream returns the next recorded response of the command as a stream
+func (p *Player) Stream(_ context.Context, cmd clients.Command) (io.ReadCloser, error) {
+	resp, err := p.next(cmd)
+	if err != nil {
+		return nil, err
+	}
+	var cmdErr error
+	if resp.Error != "" {
+		cmdErr = errors.New(resp.Error)
+	}
+	return replay([]byte(resp.Stdout), cmdErr), nil
+}
+
+// next returns the response for the next invocation of cmd; once the recorded responses run out
+// the last one is repeated
+func (p *Player) next(cmd clients.Command) (Response, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	file, err := load(path(p.Dir, cmd))
+	if errors.Is(err, os.ErrNotExist) || (err == nil && len(file.Responses) == 0) {
+		return Response{}, fmt.Errorf("%w for %s %s", ErrNoFixture, cmd.Name, strings.Join(cmd.Args, " "))
+	}
+	if err != nil {
+		return Response{}, err
+	}
+
+	key := Key(cmd)
+	i := min(p.calls[key], len(file.Responses)-1)
+	p.calls[key]++
+	return file.Responses[i], nil
+}
+
+// load reads a fixture file
+func load(p string) (*File, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %s: %w", p, err)
+	}
+	return &file, nil
+}
+
+// replay returns recorded output as a stream whose Close reports the recorded error
+func replay(output []byte, err error) io.ReadCloser {
+	return &replayed{Reader: bytes.NewReader(output), err: err}
+}
+
+type replayed struct {
+	io.Reader
+	err error
+}
+
+func (r *replayed) Close() error {
+	return r.err
+}
@@ -0,0 +1,213 @@
+package fixture
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+)
+
+// scripted is an Executor answering each command with the next of its scripted responses
+type scripted struct {
+	responses map[string][]Response // command line -> responses
+	calls     int
+}
+
+func (s *scripted) Output(_ context.Context, cmd clients.Command) ([]byte, error) {
+	s.calls++
+	line := cmd.Name + " " + strings.Join(cmd.Args, " ")
+	queue := s.responses[line]
+	if len(queue) == 0 {
+		return nil, errors.New("unexpected command " + line)
+	}
+	resp := queue[0]
+	s.responses[line] = queue[1:]
+	if resp.Error != "" {
+		return []byte(resp.Stdout), errors.New(resp.Error)
+	}
+	return []byte(resp.Stdout), nil
+}
+
+func (s *scripted) Stream(ctx context.Context, cmd clients.Command) (io.ReadCloser, error) {
+	output, err := s.Output(ctx, cmd)
+	return replay(output, err), nil
+}
+
+var (
+	getNodeClaims = clients.Command{Name: "kubectl", Args: []string{"get", "nodeclaims", "-o", "json"}}
+	applyManifest = clients.Command{Name: "kubectl", Args: []string{"apply", "-f", "-"}, Stdin: []byte(`{"kind":"EC2NodeClass"}`)}
+)
+
+func TestRecordReplayOutput(t *testing.T) {
+	dir := t.TempDir()
+	exec := &scripted{responses: map[string][]Response{
+		"kubectl get nodeclaims -o json": {{Stdout: `{"items":[1,2]}`}, {Stdout: `{"items":[1]}`}},
+		"kubectl apply -f -":             {{Error: "exit status 1: forbidden"}},
+	}}
+	recorder := &Recorder{Exec: exec, Dir: dir}
+	ctx := context.Background()
+
+	for _, want := range []string{`{"items":[1,2]}`, `{"items":[1]}`} {
+		got, err := recorder.Output(ctx, getNodeClaims)
+		if err != nil || string(got) != want {
+			t.Fatalf("recording: got %q, %v; want %q", got, err, want)
+		}
+	}
+	if _, err := recorder.Output(ctx, applyManifest); err == nil {
+		t.Fatal("recording: want the command's error")
+	}
+
+	player := NewPlayer(dir)
+	// Repeated invocations replay the responses in order, then repeat the last one
+	for _, want := range []string{`{"items":[1,2]}`, `{"items":[1]}`, `{"items":[1]}`} {
+		got, err := player.Output(ctx, getNodeClaims)
+		if err != nil || string(got) != want {
+			t.Fatalf("replay: got %q, %v; want %q", got, err, want)
+		}
+	}
+	if _, err := player.Output(ctx, applyManifest); err == nil || err.Error() != "exit status 1: forbidden" {
+		t.Fatalf("replay: got error %v, want the recorded one", err)
+	}
+	if exec.calls != 3 {
+		t.Errorf("%d commands were run, want only the 3 recorded", exec.calls)
+	}
+}
+
+func TestRecordReplayStream(t *testing.T) {
+	dir := t.TempDir()
+	exec := &scripted{responses: map[string][]Response{
+		"kubectl get nodeclaims -o json": {{Stdout: `{"items":[]}`}, {Stdout: "partial", Error: "exit status 1"}},
+	}}
+	recorder := &Recorder{Exec: exec, Dir: dir}
+	ctx := context.Background()
+	for range 2 {
+		stream, err := recorder.Stream(ctx, getNodeClaims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, stream)
+		stream.Close()
+	}
+
+	player := NewPlayer(dir)
+	stream, err := player.Stream(ctx, getNodeClaims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(stream)
+	if string(got) != `{"items":[]}` || stream.Close() != nil {
+		t.Errorf("first replay = %q, want the recorded output and no error", got)
+	}
+	stream, err = player.Stream(ctx, getNodeClaims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ = io.ReadAll(stream)
+	if err := stream.Close(); string(got) != "partial" || err == nil || err.Error() != "exit status 1" {
+		t.Errorf("second replay = %q, %v; want the partial output and the recorded error", got, err)
+	}
+}
+
+func TestReplayWithoutMatchingRecording(t *testing.T) {
+	dir := t.TempDir()
+	exec := &scripted{responses: map[string][]Response{
+		"kubectl get nodeclaims -o json": {{Stdout: `{"items":[]}`}},
+		"kubectl apply -f -":             {{Stdout: "applied"}},
+	}}
+	recorder := &Recorder{Exec: exec, Dir: dir}
+	ctx := context.Background()
+	recorder.Output(ctx, getNodeClaims)
+	recorder.Output(ctx, applyManifest)
+
+	player := NewPlayer(dir)
+	unmatched := []clients.Command{
+		{Name: "kubectl", Args: []string{"get", "nodeclaims", "-o", "yaml"}},
+		{Name: "aws", Args: []string{"get", "nodeclaims", "-o", "json"}},
+		{Name: "kubectl", Args: []string{"apply", "-f", "-"}, Stdin: []byte(`{"kind":"NodePool"}`)},
+	}
+	for _, cmd := range unmatched {
+		if _, err := player.Output(ctx, cmd); !errors.Is(err, ErrNoFixture) {
+			t.Errorf("Output(%s %v) error = %v, want ErrNoFixture", cmd.Name, cmd.Args, err)
+		}
+		if _, err := player.Stream(ctx, cmd); !errors.Is(err, ErrNoFixture) {
+			t.Errorf("Stream(%s %v) error = %v, want ErrNoFixture", cmd.Name, cmd.Args, err)
+		}
+	}
+
+	if _, err := NewPlayer(filepath.Join(dir, "missing")).Output(ctx, getNodeClaims); !errors.Is(err, ErrNoFixture) {
+		t.Errorf("replaying from a missing directory: error = %v, want ErrNoFixture", err)
+	}
+}
+
+func TestReplayCorruptFixture(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(path(dir, getNodeClaims), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := NewPlayer(dir).Output(context.Background(), getNodeClaims)
+	if err == nil || errors.Is(err, ErrNoFixture) {
+		t.Errorf("error = %v, want a parse error", err)
+	}
+}
+
+func TestRecordReplayKubectl(t *testing.T) {
+	dir := t.TempDir()
+	list := `{"items":[{"metadata":{"name":"default"},"spec":{"amiSelectorTerms":[{"name":"domino-eks-1.33-v20250901"}]}}]}`
+	recorder := &Recorder{Dir: dir, Exec: executorFunc(func(cmd clients.Command) ([]byte, error) {
+		if cmd.Name != "kubectl" {
+			return nil, errors.New("unexpected command")
+		}
+		return []byte(list), nil
+	})}
+	ctx := context.Background()
+	recorded, err := (&clients.Kubectl{Exec: recorder}).Get(ctx, "ec2nodeclasses.karpenter.k8s.aws", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replayed, err := (&clients.Kubectl{Exec: NewPlayer(dir)}).Get(ctx, "ec2nodeclasses.karpenter.k8s.aws", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(replayed) != string(recorded) {
+		t.Errorf("replayed %s, recorded %s", replayed, recorded)
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	recorder := &Recorder{Exec: &scripted{responses: map[string][]Response{
+		"kubectl get nodeclaims -o json": {{Stdout: `{"items":[]}`}},
+	}}, Dir: dir}
+	recorder.Output(context.Background(), getNodeClaims)
+
+	archive := filepath.Join(t.TempDir(), "session.tar")
+	if err := WriteArchive(dir, archive); err != nil {
+		t.Fatal(err)
+	}
+	extracted := t.TempDir()
+	if err := ExtractArchive(archive, extracted); err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewPlayer(extracted).Output(context.Background(), getNodeClaims)
+	if err != nil || string(got) != `{"items":[]}` {
+		t.Errorf("replay from archive = %q, %v", got, err)
+	}
+}
+
+// executorFunc is an Executor answering every command with a function
+type executorFunc func(cmd clients.Command) ([]byte, error)
+
+func (f executorFunc) Output(_ context.Context, cmd clients.Command) ([]byte, error) {
+	return f(cmd)
+}
+
+func (f executorFunc) Stream(_ context.Context, cmd clients.Command) (io.ReadCloser, error) {
+	output, err := f(cmd)
+	return replay(output, err), nil
+}
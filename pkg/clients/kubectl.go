@@ -0,0 +1,127 @@
+package clients
+
+import (
+	"context"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// listChunkSize is how many objects kubectl fetches from the API server per request when listing
+const listChunkSize = 500
+
+// Kubectl is a KubeClient that shells out to the kubectl binary
+type Kubectl struct {
+	Exec    Executor
+	Context string // kubeconfig context to use; the current context when empty
+}
+
+// NewKubectl creates a kubectl-backed KubeClient that runs kubectl as a local process
+func NewKubectl() *Kubectl {
+	return &Kubectl{Exec: OSExecutor{}}
+}
+
+// WithContext returns a copy of the client that talks to the cluster of the named kubeconfig context
+func (k *Kubectl) WithContext(name string) KubeClient {
+	return &Kubectl{Exec: k.Exec, Context: name}
+}
+
+// run executes kubectl with args, feeding stdin if non-nil
+func (k *Kubectl) run(ctx context.Context, stdin []byte, args ...string) ([]byte, error) {
+	return k.Exec.Output(ctx, Command{Name: "kubectl", Args: k.withContext(args), Stdin: stdin})
+}
+
+// withContext appends the --context flag to args when a context is set. It goes last so the verb and
+// subcommand stay the leading arguments.
+func (k *Kubectl) withContext(args []string) []string {
+	if k.Context == "" {
+		return args
+	}
+	return append(args, "--context", k.Context)
+}
+
+// Get returns a single object as JSON
+func (k *Kubectl) Get(ctx context.Context, resource, name string) ([]byte, error) {
+	return k.run(ctx, nil, "get", resource, name, "-o", "json")
+}
+
+// List streams a list of objects as JSON, fetched from the API server in chunks
+func (k *Kubectl) List(ctx context.Context, resource string, opts ListOptions) (io.ReadCloser, error) {
+	args := []string{"get", resource, "--chunk-size", strconv.Itoa(listChunkSize)}
+	if opts.AllNamespaces {
+		args = append(args, "--all-namespaces")
+	}
+	if opts.FieldSelector != "" {
+		args = append(args, "--field-selector", opts.FieldSelector)
+	}
+	args = append(args, "-o", "json")
+	return k.Exec.Stream(ctx, Command{Name: "kubectl", Args: k.withContext(args)})
+}
+
+// Watch streams change events of resource as JSON objects
+func (k *Kubectl) Watch(ctx context.Context, resource string) (io.ReadCloser, error) {
+	return k.Exec.Stream(ctx, Command{Name: "kubectl", Args: k.withContext([]string{
+		"get", resource, "--watch-only", "--output-watch-events", "-o", "json",
+	})})
+}
+
+// Apply applies the JSON manifest
+func (k *Kubectl) Apply(ctx context.Context, manifest []byte) error {
+	_, err := k.run(ctx, manifest, "apply", "-f", "-")
+	return err
+}
+
+// Delete deletes the named object
+func (k *Kubectl) Delete(ctx context.Context, resource, name string) error {
+	_, err := k.run(ctx, nil, "delete", resource, name, "--ignore-not-found", "--wait=false")
+	return err
+}
+
+// Cordon marks the node unschedulable
+func (k *Kubectl) Cordon(ctx context.Context, node string) error {
+	_, err := k.run(ctx, nil, "cordon", node)
+	return err
+}
+
+// Annotate sets the annotations on the named object
+func (k *Kubectl) Annotate(ctx context.Context, resource, name string, annotations map[string]string) error {
+	args := []string{"annotate", resource, name, "--overwrite"}
+	for _, key := range slices.Sorted(maps.Keys(annotations)) {
+		args = append(args, key+"="+annotations[key])
+	}
+	_, err := k.run(ctx, nil, args...)
+	return err
+}
+
+// WhoAmI returns the username the API server authenticates the context as, or the kubeconfig user of the
+// context when the server can't tell (SelfSubjectReview needs Kubernetes 1.28)
+func (k *Kubectl) WhoAmI(ctx context.Context) (string, error) {
+	output, err := k.run(ctx, nil, "auth", "whoami", "-o", "jsonpath={.status.userInfo.username}")
+	if err == nil && strings.TrimSpace(string(output)) != "" {
+		return strings.TrimSpace(string(output)), nil
+	}
+	output, err = k.run(ctx, nil, "config", "view", "--minify", "-o", "jsonpath={.contexts[0].context.user}")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// GetRaw performs a GET against a raw API server path
+func (k *Kubectl) GetRaw(ctx context.Context, path string) ([]byte, error) {
+	return k.run(ctx, nil, "get", "--raw", path)
+}
+
+// CurrentContext returns the kubectl context in use: Context when set, the kubeconfig's current context otherwise
+func (k *Kubectl) CurrentContext(ctx context.Context) (string, error) {
+	if k.Context != "" {
+		return k.Context, nil
+	}
+	output, err := k.run(ctx, nil, "config", "current-context")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
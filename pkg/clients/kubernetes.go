@@ -0,0 +1,474 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// fieldManager is the field manager the Kubernetes client's writes are recorded under
+const fieldManager = "upgrade-ami"
+
+// selfSubjectReviews is the resource asked whom the API server authenticates the client as
+var selfSubjectReviews = schema.GroupVersionResource{Group: "authentication.k8s.io", Version: "v1", Resource: "selfsubjectreviews"}
+
+// Kubernetes is a KubeClient that talks to the API server with client-go, so the kubectl binary is not
+// needed. It reads the kubeconfig kubectl would ($KUBECONFIG or ~/.kube/config) on the first call.
+type Kubernetes struct {
+	Context  string // kubeconfig context to use; the current context when empty
+	readOnly bool   // mutating calls fail with ErrReadOnly
+
+	mu   sync.Mutex
+	conn *kubeConn // nil until the first call
+}
+
+// kubeConn holds the clients of the cluster of a kubeconfig context
+type kubeConn struct {
+	config    clientcmdapi.Config // the kubeconfig as read
+	context   string              // name of the context in use
+	namespace string              // default namespace of the context
+	discovery *discovery.DiscoveryClient
+	dynamic   dynamic.Interface
+	mapper    meta.ResettableRESTMapper
+}
+
+// NewKubernetes creates a client-go-backed KubeClient for the kubeconfig's current context
+func NewKubernetes() *Kubernetes {
+	return &Kubernetes{}
+}
+
+// WithContext returns a client of the cluster of the named kubeconfig context, read-only if k is
+func (k *Kubernetes) WithContext(name string) KubeClient {
+	return &Kubernetes{Context: name, readOnly: k.readOnly}
+}
+
+// connect reads the kubeconfig and creates the clients on the first call. A failed attempt is not kept,
+// so a kubeconfig fixed in the meantime is picked up by the next call.
+func (k *Kubernetes) connect() (*kubeConn, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.conn != nil {
+		return k.conn, nil
+	}
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(),
+		&clientcmd.ConfigOverrides{CurrentContext: k.Context},
+	)
+	raw, err := loader.RawConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubeconfig: %w", err)
+	}
+	restConfig, err := loader.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubeconfig: %w", err)
+	}
+	namespace, _, err := loader.Namespace()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubeconfig: %w", err)
+	}
+	restConfig.UserAgent = fieldManager
+	// kubectl's client-side rate limits; client-go's defaults would throttle the monitor's polling
+	restConfig.QPS, restConfig.Burst = 50, 300
+
+	disc, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	dyn, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	name := k.Context
+	if name == "" {
+		name = raw.CurrentContext
+	}
+	k.conn = &kubeConn{
+		config:    raw,
+		context:   name,
+		namespace: namespace,
+		discovery: disc,
+		dynamic:   dyn,
+		mapper:    restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(disc)),
+	}
+	return k.conn, nil
+}
+
+// mapping resolves a resource type as kubectl accepts it, e.g. "pod", "nodes" or "nodeclaims.karpenter.sh",
+// to the API resource serving it
+func (c *kubeConn) mapping(resource string) (*meta.RESTMapping, error) {
+	gvr, err := c.resourceFor(resource)
+	if meta.IsNoMatchError(err) {
+		// The resource may have been installed since discovery ran, e.g. a CRD
+		c.mapper.Reset()
+		gvr, err = c.resourceFor(resource)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve resource type %s: %w", resource, err)
+	}
+	gvk, err := c.mapper.KindFor(gvr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve resource type %s: %w", resource, err)
+	}
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve resource type %s: %w", resource, err)
+	}
+	return mapping, nil
+}
+
+// resourceFor tries resource as resource.version.group first and as resource.group then, like kubectl
+func (c *kubeConn) resourceFor(resource string) (schema.GroupVersionResource, error) {
+	full, partial := schema.ParseResourceArg(strings.ToLower(resource))
+	if full != nil {
+		if gvr, err := c.mapper.ResourceFor(*full); err == nil {
+			return gvr, nil
+		}
+	}
+	return c.mapper.ResourceFor(partial.WithVersion(""))
+}
+
+// client returns the dynamic client of mapping's resource in namespace, or in every namespace when it is
+// empty; cluster-scoped resources ignore namespace
+func (c *kubeConn) client(mapping *meta.RESTMapping, namespace string) dynamic.ResourceInterface {
+	r := c.dynamic.Resource(mapping.Resource)
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return r
+	}
+	return r.Namespace(namespace)
+}
+
+// resource returns the client of a resource type in the context's namespace, or in every namespace
+func (k *Kubernetes) resource(resource string, allNamespaces bool) (dynamic.ResourceInterface, error) {
+	c, err := k.connect()
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := c.mapping(resource)
+	if err != nil {
+		return nil, err
+	}
+	namespace := c.namespace
+	if allNamespaces {
+		namespace = metav1.NamespaceAll
+	}
+	return c.client(mapping, namespace), nil
+}
+
+// Get returns a single object as JSON
+func (k *Kubernetes) Get(ctx context.Context, resource, name string) ([]byte, error) {
+	r, err := k.resource(resource, false)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := r.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s %s: %w", resource, name, err)
+	}
+	return obj.MarshalJSON()
+}
+
+// List streams a list of objects as JSON, fetched from the API server in chunks
+func (k *Kubernetes) List(ctx context.Context, resource string, opts ListOptions) (io.ReadCloser, error) {
+	r, err := k.resource(resource, opts.AllNamespaces)
+	if err != nil {
+		return nil, err
+	}
+	return newPipeStream(ctx, func(ctx context.Context, w io.Writer) error {
+		if _, err := io.WriteString(w, `{"items":[`); err != nil {
+			return err
+		}
+		list := metav1.ListOptions{FieldSelector: opts.FieldSelector, Limit: listChunkSize}
+		for first := true; ; {
+			page, err := r.List(ctx, list)
+			if err != nil {
+				return fmt.Errorf("failed to list %s: %w", resource, err)
+			}
+			for _, item := range page.Items {
+				data, err := item.MarshalJSON()
+				if err != nil {
+					return fmt.Errorf("failed to encode %s: %w", resource, err)
+				}
+				if !first {
+					data = append([]byte{','}, data...)
+				}
+				first = false
+				if _, err := w.Write(data); err != nil {
+					return err
+				}
+			}
+			if list.Continue = page.GetContinue(); list.Continue == "" {
+				break
+			}
+		}
+		_, err := io.WriteString(w, `]}`)
+		return err
+	}), nil
+}
+
+// watchEvent is a change as kubectl's --output-watch-events prints it
+type watchEvent struct {
+	Type   watch.EventType `json:"type"`
+	Object any             `json:"object"`
+}
+
+// Watch streams change events of resource as JSON objects. Like kubectl's --watch-only, only changes made
+// after the call are streamed.
+func (k *Kubernetes) Watch(ctx context.Context, resource string) (io.ReadCloser, error) {
+	r, err := k.resource(resource, false)
+	if err != nil {
+		return nil, err
+	}
+	// The resource version of a list is where the watch starts from, so existing objects are not replayed
+	list, err := r.List(ctx, metav1.ListOptions{Limit: 1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", resource, err)
+	}
+	return newPipeStream(ctx, func(ctx context.Context, w io.Writer) error {
+		watcher, err := r.Watch(ctx, metav1.ListOptions{ResourceVersion: list.GetResourceVersion()})
+		if err != nil {
+			return fmt.Errorf("failed to watch %s: %w", resource, err)
+		}
+		defer watcher.Stop()
+
+		enc := json.NewEncoder(w)
+		for event := range watcher.ResultChan() {
+			if event.Type == watch.Error {
+				return fmt.Errorf("failed to watch %s: %w", resource, apierrors.FromObject(event.Object))
+			}
+			if err := enc.Encode(watchEvent{Type: event.Type, Object: event.Object}); err != nil {
+				return err
+			}
+		}
+		return ctx.Err()
+	}), nil
+}
+
+// Apply creates or updates the object described by the JSON manifest. A manifest with a resource version,
+// i.e. an object read from the cluster and changed, replaces the object and fails with a conflict if it
+// changed in the meantime, like kubectl apply. Others are applied server-side, leaving the fields they
+// don't set as they are.
+func (k *Kubernetes) Apply(ctx context.Context, manifest []byte) error {
+	if k.readOnly {
+		return fmt.Errorf("%w: apply", ErrReadOnly)
+	}
+	var obj unstructured.Unstructured
+	if err := obj.UnmarshalJSON(manifest); err != nil {
+		return fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	c, err := k.connect()
+	if err != nil {
+		return err
+	}
+	gvk := obj.GroupVersionKind()
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		c.mapper.Reset()
+		mapping, err = c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to resolve kind %s: %w", gvk.Kind, err)
+	}
+	namespace := obj.GetNamespace()
+	if namespace == "" {
+		namespace = c.namespace
+	}
+	r := c.client(mapping, namespace)
+
+	if obj.GetResourceVersion() != "" {
+		_, err = r.Update(ctx, &obj, metav1.UpdateOptions{FieldManager: fieldManager})
+	} else {
+		obj.SetManagedFields(nil)
+		_, err = r.Apply(ctx, obj.GetName(), &obj, metav1.ApplyOptions{FieldManager: fieldManager, Force: true})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to apply %s %s: %w", strings.ToLower(gvk.Kind), obj.GetName(), err)
+	}
+	return nil
+}
+
+// Delete deletes the named object, ignoring objects that don't exist
+func (k *Kubernetes) Delete(ctx context.Context, resource, name string) error {
+	if k.readOnly {
+		return fmt.Errorf("%w: delete", ErrReadOnly)
+	}
+	r, err := k.resource(resource, false)
+	if err != nil {
+		return err
+	}
+	background := metav1.DeletePropagationBackground
+	err = r.Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &background})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete %s %s: %w", resource, name, err)
+	}
+	return nil
+}
+
+// Cordon marks the node unschedulable
+func (k *Kubernetes) Cordon(ctx context.Context, node string) error {
+	if k.readOnly {
+		return fmt.Errorf("%w: cordon", ErrReadOnly)
+	}
+	r, err := k.resource("nodes", false)
+	if err != nil {
+		return err
+	}
+	patch := []byte(`{"spec":{"unschedulable":true}}`)
+	if _, err := r.Patch(ctx, node, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: fieldManager}); err != nil {
+		return fmt.Errorf("failed to cordon node %s: %w", node, err)
+	}
+	return nil
+}
+
+// Annotate sets the annotations on the named object
+func (k *Kubernetes) Annotate(ctx context.Context, resource, name string, annotations map[string]string) error {
+	if k.readOnly {
+		return fmt.Errorf("%w: annotate", ErrReadOnly)
+	}
+	r, err := k.resource(resource, false)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]any{"metadata": map[string]any{"annotations": annotations}})
+	if err != nil {
+		return fmt.Errorf("failed to encode annotations: %w", err)
+	}
+	if _, err := r.Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: fieldManager}); err != nil {
+		return fmt.Errorf("failed to annotate %s %s: %w", resource, name, err)
+	}
+	return nil
+}
+
+// WhoAmI returns the username the API server authenticates the context as, or the kubeconfig user of the
+// context when the server can't tell (SelfSubjectReview needs Kubernetes 1.28)
+func (k *Kubernetes) WhoAmI(ctx context.Context) (string, error) {
+	c, err := k.connect()
+	if err != nil {
+		return "", err
+	}
+	review := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "authentication.k8s.io/v1",
+		"kind":       "SelfSubjectReview",
+	}}
+	result, err := c.dynamic.Resource(selfSubjectReviews).Create(ctx, review, metav1.CreateOptions{})
+	if err == nil {
+		if username, _, _ := unstructured.NestedString(result.Object, "status", "userInfo", "username"); username != "" {
+			return username, nil
+		}
+	}
+	kubeContext, ok := c.config.Contexts[c.context]
+	if !ok {
+		return "", fmt.Errorf("context %q not found in kubeconfig", c.context)
+	}
+	return kubeContext.AuthInfo, nil
+}
+
+// GetRaw performs a GET against a raw API server path
+func (k *Kubernetes) GetRaw(ctx context.Context, path string) ([]byte, error) {
+	c, err := k.connect()
+	if err != nil {
+		return nil, err
+	}
+	output, err := c.discovery.RESTClient().Get().AbsPath(path).DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", path, err)
+	}
+	return output, nil
+}
+
+// CurrentContext returns the context in use: Context when set, the kubeconfig's current context otherwise
+func (k *Kubernetes) CurrentContext(context.Context) (string, error) {
+	if k.Context != "" {
+		return k.Context, nil
+	}
+	c, err := k.connect()
+	if err != nil {
+		return "", err
+	}
+	if c.context == "" {
+		return "", errors.New("current-context is not set")
+	}
+	return c.context, nil
+}
+
+// Contexts lists the contexts of the kubeconfig by name
+func (k *Kubernetes) Contexts(context.Context) ([]KubeContext, error) {
+	raw, err := clientcmd.NewDefaultClientConfigLoadingRules().Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubeconfig: %w", err)
+	}
+	contexts := make([]KubeContext, 0, len(raw.Contexts))
+	for _, name := range slices.Sorted(maps.Keys(raw.Contexts)) {
+		c := KubeContext{Name: name, Cluster: raw.Contexts[name].Cluster, Current: name == raw.CurrentContext}
+		if cluster, ok := raw.Clusters[c.Cluster]; ok {
+			c.Server = cluster.Server
+		}
+		contexts = append(contexts, c)
+	}
+	return contexts, nil
+}
+
+// pipeStream is the output of a producer writing to a pipe in the background. Its Close stops the
+// producer and reports the producer's error if the output was read to the end, like a kubectl stream.
+type pipeStream struct {
+	*io.PipeReader
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error // the producer's, set once done is closed
+	ended  bool  // a read returned the end of the output or the producer's error
+}
+
+// newPipeStream runs produce in the background, streaming what it writes
+func newPipeStream(ctx context.Context, produce func(ctx context.Context, w io.Writer) error) *pipeStream {
+	ctx, cancel := context.WithCancel(ctx)
+	r, w := io.Pipe()
+	s := &pipeStream{PipeReader: r, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		s.err = produce(ctx, w)
+		w.CloseWithError(s.err)
+	}()
+	return s
+}
+
+func (s *pipeStream) Read(p []byte) (int, error) {
+	n, err := s.PipeReader.Read(p)
+	if err != nil {
+		s.ended = true
+	}
+	return n, err
+}
+
+// Close waits for the producer to finish, stopping it first if the output was not read to the end
+func (s *pipeStream) Close() error {
+	if !s.ended {
+		s.cancel()
+		s.PipeReader.Close()
+	}
+	<-s.done
+	s.cancel()
+	if s.ended {
+		return s.err
+	}
+	return nil
+}
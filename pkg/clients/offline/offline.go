@@ -0,0 +1,237 @@
+// Package offline provides clients backed by data exported from a cluster and an AWS account, so plans can
+// be built on a workstation that can reach neither, e.g. for air-gapped environments
+package offline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+)
+
+// ErrOffline is returned for requests the exported data cannot answer
+var ErrOffline = errors.New("not available from exported data")
+
+// Stdin is the path that reads an export from standard input
+const Stdin = "-"
+
+// read returns the content of the file at path, or of standard input for Stdin
+func read(path string) ([]byte, error) {
+	if path == Stdin {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read standard input: %w", err)
+		}
+		return data, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read export: %w", err)
+	}
+	return data, nil
+}
+
+// KubeClient serves the EC2NodeClasses of a `kubectl get ec2nodeclass -o json` export. It cannot change
+// anything.
+type KubeClient struct {
+	Context string // returned by CurrentContext
+
+	nodeClasses []json.RawMessage
+}
+
+// ReadNodeClasses loads a nodeclass export: a list of EC2NodeClasses as kubectl prints it, or a single one
+func ReadNodeClasses(path string) (*KubeClient, error) {
+	data, err := read(path)
+	if err != nil {
+		return nil, err
+	}
+	var export struct {
+		Kind  string            `json:"kind"`
+		Items []json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("failed to parse nodeclass export %s: %w", path, err)
+	}
+
+	k := &KubeClient{Context: "offline", nodeClasses: export.Items}
+	switch {
+	case export.Kind == "EC2NodeClass":
+		k.nodeClasses = []json.RawMessage{data}
+	case export.Items != nil || export.Kind == "List" || export.Kind == "EC2NodeClassList":
+	default:
+		return nil, fmt.Errorf("nodeclass export %s: expected an EC2NodeClass or a list of them, got kind %q", path, export.Kind)
+	}
+	return k, nil
+}
+
+// Get returns the named EC2NodeClass
+func (k *KubeClient) Get(_ context.Context, resource, name string) ([]byte, error) {
+	if resource != "ec2nodeclass" {
+		return nil, fmt.Errorf("get %s: %w", resource, ErrOffline)
+	}
+	for _, raw := range k.nodeClasses {
+		var obj struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+		}
+		if err := json.Unmarshal(raw, &obj); err == nil && obj.Metadata.Name == name {
+			return raw, nil
+		}
+	}
+	return nil, fmt.Errorf("%s %q not found in the export", resource, name)
+}
+
+// List returns the EC2NodeClasses of the export
+func (k *KubeClient) List(_ context.Context, resource string, _ clients.ListOptions) (io.ReadCloser, error) {
+	if resource != "ec2nodeclass" {
+		return nil, fmt.Errorf("list %s: %w", resource, ErrOffline)
+	}
+	items := k.nodeClasses
+	if items == nil {
+		items = []json.RawMessage{}
+	}
+	data, err := json.Marshal(map[string]interface{}{"items": items})
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Apply fails: exported data cannot be changed
+func (k *KubeClient) Apply(context.Context, []byte) error {
+	return fmt.Errorf("apply: %w", ErrOffline)
+}
+
+// GetRaw fails: the export has no API server behind it
+func (k *KubeClient) GetRaw(_ context.Context, path string) ([]byte, error) {
+	return nil, fmt.Errorf("get %s: %w", path, ErrOffline)
+}
+
+// CurrentContext returns the configured context name
+func (k *KubeClient) CurrentContext(context.Context) (string, error) {
+	return k.Context, nil
+}
+
+// EC2Client serves the images of an `aws ec2 describe-images --output json` export, or of a catalog
+// written by ExportImages
+type EC2Client struct {
+	ExportedAt time.Time // when the catalog was exported; zero for describe-images output
+
+	images []image
+}
+
+// image is an image as describe-images prints it
+type image struct {
+	Name                string               `json:"Name"`
+	ImageID             string               `json:"ImageId"`
+	OwnerID             string               `json:"OwnerId,omitempty"`
+	CreationDate        string               `json:"CreationDate"`
+	Tags                []tag                `json:"Tags,omitempty"`
+	BlockDeviceMappings []blockDeviceMapping `json:"BlockDeviceMappings,omitempty"`
+}
+
+type tag struct {
+	Key   string `json:"Key"`
+	Value string `json:"Value"`
+}
+
+type blockDeviceMapping struct {
+	Ebs *ebs `json:"Ebs,omitempty"`
+}
+
+type ebs struct {
+	SnapshotID string `json:"SnapshotId"`
+}
+
+// catalog is describe-images output with the time it was exported
+type catalog struct {
+	ExportedAt time.Time `json:"ExportedAt,omitzero"`
+	Images     []image   `json:"Images"`
+}
+
+// ExportImages writes a catalog of the images of each owner in describe-images' format, so ReadImages and
+// `aws ec2 describe-images` users alike can read it
+func ExportImages(w io.Writer, at time.Time, images map[string][]clients.Image) error {
+	c := catalog{ExportedAt: at.UTC(), Images: []image{}}
+	for owner, described := range images {
+		for _, d := range described {
+			im := image{Name: d.Name, ImageID: d.ImageID, OwnerID: owner, CreationDate: d.CreationDate}
+			for key, value := range d.Tags {
+				im.Tags = append(im.Tags, tag{Key: key, Value: value})
+			}
+			sort.Slice(im.Tags, func(i, j int) bool { return im.Tags[i].Key < im.Tags[j].Key })
+			for _, id := range d.Snapshots {
+				im.BlockDeviceMappings = append(im.BlockDeviceMappings, blockDeviceMapping{Ebs: &ebs{SnapshotID: id}})
+			}
+			c.Images = append(c.Images, im)
+		}
+	}
+	sort.Slice(c.Images, func(i, j int) bool { return c.Images[i].Name < c.Images[j].Name })
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(c); err != nil {
+		return fmt.Errorf("failed to write image catalog: %w", err)
+	}
+	return nil
+}
+
+// ReadImages loads an image export: describe-images output ({"Images": [...]}) or its array of images
+func ReadImages(path string) (*EC2Client, error) {
+	data, err := read(path)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+
+	e := &EC2Client{}
+	if bytes.HasPrefix(data, []byte("[")) {
+		err = json.Unmarshal(data, &e.images)
+	} else {
+		var export catalog
+		err = json.Unmarshal(data, &export)
+		e.ExportedAt, e.images = export.ExportedAt, export.Images
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image export %s: %w", path, err)
+	}
+	return e, nil
+}
+
+// DescribeImages returns the exported images of ownerID. Images exported without an owner are assumed to
+// belong to every owner, since a query with --owners doesn't need to print it.
+func (e *EC2Client) DescribeImages(_ context.Context, ownerID string) ([]clients.Image, error) {
+	images := make([]clients.Image, 0, len(e.images))
+	for _, im := range e.images {
+		if im.OwnerID != "" && ownerID != "" && im.OwnerID != ownerID {
+			continue
+		}
+		described := clients.Image{Name: im.Name, ImageID: im.ImageID, CreationDate: im.CreationDate}
+		if len(im.Tags) > 0 {
+			described.Tags = make(map[string]string, len(im.Tags))
+			for _, tag := range im.Tags {
+				described.Tags[tag.Key] = tag.Value
+			}
+		}
+		for _, m := range im.BlockDeviceMappings {
+			if m.Ebs != nil && m.Ebs.SnapshotID != "" {
+				described.Snapshots = append(described.Snapshots, m.Ebs.SnapshotID)
+			}
+		}
+		images = append(images, described)
+	}
+	return images, nil
+}
+
+// DescribeInstanceStates fails: the export has no instances
+func (e *EC2Client) DescribeInstanceStates(context.Context, string, []string) (map[string]string, error) {
+	return nil, fmt.Errorf("describe-instances: %w", ErrOffline)
+}
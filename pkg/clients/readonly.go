@@ -0,0 +1,138 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// ErrReadOnly is returned for mutating calls made through read-only clients
+var ErrReadOnly = errors.New("refusing to modify resources in read-only mode")
+
+// ReadOnly returns clients that refuse every mutating call with ErrReadOnly. The kubectl and aws CLI clients
+// keep their optional interfaces (Watcher, ToolChecker, ...) and only run commands on an allowlist of
+// read-only ones, so commands added later are blocked until they are known to be safe. The client-go and
+// aws-sdk-go-v2 clients fail their mutating methods themselves. Other clients are wrapped so that their mutating methods fail.
+func ReadOnly(cs Set) Set {
+	switch kube := cs.Kube.(type) {
+	case *Kubectl:
+		cs.Kube = &Kubectl{Exec: ReadOnlyExecutor{Exec: kube.Exec}, Context: kube.Context}
+	case *Kubernetes:
+		cs.Kube = &Kubernetes{Context: kube.Context, readOnly: true}
+	default:
+		cs.Kube = readOnlyKube{kube}
+	}
+	switch ec2 := cs.EC2.(type) {
+	case *AWSCLI:
+		cs.EC2 = &AWSCLI{Exec: ReadOnlyExecutor{Exec: ec2.Exec}, Region: ec2.Region, Profile: ec2.Profile}
+	case *AWS:
+		cs.EC2 = &AWS{Region: ec2.Region, Profile: ec2.Profile, readOnly: true}
+	}
+	// EC2Client has no mutating methods; ImageRemover and ImageSharer are only implemented by the AWS clients
+	return cs
+}
+
+// readOnlyKube fails the mutating methods of a KubeClient
+type readOnlyKube struct {
+	KubeClient
+}
+
+// Apply fails with ErrReadOnly
+func (readOnlyKube) Apply(context.Context, []byte) error {
+	return fmt.Errorf("%w: apply", ErrReadOnly)
+}
+
+// Delete fails with ErrReadOnly
+func (readOnlyKube) Delete(context.Context, string, string) error {
+	return fmt.Errorf("%w: delete", ErrReadOnly)
+}
+
+// ReadOnlyExecutor runs only the kubectl and aws commands known not to modify anything
+type ReadOnlyExecutor struct {
+	Exec Executor
+}
+
+// Output runs the command if it is read-only
+func (r ReadOnlyExecutor) Output(ctx context.Context, c Command) ([]byte, error) {
+	if !readOnlyCommand(c) {
+		return nil, fmt.Errorf("%w: %s", ErrReadOnly, c.Label())
+	}
+	return r.Exec.Output(ctx, c)
+}
+
+// Stream starts the command if it is read-only
+func (r ReadOnlyExecutor) Stream(ctx context.Context, c Command) (io.ReadCloser, error) {
+	if !readOnlyCommand(c) {
+		return nil, fmt.Errorf("%w: %s", ErrReadOnly, c.Label())
+	}
+	return r.Exec.Stream(ctx, c)
+}
+
+// readOnlyKubectl are the kubectl verbs that only read, mapped to their allowed subcommands (nil for any)
+var readOnlyKubectl = map[string][]string{
+	"get":           nil,
+	"describe":      nil,
+	"logs":          nil,
+	"top":           nil,
+	"explain":       nil,
+	"api-resources": nil,
+	"api-versions":  nil,
+	"version":       nil,
+	"cluster-info":  nil,
+	"auth":          {"can-i", "whoami"},
+	"config":        {"current-context", "view", "get-contexts", "get-clusters"},
+}
+
+// readOnlyCommand reports whether c is on the read-only allowlist
+func readOnlyCommand(c Command) bool {
+	var words []string // the leading non-flag arguments: verb and subcommand, or service and operation
+	for _, arg := range c.Args {
+		if strings.HasPrefix(arg, "-") || len(words) == 2 {
+			break
+		}
+		words = append(words, arg)
+	}
+
+	switch c.Name {
+	case "kubectl":
+		if len(words) == 0 {
+			return false
+		}
+		subcommands, ok := readOnlyKubectl[words[0]]
+		if !ok {
+			return false
+		}
+		if subcommands == nil {
+			return true
+		}
+		return len(words) == 2 && slices.Contains(subcommands, words[1])
+	case "aws":
+		if len(words) < 2 {
+			return slices.Equal(c.Args, []string{"--version"})
+		}
+		op := words[1]
+		if words[0] == "s3" && op == "cp" {
+			// Only downloads of an object to stdout
+			args := withoutAWSGlobals(c.Args)
+			return len(args) == 4 && strings.HasPrefix(args[2], "s3://") && args[3] == "-"
+		}
+		return strings.HasPrefix(op, "describe-") || strings.HasPrefix(op, "list-") || strings.HasPrefix(op, "get-")
+	}
+	return false
+}
+
+// withoutAWSGlobals returns args without the --region and --profile options AWSCLI adds to every command
+func withoutAWSGlobals(args []string) []string {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		if (args[i] == "--region" || args[i] == "--profile") && i+1 < len(args) {
+			i++
+			continue
+		}
+		rest = append(rest, args[i])
+	}
+	return rest
+}
@@ -0,0 +1,90 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrVersionSkew is returned when kubectl is more than one minor version away from the API server,
+// which kubectl does not support
+var ErrVersionSkew = errors.New("kubectl and API server versions are too far apart")
+
+// ToolVersion describes an external binary a client shells out to
+type ToolVersion struct {
+	Name    string // e.g. "kubectl"
+	Version string // version of the binary
+	Server  string // version of the server it talks to, if any
+}
+
+// ToolChecker is implemented by clients that depend on an external binary. CheckTool reports the binary's
+// version, failing with ErrToolNotFound when it is missing; other errors may come with a partial ToolVersion.
+type ToolChecker interface {
+	CheckTool(ctx context.Context) (ToolVersion, error)
+}
+
+// kubeVersion is the version document returned by kubectl version and the API server's /version
+type kubeVersion struct {
+	Minor      string `json:"minor"`
+	GitVersion string `json:"gitVersion"`
+}
+
+// CheckTool reports the kubectl and API server versions and checks that they are within one minor version
+func (k *Kubectl) CheckTool(ctx context.Context) (ToolVersion, error) {
+	tool := ToolVersion{Name: "kubectl"}
+
+	output, err := k.run(ctx, nil, "version", "--client", "-o", "json")
+	if err != nil {
+		return tool, err
+	}
+	var client struct {
+		ClientVersion kubeVersion `json:"clientVersion"`
+	}
+	if err := json.Unmarshal(output, &client); err != nil {
+		return tool, fmt.Errorf("failed to parse kubectl version: %w", err)
+	}
+	tool.Version = client.ClientVersion.GitVersion
+
+	output, err = k.GetRaw(ctx, "/version")
+	if err != nil {
+		return tool, fmt.Errorf("failed to get API server version: %w", err)
+	}
+	var server kubeVersion
+	if err := json.Unmarshal(output, &server); err != nil {
+		return tool, fmt.Errorf("failed to parse API server version: %w", err)
+	}
+	tool.Server = server.GitVersion
+
+	clientMinor, clientOK := minorVersion(client.ClientVersion.Minor)
+	serverMinor, serverOK := minorVersion(server.Minor)
+	if clientOK && serverOK && (clientMinor-serverMinor > 1 || serverMinor-clientMinor > 1) {
+		return tool, fmt.Errorf("%w: kubectl %s, server %s", ErrVersionSkew, tool.Version, tool.Server)
+	}
+	return tool, nil
+}
+
+// minorVersion parses a Kubernetes minor version, which managed clusters suffix with "+" (e.g. "31+")
+func minorVersion(minor string) (int, bool) {
+	n, err := strconv.Atoi(strings.TrimSuffix(minor, "+"))
+	return n, err == nil
+}
+
+// CheckTool reports the aws CLI version
+func (a *AWSCLI) CheckTool(ctx context.Context) (ToolVersion, error) {
+	tool := ToolVersion{Name: "aws"}
+
+	// e.g. "aws-cli/2.15.30 Python/3.11.8 Linux/6.5.0 exe/x86_64.ubuntu.22"
+	output, err := a.Exec.Output(ctx, Command{Name: "aws", Args: []string{"--version"}})
+	if err != nil {
+		return tool, err
+	}
+	fields := strings.Fields(string(output))
+	if len(fields) == 0 {
+		return tool, fmt.Errorf("failed to parse aws CLI version: empty output")
+	}
+	tool.Version = strings.TrimPrefix(fields[0], "aws-cli/")
+	return tool, nil
+}
@@ -0,0 +1,57 @@
+// Package clock abstracts the passage of time, so ages, timeouts and polling cadence can be tested
+// deterministically and simulations can fast-forward instead of waiting
+package clock
+
+import "time"
+
+// Clock tells the time and schedules wake-ups
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	// After waits for d and then sends the current time on the returned channel
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is a single event, like time.Timer
+type Timer interface {
+	C() <-chan time.Time
+	// Stop prevents the timer from firing, returning false if it already fired or was stopped
+	Stop() bool
+}
+
+// Ticker delivers ticks at intervals, like time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real is the system clock
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTimer(d time.Duration) Timer         { return realTimer{time.NewTimer(d)} }
+func (realClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+
+type realTimer struct{ t *time.Timer }
+
+func (r realTimer) C() <-chan time.Time { return r.t.C }
+func (r realTimer) Stop() bool          { return r.t.Stop() }
+
+type realTicker struct{ t *time.Ticker }
+
+func (r realTicker) C() <-chan time.Time { return r.t.C }
+func (r realTicker) Stop()               { r.t.Stop() }
+
+// OrReal returns c, or the real clock if c is nil, so a nil Clock field means the system clock
+func OrReal(c Clock) Clock {
+	if c == nil {
+		return Real
+	}
+	return c
+}
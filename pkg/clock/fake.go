@@ -0,0 +1,150 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is a Clock that only moves when told to. Timers, tickers and After channels fire
+// when Advance or Set moves the time past their deadline.
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+// NewFake creates a Fake clock set to now
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// fakeWaiter is a pending timer or ticker of a Fake clock
+type fakeWaiter struct {
+	clock    *Fake
+	deadline time.Time
+	period   time.Duration // zero for timers
+	c        chan time.Time
+}
+
+// Now returns the fake time
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Since returns the fake time elapsed since t
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// After returns a channel that receives the fake time once it has advanced by d
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+// NewTimer creates a timer that fires once the fake time has advanced by d
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	return f.schedule(d, 0)
+}
+
+// NewTicker creates a ticker that fires every d of fake time
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	return fakeTicker{f.schedule(d, d)}
+}
+
+// Advance moves the fake time forward by d, firing everything that comes due
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set moves the fake time to t, firing everything that comes due. Like a real ticker, a ticker
+// that falls behind fires once and drops the ticks it missed.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = t
+	pending := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.deadline.After(t) {
+			pending = append(pending, w)
+			continue
+		}
+		select {
+		case w.c <- t:
+		default:
+		}
+		if w.period > 0 {
+			for !w.deadline.After(t) {
+				w.deadline = w.deadline.Add(w.period)
+			}
+			pending = append(pending, w)
+		}
+	}
+	f.waiters = pending
+}
+
+// Waiters returns how many timers and tickers are pending, so a simulation can wait for
+// the code under test to block before advancing the time
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+// NextDeadline returns when the next pending timer or ticker fires, or false if none is pending
+func (f *Fake) NextDeadline() (time.Time, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.waiters) == 0 {
+		return time.Time{}, false
+	}
+	deadlines := make([]time.Time, len(f.waiters))
+	for i, w := range f.waiters {
+		deadlines[i] = w.deadline
+	}
+	sort.Slice(deadlines, func(i, j int) bool { return deadlines[i].Before(deadlines[j]) })
+	return deadlines[0], true
+}
+
+// schedule registers a waiter firing after d, repeating every period if non-zero
+func (f *Fake) schedule(d, period time.Duration) *fakeWaiter {
+	f.mu.Lock()
+	w := &fakeWaiter{clock: f, deadline: f.now.Add(d), period: period, c: make(chan time.Time, 1)}
+	f.waiters = append(f.waiters, w)
+	f.mu.Unlock()
+
+	// A timer that is already due fires right away
+	if d <= 0 {
+		f.Set(f.Now())
+	}
+	return w
+}
+
+func (w *fakeWaiter) C() <-chan time.Time { return w.c }
+
+// Stop removes the waiter, returning false if it had already fired (timers) or been stopped
+func (w *fakeWaiter) Stop() bool {
+	f := w.clock
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, other := range f.waiters {
+		if other == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// fakeTicker adapts a repeating waiter to the Ticker interface
+type fakeTicker struct {
+	*fakeWaiter
+}
+
+func (t fakeTicker) Stop() { t.fakeWaiter.Stop() }
@@ -0,0 +1,398 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/naming"
+)
+
+// accountPattern matches AWS account IDs
+var accountPattern = regexp.MustCompile(`^[0-9]{12}$`)
+
+// EnvPath is the environment variable that overrides the config file location
+const EnvPath = "UPGRADE_AMI_CONFIG"
+
+// Config is the tool configuration loaded from the config file
+type Config struct {
+	Naming          Naming          `yaml:"naming"`
+	Update          Update          `yaml:"update"`
+	Provenance      Provenance      `yaml:"provenance"`
+	Vulnerabilities Vulnerabilities `yaml:"vulnerabilities"`
+
+	// AMIFamilies sets the spec.amiFamily of nodeclasses moved to images of a variant (standard or
+	// fips), e.g. {standard: AL2023} when the images switch from AL2 to AL2023
+	AMIFamilies map[string]string `yaml:"amiFamilies"`
+
+	Prewarm  Prewarm  `yaml:"prewarm"`
+	Versions Versions `yaml:"versions"`
+	Sharing  Sharing  `yaml:"sharing"`
+	Releases Releases `yaml:"releases"`
+	Policy   Policy   `yaml:"policy"`
+
+	Confirmation  Confirmation  `yaml:"confirmation"`
+	Notifications Notifications `yaml:"notifications"`
+	Validation    Validation    `yaml:"validation"`
+
+	// Channels are AMI sources some nodeclasses track instead of the owner their selector names, e.g. beta
+	// GPU images; each channel is planned against its own AMI versions
+	Channels []Channel `yaml:"channels"`
+
+	// FreezeCalendar is the s3:// or http(s):// URL, or path, of the change calendar whose freeze windows
+	// block applying plans, see pkg/freeze; nothing is checked when empty
+	FreezeCalendar string `yaml:"freezeCalendar"`
+
+	// StatusConfigMap is the ConfigMap, NAMESPACE or NAMESPACE/NAME, upgrades publish their plans and progress
+	// to; nothing is published when empty
+	StatusConfigMap string `yaml:"statusConfigMap"`
+
+	// AMICatalog is the path of an image catalog written by export-amis. The AMI versions offered are read
+	// from it instead of ec2:DescribeImages when set.
+	AMICatalog string `yaml:"amiCatalog"`
+
+	// BuildManifests are the manifests the image pipeline publishes per build. The AMI versions offered are
+	// listed from them instead of ec2:DescribeImages when set.
+	BuildManifests BuildManifests `yaml:"buildManifests"`
+
+	// Approvals is the s3:// or http(s):// URL, or path, of the allow-list of approved AMI versions, see
+	// pkg/approval; every version may be selected when empty
+	Approvals string `yaml:"approvals"`
+
+	// Contexts are the kubeconfig contexts of every cluster using the AMIs; prune-amis keeps the AMIs any
+	// of them references
+	Contexts []string `yaml:"contexts"`
+
+	// TimeZone is the IANA time zone AMI dates are shown in, e.g. Europe/Berlin or UTC; the local time zone
+	// ($TZ) when empty
+	TimeZone string `yaml:"timeZone"`
+}
+
+// BuildManifests configures listing AMIs from the manifests an image pipeline publishes per build, see
+// pkg/builds
+type BuildManifests struct {
+	Location string `yaml:"location"` // s3://bucket/prefix/ URL, or directory, of the manifests; not used when empty
+	Region   string `yaml:"region"`   // region whose image IDs are used; --region, AWS_REGION or AWS_DEFAULT_REGION when empty
+}
+
+// ResolvedRegion returns the configured region, or else region (e.g. from --region), or else the region of
+// the AWS environment
+func (b BuildManifests) ResolvedRegion(region string) string {
+	for _, region := range []string{b.Region, region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")} {
+		if region != "" {
+			return region
+		}
+	}
+	return ""
+}
+
+// Versions restricts which AMI versions are offered
+type Versions struct {
+	MinAgeDays int `yaml:"minAgeDays"` // only offer versions at least this many days old, e.g. to let them soak
+}
+
+// Sharing configures the accounts the AMIs of a selected version are shared with, see pkg/share
+type Sharing struct {
+	Accounts []string `yaml:"accounts"` // AWS account IDs granted launch permission; nothing is shared when empty
+}
+
+// Policy configures the Rego policies plans are evaluated against before they are applied, see pkg/policy
+type Policy struct {
+	Paths []string `yaml:"paths"` // Rego files or directories; plans are not evaluated when empty
+}
+
+// Confirmation configures how the go-ahead to apply a plan is given, see pkg/confirmation
+type Confirmation struct {
+	Provider  string        `yaml:"provider"`  // tty, auto, token-file or slack; tty when empty
+	TokenFile string        `yaml:"tokenFile"` // approval token file read by the token-file provider
+	Slack     SlackApproval `yaml:"slack"`
+}
+
+// SlackApproval configures approvals requested in a Slack channel
+type SlackApproval struct {
+	Channel   string        `yaml:"channel"`   // channel ID the request is posted to
+	TokenEnv  string        `yaml:"tokenEnv"`  // environment variable holding the bot token; SLACK_BOT_TOKEN when empty
+	Approvers []string      `yaml:"approvers"` // user IDs allowed to answer; anyone in the channel when empty
+	Timeout   time.Duration `yaml:"timeout"`   // how long to wait for an answer; confirmation.DefaultSlackTimeout when zero
+}
+
+// Notifications configures where the progress of --daemon rollouts is announced at each slice boundary,
+// see confirmation.Notifier. A Slack channel also takes the acknowledgements --gate manual asks for.
+type Notifications struct {
+	Slack   SlackApproval `yaml:"slack"`   // no Slack notifications when the channel is empty
+	Webhook string        `yaml:"webhook"` // URL notifications are posted to as JSON {"text": ...}; none when empty
+}
+
+// DefaultSlackTokenEnv is the environment variable holding the Slack bot token unless tokenEnv is set
+const DefaultSlackTokenEnv = "SLACK_BOT_TOKEN"
+
+// Validate checks the settings the provider needs
+func (c Confirmation) Validate() error {
+	switch c.Provider {
+	case "", "tty", "auto":
+	case "token-file":
+		if c.TokenFile == "" {
+			return fmt.Errorf("confirmation.tokenFile is required for the token-file provider")
+		}
+	case "slack":
+		if c.Slack.Channel == "" {
+			return fmt.Errorf("confirmation.slack.channel is required for the slack provider")
+		}
+	default:
+		return fmt.Errorf("unknown confirmation.provider %q (want tty, auto, token-file or slack)", c.Provider)
+	}
+	return nil
+}
+
+// Validation configures the cluster an upgrade is applied to and smoke tested on before the cluster being
+// upgraded, see pkg/validation
+type Validation struct {
+	Context string        `yaml:"context"` // kubeconfig context of the validation cluster; no validation when empty
+	Command string        `yaml:"command"` // smoke test run with sh -c once the validation cluster rolled
+	Timeout time.Duration `yaml:"timeout"` // how long the rollout and the smoke test may each take; validation.DefaultTimeout when zero
+}
+
+// Enabled reports whether a validation cluster is configured
+func (v Validation) Enabled() bool {
+	return v.Context != ""
+}
+
+// Validate checks that an enabled validation has a smoke test
+func (v Validation) Validate() error {
+	switch {
+	case v.Enabled() && v.Command == "":
+		return fmt.Errorf("validation.command is required with validation.context")
+	case !v.Enabled() && v.Command != "":
+		return fmt.Errorf("validation.context is required with validation.command")
+	case v.Timeout < 0:
+		return fmt.Errorf("validation.timeout must not be negative")
+	}
+	return nil
+}
+
+// Channel is an AMI source a set of nodeclasses is planned against
+type Channel struct {
+	Name        string   `yaml:"name"`        // e.g. beta-gpu
+	Owner       string   `yaml:"owner"`       // AMI owner (account ID or alias) publishing the channel's images
+	NodeClasses []string `yaml:"nodeClasses"` // nodeclasses tracking the channel
+}
+
+// ValidateChannels checks that every channel has a unique name, an owner and nodeclasses, and that no
+// nodeclass tracks two channels
+func ValidateChannels(channels []Channel) error {
+	names := make(map[string]bool, len(channels))
+	tracked := make(map[string]string) // nodeclass -> channel
+	for i, ch := range channels {
+		switch {
+		case ch.Name == "":
+			return fmt.Errorf("channels[%d].name is required", i)
+		case names[ch.Name]:
+			return fmt.Errorf("channels: %q is defined twice", ch.Name)
+		case ch.Owner == "":
+			return fmt.Errorf("channels[%d].owner is required", i)
+		case len(ch.NodeClasses) == 0:
+			return fmt.Errorf("channels[%d].nodeClasses must name at least one nodeclass", i)
+		}
+		names[ch.Name] = true
+		for _, nc := range ch.NodeClasses {
+			if other, ok := tracked[nc]; ok {
+				return fmt.Errorf("channels: nodeclass %s tracks both %s and %s", nc, other, ch.Name)
+			}
+			tracked[nc] = ch.Name
+		}
+	}
+	return nil
+}
+
+// Releases configures where --release looks up the AMI version of a platform release, see pkg/release
+type Releases struct {
+	Manifest string `yaml:"manifest"` // s3:// or http(s):// URL, or path, of the release manifest
+}
+
+// Prewarm configures the nodes launched on the new AMIs before a plan is applied, see pkg/prewarm
+type Prewarm struct {
+	Images  []string      `yaml:"images"`  // container images to pull onto the pre-warmed nodes
+	Timeout time.Duration `yaml:"timeout"` // how long to wait for the nodes and pulls; prewarm.DefaultTimeout when zero
+}
+
+// Naming defines how AMI names are parsed and rendered: either a built-in provider,
+// or a custom parse regex and render template
+type Naming struct {
+	Provider string `yaml:"provider"` // built-in provider name, e.g. domino-eks, eks-al2023, bottlerocket
+	Parse    string `yaml:"parse"`    // regex with k8sVersion and optional nodegroup/version named groups
+	Render   string `yaml:"render"`   // Go template over .Nodegroup, .K8sVersion and .Version
+}
+
+// Update configures where self-update looks for releases
+type Update struct {
+	ReleasesURL string `yaml:"releasesURL"` // latest-release endpoint in GitHub's releases API format
+	PublicKey   string `yaml:"publicKey"`   // base64 ed25519 key that must sign checksums.txt; checksums only when empty
+}
+
+// Provenance configures which AMIs are trusted, see pkg/provenance. Verification is off when neither
+// pipeline ARNs nor a public key are set.
+type Provenance struct {
+	PipelineARNs   []string `yaml:"pipelineARNs"`   // Image Builder pipelines whose images are trusted
+	PipelineTag    string   `yaml:"pipelineTag"`    // image tag naming the source pipeline
+	AttestationTag string   `yaml:"attestationTag"` // image tag holding a signed attestation
+	PublicKey      string   `yaml:"publicKey"`      // base64 ed25519 key that signs attestations
+}
+
+// Enabled reports whether provenance verification is configured
+func (p Provenance) Enabled() bool {
+	return len(p.PipelineARNs) > 0 || p.PublicKey != ""
+}
+
+// Vulnerabilities configures where vulnerability scan results come from and how many findings a
+// selectable AMI version may have, see pkg/vulns
+type Vulnerabilities struct {
+	Source      string `yaml:"source"`      // inspector or file; scan results are not shown when empty
+	File        string `yaml:"file"`        // findings file for the file source
+	MaxCritical *int   `yaml:"maxCritical"` // no limit when unset
+	MaxHigh     *int   `yaml:"maxHigh"`     // no limit when unset
+}
+
+// Vulnerability sources
+const (
+	VulnSourceInspector = "inspector"
+	VulnSourceFile      = "file"
+)
+
+// Validate checks the source settings
+func (v Vulnerabilities) Validate() error {
+	switch v.Source {
+	case "", VulnSourceInspector:
+	case VulnSourceFile:
+		if v.File == "" {
+			return fmt.Errorf("vulnerabilities.file is required for the file source")
+		}
+	default:
+		return fmt.Errorf("unknown vulnerabilities.source %q (want %s or %s)", v.Source, VulnSourceInspector, VulnSourceFile)
+	}
+	return nil
+}
+
+// Default returns the configuration used when no config file exists
+func Default() *Config {
+	return &Config{
+		Naming: Naming{
+			Provider: naming.ProviderDominoEKS,
+		},
+	}
+}
+
+// DefaultPath returns the config file location, honoring UPGRADE_AMI_CONFIG
+func DefaultPath() (string, error) {
+	if path := os.Getenv(EnvPath); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine home directory: %w", err)
+	}
+	return filepath.Join(home, ".upgrade-ami", "config.yaml"), nil
+}
+
+// Load reads the config file at path on top of the defaults. A missing file yields the defaults.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	// Reject unknown keys so that typos don't silently fall back to defaults
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	if _, err := cfg.NamingScheme(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if err := cfg.Vulnerabilities.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if err := cfg.Confirmation.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if cfg.BuildManifests.Location != "" && cfg.AMICatalog != "" {
+		return nil, fmt.Errorf("invalid config %s: amiCatalog and buildManifests are mutually exclusive", path)
+	}
+	if err := cfg.Validation.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if err := ValidateChannels(cfg.Channels); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if cfg.Versions.MinAgeDays < 0 {
+		return nil, fmt.Errorf("invalid config %s: versions.minAgeDays must not be negative", path)
+	}
+	for _, account := range cfg.Sharing.Accounts {
+		if !accountPattern.MatchString(account) {
+			return nil, fmt.Errorf("invalid config %s: sharing.accounts: %q is not a 12-digit AWS account ID", path, account)
+		}
+	}
+	if _, err := cfg.VariantAMIFamilies(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if _, err := cfg.Location(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Location returns the configured time zone, or the local one when none is
+func (c *Config) Location() (*time.Location, error) {
+	if c.TimeZone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("timeZone: %w", err)
+	}
+	return loc, nil
+}
+
+// VariantAMIFamilies returns the configured amiFamilies keyed by variant (see naming.ParseVariant)
+func (c *Config) VariantAMIFamilies() (map[string]string, error) {
+	if len(c.AMIFamilies) == 0 {
+		return nil, nil
+	}
+	families := make(map[string]string, len(c.AMIFamilies))
+	for name, family := range c.AMIFamilies {
+		variant, err := naming.ParseVariant(name)
+		if err != nil {
+			return nil, fmt.Errorf("amiFamilies: %w", err)
+		}
+		if family == "" {
+			return nil, fmt.Errorf("amiFamilies.%s must not be empty", name)
+		}
+		families[variant] = family
+	}
+	return families, nil
+}
+
+// NamingScheme returns the configured AMI naming provider. A custom parse regex and
+// render template take precedence over the provider name.
+func (c *Config) NamingScheme() (naming.Provider, error) {
+	if c.Naming.Parse != "" || c.Naming.Render != "" {
+		if c.Naming.Parse == "" || c.Naming.Render == "" {
+			return nil, fmt.Errorf("naming parse and render must be set together")
+		}
+		return naming.NewScheme(c.Naming.Parse, c.Naming.Render)
+	}
+	return naming.Lookup(c.Naming.Provider)
+}
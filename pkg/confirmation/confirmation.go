@@ -0,0 +1,148 @@
+// Package confirmation asks for the go-ahead before a plan is applied: at the terminal, through an approval
+// in Slack, with an approval token file provisioned ahead of time, or automatically for unattended runs
+package confirmation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+)
+
+// ErrNotApproved is returned for requests an approver rejected or didn't answer
+var ErrNotApproved = errors.New("the plan was not approved")
+
+// Provider names
+const (
+	ProviderTTY       = "tty"
+	ProviderAuto      = "auto"
+	ProviderTokenFile = "token-file"
+	ProviderSlack     = "slack"
+)
+
+// Providers lists the provider names, in the order they are documented
+var Providers = []string{ProviderTTY, ProviderAuto, ProviderTokenFile, ProviderSlack}
+
+// Request is what is being confirmed
+type Request struct {
+	Question string   // e.g. "Apply changes?"
+	Summary  string   // the plans as text, for approvers who don't see the terminal
+	Cluster  string   // kubeconfig context the plans are applied to
+	Operator string   // who is running the tool
+	PlanIDs  []string // fingerprints of the plans (see runstate.PlanID), which an approval token must name
+}
+
+// Decision is the answer to a Request
+type Decision struct {
+	Provider string `json:"provider"`
+	Approved bool   `json:"approved"`
+	By       string `json:"by,omitempty"`     // who approved or rejected, when known
+	Reason   string `json:"reason,omitempty"` // why the request was not approved
+}
+
+// Err returns ErrNotApproved with the reason unless the request was approved
+func (d Decision) Err() error {
+	if d.Approved {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrNotApproved, d.Reason)
+}
+
+// Provider asks for the go-ahead. An error means no decision could be obtained, not a rejection.
+type Provider interface {
+	Confirm(ctx context.Context, req Request) (Decision, error)
+}
+
+// TTY asks the question at the terminal and approves on "y" or "yes"
+type TTY struct {
+	In  io.Reader
+	Out io.Writer
+}
+
+// Confirm prompts on Out and reads the answer from In, giving up when ctx is cancelled
+func (t TTY) Confirm(ctx context.Context, req Request) (Decision, error) {
+	fmt.Fprint(t.Out, req.Question+" (y/N): ")
+
+	answer := make(chan string, 1)
+	go func() {
+		var response string
+		fmt.Fscanln(t.In, &response)
+		answer <- strings.ToLower(response)
+	}()
+
+	select {
+	case response := <-answer:
+		d := Decision{Provider: ProviderTTY, By: req.Operator}
+		d.Approved = response == "y" || response == "yes"
+		if !d.Approved {
+			d.Reason = "declined at the terminal"
+		}
+		return d, nil
+	case <-ctx.Done():
+		fmt.Fprintln(t.Out)
+		return Decision{}, ctx.Err()
+	}
+}
+
+// Auto approves every request, for unattended runs whose plans are reviewed some other way
+type Auto struct{}
+
+// Confirm approves req
+func (Auto) Confirm(_ context.Context, req Request) (Decision, error) {
+	return Decision{Provider: ProviderAuto, Approved: true, By: "auto-approve"}, nil
+}
+
+// Token is an approval token file, written by an approver who reviewed the plans, e.g.
+//
+//	{"plans": ["sha256:..."], "approvedBy": "bob", "expires": "2025-10-02T00:00:00Z"}
+type Token struct {
+	Plans      []string  `json:"plans"`             // IDs of the approved plans
+	ApprovedBy string    `json:"approvedBy"`        // who approved them
+	Expires    time.Time `json:"expires,omitempty"` // the token is refused after this time; never when zero
+}
+
+// TokenFile approves requests whose plans are all named by the approval token at Path
+type TokenFile struct {
+	Path  string
+	Clock clock.Clock
+}
+
+// Confirm reads the token and checks that it is unexpired and names every plan of req
+func (t TokenFile) Confirm(_ context.Context, req Request) (Decision, error) {
+	data, err := os.ReadFile(t.Path)
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to read approval token: %w", err)
+	}
+	var token Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		return Decision{}, fmt.Errorf("failed to parse approval token %s: %w", t.Path, err)
+	}
+	if token.ApprovedBy == "" {
+		return Decision{}, fmt.Errorf("failed to parse approval token %s: approvedBy is required", t.Path)
+	}
+
+	d := Decision{Provider: ProviderTokenFile, By: token.ApprovedBy}
+	now := clock.OrReal(t.Clock).Now()
+	switch {
+	case !token.Expires.IsZero() && now.After(token.Expires):
+		d.Reason = fmt.Sprintf("the approval token expired at %s", token.Expires.Format(time.RFC3339))
+	case len(req.PlanIDs) == 0:
+		d.Reason = "there is no plan for the approval token to name"
+	default:
+		for _, id := range req.PlanIDs {
+			if !slices.Contains(token.Plans, id) {
+				d.Reason = fmt.Sprintf("the approval token does not name plan %s", id)
+				return d, nil
+			}
+		}
+		d.Approved = true
+	}
+	return d, nil
+}
@@ -0,0 +1,77 @@
+package confirmation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Notification tells about a run's progress without asking anything, e.g. that a slice of a plan was applied
+type Notification struct {
+	Title   string // e.g. "Slice 1 of 3 applied"
+	Summary string // the changes concerned, as text
+	Cluster string // kubeconfig context the run applies to
+}
+
+// Notifier sends notifications
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Notify posts n to the channel
+func (s Slack) Notify(ctx context.Context, n Notification) error {
+	return s.call(ctx, "chat.postMessage", map[string]string{"channel": s.Channel, "text": notificationText(n, "*")}, nil)
+}
+
+// Webhook posts notifications as JSON {"text": "..."} to a URL, e.g. a Slack incoming webhook or a chat
+// bridge
+type Webhook struct {
+	URL    string
+	Client *http.Client // http.DefaultClient when nil
+}
+
+// Notify posts n to the webhook and fails unless it answers with a 2xx status
+func (w Webhook) Notify(ctx context.Context, n Notification) error {
+	data, err := json.Marshal(map[string]string{"text": notificationText(n, "")})
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to call webhook: %s", resp.Status)
+	}
+	return nil
+}
+
+// notificationText renders n as text, with the title between bold markers
+func notificationText(n Notification, bold string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s%s%s\n", bold, n.Title, bold)
+	if n.Cluster != "" {
+		fmt.Fprintf(&b, "Cluster: %s\n", n.Cluster)
+	}
+	summary := n.Summary
+	if len(summary) > maxSummary {
+		summary = summary[:maxSummary] + "\n… (truncated)"
+	}
+	if summary != "" {
+		fmt.Fprintf(&b, "```%s```\n", summary)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
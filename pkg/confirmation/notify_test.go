@@ -0,0 +1,81 @@
+package confirmation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var testNotification = Notification{
+	Title:   "Slice 1 of 3 applied: 2 of 6 changes done",
+	Summary: "default: domino-eks-1.33-v20251001 → domino-eks-1.33-v20251101\n",
+	Cluster: "prod",
+}
+
+func TestWebhookNotify(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s with Content-Type %q, want a JSON POST", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	if err := (Webhook{URL: srv.URL}).Notify(context.Background(), testNotification); err != nil {
+		t.Fatal(err)
+	}
+	want := "Slice 1 of 3 applied: 2 of 6 changes done\nCluster: prod\n```default: domino-eks-1.33-v20251001 → domino-eks-1.33-v20251101\n```"
+	if got["text"] != want {
+		t.Errorf("text = %q, want %q", got["text"], want)
+	}
+}
+
+func TestWebhookNotifyStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such hook", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	err := (Webhook{URL: srv.URL}).Notify(context.Background(), testNotification)
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Notify() error = %v, want the status", err)
+	}
+}
+
+func TestSlackNotify(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat.postMessage" || r.Header.Get("Authorization") != "Bearer xoxb-test" {
+			t.Errorf("got %s with Authorization %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.Write([]byte(`{"ok": true, "channel": "C0123", "ts": "1.0"}`))
+	}))
+	defer srv.Close()
+
+	s := Slack{Token: "xoxb-test", Channel: "C0123", BaseURL: srv.URL}
+	if err := s.Notify(context.Background(), testNotification); err != nil {
+		t.Fatal(err)
+	}
+	if got["channel"] != "C0123" || !strings.HasPrefix(got["text"], "*Slice 1 of 3 applied: 2 of 6 changes done*\n") {
+		t.Errorf("posted %v, want the bold title in C0123", got)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok": false, "error": "channel_not_found"}`))
+	}))
+	defer failing.Close()
+	s.BaseURL = failing.URL
+	if err := s.Notify(context.Background(), testNotification); err == nil || !strings.Contains(err.Error(), "channel_not_found") {
+		t.Errorf("Notify() error = %v, want channel_not_found", err)
+	}
+}
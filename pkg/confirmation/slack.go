@@ -0,0 +1,227 @@
+package confirmation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+)
+
+// Defaults for Slack approvals
+const (
+	DefaultSlackURL      = "https://slack.com/api"
+	DefaultSlackTimeout  = 30 * time.Minute
+	DefaultSlackInterval = 10 * time.Second
+)
+
+// Reactions that answer a Slack approval request
+const (
+	approveReaction = "white_check_mark"
+	rejectReaction  = "x"
+)
+
+// maxSummary bounds the plan text posted to Slack, which truncates long messages
+const maxSummary = 3000
+
+// Slack posts the request to a channel and waits for an approver to react with :white_check_mark: to
+// approve or :x: to reject. The bot token needs the chat:write and reactions:read scopes.
+type Slack struct {
+	Token     string
+	Channel   string        // channel ID, e.g. C0123456789
+	Approvers []string      // user IDs allowed to answer; anyone in the channel when empty
+	Timeout   time.Duration // how long to wait for an answer; DefaultSlackTimeout when zero
+	Interval  time.Duration // how often the reactions are polled; DefaultSlackInterval when zero
+	BaseURL   string        // Web API URL; DefaultSlackURL when empty
+	Client    *http.Client  // http.DefaultClient when nil
+	Clock     clock.Clock
+}
+
+// Confirm posts req and polls the message's reactions until it is answered or the timeout passes. A
+// rejection wins over an approval given at the same time. The outcome is posted in the message's thread.
+func (s Slack) Confirm(ctx context.Context, req Request) (Decision, error) {
+	clk := clock.OrReal(s.Clock)
+	timeout, interval := s.Timeout, s.Interval
+	if timeout <= 0 {
+		timeout = DefaultSlackTimeout
+	}
+	if interval <= 0 {
+		interval = DefaultSlackInterval
+	}
+
+	var posted struct {
+		Channel string `json:"channel"`
+		TS      string `json:"ts"`
+	}
+	err := s.call(ctx, "chat.postMessage", map[string]string{"channel": s.Channel, "text": s.message(req)}, &posted)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	d := Decision{Provider: ProviderSlack}
+	deadline := clk.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		approvedBy, rejectedBy, err := s.answers(ctx, posted.Channel, posted.TS)
+		if err != nil {
+			return Decision{}, err
+		}
+		switch {
+		case rejectedBy != "":
+			d.By, d.Reason = rejectedBy, "rejected in Slack"
+		case approvedBy != "":
+			d.By, d.Approved = approvedBy, true
+		}
+		if d.By != "" {
+			s.reply(ctx, posted.Channel, posted.TS, d)
+			return d, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			s.reply(context.WithoutCancel(ctx), posted.Channel, posted.TS, Decision{Reason: "the run was cancelled"})
+			return Decision{}, ctx.Err()
+		case <-deadline.C():
+			d.Reason = fmt.Sprintf("no answer in Slack within %s", timeout)
+			s.reply(ctx, posted.Channel, posted.TS, d)
+			return d, nil
+		case <-clk.After(interval):
+		}
+	}
+}
+
+// message renders the request as a Slack message
+func (s Slack) message(req Request) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%s*\nCluster: %s\n", req.Question, req.Cluster)
+	if req.Operator != "" {
+		fmt.Fprintf(&b, "Operator: %s\n", req.Operator)
+	}
+	summary := req.Summary
+	if len(summary) > maxSummary {
+		summary = summary[:maxSummary] + "\n… (truncated)"
+	}
+	if summary != "" {
+		fmt.Fprintf(&b, "```%s```\n", summary)
+	}
+	fmt.Fprintf(&b, "React with :%s: to approve or :%s: to reject.", approveReaction, rejectReaction)
+	return b.String()
+}
+
+// answers returns the first allowed user who reacted to approve and to reject the message, if any
+func (s Slack) answers(ctx context.Context, channel, ts string) (approvedBy, rejectedBy string, err error) {
+	var got struct {
+		Message struct {
+			Reactions []struct {
+				Name  string   `json:"name"`
+				Users []string `json:"users"`
+			} `json:"reactions"`
+		} `json:"message"`
+	}
+	params := url.Values{"channel": {channel}, "timestamp": {ts}, "full": {"true"}}
+	if err := s.get(ctx, "reactions.get", params, &got); err != nil {
+		return "", "", err
+	}
+	for _, r := range got.Message.Reactions {
+		for _, user := range r.Users {
+			if len(s.Approvers) > 0 && !slices.Contains(s.Approvers, user) {
+				continue
+			}
+			switch {
+			case r.Name == approveReaction && approvedBy == "":
+				approvedBy = user
+			case r.Name == rejectReaction && rejectedBy == "":
+				rejectedBy = user
+			}
+		}
+	}
+	return approvedBy, rejectedBy, nil
+}
+
+// reply posts the outcome in the thread of the request; failures are ignored since the decision stands
+func (s Slack) reply(ctx context.Context, channel, ts string, d Decision) {
+	text := "Not approved: " + d.Reason
+	switch {
+	case d.Approved:
+		text = fmt.Sprintf("Approved by <@%s>, applying", d.By)
+	case d.By != "":
+		text = fmt.Sprintf("Rejected by <@%s>", d.By)
+	}
+	s.call(ctx, "chat.postMessage", map[string]string{"channel": channel, "thread_ts": ts, "text": text}, nil)
+}
+
+// call posts body as JSON to the Web API method and decodes the response into result unless it is nil
+func (s Slack) call(ctx context.Context, method string, body any, result any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to call Slack %s: %w", method, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL()+"/"+method, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to call Slack %s: %w", method, err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	return s.do(req, method, result)
+}
+
+// get calls the Web API method with params in the query string and decodes the response into result
+func (s Slack) get(ctx context.Context, method string, params url.Values, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL()+"/"+method+"?"+params.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to call Slack %s: %w", method, err)
+	}
+	return s.do(req, method, result)
+}
+
+// do sends the request with the bot token and checks the Web API's ok flag
+func (s Slack) do(req *http.Request, method string, result any) error {
+	req.Header.Set("Authorization", "Bearer "+s.Token)
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call Slack %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to call Slack %s: %s", method, resp.Status)
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return fmt.Errorf("failed to decode Slack %s response: %w", method, err)
+	}
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &status); err != nil {
+		return fmt.Errorf("failed to decode Slack %s response: %w", method, err)
+	}
+	if !status.OK {
+		return fmt.Errorf("failed to call Slack %s: %s", method, status.Error)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(raw, result); err != nil {
+		return fmt.Errorf("failed to decode Slack %s response: %w", method, err)
+	}
+	return nil
+}
+
+// baseURL returns the Web API URL without a trailing slash
+func (s Slack) baseURL() string {
+	if s.BaseURL == "" {
+		return DefaultSlackURL
+	}
+	return strings.TrimSuffix(s.BaseURL, "/")
+}
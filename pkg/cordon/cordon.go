@@ -0,0 +1,142 @@
+// Package cordon marks the nodes of old-AMI nodeclaims unschedulable as soon as an applied plan makes them
+// drift, so pods evicted by one replacement don't land on a node that is about to be replaced as well
+package cordon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/retry"
+)
+
+// ErrUnsupported is returned when the KubeClient cannot cordon nodes
+var ErrUnsupported = errors.New("the Kubernetes client cannot cordon nodes")
+
+// Defaults for waiting on drift
+const (
+	DefaultTimeout  = 5 * time.Minute
+	DefaultInterval = 10 * time.Second
+)
+
+// Result is the outcome of Drifted
+type Result struct {
+	Cordoned  []string // nodes cordoned, in the order their nodeclaims drifted
+	Undrifted []string // nodeclaims that had not drifted when the wait ended, e.g. already on the new AMI
+}
+
+// Cordoner cordons the nodes of drifting nodeclaims
+type Cordoner struct {
+	Kube     clients.KubeClient
+	Clock    clock.Clock
+	Timeout  time.Duration // how long to wait for the nodeclaims to drift; DefaultTimeout when zero
+	Interval time.Duration // how often the nodeclaims are polled; DefaultInterval when zero
+}
+
+// New creates a Cordoner using kube and the system clock
+func New(kube clients.KubeClient) *Cordoner {
+	return &Cordoner{Kube: kube, Clock: clock.Real}
+}
+
+// Drifted waits for the nodeclaims of the nodeclasses to drift, cordoning each node as soon as its
+// nodeclaim is marked drifted and calling onCordon with it. Only the nodeclaims that exist when it is
+// called are waited for; it returns once each of them drifted or is gone, or the timeout passed. Nodeclaims
+// that never drift, such as ones already running the new AMI, are left schedulable. Failures to cordon a
+// node are joined and don't stop the others.
+func (c *Cordoner) Drifted(ctx context.Context, nodeClasses []string, onCordon func(node string)) (*Result, error) {
+	cordoner, ok := c.Kube.(clients.Cordoner)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	clk := clock.OrReal(c.Clock)
+	timeout, interval := c.Timeout, c.Interval
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	changed := make(map[string]bool, len(nodeClasses))
+	for _, name := range nodeClasses {
+		changed[name] = true
+	}
+
+	statuses, err := nodeclasses.GetNodeClaimStatuses(ctx, c.Kube, clk.Now())
+	if err != nil {
+		return nil, err
+	}
+	waiting := make(map[string]bool) // nodeclaims of the changed nodeclasses that haven't drifted yet
+	for _, s := range statuses {
+		if changed[s.NodeClass] && !s.Terminating {
+			waiting[s.Name] = true
+		}
+	}
+
+	result := &Result{}
+	var errs []error
+	deadline := clk.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		for _, s := range statuses {
+			if !waiting[s.Name] || !s.Drifted {
+				continue
+			}
+			delete(waiting, s.Name)
+			// A nodeclaim without a node yet has no pods to protect
+			if s.NodeName == "" || s.Terminating {
+				continue
+			}
+			err := retry.Do(ctx, retry.Default, func(ctx context.Context) error {
+				return cordoner.Cordon(ctx, s.NodeName)
+			})
+			if err != nil {
+				if ctx.Err() != nil {
+					return result, ctx.Err()
+				}
+				errs = append(errs, fmt.Errorf("failed to cordon node %s: %w", s.NodeName, err))
+				continue
+			}
+			result.Cordoned = append(result.Cordoned, s.NodeName)
+			if onCordon != nil {
+				onCordon(s.NodeName)
+			}
+		}
+		if len(waiting) == 0 {
+			return result, errors.Join(errs...)
+		}
+
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-deadline.C():
+			for name := range waiting {
+				result.Undrifted = append(result.Undrifted, name)
+			}
+			sort.Strings(result.Undrifted)
+			return result, errors.Join(errs...)
+		case <-clk.After(interval):
+		}
+
+		if statuses, err = nodeclasses.GetNodeClaimStatuses(ctx, c.Kube, clk.Now()); err != nil {
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+			return result, errors.Join(append(errs, err)...)
+		}
+		// Nodeclaims that are gone were replaced before they were seen drifting
+		present := make(map[string]bool, len(statuses))
+		for _, s := range statuses {
+			present[s.Name] = true
+		}
+		for name := range waiting {
+			if !present[name] {
+				delete(waiting, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Package freeze checks the change calendar for freeze windows during which clusters must not be upgraded
+// without an approved exception
+package freeze
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/remote"
+)
+
+// ErrFrozen is returned when a freeze window is active and no exception was given
+var ErrFrozen = errors.New("change freeze in effect")
+
+// Window is a period during which changes to the matching clusters are frozen
+type Window struct {
+	Name     string    `json:"name"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Clusters []string  `json:"clusters,omitempty"` // glob patterns of the kubeconfig contexts it covers; every cluster when empty
+	Reason   string    `json:"reason,omitempty"`
+}
+
+// covers reports whether the window is in effect for the cluster at t
+func (w Window) covers(cluster string, t time.Time) bool {
+	if t.Before(w.Start) || !t.Before(w.End) {
+		return false
+	}
+	if len(w.Clusters) == 0 {
+		return true
+	}
+	for _, pattern := range w.Clusters {
+		if ok, _ := path.Match(pattern, cluster); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Calendar is the change calendar document served by the change-management endpoint, e.g.
+//
+//	{"windows": [{"name": "Q4 freeze", "start": "2025-12-15T00:00:00Z", "end": "2026-01-05T00:00:00Z", "clusters": ["prod-*"]}]}
+type Calendar struct {
+	Windows []Window `json:"windows"`
+}
+
+// Parse decodes a calendar document, checking that every window ends after it starts
+func Parse(data []byte) (*Calendar, error) {
+	var c Calendar
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse change calendar: %w", err)
+	}
+	for _, w := range c.Windows {
+		if !w.End.After(w.Start) {
+			return nil, fmt.Errorf("failed to parse change calendar: window %q ends before it starts", w.Name)
+		}
+		for _, pattern := range w.Clusters {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("failed to parse change calendar: window %q: invalid cluster pattern %q", w.Name, pattern)
+			}
+		}
+	}
+	return &c, nil
+}
+
+// Load fetches and decodes the calendar at source (see remote.Fetch)
+func Load(ctx context.Context, reader clients.ObjectReader, source string) (*Calendar, error) {
+	data, err := remote.Fetch(ctx, reader, source)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Active returns the windows in effect for the cluster at t, ending soonest first
+func (c *Calendar) Active(cluster string, t time.Time) []Window {
+	var active []Window
+	for _, w := range c.Windows {
+		if w.covers(cluster, t) {
+			active = append(active, w)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].End.Before(active[j].End)
+	})
+	return active
+}
+
+// Decision records whether a run was allowed to change a cluster, for the audit trail
+type Decision struct {
+	Cluster   string    `json:"cluster"`
+	At        time.Time `json:"at"`
+	Windows   []Window  `json:"windows,omitempty"`   // active freeze windows
+	Exception string    `json:"exception,omitempty"` // change exception the run proceeded under
+	Error     string    `json:"error,omitempty"`     // why the calendar could not be checked
+	Allowed   bool      `json:"allowed"`
+}
+
+// Decide allows a change to the cluster at t when no window is active or an exception ID is given.
+// A calendar that could not be loaded (loadErr) only allows the change under an exception.
+func Decide(c *Calendar, loadErr error, cluster string, t time.Time, exception string) Decision {
+	d := Decision{Cluster: cluster, At: t, Exception: exception}
+	if loadErr != nil {
+		d.Error = loadErr.Error()
+	} else {
+		d.Windows = c.Active(cluster, t)
+	}
+	d.Allowed = exception != "" || (loadErr == nil && len(d.Windows) == 0)
+	return d
+}
+
+// Err returns why the change is refused, or nil when it is allowed
+func (d Decision) Err() error {
+	if d.Allowed {
+		return nil
+	}
+	if d.Error != "" {
+		return fmt.Errorf("cannot check the change calendar: %s", d.Error)
+	}
+	names := make([]string, 0, len(d.Windows))
+	for _, w := range d.Windows {
+		names = append(names, fmt.Sprintf("%s until %s", w.Name, w.End.Format(time.RFC3339)))
+	}
+	return fmt.Errorf("%w: %s", ErrFrozen, strings.Join(names, ", "))
+}
@@ -0,0 +1,320 @@
+package history
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+)
+
+// Resolution records how long a single nodeclaim stayed drifted before it was replaced or undrifted
+type Resolution struct {
+	NodeClaim  string    `json:"nodeClaim"`
+	NodeClass  string    `json:"nodeClass"`
+	ProviderID string    `json:"providerID,omitempty"`
+	Replaced   bool      `json:"replaced"` // true if the nodeclaim was deleted rather than undrifted
+	DriftedAt  time.Time `json:"driftedAt"`
+	ResolvedAt time.Time `json:"resolvedAt"`
+}
+
+// Duration returns the time between the nodeclaim drifting and the drift being resolved
+func (r Resolution) Duration() time.Duration {
+	return r.ResolvedAt.Sub(r.DriftedAt)
+}
+
+// Change records the outcome of a nodeclass update applied by a run
+type Change struct {
+	NodeClass string `json:"nodeClass"`
+	OldAMI    string `json:"oldAMI"`
+	NewAMI    string `json:"newAMI"`
+	Status    string `json:"status"` // as in the final report: updated, failed or not-applied
+	Error     string `json:"error,omitempty"`
+}
+
+// Change statuses that matter when comparing with a later run
+const (
+	ChangeUpdated = "updated"
+	ChangeFailed  = "failed"
+)
+
+// Run records the drift resolutions observed during a single run of the tool, and the nodeclass updates it
+// applied
+type Run struct {
+	ID          string       `json:"id,omitempty"` // see NewRunID; empty for runs that changed nothing
+	Cluster     string       `json:"cluster"`
+	Command     string       `json:"command"`
+	StartedAt   time.Time    `json:"startedAt"`
+	FinishedAt  time.Time    `json:"finishedAt"`
+	Resolutions []Resolution `json:"resolutions"`
+	ToolVersion string       `json:"toolVersion,omitempty"` // build of the tool that made the run
+	Operator    string       `json:"operator,omitempty"`    // who ran the tool
+	Changes     []Change     `json:"changes,omitempty"`
+	Monitored   bool         `json:"monitored,omitempty"` // the run followed the nodeclaims after applying
+	Reverted    bool         `json:"reverted,omitempty"`  // the updated nodeclasses were reverted after a failure
+}
+
+// NewRunID returns an ID for a run started at t, e.g. 20251016-221500-3f9a2c: sortable by start time, with a
+// random suffix telling apart runs started in the same second
+func NewRunID(t time.Time) string {
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		// crypto/rand doesn't fail on supported platforms; the nanoseconds still tell most runs apart
+		return t.UTC().Format("20060102-150405") + fmt.Sprintf("-%06x", t.Nanosecond()&0xffffff)
+	}
+	return t.UTC().Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// Duration returns how long the run took
+func (r Run) Duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// LastUpgrade returns the most recent run on cluster that applied nodeclass updates, or nil if there is none
+func LastUpgrade(runs []Run, cluster string) *Run {
+	var last *Run
+	for i, run := range runs {
+		if run.Cluster != cluster || len(run.Changes) == 0 {
+			continue
+		}
+		if last == nil || run.StartedAt.After(last.StartedAt) {
+			last = &runs[i]
+		}
+	}
+	return last
+}
+
+// Comparison relates the nodeclasses about to be updated to the previous run's updates
+type Comparison struct {
+	Previous *Run     `json:"-"`
+	Repeated []Change `json:"repeated"` // previous updates of nodeclasses that are being moved again
+	Failed   []Change `json:"failed"`   // previous updates that failed, whether or not they are being retried
+}
+
+// Compare relates the nodeclasses about to be updated to the updates of prev. Updates the previous run
+// reverted don't count as moves.
+func Compare(prev *Run, nodeClasses []string) *Comparison {
+	moving := make(map[string]bool, len(nodeClasses))
+	for _, name := range nodeClasses {
+		moving[name] = true
+	}
+	c := &Comparison{Previous: prev}
+	for _, ch := range prev.Changes {
+		switch {
+		case ch.Status == ChangeFailed:
+			c.Failed = append(c.Failed, ch)
+		case ch.Status == ChangeUpdated && !prev.Reverted && moving[ch.NodeClass]:
+			c.Repeated = append(c.Repeated, ch)
+		}
+	}
+	return c
+}
+
+// DefaultPath returns the default location of the history file
+func DefaultPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine home directory: %w", err)
+	}
+	return filepath.Join(home, ".upgrade-ami", "history.json"), nil
+}
+
+// Load reads all recorded runs from path, returning no runs if the file does not exist
+func Load(path string) ([]Run, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	var runs []Run
+	if err := json.Unmarshal(data, &runs); err != nil {
+		return nil, fmt.Errorf("failed to parse history: %w", err)
+	}
+	return runs, nil
+}
+
+// Append adds a run to the history file at path
+func Append(path string, run Run) error {
+	runs, err := Load(path)
+	if err != nil {
+		return err
+	}
+	runs = append(runs, run)
+
+	data, err := json.MarshalIndent(runs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal history: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	// Write to a temporary file first so an interrupted write can't corrupt the history
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
+
+// Tracker follows nodeclaim statuses across polls and records when drift gets resolved
+type Tracker struct {
+	drifted     map[string]Resolution // nodeclaim name -> pending resolution
+	resolutions []Resolution
+}
+
+// NewTracker creates an empty Tracker
+func NewTracker() *Tracker {
+	return &Tracker{drifted: make(map[string]Resolution)}
+}
+
+// Observe updates the tracker with the statuses from one poll taken at now
+func (t *Tracker) Observe(statuses []nodeclasses.NodeClaimStatus, now time.Time) {
+	seen := make(map[string]bool)
+	for _, status := range statuses {
+		seen[status.Name] = true
+
+		pending, tracked := t.drifted[status.Name]
+		switch {
+		case status.Drifted && !tracked:
+			driftedAt := status.DriftedSince
+			if driftedAt.IsZero() {
+				driftedAt = now
+			}
+			t.drifted[status.Name] = Resolution{
+				NodeClaim:  status.Name,
+				NodeClass:  status.NodeClass,
+				ProviderID: status.ProviderID,
+				DriftedAt:  driftedAt,
+			}
+		case !status.Drifted && tracked:
+			t.resolve(pending, now, false)
+		}
+	}
+
+	// Drifted nodeclaims that disappeared have been replaced
+	for name, pending := range t.drifted {
+		if !seen[name] {
+			t.resolve(pending, now, true)
+		}
+	}
+}
+
+func (t *Tracker) resolve(pending Resolution, now time.Time, replaced bool) {
+	pending.ResolvedAt = now
+	pending.Replaced = replaced
+	t.resolutions = append(t.resolutions, pending)
+	delete(t.drifted, pending.NodeClaim)
+}
+
+// Resolutions returns the drift resolutions observed so far
+func (t *Tracker) Resolutions() []Resolution {
+	return t.resolutions
+}
+
+// Median returns the median of durations, or zero if there are none
+func Median(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// Percentile returns the p-th percentile (0-100) of durations using the nearest-rank method, or zero if there are none
+func Percentile(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// ReplacementDurations returns the durations of the resolutions where the nodeclaim was replaced
+func ReplacementDurations(resolutions []Resolution) []time.Duration {
+	var durations []time.Duration
+	for _, r := range resolutions {
+		if r.Replaced {
+			durations = append(durations, r.Duration())
+		}
+	}
+	return durations
+}
+
+// PeriodSummary aggregates the runs recorded during one calendar month
+type PeriodSummary struct {
+	Month        string // YYYY-MM
+	Runs         int
+	Replacements int
+	Median       time.Duration
+}
+
+// MonthlySummaries groups runs for cluster (all clusters when empty) by the month they started in, oldest first
+func MonthlySummaries(runs []Run, cluster string) []PeriodSummary {
+	type bucket struct {
+		runs      int
+		durations []time.Duration
+	}
+	buckets := make(map[string]*bucket)
+
+	for _, run := range runs {
+		if cluster != "" && run.Cluster != cluster {
+			continue
+		}
+
+		month := run.StartedAt.Format("2006-01")
+		b, ok := buckets[month]
+		if !ok {
+			b = &bucket{}
+			buckets[month] = b
+		}
+		b.runs++
+		for _, r := range run.Resolutions {
+			b.durations = append(b.durations, r.Duration())
+		}
+	}
+
+	var summaries []PeriodSummary
+	for month, b := range buckets {
+		summaries = append(summaries, PeriodSummary{
+			Month:        month,
+			Runs:         b.runs,
+			Replacements: len(b.durations),
+			Median:       Median(b.durations),
+		})
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Month < summaries[j].Month
+	})
+
+	return summaries
+}
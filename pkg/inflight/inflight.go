@@ -0,0 +1,100 @@
+// Package inflight detects rollouts still in progress on a cluster: nodeclaims Karpenter has yet to replace
+// after an earlier change, and runs left unfinished. Starting another upgrade on top of them would mix two
+// changes in the same rollout, so neither monitoring nor a rollback could tell them apart.
+package inflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/runstate"
+)
+
+// ErrInFlight is returned when a new upgrade would overlap a rollout still in progress
+var ErrInFlight = errors.New("a previous rollout is still in flight")
+
+// Rollout is what is still in flight on a cluster
+type Rollout struct {
+	Cluster string            `json:"cluster"`
+	Drifted map[string]int    `json:"drifted,omitempty"` // drifted nodeclaims by nodeclass
+	Runs    []*runstate.State `json:"runs,omitempty"`    // unfinished runs recorded for the cluster
+}
+
+// Active reports whether anything is in flight
+func (r *Rollout) Active() bool {
+	return len(r.Drifted) > 0 || len(r.Runs) > 0
+}
+
+// DriftedCount is the number of drifted nodeclaims
+func (r *Rollout) DriftedCount() int {
+	n := 0
+	for _, count := range r.Drifted {
+		n += count
+	}
+	return n
+}
+
+// Err returns ErrInFlight summarizing the rollout, or nil when nothing is in flight
+func (r *Rollout) Err() error {
+	if !r.Active() {
+		return nil
+	}
+	var parts []string
+	if len(r.Drifted) > 0 {
+		parts = append(parts, fmt.Sprintf("%d nodeclaims still drifted", r.DriftedCount()))
+	}
+	if len(r.Runs) > 0 {
+		parts = append(parts, fmt.Sprintf("%d unfinished runs", len(r.Runs)))
+	}
+	return fmt.Errorf("%w on %s: %s", ErrInFlight, r.Cluster, strings.Join(parts, ", "))
+}
+
+// NodeClasses returns the nodeclasses with drifted nodeclaims, sorted
+func (r *Rollout) NodeClasses() []string {
+	names := make([]string, 0, len(r.Drifted))
+	for name := range r.Drifted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Detect finds the drifted nodeclaims and unfinished runs of the cluster. resumed is the state of the run
+// being resumed, if any: its own record and the drift of the nodeclasses it already changed belong to the
+// run and don't count. store may be nil when runs aren't recorded.
+func Detect(ctx context.Context, kube clients.KubeClient, store *runstate.Store, cluster string, resumed *runstate.State, now time.Time) (*Rollout, error) {
+	r := &Rollout{Cluster: cluster}
+
+	statuses, err := nodeclasses.GetNodeClaimStatuses(ctx, kube, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for drifted nodeclaims: %w", err)
+	}
+	for _, s := range statuses {
+		if !s.Drifted || (resumed != nil && resumed.Done(s.NodeClass)) {
+			continue
+		}
+		if r.Drifted == nil {
+			r.Drifted = make(map[string]int)
+		}
+		r.Drifted[s.NodeClass]++
+	}
+
+	if store != nil {
+		states, err := store.List(cluster)
+		if err != nil {
+			return nil, err
+		}
+		for _, st := range states {
+			if resumed == nil || st.PlanID != resumed.PlanID {
+				r.Runs = append(r.Runs, st)
+			}
+		}
+	}
+	return r, nil
+}
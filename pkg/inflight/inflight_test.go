@@ -0,0 +1,112 @@
+package inflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients/fake"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/runstate"
+)
+
+var now = time.Date(2025, 10, 2, 12, 0, 0, 0, time.UTC)
+
+// addNodeClaim adds a ready nodeclaim of the nodeclass to kube
+func addNodeClaim(t *testing.T, kube *fake.KubeClient, name, nodeClass string, drifted bool) {
+	t.Helper()
+	condition := "False"
+	if drifted {
+		condition = "True"
+	}
+	err := kube.Add("nodeclaims.karpenter.sh", fmt.Sprintf(`{
+		"metadata": {"name": %q, "creationTimestamp": %q},
+		"spec": {"nodeClassRef": {"name": %q}},
+		"status": {"conditions": [{"type": "Ready", "status": "True"}, {"type": "Drifted", "status": %q}]}
+	}`, name, now.Add(-time.Hour).Format(time.RFC3339), nodeClass, condition))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	kube := fake.NewKubeClient()
+	addNodeClaim(t, kube, "default-1", "default", true)
+	addNodeClaim(t, kube, "default-2", "default", true)
+	addNodeClaim(t, kube, "gpu-1", "gpu", true)
+	addNodeClaim(t, kube, "gpu-2", "gpu", false)
+
+	store := &runstate.Store{Dir: t.TempDir()}
+	for _, st := range []*runstate.State{
+		{PlanID: "sha256:resumed", Cluster: "prod", StartedAt: now.Add(-2 * time.Hour), Completed: []string{"gpu"}},
+		{PlanID: "sha256:other", Cluster: "prod", StartedAt: now.Add(-time.Hour)},
+		{PlanID: "sha256:staging", Cluster: "staging", StartedAt: now.Add(-time.Hour)},
+	} {
+		if err := store.Save(st); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("new run", func(t *testing.T) {
+		r, err := Detect(context.Background(), kube, store, "prod", nil, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Drifted["default"] != 2 || r.Drifted["gpu"] != 1 || len(r.Drifted) != 2 {
+			t.Errorf("drifted = %v, want default: 2, gpu: 1", r.Drifted)
+		}
+		if len(r.Runs) != 2 || r.Runs[0].PlanID != "sha256:resumed" || r.Runs[1].PlanID != "sha256:other" {
+			t.Errorf("runs = %+v, want the two runs on prod, oldest first", r.Runs)
+		}
+		if !errors.Is(r.Err(), ErrInFlight) {
+			t.Errorf("Err() = %v, want ErrInFlight", r.Err())
+		}
+	})
+
+	t.Run("resumed run", func(t *testing.T) {
+		resumed, err := store.Load("sha256:resumed", "prod")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := Detect(context.Background(), kube, store, "prod", resumed, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The drift of the nodeclasses the resumed run changed is its own
+		if r.Drifted["default"] != 2 || len(r.Drifted) != 1 {
+			t.Errorf("drifted = %v, want default: 2", r.Drifted)
+		}
+		if len(r.Runs) != 1 || r.Runs[0].PlanID != "sha256:other" {
+			t.Errorf("runs = %+v, want only the other run", r.Runs)
+		}
+	})
+
+	t.Run("without a store", func(t *testing.T) {
+		r, err := Detect(context.Background(), kube, nil, "prod", nil, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r.Runs) != 0 || r.DriftedCount() != 3 {
+			t.Errorf("rollout = %+v, want 3 drifted nodeclaims and no runs", r)
+		}
+	})
+
+	t.Run("nothing in flight", func(t *testing.T) {
+		r, err := Detect(context.Background(), fake.NewKubeClient(), &runstate.Store{Dir: t.TempDir()}, "prod", nil, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Active() || r.Err() != nil {
+			t.Errorf("rollout = %+v, err %v; want nothing in flight", r, r.Err())
+		}
+	})
+
+	t.Run("list error", func(t *testing.T) {
+		failing := fake.NewKubeClient()
+		failing.Err = errors.New("connection refused")
+		if _, err := Detect(context.Background(), failing, store, "prod", nil, now); err == nil {
+			t.Error("Detect() error = nil, want the list error")
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package instances
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+)
+
+// providerIDPattern matches AWS provider IDs like aws:///us-west-2a/i-0123456789abcdef0
+var providerIDPattern = regexp.MustCompile(`^aws:///([a-z0-9-]+?)[a-z]?/(i-[0-9a-f]+)$`)
+
+// Instance identifies an EC2 instance and the region it runs in
+type Instance struct {
+	ID     string
+	Region string
+}
+
+// ParseProviderID extracts the instance ID and region from a Kubernetes AWS provider ID
+func ParseProviderID(providerID string) (Instance, error) {
+	matches := providerIDPattern.FindStringSubmatch(providerID)
+	if len(matches) != 3 {
+		return Instance{}, fmt.Errorf("invalid AWS provider ID: %s", providerID)
+	}
+	return Instance{ID: matches[2], Region: matches[1]}, nil
+}
+
+// GetInstanceStates returns the state name (running, shutting-down, terminated, ...) of each instance by ID.
+// Instances that EC2 no longer knows about are omitted.
+func GetInstanceStates(ctx context.Context, ec2 clients.EC2Client, instances []Instance) (map[string]string, error) {
+	byRegion := make(map[string][]string)
+	for _, inst := range instances {
+		byRegion[inst.Region] = append(byRegion[inst.Region], inst.ID)
+	}
+
+	states := make(map[string]string)
+	for region, ids := range byRegion {
+		regionStates, err := ec2.DescribeInstanceStates(ctx, region, ids)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe instances in %s: %w", region, err)
+		}
+		for id, state := range regionStates {
+			states[id] = state
+		}
+	}
+
+	return states, nil
+}
+
+// WaitForTermination polls the given instances until they are all terminated or the timeout elapses,
+// returning the instances that are still not terminated mapped to their last known state
+func WaitForTermination(ctx context.Context, clk clock.Clock, ec2 clients.EC2Client, instances []Instance, timeout, interval time.Duration) (map[string]string, error) {
+	deadline := clk.Now().Add(timeout)
+
+	for {
+		states, err := GetInstanceStates(ctx, ec2, instances)
+		if err != nil {
+			return nil, err
+		}
+
+		remaining := make(map[string]string)
+		for _, inst := range instances {
+			state, ok := states[inst.ID]
+			if ok && state != "terminated" {
+				remaining[inst.ID] = state
+			}
+		}
+
+		if len(remaining) == 0 || clk.Now().After(deadline) {
+			return remaining, nil
+		}
+
+		select {
+		case <-clk.After(interval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// SortedIDs returns the instance IDs of a state map in a stable order
+func SortedIDs(states map[string]string) []string {
+	ids := make([]string, 0, len(states))
+	for id := range states {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
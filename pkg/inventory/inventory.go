@@ -0,0 +1,237 @@
+// Package inventory collects what each EC2NodeClass runs: its AMI selector and the AMIs Karpenter resolved
+// it to, the NodePools using it, its nodeclaims and which AMIs their nodes run
+package inventory
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/amis"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+)
+
+// AMI is a resolved AMI of a nodeclass
+type AMI struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created,omitzero"` // zero if the image could not be looked up
+	AgeDays int       `json:"ageDays,omitempty"`
+}
+
+// NodeClass is the inventory of one EC2NodeClass
+type NodeClass struct {
+	Name        string         `json:"name"`
+	AMISelector string         `json:"amiSelector"`
+	AMIs        []AMI          `json:"amis"`
+	NodePools   []string       `json:"nodePools"`
+	NodeClaims  int            `json:"nodeClaims"`
+	Drifted     int            `json:"drifted"`
+	NodeAMIs    map[string]int `json:"nodeAMIs"` // image ID -> number of nodeclaims running it
+
+	// Missing is set for a nodeclass that doesn't exist but is referenced by nodeclaims, e.g. after it was
+	// deleted or renamed; only its nodeclaim fields are filled in
+	Missing bool `json:"missing,omitempty"`
+}
+
+// Inventory is the inventory of a cluster
+type Inventory struct {
+	Cluster     string      `json:"cluster"`
+	GeneratedAt time.Time   `json:"generatedAt"`
+	NodeClasses []NodeClass `json:"nodeClasses"`
+	Warnings    []string    `json:"warnings,omitempty"` // information that could not be collected
+}
+
+// Collect builds the inventory of the cluster as of now. AMI creation dates are looked up in EC2 on a best
+// effort basis; failures are reported in Warnings.
+func Collect(ctx context.Context, cs clients.Set, now time.Time) (*Inventory, error) {
+	cluster, err := nodeclasses.CurrentContext(ctx, cs.Kube)
+	if err != nil {
+		return nil, err
+	}
+	list, err := nodeclasses.GetEC2NodeClasses(ctx, cs.Kube)
+	if err != nil {
+		return nil, err
+	}
+	nodePools, err := nodeclasses.GetNodePools(ctx, cs.Kube)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := &Inventory{Cluster: cluster, GeneratedAt: now}
+	byName := make(map[string]*NodeClass)
+	owners := make(map[string]bool)
+	for _, nc := range list.Items {
+		item := NodeClass{Name: nc.Metadata.Name, AMIs: []AMI{}, NodePools: []string{}, NodeAMIs: make(map[string]int)}
+		if len(nc.Spec.AMISelectorTerms) > 0 {
+			item.AMISelector = nc.AMIName()
+			if owner := nc.AMIOwner(); owner != "" {
+				owners[owner] = true
+			}
+		}
+		for _, ami := range nc.Status.AMIs {
+			item.AMIs = append(item.AMIs, AMI{ID: ami.ID, Name: ami.Name})
+		}
+		inv.NodeClasses = append(inv.NodeClasses, item)
+	}
+	sort.Slice(inv.NodeClasses, func(i, j int) bool {
+		return inv.NodeClasses[i].Name < inv.NodeClasses[j].Name
+	})
+	for i := range inv.NodeClasses {
+		byName[inv.NodeClasses[i].Name] = &inv.NodeClasses[i]
+	}
+
+	for _, np := range nodePools {
+		if item, ok := byName[np.Spec.Template.Spec.NodeClassRef.Name]; ok {
+			item.NodePools = append(item.NodePools, np.Metadata.Name)
+		}
+	}
+
+	orphans := make(map[string]*NodeClass) // missing nodeclass -> its orphaned nodeclaims
+	err = nodeclasses.EachNodeClaim(ctx, cs.Kube, func(nc nodeclasses.NodeClaim) error {
+		name := nc.Spec.NodeClassRef.Name
+		item, ok := byName[name]
+		if !ok {
+			if item, ok = orphans[name]; !ok {
+				item = &NodeClass{Name: name, AMIs: []AMI{}, NodePools: []string{}, NodeAMIs: make(map[string]int), Missing: true}
+				orphans[name] = item
+			}
+		}
+		item.NodeClaims++
+		if isDrifted(nc) {
+			item.Drifted++
+		}
+		if nc.Status.ImageID != "" {
+			item.NodeAMIs[nc.Status.ImageID]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	inv.Warnings = addAMIDates(ctx, cs.EC2, owners, inv.NodeClasses, now)
+	inv.Warnings = append(inv.Warnings, addOrphans(inv, orphans)...)
+	return inv, nil
+}
+
+// addOrphans appends the missing nodeclasses referenced by nodeclaims to the inventory, sorted by name,
+// and returns a warning for each
+func addOrphans(inv *Inventory, orphans map[string]*NodeClass) []string {
+	names := make([]string, 0, len(orphans))
+	for name := range orphans {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var warnings []string
+	for _, name := range names {
+		item := orphans[name]
+		inv.NodeClasses = append(inv.NodeClasses, *item)
+		if name == "" {
+			warnings = append(warnings, fmt.Sprintf("%d nodeclaims reference no nodeclass", item.NodeClaims))
+		} else {
+			warnings = append(warnings, fmt.Sprintf("%d nodeclaims reference nodeclass %s, which does not exist", item.NodeClaims, name))
+		}
+	}
+	return warnings
+}
+
+// isDrifted reports whether the nodeclaim has a true drift condition
+func isDrifted(nc nodeclasses.NodeClaim) bool {
+	for _, condition := range nc.Status.Conditions {
+		if (condition.Type == "Drifted" || condition.Type == "Drift") && condition.Status == "True" {
+			return true
+		}
+	}
+	return false
+}
+
+// addAMIDates fills in the creation dates and ages of the resolved AMIs from the images of owners
+func addAMIDates(ctx context.Context, ec2 clients.EC2Client, owners map[string]bool, items []NodeClass, now time.Time) []string {
+	var warnings []string
+	created := make(map[string]time.Time) // image ID -> creation date
+	for owner := range owners {
+		images, err := amis.GetAvailableAMIs(ctx, ec2, owner)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("AMI ages of owner %s unavailable: %v", owner, err))
+			continue
+		}
+		for _, image := range images {
+			if t, ok := image.Created(); ok {
+				created[image.ImageID] = t
+			}
+		}
+	}
+	sort.Strings(warnings)
+
+	for i := range items {
+		for j := range items[i].AMIs {
+			ami := &items[i].AMIs[j]
+			if t, ok := created[ami.ID]; ok {
+				ami.Created = t
+				ami.AgeDays = int(now.Sub(t).Hours() / 24)
+			}
+		}
+	}
+	return warnings
+}
+
+// WriteJSON writes the inventory as indented JSON
+func WriteJSON(w io.Writer, inv *Inventory) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(inv); err != nil {
+		return fmt.Errorf("failed to encode inventory: %w", err)
+	}
+	return nil
+}
+
+// csvHeader are the columns of the CSV inventory; list values are separated by semicolons
+var csvHeader = []string{
+	"cluster", "nodeclass", "ami_selector", "ami_ids", "ami_names", "ami_age_days",
+	"nodepools", "nodeclaims", "drifted", "node_amis", "missing",
+}
+
+// WriteCSV writes the inventory as CSV, one row per nodeclass
+func WriteCSV(w io.Writer, inv *Inventory) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, item := range inv.NodeClasses {
+		var ids, names, ages []string
+		for _, ami := range item.AMIs {
+			ids = append(ids, ami.ID)
+			names = append(names, ami.Name)
+			if !ami.Created.IsZero() {
+				ages = append(ages, strconv.Itoa(ami.AgeDays))
+			} else {
+				ages = append(ages, "")
+			}
+		}
+
+		nodeAMIs := make([]string, 0, len(item.NodeAMIs))
+		for id, count := range item.NodeAMIs {
+			nodeAMIs = append(nodeAMIs, fmt.Sprintf("%s=%d", id, count))
+		}
+		sort.Strings(nodeAMIs)
+
+		cw.Write([]string{
+			inv.Cluster, item.Name, item.AMISelector,
+			strings.Join(ids, ";"), strings.Join(names, ";"), strings.Join(ages, ";"),
+			strings.Join(item.NodePools, ";"), strconv.Itoa(item.NodeClaims), strconv.Itoa(item.Drifted),
+			strings.Join(nodeAMIs, ";"), strconv.FormatBool(item.Missing),
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to write inventory: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package naming
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// DefaultParse matches domino-eks AMI names with or without a nodegroup, either with a date or
+// semantic version (domino-eks-gpu-1.33-v20251001, domino-eks-gpu-1.33-v1.4.2) or a wildcard
+// (domino-eks-gpu-1.33-*). Variant images carry the variant after the Kubernetes version
+// (domino-eks-gpu-1.33-fips-v20251001). Nodegroups are hyphen-separated segments of letters, digits, "_" and
+// ".", and a malformed version (domino-eks-gpu-1.33-v2025) is rejected rather than treated as a wildcard.
+const DefaultParse = `^domino-eks-(?:(?P<nodegroup>` + nodegroupPattern + `)-)?(?P<k8sVersion>1\.[0-9]+)-(?:(?P<variant>` + variantPattern + `)-)?(?:v(?P<version>[0-9]{8}|[0-9]+\.[0-9]+\.[0-9]+)|` + wildcardPattern + `)$`
+
+// nodegroupPattern matches nodegroup names: one or more hyphen-separated segments of letters, digits, "_"
+// and ".", e.g. GPU_large or gpu-v1.2. Empty segments are not allowed.
+const nodegroupPattern = `[A-Za-z0-9_.]+(?:-[A-Za-z0-9_.]+)*`
+
+// variantPattern matches the compliance variants of the built-in schemes
+const variantPattern = VariantFIPS
+
+// wildcardPattern matches the version part of a wildcard selector; it must contain a "*"
+const wildcardPattern = `[^*]*\*.*`
+
+// DefaultRender renders domino-eks AMI names, omitting the nodegroup and variant when empty
+const DefaultRender = `domino-eks-{{with .Nodegroup}}{{.}}-{{end}}{{.K8sVersion}}-{{with .Variant}}{{.}}-{{end}}v{{.Version}}`
+
+// Image variants. The standard variant is the empty string, so names without a variant are standard.
+const (
+	VariantStandard = ""
+	VariantFIPS     = "fips" // FIPS 140 validated crypto modules, hardened configuration
+)
+
+// ParseVariant converts a variant name as given on the command line ("standard", "fips") to a Fields.Variant
+func ParseVariant(name string) (string, error) {
+	switch name {
+	case "standard":
+		return VariantStandard, nil
+	case VariantFIPS:
+		return VariantFIPS, nil
+	}
+	return "", fmt.Errorf("unknown image variant %q (want standard or %s)", name, VariantFIPS)
+}
+
+// VariantName returns the display name of a variant
+func VariantName(variant string) string {
+	if variant == VariantStandard {
+		return "standard"
+	}
+	return variant
+}
+
+// Fields are the components of an AMI name
+type Fields struct {
+	Nodegroup  string // empty if the name has no nodegroup
+	K8sVersion string
+	Variant    string // compliance variant, e.g. VariantFIPS; VariantStandard if the name has none
+	Version    string // empty for wildcard selectors
+}
+
+// Scheme parses and renders AMI names according to a parse regex and a render template.
+// The regex must have a k8sVersion named group and may have nodegroup, variant and version groups;
+// the template can reference .Nodegroup, .K8sVersion, .Variant and .Version.
+type Scheme struct {
+	parse  *regexp.Regexp
+	render *template.Template
+
+	// Submatch indexes of the named groups, -1 if absent; looked up once since Parse runs for every AMI
+	nodegroupIdx, k8sVersionIdx, variantIdx, versionIdx int
+}
+
+// NewScheme compiles a naming scheme from a parse regex and a render template
+func NewScheme(parseRegex, renderTemplate string) (*Scheme, error) {
+	re, err := regexp.Compile(parseRegex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid naming parse regex: %w", err)
+	}
+	k8sVersionIdx := re.SubexpIndex("k8sVersion")
+	if k8sVersionIdx < 0 {
+		return nil, fmt.Errorf("naming parse regex must have a (?P<k8sVersion>...) group")
+	}
+
+	tmpl, err := template.New("ami-name").Option("missingkey=error").Parse(renderTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid naming render template: %w", err)
+	}
+
+	return &Scheme{
+		parse:         re,
+		render:        tmpl,
+		nodegroupIdx:  re.SubexpIndex("nodegroup"),
+		k8sVersionIdx: k8sVersionIdx,
+		variantIdx:    re.SubexpIndex("variant"),
+		versionIdx:    re.SubexpIndex("version"),
+	}, nil
+}
+
+// MustScheme is like NewScheme but panics on error
+func MustScheme(parseRegex, renderTemplate string) *Scheme {
+	s, err := NewScheme(parseRegex, renderTemplate)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Default is the domino-eks naming scheme
+var Default = MustScheme(DefaultParse, DefaultRender)
+
+// Parse extracts the fields of an AMI name, reporting whether the name matched the scheme
+func (s *Scheme) Parse(name string) (Fields, bool) {
+	matches := s.parse.FindStringSubmatch(name)
+	if matches == nil {
+		return Fields{}, false
+	}
+
+	group := func(i int) string {
+		if i >= 0 {
+			return matches[i]
+		}
+		return ""
+	}
+
+	return Fields{
+		Nodegroup:  group(s.nodegroupIdx),
+		K8sVersion: matches[s.k8sVersionIdx],
+		Variant:    group(s.variantIdx),
+		Version:    group(s.versionIdx),
+	}, true
+}
+
+// Render builds the AMI name for the given fields
+func (s *Scheme) Render(fields Fields) (string, error) {
+	var b strings.Builder
+	if err := s.render.Execute(&b, fields); err != nil {
+		return "", fmt.Errorf("failed to render AMI name: %w", err)
+	}
+	return b.String(), nil
+}
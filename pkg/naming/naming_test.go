@@ -0,0 +1,127 @@
+package naming_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/naming"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+)
+
+func FuzzParse(f *testing.F) {
+	for _, name := range []string{
+		"domino-eks-1.33-v20251001",
+		"domino-eks-gpu-1.33-v20251001",
+		"domino-eks-gpu-large-1.33-v1.4.2",
+		"domino-eks-gpu-1.33-fips-v20251001",
+		"domino-eks-1.33-*",
+		"domino-eks-gpu-1.33-v2025*",
+		"domino-eks-gpu-1.33-v2025",
+		"domino-eks--1.33-v20251001",
+		"domino-eks-1.33-fips-1.34-v20251001",
+		"domino-eks-GPU_large-1.33-v20251001",
+		"amazon-eks-node-al2023-x86_64-standard-1.33-v20251001",
+		"",
+	} {
+		f.Add(name)
+	}
+
+	f.Fuzz(func(t *testing.T, name string) {
+		fields, ok := naming.Default.Parse(name)
+
+		// ParseAMIName is Parse with the fields of a match as a pattern
+		pattern, err := nodeclasses.ParseAMIName(naming.Default, name)
+		if ok != (err == nil) {
+			t.Fatalf("Parse(%q) matched %v, but ParseAMIName returned error %v", name, ok, err)
+		}
+		if !ok {
+			if !errors.Is(err, nodeclasses.ErrAMIPatternUnrecognized) {
+				t.Fatalf("ParseAMIName(%q) error = %v, want ErrAMIPatternUnrecognized", name, err)
+			}
+			return
+		}
+		want := nodeclasses.AMIPattern{
+			HasNodegroup: fields.Nodegroup != "",
+			Nodegroup:    fields.Nodegroup,
+			K8sVersion:   fields.K8sVersion,
+			Variant:      fields.Variant,
+			Version:      fields.Version,
+		}
+		if *pattern != want {
+			t.Fatalf("ParseAMIName(%q) = %+v, want %+v", name, *pattern, want)
+		}
+
+		if fields.K8sVersion == "" {
+			t.Fatalf("Parse(%q) matched without a Kubernetes version", name)
+		}
+		if fields.Variant != naming.VariantStandard && fields.Variant != naming.VariantFIPS {
+			t.Fatalf("Parse(%q) variant = %q", name, fields.Variant)
+		}
+		if fields.Version == "" {
+			// A wildcard selector
+			if !strings.Contains(name, "*") {
+				t.Fatalf("Parse(%q) matched without a version or wildcard", name)
+			}
+			return
+		}
+
+		// A versioned name renders back to itself
+		rendered, err := naming.Default.Render(fields)
+		if err != nil {
+			t.Fatalf("Render(%+v): %v", fields, err)
+		}
+		if rendered != name {
+			t.Fatalf("Render(Parse(%q)) = %q", name, rendered)
+		}
+	})
+}
+
+func TestParseHyphenatedNodegroups(t *testing.T) {
+	tests := []struct {
+		name string
+		want naming.Fields
+	}{
+		{"domino-eks-1.33-v20251001", naming.Fields{K8sVersion: "1.33", Version: "20251001"}},
+		{"domino-eks-gpu-1.33-v20251001", naming.Fields{Nodegroup: "gpu", K8sVersion: "1.33", Version: "20251001"}},
+		{"domino-eks-gpu-large-1.33-v20251001", naming.Fields{Nodegroup: "gpu-large", K8sVersion: "1.33", Version: "20251001"}},
+		{"domino-eks-mem-opt-x2-1.34-v1.4.2", naming.Fields{Nodegroup: "mem-opt-x2", K8sVersion: "1.34", Version: "1.4.2"}},
+		{"domino-eks-gpu-large-1.33-fips-v20251001", naming.Fields{Nodegroup: "gpu-large", K8sVersion: "1.33", Variant: naming.VariantFIPS, Version: "20251001"}},
+		// A nodegroup may be named like a variant; only the segment after the Kubernetes version is one
+		{"domino-eks-fips-gpu-1.33-v20251001", naming.Fields{Nodegroup: "fips-gpu", K8sVersion: "1.33", Version: "20251001"}},
+		{"domino-eks-gpu-large-1.33-*", naming.Fields{Nodegroup: "gpu-large", K8sVersion: "1.33"}},
+		{"domino-eks-GPU-1.33-v20251001", naming.Fields{Nodegroup: "GPU", K8sVersion: "1.33", Version: "20251001"}},
+		{"domino-eks-gpu_large-x2.8-1.33-fips-v20251001", naming.Fields{Nodegroup: "gpu_large-x2.8", K8sVersion: "1.33", Variant: naming.VariantFIPS, Version: "20251001"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := naming.Default.Parse(tt.name)
+			if !ok || got != tt.want {
+				t.Fatalf("Parse() = %+v, %v; want %+v", got, ok, tt.want)
+			}
+			if got.Version == "" {
+				return
+			}
+			// A newer version of the same image keeps the whole nodegroup
+			got.Version = "20251101"
+			newAMI, err := naming.Default.Render(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again, ok := naming.Default.Parse(newAMI); !ok || again != got {
+				t.Errorf("Render() = %q, which parses as %+v, %v; want %+v", newAMI, again, ok, got)
+			}
+		})
+	}
+
+	for _, name := range []string{
+		"domino-eks-gpu--large-1.33-v20251001", // empty segment
+		"domino-eks--1.33-v20251001",
+		"domino-eks-gpu-large-1.33-v2025", // malformed version, not a wildcard
+		"domino-eks-gpu+large-1.33-v20251001",
+	} {
+		if fields, ok := naming.Default.Parse(name); ok {
+			t.Errorf("Parse(%q) = %+v, want no match", name, fields)
+		}
+	}
+}
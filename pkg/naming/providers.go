@@ -0,0 +1,61 @@
+package naming
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Provider parses and renders AMI names for one AMI family
+type Provider interface {
+	Parse(name string) (Fields, bool)
+	Render(fields Fields) (string, error)
+}
+
+// Built-in provider names
+const (
+	ProviderDominoEKS    = "domino-eks"
+	ProviderEKSAL2023    = "eks-al2023"
+	ProviderBottlerocket = "bottlerocket"
+)
+
+// EKSAL2023 is the official EKS optimized Amazon Linux 2023 naming, e.g.
+// amazon-eks-node-al2023-x86_64-standard-1.33-v20251001. The nodegroup holds the
+// architecture and variant (x86_64-standard, arm64-nvidia, ...).
+var EKSAL2023 = MustScheme(
+	`^amazon-eks-node-al2023-(?P<nodegroup>(?:x86_64|arm64)-[a-z0-9]+)-(?P<k8sVersion>1\.[0-9]+)-(?:v(?P<version>[0-9]{8})|`+wildcardPattern+`)$`,
+	`amazon-eks-node-al2023-{{.Nodegroup}}-{{.K8sVersion}}-v{{.Version}}`,
+)
+
+// Bottlerocket is the official Bottlerocket naming, e.g. bottlerocket-aws-k8s-1.33-x86_64-v1.45.0-5ad46d0c.
+// The FIPS variant is captured as the variant (bottlerocket-aws-k8s-1.33-fips-x86_64-...), the nodegroup
+// holds any other variant and the architecture (x86_64, nvidia-aarch64, ...) and the version is the
+// Bottlerocket release with its commit.
+var Bottlerocket = MustScheme(
+	`^bottlerocket-aws-k8s-(?P<k8sVersion>1\.[0-9]+)-(?:(?P<variant>`+variantPattern+`)-)?(?P<nodegroup>(?:[a-z]+-)?(?:x86_64|aarch64))-(?:v(?P<version>[0-9]+\.[0-9]+\.[0-9]+-[0-9a-f]+)|`+wildcardPattern+`)$`,
+	`bottlerocket-aws-k8s-{{.K8sVersion}}-{{with .Variant}}{{.}}-{{end}}{{.Nodegroup}}-v{{.Version}}`,
+)
+
+var providers = map[string]Provider{
+	ProviderDominoEKS:    Default,
+	ProviderEKSAL2023:    EKSAL2023,
+	ProviderBottlerocket: Bottlerocket,
+}
+
+// Lookup returns the built-in provider registered under name
+func Lookup(name string) (Provider, error) {
+	p, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown naming provider %q (available: %v)", name, Providers())
+	}
+	return p, nil
+}
+
+// Providers returns the names of the built-in providers
+func Providers() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
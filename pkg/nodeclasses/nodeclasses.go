@@ -1,28 +1,180 @@
 package nodeclasses
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
-	"os/exec"
-	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/cadence"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/naming"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/retry"
 )
 
+// ErrNoNodeClasses is returned when the cluster has no EC2NodeClass objects
+var ErrNoNodeClasses = errors.New("no EC2NodeClass objects found in cluster")
+
+// ErrAMIPatternUnrecognized is returned when an AMI name matches none of the supported naming patterns
+var ErrAMIPatternUnrecognized = errors.New("invalid AMI name format")
+
+// ErrConflict is returned when a nodeclass no longer selects the AMI an update was planned from, because it
+// was changed another way since
+var ErrConflict = errors.New("nodeclass changed since it was planned")
+
+// ErrPartialApply is matched by an *ApplyError when some nodeclass updates failed
+var ErrPartialApply = errors.New("some nodeclass updates failed")
+
+// ItemError records why a single nodeclass could not be updated
+type ItemError struct {
+	NodeClass string
+	Err       error
+}
+
+// ApplyError reports the nodeclass updates that failed while applying a set of changes
+type ApplyError struct {
+	Failed       []ItemError
+	Succeeded    int
+	NotAttempted int // updates skipped after the failure
+}
+
+// Error summarizes the failed updates
+func (e *ApplyError) Error() string {
+	names := make([]string, len(e.Failed))
+	for i, item := range e.Failed {
+		names[i] = item.NodeClass
+	}
+	msg := fmt.Sprintf("%d of %d nodeclass updates failed: %s",
+		len(e.Failed), len(e.Failed)+e.Succeeded+e.NotAttempted, strings.Join(names, ", "))
+	if e.NotAttempted > 0 {
+		msg += fmt.Sprintf(" (%d not attempted)", e.NotAttempted)
+	}
+	return msg
+}
+
+// Is makes errors.Is(err, ErrPartialApply) match
+func (e *ApplyError) Is(target error) bool {
+	return target == ErrPartialApply
+}
+
+// Unwrap returns the per-item errors
+func (e *ApplyError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, item := range e.Failed {
+		errs[i] = item.Err
+	}
+	return errs
+}
+
 // EC2NodeClass represents a Karpenter EC2NodeClass resource
 type EC2NodeClass struct {
 	APIVersion string `json:"apiVersion"`
 	Kind       string `json:"kind"`
 	Metadata   struct {
-		Name string `json:"name"`
+		Name        string            `json:"name"`
+		Annotations map[string]string `json:"annotations,omitempty"`
 	} `json:"metadata"`
 	Spec struct {
+		AMIFamily        string `json:"amiFamily"`
 		AMISelectorTerms []struct {
 			Name  string `json:"name"`
 			Owner string `json:"owner"`
+			ID    string `json:"id,omitempty"` // set instead of name and owner when the nodeclass is pinned to an image
 		} `json:"amiSelectorTerms"`
 	} `json:"spec"`
+	Status struct {
+		AMIs []ResolvedAMI `json:"amis"`
+	} `json:"status"`
+}
+
+// Annotations that opt a nodeclass out of upgrades
+const (
+	SkipAnnotation       = "upgrade-ami/skip"        // "true" leaves the nodeclass out of plans
+	SkipReasonAnnotation = "upgrade-ami/skip-reason" // why, shown wherever the nodeclass is reported as skipped
+)
+
+// Annotations recording the last run that updated a nodeclass
+const (
+	UpdatedByAnnotation = "upgrade-ami/updated-by" // the operator, see package operator
+	UpdatedAtAnnotation = "upgrade-ami/updated-at" // RFC 3339 time of the update
+	// RunIDAnnotation identifies the run, see history.NewRunID. The run also sets it on the nodeclaims and
+	// nodes of the nodeclasses it updates, so node churn can be traced back to it.
+	RunIDAnnotation = "upgrade-ami/run-id"
+)
+
+// Annotations keeping the name and owner of the AMI a nodeclass is pinned to by ID, since a selector term
+// with an id can't have them
+const (
+	PinnedNameAnnotation  = "upgrade-ami/pinned-name"
+	PinnedOwnerAnnotation = "upgrade-ami/pinned-owner"
+)
+
+// pinned reports whether the first selector term selects an image by ID rather than by name
+func (nc EC2NodeClass) pinned() bool {
+	return len(nc.Spec.AMISelectorTerms) > 0 && nc.Spec.AMISelectorTerms[0].Name == "" && nc.Spec.AMISelectorTerms[0].ID != ""
+}
+
+// AMIName returns the AMI name the first selector term selects, or the name of the image the nodeclass is
+// pinned to; empty when it has no selector terms
+func (nc EC2NodeClass) AMIName() string {
+	if nc.pinned() {
+		return nc.Metadata.Annotations[PinnedNameAnnotation]
+	}
+	if len(nc.Spec.AMISelectorTerms) == 0 {
+		return ""
+	}
+	return nc.Spec.AMISelectorTerms[0].Name
+}
+
+// AMIOwner returns the owner of the first selector term, or of the image the nodeclass is pinned to
+func (nc EC2NodeClass) AMIOwner() string {
+	if nc.pinned() {
+		return nc.Metadata.Annotations[PinnedOwnerAnnotation]
+	}
+	if len(nc.Spec.AMISelectorTerms) == 0 {
+		return ""
+	}
+	return nc.Spec.AMISelectorTerms[0].Owner
+}
+
+// OptedOut reports whether the nodeclass is annotated to be left out of upgrades, and the reason given
+func (nc EC2NodeClass) OptedOut() (reason string, ok bool) {
+	if !strings.EqualFold(strings.TrimSpace(nc.Metadata.Annotations[SkipAnnotation]), "true") {
+		return "", false
+	}
+	return strings.TrimSpace(nc.Metadata.Annotations[SkipReasonAnnotation]), true
+}
+
+// Owners returns the distinct AMI owners the selector terms name, in term order
+func (nc EC2NodeClass) Owners() []string {
+	var owners []string
+	if nc.pinned() && nc.AMIOwner() != "" {
+		owners = append(owners, nc.AMIOwner())
+	}
+	for _, term := range nc.Spec.AMISelectorTerms {
+		if term.Owner != "" && !slices.Contains(owners, term.Owner) {
+			owners = append(owners, term.Owner)
+		}
+	}
+	return owners
+}
+
+// ResolvedAMI is an AMI Karpenter resolved the selector terms of an EC2NodeClass to
+type ResolvedAMI struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Validate checks the fields the tool relies on
+func (nc EC2NodeClass) Validate() error {
+	if nc.Metadata.Name == "" {
+		return fmt.Errorf("EC2NodeClass without metadata.name")
+	}
+	return nil
 }
 
 // NodeClassList represents a list of EC2NodeClass resources
@@ -35,94 +187,107 @@ type AMIPattern struct {
 	HasNodegroup bool
 	Nodegroup    string
 	K8sVersion   string
+	Variant      string // naming.VariantStandard or a compliance variant such as naming.VariantFIPS
 	Version      string
 }
 
-// ParseAMIName parses an AMI name to extract nodegroup, k8s version, and version
-func ParseAMIName(amiName string) (*AMIPattern, error) {
-	// Format can be either:
-	// - domino-eks-<nodegroup>-<k8s-version>-vYYYYMMDD (e.g., domino-eks-gpu-1.33-v20251001)
-	// - domino-eks-<k8s-version>-vYYYYMMDD (e.g., domino-eks-1.33-v20251001)
-	// Or with wildcards:
-	// - domino-eks-<nodegroup>-<k8s-version>-* (e.g., domino-eks-gpu-1.33-*)
-	// - domino-eks-<k8s-version>-* (e.g., domino-eks-1.33-*)
+// ParseAMIName parses an AMI name according to the naming scheme to extract nodegroup, k8s version, and version.
+// With the default scheme the name can be either:
+// - domino-eks-<nodegroup>-<k8s-version>-vYYYYMMDD (e.g., domino-eks-gpu-1.33-v20251001)
+// - domino-eks-<k8s-version>-vYYYYMMDD (e.g., domino-eks-1.33-v20251001)
+// Or with wildcards, in which case Version is empty:
+// - domino-eks-<nodegroup>-<k8s-version>-* (e.g., domino-eks-gpu-1.33-*)
+// - domino-eks-<k8s-version>-* (e.g., domino-eks-1.33-*)
+// A FIPS image carries the variant after the k8s version (domino-eks-gpu-1.33-fips-v20251001). The nodegroup
+// is hyphen-separated segments of letters, digits, "_" and ".", none empty. The part after the k8s version (and
+// variant) must contain a "*" to be a wildcard, e.g. v2025*, so a malformed version like v2025 is rejected.
+func ParseAMIName(scheme naming.Provider, amiName string) (*AMIPattern, error) {
+	fields, ok := scheme.Parse(amiName)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAMIPatternUnrecognized, amiName)
+	}
 
-	// Try pattern with nodegroup first (with version)
-	reWithNodegroupVersion := regexp.MustCompile(`^domino-eks-([^-]+)-(1\.[0-9]+)-v([0-9]{8})$`)
-	matches := reWithNodegroupVersion.FindStringSubmatch(amiName)
+	return &AMIPattern{
+		HasNodegroup: fields.Nodegroup != "",
+		Nodegroup:    fields.Nodegroup,
+		K8sVersion:   fields.K8sVersion,
+		Variant:      fields.Variant,
+		Version:      fields.Version, // Empty for wildcards; will be selected by user
+	}, nil
+}
 
-	if len(matches) == 4 {
-		return &AMIPattern{
-			HasNodegroup: true,
-			Nodegroup:    matches[1],
-			K8sVersion:   matches[2],
-			Version:      matches[3],
-		}, nil
+// GetEC2NodeClasses retrieves all EC2NodeClass objects from the cluster
+func GetEC2NodeClasses(ctx context.Context, kube clients.KubeClient) (NodeClassList, error) {
+	stream, err := kube.List(ctx, "ec2nodeclass", clients.ListOptions{})
+	if err != nil {
+		return NodeClassList{}, fmt.Errorf("failed to get nodeclasses: %w", err)
 	}
 
-	// Try pattern without nodegroup (with version)
-	reWithoutNodegroupVersion := regexp.MustCompile(`^domino-eks-(1\.[0-9]+)-v([0-9]{8})$`)
-	matches = reWithoutNodegroupVersion.FindStringSubmatch(amiName)
-
-	if len(matches) == 3 {
-		return &AMIPattern{
-			HasNodegroup: false,
-			Nodegroup:    "",
-			K8sVersion:   matches[1],
-			Version:      matches[2],
-		}, nil
+	var nodeClasses NodeClassList
+	err = clients.DecodeItems(stream, func(item EC2NodeClass) error {
+		nodeClasses.Items = append(nodeClasses.Items, item)
+		return nil
+	})
+	if err != nil {
+		return NodeClassList{}, fmt.Errorf("failed to get nodeclasses: %w", err)
 	}
 
-	// Try pattern with nodegroup but wildcard (no version yet)
-	reWithNodegroupWildcard := regexp.MustCompile(`^domino-eks-([^-]+)-(1\.[0-9]+)-.*$`)
-	matches = reWithNodegroupWildcard.FindStringSubmatch(amiName)
+	return nodeClasses, nil
+}
 
-	if len(matches) == 3 {
-		return &AMIPattern{
-			HasNodegroup: true,
-			Nodegroup:    matches[1],
-			K8sVersion:   matches[2],
-			Version:      "", // Will be selected by user
-		}, nil
-	}
+// updateRetryPolicy bounds the retries of a single nodeclass update
+var updateRetryPolicy = retry.Default.WithBudget(2 * time.Minute)
 
-	// Try pattern without nodegroup but wildcard (no version yet)
-	reWithoutNodegroupWildcard := regexp.MustCompile(`^domino-eks-(1\.[0-9]+)-.*$`)
-	matches = reWithoutNodegroupWildcard.FindStringSubmatch(amiName)
+// UpdateNodeClass updates the AMI name in an EC2NodeClass, retrying throttling, conflicts and transient failures
+func UpdateNodeClass(ctx context.Context, kube clients.KubeClient, name, newAMI string) error {
+	return UpdateNodeClassFamily(ctx, kube, name, newAMI, "")
+}
 
-	if len(matches) == 2 {
-		return &AMIPattern{
-			HasNodegroup: false,
-			Nodegroup:    "",
-			K8sVersion:   matches[1],
-			Version:      "", // Will be selected by user
-		}, nil
-	}
+// UpdateNodeClassFamily is like UpdateNodeClass, but also sets spec.amiFamily in the same update, so
+// Karpenter never sees the new AMI with the old family or vice versa. An empty amiFamily leaves it unchanged.
+func UpdateNodeClassFamily(ctx context.Context, kube clients.KubeClient, name, newAMI, amiFamily string) error {
+	return UpdateNodeClassWith(ctx, kube, name, Update{NewAMI: newAMI, AMIFamily: amiFamily})
+}
 
-	return nil, fmt.Errorf("invalid AMI name format: %s", amiName)
+// Update is a change to a nodeclass made by UpdateNodeClassWith
+type Update struct {
+	NewAMI      string            // AMI name the first selector term selects
+	NewAMIID    string            // when set, the nodeclass is pinned to this image, named NewAMI, by ID
+	Owner       string            // owner of the first selector term, e.g. when moving to another AMI channel; unchanged when empty
+	AMIFamily   string            // spec.amiFamily; unchanged when empty
+	Annotations map[string]string // set in the same update, e.g. UpdatedByAnnotation
+
+	// ExpectAMI, when set, is the AMI name the nodeclass must still select, and ExpectAMIFamily, when set,
+	// its amiFamily; otherwise the update fails with ErrConflict instead of overwriting the other change
+	ExpectAMI       string
+	ExpectAMIFamily string
 }
 
-// GetEC2NodeClasses retrieves all EC2NodeClass objects from the cluster
-func GetEC2NodeClasses() (NodeClassList, error) {
-	cmd := exec.Command("kubectl", "get", "ec2nodeclass", "-o", "json")
-	output, err := cmd.Output()
-	if err != nil {
-		return NodeClassList{}, fmt.Errorf("failed to get nodeclasses: %w", err)
+// check returns ErrConflict if nc no longer matches the state the update expects
+func (u Update) check(nc EC2NodeClass) error {
+	if u.ExpectAMI != "" && nc.AMIName() != u.ExpectAMI {
+		return fmt.Errorf("%w: selects %q instead of %q", ErrConflict, nc.AMIName(), u.ExpectAMI)
 	}
-
-	var nodeClasses NodeClassList
-	if err := json.Unmarshal(output, &nodeClasses); err != nil {
-		return NodeClassList{}, fmt.Errorf("failed to parse nodeclasses: %w", err)
+	if u.ExpectAMIFamily != "" && nc.Spec.AMIFamily != u.ExpectAMIFamily {
+		return fmt.Errorf("%w: amiFamily is %q instead of %q", ErrConflict, nc.Spec.AMIFamily, u.ExpectAMIFamily)
 	}
+	return nil
+}
 
-	return nodeClasses, nil
+// UpdateNodeClassWith is like UpdateNodeClassFamily, but can also pin the nodeclass to an image by ID,
+// change the owner of its selector and set annotations in the same update. A pinned nodeclass moved to an AMI name is unpinned.
+// With u.ExpectAMI set, a nodeclass changed another way fails with ErrConflict instead of being updated.
+func UpdateNodeClassWith(ctx context.Context, kube clients.KubeClient, name string, u Update) error {
+	// A conflict means the nodeclass changed underneath us, so retry the whole read-modify-apply cycle, which
+	// checks u's expectations against the nodeclass again
+	return retry.Do(ctx, updateRetryPolicy, func(ctx context.Context) error {
+		return updateNodeClass(ctx, kube, name, u)
+	})
 }
 
-// UpdateNodeClass updates the AMI name in an EC2NodeClass
-func UpdateNodeClass(name, newAMI string) error {
+func updateNodeClass(ctx context.Context, kube clients.KubeClient, name string, u Update) error {
 	// Get the current nodeclass
-	cmd := exec.Command("kubectl", "get", "ec2nodeclass", name, "-o", "json")
-	output, err := cmd.Output()
+	output, err := kube.Get(ctx, "ec2nodeclass", name)
 	if err != nil {
 		return fmt.Errorf("failed to get nodeclass %s: %w", name, err)
 	}
@@ -132,11 +297,26 @@ func UpdateNodeClass(name, newAMI string) error {
 	if err := json.Unmarshal(output, &nodeclass); err != nil {
 		return fmt.Errorf("failed to parse nodeclass JSON: %w", err)
 	}
+	var current EC2NodeClass
+	if err := json.Unmarshal(output, &current); err != nil {
+		return fmt.Errorf("failed to parse nodeclass JSON: %w", err)
+	}
+	if err := u.check(current); err != nil {
+		return retry.Permanent(fmt.Errorf("failed to update nodeclass %s: %w", name, err))
+	}
 
-	// Navigate to spec.amiSelectorTerms[0].name and update it
-	spec := nodeclass["spec"].(map[string]interface{})
-	amiSelectorTerms := spec["amiSelectorTerms"].([]interface{})
-	amiSelectorTerms[0].(map[string]interface{})["name"] = newAMI
+	if err := setAMISelector(nodeclass, u); err != nil {
+		return fmt.Errorf("failed to update nodeclass %s: %w", name, err)
+	}
+	if u.AMIFamily != "" {
+		// setAMISelector checked that spec is an object
+		nodeclass["spec"].(map[string]interface{})["amiFamily"] = u.AMIFamily
+	}
+	if len(u.Annotations) > 0 {
+		if err := setAnnotations(nodeclass, u.Annotations); err != nil {
+			return fmt.Errorf("failed to update nodeclass %s: %w", name, err)
+		}
+	}
 
 	// Apply the changes
 	updatedJSON, err := json.Marshal(nodeclass)
@@ -144,44 +324,147 @@ func UpdateNodeClass(name, newAMI string) error {
 		return fmt.Errorf("failed to marshal updated JSON: %w", err)
 	}
 
-	applyCmd := exec.Command("kubectl", "apply", "-f", "-")
-	applyCmd.Stdin = strings.NewReader(string(updatedJSON))
-	applyCmd.Stdout = os.Stdout
-	applyCmd.Stderr = os.Stderr
-
-	if err := applyCmd.Run(); err != nil {
+	if err := kube.Apply(ctx, updatedJSON); err != nil {
 		return fmt.Errorf("failed to apply changes: %w", err)
 	}
 
 	return nil
 }
 
+// setAMISelector sets the first selector term to u.NewAMI by name, or pins it to the image u.NewAMIID named
+// u.NewAMI, setting its owner to u.Owner if given. The name and owner of a pinned term are kept in
+// annotations and restored when it is moved back to a name.
+func setAMISelector(nodeclass map[string]interface{}, u Update) error {
+	newAMI, newAMIID := u.NewAMI, u.NewAMIID
+	spec, ok := nodeclass["spec"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%w: spec is missing or not an object", clients.ErrUnexpectedSchema)
+	}
+	terms, ok := spec["amiSelectorTerms"].([]interface{})
+	if !ok || len(terms) == 0 {
+		return fmt.Errorf("%w: spec.amiSelectorTerms is missing, empty or not a list", clients.ErrUnexpectedSchema)
+	}
+	term, ok := terms[0].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%w: spec.amiSelectorTerms[0] is not an object", clients.ErrUnexpectedSchema)
+	}
+	_, named := term["name"].(string)
+	id, _ := term["id"].(string)
+	switch {
+	case !named && id == "":
+		return fmt.Errorf("%w: spec.amiSelectorTerms[0] has no name selector", clients.ErrUnexpectedSchema)
+	case named && newAMIID == "":
+		term["name"] = newAMI
+		if u.Owner != "" {
+			term["owner"] = u.Owner
+		}
+		return nil
+	}
+
+	annotations, err := annotationsOf(nodeclass)
+	if err != nil {
+		return err
+	}
+	owner, _ := term["owner"].(string)
+	if !named {
+		owner, _ = annotations[PinnedOwnerAnnotation].(string)
+	}
+	if u.Owner != "" {
+		owner = u.Owner
+	}
+	if newAMIID != "" {
+		// A term with an id can't have other fields
+		terms[0] = map[string]interface{}{"id": newAMIID}
+		annotations[PinnedNameAnnotation] = newAMI
+		if owner != "" {
+			annotations[PinnedOwnerAnnotation] = owner
+		} else {
+			delete(annotations, PinnedOwnerAnnotation)
+		}
+		return nil
+	}
+	unpinned := map[string]interface{}{"name": newAMI}
+	if owner != "" {
+		unpinned["owner"] = owner
+	}
+	terms[0] = unpinned
+	delete(annotations, PinnedNameAnnotation)
+	delete(annotations, PinnedOwnerAnnotation)
+	return nil
+}
+
+// setAnnotations adds the annotations to metadata.annotations, keeping the others
+func setAnnotations(nodeclass map[string]interface{}, annotations map[string]string) error {
+	existing, err := annotationsOf(nodeclass)
+	if err != nil {
+		return err
+	}
+	for key, value := range annotations {
+		existing[key] = value
+	}
+	return nil
+}
+
+// annotationsOf returns metadata.annotations, adding it if missing
+func annotationsOf(nodeclass map[string]interface{}) (map[string]interface{}, error) {
+	metadata, ok := nodeclass["metadata"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is missing or not an object", clients.ErrUnexpectedSchema)
+	}
+	annotations, ok := metadata["annotations"].(map[string]interface{})
+	if !ok {
+		annotations = make(map[string]interface{})
+		metadata["annotations"] = annotations
+	}
+	return annotations, nil
+}
+
+// CloneNodeClass returns the manifest of a new EC2NodeClass called name with the spec of the nodeclass
+// source, selecting newAMI and, if set, amiFamily. Status and server-managed metadata are not copied.
+func CloneNodeClass(ctx context.Context, kube clients.KubeClient, source, name, newAMI, amiFamily string) (map[string]interface{}, error) {
+	output, err := kube.Get(ctx, "ec2nodeclass", source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodeclass %s: %w", source, err)
+	}
+	var nodeclass map[string]interface{}
+	if err := json.Unmarshal(output, &nodeclass); err != nil {
+		return nil, fmt.Errorf("failed to parse nodeclass JSON: %w", err)
+	}
+
+	clone := map[string]interface{}{
+		"apiVersion": nodeclass["apiVersion"],
+		"kind":       nodeclass["kind"],
+		"metadata":   map[string]interface{}{"name": name},
+		"spec":       nodeclass["spec"],
+	}
+	if err := setAMISelector(clone, Update{NewAMI: newAMI}); err != nil {
+		return nil, fmt.Errorf("failed to clone nodeclass %s: %w", source, err)
+	}
+	if amiFamily != "" {
+		clone["spec"].(map[string]interface{})["amiFamily"] = amiFamily
+	}
+	return clone, nil
+}
+
 // NodeClassInfo contains metadata about a nodeclass
 type NodeClassInfo struct {
 	HasNodegroup bool
 	Nodegroup    string
 }
 
-// BuildNodeClassMap builds a map of nodeclass names to their info
-func BuildNodeClassMap(nodeClasses NodeClassList) map[string]*NodeClassInfo {
+// BuildNodeClassMap builds a map of nodeclass names to their info. The nodegroup is the one of the AMI
+// name, which the scheme finds by anchoring on the Kubernetes version, so hyphenated nodegroups such as
+// gpu-large are kept whole; nodeclasses whose AMI name has none get none, whatever they are called.
+func BuildNodeClassMap(scheme naming.Provider, nodeClasses NodeClassList) map[string]*NodeClassInfo {
 	nodeclassMap := make(map[string]*NodeClassInfo)
 
 	for _, nc := range nodeClasses.Items {
 		if len(nc.Spec.AMISelectorTerms) > 0 {
-			pattern, err := ParseAMIName(nc.Spec.AMISelectorTerms[0].Name)
+			pattern, err := ParseAMIName(scheme, nc.AMIName())
 			if err == nil {
-				ng := pattern.Nodegroup
-				// If AMI name doesn't have explicit nodegroup, derive from nodeclass name
-				if !pattern.HasNodegroup {
-					// Extract nodegroup from nodeclass name (e.g., "domino-eks-compute" -> "compute")
-					nameParts := strings.Split(nc.Metadata.Name, "-")
-					if len(nameParts) >= 3 && nameParts[0] == "domino" && nameParts[1] == "eks" {
-						ng = strings.Join(nameParts[2:], "-")
-					}
-				}
 				nodeclassMap[nc.Metadata.Name] = &NodeClassInfo{
 					HasNodegroup: pattern.HasNodegroup,
-					Nodegroup:    ng,
+					Nodegroup:    pattern.Nodegroup,
 				}
 			}
 		}
@@ -190,17 +473,27 @@ func BuildNodeClassMap(nodeClasses NodeClassList) map[string]*NodeClassInfo {
 	return nodeclassMap
 }
 
+// LabelNodePool is the label Karpenter puts on nodeclaims naming the NodePool that launched them
+const LabelNodePool = "karpenter.sh/nodepool"
+
 // NodeClaim represents a Karpenter NodeClaim resource
 type NodeClaim struct {
 	Metadata struct {
-		Name              string    `json:"name"`
-		CreationTimestamp time.Time `json:"creationTimestamp"`
+		Name              string            `json:"name"`
+		Labels            map[string]string `json:"labels,omitempty"`
+		Annotations       map[string]string `json:"annotations,omitempty"`
+		CreationTimestamp time.Time         `json:"creationTimestamp"`
+		DeletionTimestamp *time.Time        `json:"deletionTimestamp,omitempty"`
 	} `json:"metadata"`
 	Status struct {
+		ProviderID string `json:"providerID,omitempty"`
+		NodeName   string `json:"nodeName,omitempty"`
+		ImageID    string `json:"imageID,omitempty"`
 		Conditions []struct {
-			Type   string `json:"type"`
-			Status string `json:"status"`
-			Reason string `json:"reason,omitempty"`
+			Type               string    `json:"type"`
+			Status             string    `json:"status"`
+			Reason             string    `json:"reason,omitempty"`
+			LastTransitionTime time.Time `json:"lastTransitionTime,omitempty"`
 		} `json:"conditions"`
 	} `json:"status"`
 	Spec struct {
@@ -210,22 +503,171 @@ type NodeClaim struct {
 	} `json:"spec"`
 }
 
+// Validate checks the fields the tool relies on
+func (nc NodeClaim) Validate() error {
+	if nc.Metadata.Name == "" {
+		return fmt.Errorf("NodeClaim without metadata.name")
+	}
+	if nc.Metadata.CreationTimestamp.IsZero() {
+		return fmt.Errorf("NodeClaim %s without metadata.creationTimestamp", nc.Metadata.Name)
+	}
+	return nil
+}
+
 // NodeClaimList represents a list of NodeClaim resources
 type NodeClaimList struct {
 	Items []NodeClaim `json:"items"`
 }
 
-// GetNodeClaims retrieves all NodeClaim objects from the cluster
-func GetNodeClaims() (NodeClaimList, error) {
-	cmd := exec.Command("kubectl", "get", "nodeclaims.karpenter.sh", "-o", "json")
-	output, err := cmd.Output()
+// NodePool represents a Karpenter NodePool resource
+type NodePool struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		Template struct {
+			Metadata struct {
+				Labels map[string]string `json:"labels,omitempty"` // set on every node of the pool
+			} `json:"metadata"`
+			Spec struct {
+				NodeClassRef struct {
+					Name string `json:"name"`
+				} `json:"nodeClassRef"`
+				Requirements []Requirement `json:"requirements"`
+				Taints       []Taint       `json:"taints,omitempty"` // set on every node of the pool; startupTaints are removed once it is ready
+			} `json:"spec"`
+		} `json:"template"`
+		Disruption struct {
+			Budgets []Budget `json:"budgets,omitempty"`
+		} `json:"disruption"`
+	} `json:"spec"`
+}
+
+// Budget limits how many of a NodePool's nodes Karpenter disrupts at once
+type Budget struct {
+	Nodes    string   `json:"nodes"`              // a count or a percentage of the NodePool's nodes, e.g. 10%
+	Reasons  []string `json:"reasons,omitempty"`  // disruption reasons it applies to, e.g. Drifted; all when empty
+	Schedule string   `json:"schedule,omitempty"` // cron schedule of the window it is active in; always when empty
+	Duration string   `json:"duration,omitempty"` // how long the window lasts
+}
+
+// Taint is a node taint, e.g. nvidia.com/gpu=true:NoSchedule
+type Taint struct {
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"`
+	Effect string `json:"effect"`
+}
+
+// String formats the taint as kubectl taint takes it, e.g. nvidia.com/gpu=true:NoSchedule
+func (t Taint) String() string {
+	if t.Value == "" {
+		return t.Key + ":" + t.Effect
+	}
+	return t.Key + "=" + t.Value + ":" + t.Effect
+}
+
+// Requirement is a scheduling requirement of a NodePool's nodes, e.g. karpenter.k8s.aws/instance-family In [m5 c5]
+type Requirement struct {
+	Key      string   `json:"key"`
+	Operator string   `json:"operator"` // In, NotIn, Exists, DoesNotExist, Gt or Lt
+	Values   []string `json:"values"`
+}
+
+// Validate checks the fields the tool relies on
+func (np NodePool) Validate() error {
+	if np.Metadata.Name == "" {
+		return fmt.Errorf("NodePool without metadata.name")
+	}
+	return nil
+}
+
+// GetNodePools retrieves all NodePool objects from the cluster
+func GetNodePools(ctx context.Context, kube clients.KubeClient) ([]NodePool, error) {
+	stream, err := kube.List(ctx, "nodepools.karpenter.sh", clients.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodepools: %w", err)
+	}
+
+	var nodePools []NodePool
+	err = clients.DecodeItems(stream, func(item NodePool) error {
+		nodePools = append(nodePools, item)
+		return nil
+	})
 	if err != nil {
-		return NodeClaimList{}, fmt.Errorf("failed to get nodeclaims: %w", err)
+		return nil, fmt.Errorf("failed to get nodepools: %w", err)
+	}
+	return nodePools, nil
+}
+
+// Node is the part of a Kubernetes node the tool checks: its labels and taints
+type Node struct {
+	Metadata struct {
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		Taints []Taint `json:"taints,omitempty"`
+	} `json:"spec"`
+}
+
+// Validate checks the fields the tool relies on
+func (n Node) Validate() error {
+	if n.Metadata.Name == "" {
+		return fmt.Errorf("Node without metadata.name")
 	}
+	return nil
+}
 
+// GetNodes retrieves every node of the cluster, keyed by name
+func GetNodes(ctx context.Context, kube clients.KubeClient) (map[string]Node, error) {
+	stream, err := kube.List(ctx, "nodes", clients.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodes: %w", err)
+	}
+
+	nodes := make(map[string]Node)
+	err = clients.DecodeItems(stream, func(item Node) error {
+		nodes[item.Metadata.Name] = item
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodes: %w", err)
+	}
+	return nodes, nil
+}
+
+// CurrentContext returns the name of the current kubectl context
+func CurrentContext(ctx context.Context, kube clients.KubeClient) (string, error) {
+	name, err := kube.CurrentContext(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get current context: %w", err)
+	}
+	return name, nil
+}
+
+// EachNodeClaim streams the cluster's NodeClaim objects to fn one at a time, as the API server pages them,
+// so large clusters are never held in memory as a whole list
+func EachNodeClaim(ctx context.Context, kube clients.KubeClient, fn func(NodeClaim) error) error {
+	stream, err := kube.List(ctx, "nodeclaims.karpenter.sh", clients.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get nodeclaims: %w", err)
+	}
+
+	if err := clients.DecodeItems(stream, fn); err != nil {
+		return fmt.Errorf("failed to get nodeclaims: %w", err)
+	}
+	return nil
+}
+
+// GetNodeClaims retrieves all NodeClaim objects from the cluster
+func GetNodeClaims(ctx context.Context, kube clients.KubeClient) (NodeClaimList, error) {
 	var nodeClaims NodeClaimList
-	if err := json.Unmarshal(output, &nodeClaims); err != nil {
-		return NodeClaimList{}, fmt.Errorf("failed to parse nodeclaims: %w", err)
+	err := EachNodeClaim(ctx, kube, func(item NodeClaim) error {
+		nodeClaims.Items = append(nodeClaims.Items, item)
+		return nil
+	})
+	if err != nil {
+		return NodeClaimList{}, err
 	}
 
 	return nodeClaims, nil
@@ -233,83 +675,315 @@ func GetNodeClaims() (NodeClaimList, error) {
 
 // NodeClaimStatus represents the drift status of a nodeclaim
 type NodeClaimStatus struct {
-	Name      string
-	Drifted   bool
-	Reason    string
-	NodeClass string
-	Age       time.Duration
+	Name         string
+	Drifted      bool
+	DriftedSince time.Time // when the drift condition last transitioned, zero if unknown
+	Reason       string
+	BlockedBy    string // why Karpenter cannot currently disrupt the nodeclaim, from its events
+	NodeClass    string
+	NodePool     string // from the karpenter.sh/nodepool label; empty if unlabelled
+	NodeName     string
+	ProviderID   string // e.g. aws:///us-west-2a/i-0123456789abcdef0
+	ImageID      string // AMI the nodeclaim was launched with; empty until it is launched
+	Age          time.Duration
+	Created      time.Time
+	Terminating  bool            // the nodeclaim is being deleted
+	Orphaned     bool            // NodeClass is empty or names a nodeclass that no longer exists
+	RunID        string          // the upgrade-ami/run-id annotation: the last run that tagged the nodeclaim
+	Conditions   map[string]bool // condition type -> whether its status is True
 }
 
-// GetNodeClaimStatuses retrieves the drift status of all nodeclaims
-func GetNodeClaimStatuses() ([]NodeClaimStatus, error) {
-	nodeClaims, err := GetNodeClaims()
+// LaunchConditions are the conditions a replacement nodeclaim passes through, in order
+var LaunchConditions = []string{"Launched", "Registered", "Initialized", "Ready"}
+
+// GetNodeClaimStatuses retrieves the drift status of all nodeclaims, with ages as of now
+func GetNodeClaimStatuses(ctx context.Context, kube clients.KubeClient, now time.Time) ([]NodeClaimStatus, error) {
+	// Each nodeclaim is reduced to its status as it is decoded, so only the statuses are kept
+	var statuses []NodeClaimStatus
+	err := EachNodeClaim(ctx, kube, func(nc NodeClaim) error {
+		statuses = append(statuses, nodeClaimStatus(nc, now))
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	var statuses []NodeClaimStatus
-	now := time.Now()
-	for _, nc := range nodeClaims.Items {
-		// Calculate age
-		age := now.Sub(nc.Metadata.CreationTimestamp)
-
-		status := NodeClaimStatus{
-			Name:      nc.Metadata.Name,
-			Drifted:   false,
-			Reason:    "",
-			NodeClass: nc.Spec.NodeClassRef.Name,
-			Age:       age,
+	// Orphans are flagged on a best effort basis too, since the nodeclasses are a separate list
+	if list, err := GetEC2NodeClasses(ctx, kube); err == nil {
+		MarkOrphaned(statuses, list)
+	}
+
+	// Block reasons are best effort; monitoring still works without them
+	if reasons, err := GetDisruptionBlockedReasons(ctx, kube, now); err == nil {
+		for i := range statuses {
+			if reason, ok := reasons["NodeClaim/"+statuses[i].Name]; ok {
+				statuses[i].BlockedBy = reason
+			} else if reason, ok := reasons["Node/"+statuses[i].NodeName]; ok && statuses[i].NodeName != "" {
+				statuses[i].BlockedBy = reason
+			}
 		}
+	}
 
-		// Check for drift condition (Karpenter may use different condition names)
-		for _, condition := range nc.Status.Conditions {
-			// Check for common drift condition types
-			if condition.Type == "Drifted" || condition.Type == "Drift" {
-				if condition.Status == "True" {
-					status.Drifted = true
-					status.Reason = condition.Reason
-				}
-				break
+	return statuses, nil
+}
+
+// MarkOrphaned flags the statuses of nodeclaims that reference no nodeclass of list, e.g. after it was
+// deleted or renamed
+func MarkOrphaned(statuses []NodeClaimStatus, list NodeClassList) {
+	names := make(map[string]bool, len(list.Items))
+	for _, nc := range list.Items {
+		names[nc.Metadata.Name] = true
+	}
+	for i := range statuses {
+		statuses[i].Orphaned = !names[statuses[i].NodeClass]
+	}
+}
+
+// nodeClaimStatus summarizes the drift status of nc as of now
+func nodeClaimStatus(nc NodeClaim, now time.Time) NodeClaimStatus {
+	status := NodeClaimStatus{
+		Name:        nc.Metadata.Name,
+		Drifted:     false,
+		Reason:      "",
+		NodeClass:   nc.Spec.NodeClassRef.Name,
+		NodePool:    nc.Metadata.Labels[LabelNodePool],
+		NodeName:    nc.Status.NodeName,
+		ProviderID:  nc.Status.ProviderID,
+		ImageID:     nc.Status.ImageID,
+		Age:         now.Sub(nc.Metadata.CreationTimestamp),
+		Created:     nc.Metadata.CreationTimestamp,
+		Terminating: nc.Metadata.DeletionTimestamp != nil,
+		RunID:       nc.Metadata.Annotations[RunIDAnnotation],
+		Conditions:  make(map[string]bool),
+	}
+
+	for _, condition := range nc.Status.Conditions {
+		status.Conditions[condition.Type] = condition.Status == "True"
+	}
+
+	// Check for drift condition (Karpenter may use different condition names)
+	for _, condition := range nc.Status.Conditions {
+		// Check for common drift condition types
+		if condition.Type == "Drifted" || condition.Type == "Drift" {
+			if condition.Status == "True" {
+				status.Drifted = true
+				status.DriftedSince = condition.LastTransitionTime
+				status.Reason = condition.Reason
 			}
+			break
 		}
+	}
 
-		statuses = append(statuses, status)
+	return status
+}
+
+// Event represents a Kubernetes Event
+type Event struct {
+	InvolvedObject struct {
+		Kind string `json:"kind"`
+		Name string `json:"name"`
+	} `json:"involvedObject"`
+	Reason        string    `json:"reason"`
+	Message       string    `json:"message"`
+	LastTimestamp time.Time `json:"lastTimestamp,omitempty"`
+	EventTime     time.Time `json:"eventTime,omitempty"`
+}
+
+// Time returns when the event last occurred
+func (e Event) Time() time.Time {
+	if !e.LastTimestamp.IsZero() {
+		return e.LastTimestamp
 	}
+	return e.EventTime
+}
 
-	return statuses, nil
+// EventList represents a list of Event resources
+type EventList struct {
+	Items []Event `json:"items"`
 }
 
-// WaitForNodeClaimsUndrifted waits for all nodeclaims to become undrifted, updating status as we wait
-func WaitForNodeClaimsUndrifted(updateInterval time.Duration, callback func([]NodeClaimStatus) bool) error {
-	ticker := time.NewTicker(updateInterval)
-	defer ticker.Stop()
+// blockedEventMaxAge is how recent a DisruptionBlocked event must be to still be considered current
+const blockedEventMaxAge = 15 * time.Minute
+
+// GetDisruptionBlockedReasons returns the latest "Cannot disrupt" message per object as of now, keyed by "Kind/name"
+func GetDisruptionBlockedReasons(ctx context.Context, kube clients.KubeClient, now time.Time) (map[string]string, error) {
+	stream, err := kube.List(ctx, "events", clients.ListOptions{
+		AllNamespaces: true,
+		FieldSelector: "reason=DisruptionBlocked",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events: %w", err)
+	}
 
-	for {
-		statuses, err := GetNodeClaimStatuses()
-		if err != nil {
-			return fmt.Errorf("failed to get nodeclaim statuses: %w", err)
+	reasons := make(map[string]string)
+	latest := make(map[string]time.Time)
+	cutoff := now.Add(-blockedEventMaxAge)
+	err = clients.DecodeItems(stream, func(event Event) error {
+		if event.Time().Before(cutoff) {
+			return nil
 		}
 
-		// Display current status
-		shouldContinue := callback(statuses)
-		if !shouldContinue {
+		key := event.InvolvedObject.Kind + "/" + event.InvolvedObject.Name
+		if event.Time().Before(latest[key]) {
 			return nil
 		}
+		latest[key] = event.Time()
+		reasons[key] = trimDisruptionPrefix(event.Message)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events: %w", err)
+	}
 
-		// Check if all are undrifted
-		allUndrifted := true
-		for _, status := range statuses {
-			if status.Drifted {
-				allUndrifted = false
-				break
-			}
+	return reasons, nil
+}
+
+// trimDisruptionPrefix strips the "Cannot disrupt <Kind>: " prefix from Karpenter event messages
+func trimDisruptionPrefix(message string) string {
+	if !strings.HasPrefix(message, "Cannot disrupt ") {
+		return message
+	}
+	if _, rest, ok := strings.Cut(message, ": "); ok {
+		return rest
+	}
+	return message
+}
+
+// ErrMonitorTimeout is returned when monitoring stops because the timeout elapsed
+var ErrMonitorTimeout = errors.New("timed out waiting for nodeclaims to become undrifted")
+
+// ErrMonitorStopped is returned when monitoring is stopped by cancelling its context
+var ErrMonitorStopped = errors.New("monitoring stopped")
+
+// MonitorOptions controls how nodeclaims are monitored
+type MonitorOptions struct {
+	UpdateInterval time.Duration
+	Cadence        cadence.Strategy // when to poll; nil polls every UpdateInterval
+	NodeClass      string           // only monitor nodeclaims of this nodeclass when set
+	NodeClasses    []string         // only monitor nodeclaims of these nodeclasses when set, e.g. those of a run
+	CreatedBefore  time.Time        // only monitor nodeclaims created before this time when non-zero, e.g. an apply
+	UntilClean     bool             // stop once all monitored nodeclaims are undrifted
+	Timeout        time.Duration    // stop after this duration when non-zero (ErrMonitorTimeout with UntilClean)
+}
+
+// Filter returns the statuses of the nodeclaims the options monitor, leaving out e.g. the scale-up churn
+// of other nodeclasses during a long rollout
+func (o MonitorOptions) Filter(statuses []NodeClaimStatus) []NodeClaimStatus {
+	statuses = FilterNodeClaimStatuses(statuses, o.NodeClass)
+	if len(o.NodeClasses) == 0 && o.CreatedBefore.IsZero() {
+		return statuses
+	}
+
+	var filtered []NodeClaimStatus
+	for _, status := range statuses {
+		if len(o.NodeClasses) > 0 && !slices.Contains(o.NodeClasses, status.NodeClass) {
+			continue
 		}
+		if !o.CreatedBefore.IsZero() && !status.Created.Before(o.CreatedBefore) {
+			continue
+		}
+		filtered = append(filtered, status)
+	}
+	return filtered
+}
+
+// FilterNodeClaimStatuses returns the statuses belonging to the given nodeclass
+func FilterNodeClaimStatuses(statuses []NodeClaimStatus, nodeClass string) []NodeClaimStatus {
+	if nodeClass == "" {
+		return statuses
+	}
+
+	var filtered []NodeClaimStatus
+	for _, status := range statuses {
+		if status.NodeClass == nodeClass {
+			filtered = append(filtered, status)
+		}
+	}
+	return filtered
+}
+
+// AllUndrifted reports whether none of the statuses are drifted
+func AllUndrifted(statuses []NodeClaimStatus) bool {
+	for _, status := range statuses {
+		if status.Drifted {
+			return false
+		}
+	}
+	return true
+}
+
+// DisruptionEvent is a disruption decision Karpenter made for a node or nodeclaim
+type DisruptionEvent struct {
+	Time   time.Time
+	Kind   string // Node or NodeClaim
+	Name   string
+	Reason string // e.g. Drifted, Underutilized, Empty
+}
+
+// IsConsolidation reports whether the disruption was caused by consolidation rather than drift
+func (e DisruptionEvent) IsConsolidation() bool {
+	switch e.Reason {
+	case "Underutilized", "Empty", "Emptiness", "Consolidation":
+		return true
+	}
+	return false
+}
+
+// GetDisruptionEvents returns the Karpenter disruption events that occurred at or after since, oldest first.
+// Karpenter reports the same decision for both the Node and its NodeClaim; Node duplicates are dropped.
+func GetDisruptionEvents(ctx context.Context, kube clients.KubeClient, since time.Time) ([]DisruptionEvent, error) {
+	stream, err := kube.List(ctx, "events", clients.ListOptions{
+		AllNamespaces: true,
+		FieldSelector: "reason=DisruptionTerminating",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events: %w", err)
+	}
 
-		if allUndrifted {
+	var disruptions []DisruptionEvent
+	claimDecisions := make(map[string]bool) // time + reason of NodeClaim events
+	err = clients.DecodeItems(stream, func(event Event) error {
+		if event.Time().Before(since) {
 			return nil
 		}
 
-		// Wait for next tick
-		<-ticker.C
+		disruption := DisruptionEvent{
+			Time:   event.Time(),
+			Kind:   event.InvolvedObject.Kind,
+			Name:   event.InvolvedObject.Name,
+			Reason: parseDisruptionReason(event.Message),
+		}
+		if disruption.Kind == "NodeClaim" {
+			claimDecisions[disruption.Time.String()+disruption.Reason] = true
+		}
+		disruptions = append(disruptions, disruption)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events: %w", err)
+	}
+
+	deduped := disruptions[:0]
+	for _, d := range disruptions {
+		if d.Kind == "Node" && claimDecisions[d.Time.String()+d.Reason] {
+			continue
+		}
+		deduped = append(deduped, d)
+	}
+
+	sort.SliceStable(deduped, func(i, j int) bool {
+		return deduped[i].Time.Before(deduped[j].Time)
+	})
+
+	return deduped, nil
+}
+
+// parseDisruptionReason extracts the reason from messages like "Disrupting NodeClaim: Underutilized/Delete"
+func parseDisruptionReason(message string) string {
+	_, rest, ok := strings.Cut(message, ": ")
+	if !ok {
+		return message
 	}
+	reason, _, _ := strings.Cut(rest, "/")
+	return strings.TrimSpace(reason)
 }
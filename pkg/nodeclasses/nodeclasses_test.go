@@ -0,0 +1,168 @@
+package nodeclasses
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/naming"
+)
+
+func TestSetAMISelector(t *testing.T) {
+	tests := []struct {
+		name      string
+		nodeclass string
+		update    Update
+		want      string // the nodeclass after the update; empty when it fails with ErrUnexpectedSchema
+	}{
+		{
+			name:      "missing spec",
+			nodeclass: `{"metadata": {"name": "default"}}`,
+			update:    Update{NewAMI: "domino-eks-1.33-v20251101"},
+		},
+		{
+			name:      "spec not an object",
+			nodeclass: `{"metadata": {"name": "default"}, "spec": "default"}`,
+			update:    Update{NewAMI: "domino-eks-1.33-v20251101"},
+		},
+		{
+			name:      "missing amiSelectorTerms",
+			nodeclass: `{"metadata": {"name": "default"}, "spec": {"role": "KarpenterNodeRole"}}`,
+			update:    Update{NewAMI: "domino-eks-1.33-v20251101"},
+		},
+		{
+			name:      "empty amiSelectorTerms",
+			nodeclass: `{"metadata": {"name": "default"}, "spec": {"amiSelectorTerms": []}}`,
+			update:    Update{NewAMI: "domino-eks-1.33-v20251101"},
+		},
+		{
+			name:      "term not an object",
+			nodeclass: `{"metadata": {"name": "default"}, "spec": {"amiSelectorTerms": ["domino-eks-1.33-v20251001"]}}`,
+			update:    Update{NewAMI: "domino-eks-1.33-v20251101"},
+		},
+		{
+			name:      "term without name or id",
+			nodeclass: `{"metadata": {"name": "default"}, "spec": {"amiSelectorTerms": [{"alias": "al2023@latest"}]}}`,
+			update:    Update{NewAMI: "domino-eks-1.33-v20251101"},
+		},
+		{
+			name:      "name",
+			nodeclass: `{"metadata": {"name": "default"}, "spec": {"amiSelectorTerms": [{"name": "domino-eks-1.33-v20251001", "owner": "111111111111"}, {"name": "fallback"}]}}`,
+			update:    Update{NewAMI: "domino-eks-1.33-v20251101"},
+			want:      `{"metadata": {"name": "default"}, "spec": {"amiSelectorTerms": [{"name": "domino-eks-1.33-v20251101", "owner": "111111111111"}, {"name": "fallback"}]}}`,
+		},
+		{
+			name:      "name and owner",
+			nodeclass: `{"metadata": {"name": "default"}, "spec": {"amiSelectorTerms": [{"name": "domino-eks-1.33-v20251001", "owner": "111111111111"}]}}`,
+			update:    Update{NewAMI: "domino-eks-1.33-v20251101", Owner: "222222222222"},
+			want:      `{"metadata": {"name": "default"}, "spec": {"amiSelectorTerms": [{"name": "domino-eks-1.33-v20251101", "owner": "222222222222"}]}}`,
+		},
+		{
+			name:      "pin a named term",
+			nodeclass: `{"metadata": {"name": "default"}, "spec": {"amiSelectorTerms": [{"name": "domino-eks-1.33-v20251001", "owner": "111111111111"}]}}`,
+			update:    Update{NewAMI: "domino-eks-1.33-v20251101", NewAMIID: "ami-0123"},
+			want: `{"metadata": {"name": "default", "annotations": {"upgrade-ami/pinned-name": "domino-eks-1.33-v20251101", "upgrade-ami/pinned-owner": "111111111111"}},
+				"spec": {"amiSelectorTerms": [{"id": "ami-0123"}]}}`,
+		},
+		{
+			name:      "pin a term without metadata",
+			nodeclass: `{"spec": {"amiSelectorTerms": [{"name": "domino-eks-1.33-v20251001"}]}}`,
+			update:    Update{NewAMI: "domino-eks-1.33-v20251101", NewAMIID: "ami-0123"},
+		},
+		{
+			name: "id-only term to a name",
+			nodeclass: `{"metadata": {"name": "default", "annotations": {"upgrade-ami/pinned-name": "domino-eks-1.33-v20251001", "upgrade-ami/pinned-owner": "111111111111", "team": "ml"}},
+				"spec": {"amiSelectorTerms": [{"id": "ami-0123"}]}}`,
+			update: Update{NewAMI: "domino-eks-1.33-v20251101"},
+			want: `{"metadata": {"name": "default", "annotations": {"team": "ml"}},
+				"spec": {"amiSelectorTerms": [{"name": "domino-eks-1.33-v20251101", "owner": "111111111111"}]}}`,
+		},
+		{
+			name:      "id-only term without annotations to a name",
+			nodeclass: `{"metadata": {"name": "default"}, "spec": {"amiSelectorTerms": [{"id": "ami-0123"}]}}`,
+			update:    Update{NewAMI: "domino-eks-1.33-v20251101"},
+			want:      `{"metadata": {"name": "default", "annotations": {}}, "spec": {"amiSelectorTerms": [{"name": "domino-eks-1.33-v20251101"}]}}`,
+		},
+		{
+			name: "id-only term to another owner's name",
+			nodeclass: `{"metadata": {"name": "default", "annotations": {"upgrade-ami/pinned-name": "domino-eks-1.33-v20251001", "upgrade-ami/pinned-owner": "111111111111"}},
+				"spec": {"amiSelectorTerms": [{"id": "ami-0123"}]}}`,
+			update: Update{NewAMI: "domino-eks-1.33-v20251101", Owner: "222222222222"},
+			want:   `{"metadata": {"name": "default", "annotations": {}}, "spec": {"amiSelectorTerms": [{"name": "domino-eks-1.33-v20251101", "owner": "222222222222"}]}}`,
+		},
+		{
+			name: "id-only term to another id",
+			nodeclass: `{"metadata": {"name": "default", "annotations": {"upgrade-ami/pinned-name": "domino-eks-1.33-v20251001", "upgrade-ami/pinned-owner": "111111111111"}},
+				"spec": {"amiSelectorTerms": [{"id": "ami-0123"}]}}`,
+			update: Update{NewAMI: "domino-eks-1.33-v20251101", NewAMIID: "ami-0456"},
+			want: `{"metadata": {"name": "default", "annotations": {"upgrade-ami/pinned-name": "domino-eks-1.33-v20251101", "upgrade-ami/pinned-owner": "111111111111"}},
+				"spec": {"amiSelectorTerms": [{"id": "ami-0456"}]}}`,
+		},
+		{
+			name:      "id-only term without an owner to another id",
+			nodeclass: `{"metadata": {"name": "default", "annotations": {"upgrade-ami/pinned-name": "domino-eks-1.33-v20251001"}}, "spec": {"amiSelectorTerms": [{"id": "ami-0123"}]}}`,
+			update:    Update{NewAMI: "domino-eks-1.33-v20251101", NewAMIID: "ami-0456"},
+			want:      `{"metadata": {"name": "default", "annotations": {"upgrade-ami/pinned-name": "domino-eks-1.33-v20251101"}}, "spec": {"amiSelectorTerms": [{"id": "ami-0456"}]}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var nodeclass map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.nodeclass), &nodeclass); err != nil {
+				t.Fatal(err)
+			}
+			err := setAMISelector(nodeclass, tt.update)
+			if tt.want == "" {
+				if !errors.Is(err, clients.ErrUnexpectedSchema) {
+					t.Errorf("setAMISelector() error = %v, want ErrUnexpectedSchema", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("setAMISelector() error = %v", err)
+			}
+
+			var want map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			// Compared as JSON, since the nodeclass mixes []interface{} and the terms setAMISelector builds
+			got, _ := json.Marshal(nodeclass)
+			wantJSON, _ := json.Marshal(want)
+			if string(got) != string(wantJSON) {
+				t.Errorf("nodeclass = %s\nwant %s", got, wantJSON)
+			}
+		})
+	}
+}
+
+func TestBuildNodeClassMap(t *testing.T) {
+	var list NodeClassList
+	err := json.Unmarshal([]byte(`{"items": [
+		{"metadata": {"name": "default"}, "spec": {"amiSelectorTerms": [{"name": "domino-eks-1.33-v20251001"}]}},
+		{"metadata": {"name": "domino-eks-compute"}, "spec": {"amiSelectorTerms": [{"name": "domino-eks-1.33-*"}]}},
+		{"metadata": {"name": "gpu-large"}, "spec": {"amiSelectorTerms": [{"name": "domino-eks-gpu-large-1.33-v20251001"}]}},
+		{"metadata": {"name": "foreign"}, "spec": {"amiSelectorTerms": [{"name": "amazon-eks-node-al2023-x86_64-standard-1.33-v20251001"}]}},
+		{"metadata": {"name": "unselected"}, "spec": {"amiSelectorTerms": []}}
+	]}`), &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := BuildNodeClassMap(naming.Default, list)
+	// The nodegroup only ever comes from the AMI name, never from the nodeclass's name
+	want := map[string]NodeClassInfo{
+		"default":            {},
+		"domino-eks-compute": {},
+		"gpu-large":          {HasNodegroup: true, Nodegroup: "gpu-large"},
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d nodeclasses, want %d", len(got), len(want))
+	}
+	for name, info := range want {
+		if got[name] == nil || *got[name] != info {
+			t.Errorf("%s: %+v, want %+v", name, got[name], info)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Package nodelabels verifies that replacement nodes carry the labels and taints the templates of their
+// NodePools give them. Karpenter passes them to the kubelet, so an AMI whose bootstrap drops or mangles
+// kubelet flags registers nodes without them, and workloads selecting or tolerating them stop scheduling.
+package nodelabels
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+)
+
+// Discrepancy is a node missing labels or taints its NodePool's template gives it
+type Discrepancy struct {
+	Node          string   `json:"node"`
+	NodeClaim     string   `json:"nodeClaim"`
+	NodePool      string   `json:"nodePool"`
+	MissingLabels []string `json:"missingLabels,omitempty"` // key=value, with the value found when it differs
+	MissingTaints []string `json:"missingTaints,omitempty"` // key=value:effect
+}
+
+// Result is the outcome of Check
+type Result struct {
+	Checked       int           `json:"checked"` // replacement nodes whose NodePool is known
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
+
+// Check compares the nodes of the nodeclaims of the nodeclasses launched after since, i.e. the
+// replacements of a run, with the templates of their NodePools. Nodeclaims without a node yet, being
+// deleted, or of a NodePool that no longer exists are left out. Besides the template's labels, a node must
+// carry the label of every requirement with the In operator and a single value, which Karpenter sets too.
+func Check(pools []nodeclasses.NodePool, statuses []nodeclasses.NodeClaimStatus, nodes map[string]nodeclasses.Node, nodeClasses []string, since time.Time) Result {
+	byName := make(map[string]nodeclasses.NodePool, len(pools))
+	for _, np := range pools {
+		byName[np.Metadata.Name] = np
+	}
+	changed := make(map[string]bool, len(nodeClasses))
+	for _, name := range nodeClasses {
+		changed[name] = true
+	}
+
+	r := Result{Discrepancies: []Discrepancy{}}
+	for _, s := range statuses {
+		if !changed[s.NodeClass] || s.Terminating || s.NodeName == "" || !s.Created.After(since) {
+			continue
+		}
+		np, ok := byName[s.NodePool]
+		node, registered := nodes[s.NodeName]
+		if !ok || !registered {
+			continue
+		}
+		r.Checked++
+		d := Discrepancy{Node: s.NodeName, NodeClaim: s.Name, NodePool: s.NodePool}
+		for key, want := range expectedLabels(np) {
+			got, ok := node.Metadata.Labels[key]
+			switch {
+			case !ok:
+				d.MissingLabels = append(d.MissingLabels, key+"="+want)
+			case got != want:
+				d.MissingLabels = append(d.MissingLabels, fmt.Sprintf("%s=%s (found %s)", key, want, got))
+			}
+		}
+		for _, want := range np.Spec.Template.Spec.Taints {
+			if !hasTaint(node.Spec.Taints, want) {
+				d.MissingTaints = append(d.MissingTaints, want.String())
+			}
+		}
+		if len(d.MissingLabels) > 0 || len(d.MissingTaints) > 0 {
+			sort.Strings(d.MissingLabels)
+			r.Discrepancies = append(r.Discrepancies, d)
+		}
+	}
+	sort.Slice(r.Discrepancies, func(i, j int) bool { return r.Discrepancies[i].Node < r.Discrepancies[j].Node })
+	return r
+}
+
+// expectedLabels returns the labels every node of the NodePool carries
+func expectedLabels(np nodeclasses.NodePool) map[string]string {
+	labels := make(map[string]string, len(np.Spec.Template.Metadata.Labels))
+	for _, req := range np.Spec.Template.Spec.Requirements {
+		if req.Operator == "In" && len(req.Values) == 1 {
+			labels[req.Key] = req.Values[0]
+		}
+	}
+	for key, value := range np.Spec.Template.Metadata.Labels {
+		labels[key] = value
+	}
+	return labels
+}
+
+// hasTaint reports whether taints has want, with the same value and effect
+func hasTaint(taints []nodeclasses.Taint, want nodeclasses.Taint) bool {
+	for _, t := range taints {
+		if t.Key == want.Key && t.Value == want.Value && t.Effect == want.Effect {
+			return true
+		}
+	}
+	return false
+}
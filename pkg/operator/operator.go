@@ -0,0 +1,72 @@
+// Package operator resolves who is running the tool, so plans, logs, the run history and the nodeclasses
+// a run updates record it and "who upgraded prod at 2am" can be answered without forensics
+package operator
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"strings"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+)
+
+// Operator is the identity of whoever runs the tool, as far as the machine, the cluster and AWS can tell
+type Operator struct {
+	User     string `json:"user,omitempty"`     // local account, e.g. $USER
+	KubeUser string `json:"kubeUser,omitempty"` // user the cluster authenticates the kubeconfig context as
+	AWSARN   string `json:"awsARN,omitempty"`   // ARN of the identity the AWS credentials belong to
+}
+
+// Resolve looks up the operator's identities. The cluster and AWS are only asked when their clients
+// implement clients.Identifier; identities that can't be determined are left empty.
+func Resolve(ctx context.Context, cs clients.Set) Operator {
+	op := Operator{User: localUser()}
+	if id, ok := cs.Kube.(clients.Identifier); ok {
+		if name, err := id.WhoAmI(ctx); err == nil {
+			op.KubeUser = name
+		}
+	}
+	if id, ok := cs.EC2.(clients.Identifier); ok {
+		if arn, err := id.WhoAmI(ctx); err == nil {
+			op.AWSARN = arn
+		}
+	}
+	return op
+}
+
+// localUser returns the name of the account running the tool
+func localUser() string {
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
+// IsZero reports whether no identity is known
+func (o Operator) IsZero() bool {
+	return o == Operator{}
+}
+
+// String names the operator by the local account followed by the cluster and AWS identities, e.g.
+// "alice (kube: alice@example.com, aws: arn:aws:sts::123456789012:assumed-role/Admin/alice)"
+func (o Operator) String() string {
+	name := o.User
+	if name == "" {
+		name = "unknown"
+	}
+	var ids []string
+	if o.KubeUser != "" {
+		ids = append(ids, "kube: "+o.KubeUser)
+	}
+	if o.AWSARN != "" {
+		ids = append(ids, "aws: "+o.AWSARN)
+	}
+	if len(ids) == 0 {
+		return name
+	}
+	return name + " (" + strings.Join(ids, ", ") + ")"
+}
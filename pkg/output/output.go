@@ -0,0 +1,138 @@
+// Package output fans user-facing output out to sinks, so one run can write to the terminal, a log
+// file and a structured event stream at once without duplicating output logic. Text is passed on as
+// written; structured events describe milestones such as the plan, apply results and monitor polls.
+package output
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// Level classifies output
+type Level string
+
+// Output levels
+const (
+	LevelInfo Level = "info"
+	LevelWarn Level = "warn" // problems and errors, written to stderr on the terminal
+)
+
+// Event is a structured milestone of a run
+type Event struct {
+	Time    time.Time `json:"time"`
+	Level   Level     `json:"level"`
+	Type    string    `json:"type"` // e.g. "plan", "apply", "poll", "report"; "message" for text
+	Message string    `json:"message,omitempty"`
+	Data    any       `json:"data,omitempty"`
+}
+
+// Sink receives the output of a run
+type Sink interface {
+	// Text receives user-facing text as written, which is not necessarily a whole line
+	Text(level Level, text string)
+	// Event receives a structured event
+	Event(e Event)
+	// Close flushes buffered output
+	Close() error
+}
+
+// Multi sends output to several sinks. It is safe for concurrent use.
+type Multi struct {
+	// Redactor, when set, removes secrets from all text and events before they reach any sink.
+	// Text is redacted per write, so a secret split across writes is not caught.
+	Redactor *Redactor
+
+	mu    sync.Mutex
+	sinks []Sink
+}
+
+// Add attaches a sink
+func (m *Multi) Add(s Sink) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sinks = append(m.sinks, s)
+}
+
+// Text passes text on to every sink
+func (m *Multi) Text(level Level, text string) {
+	if m.Redactor != nil {
+		text = m.Redactor.Redact(text)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.sinks {
+		s.Text(level, text)
+	}
+}
+
+// Event passes e on to every sink
+func (m *Multi) Event(e Event) {
+	if m.Redactor != nil {
+		e = m.Redactor.redactEvent(e)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.sinks {
+		s.Event(e)
+	}
+}
+
+// Close closes every sink, returning their errors joined
+func (m *Multi) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var errs []error
+	for _, s := range m.sinks {
+		errs = append(errs, s.Close())
+	}
+	m.sinks = nil
+	return errors.Join(errs...)
+}
+
+// Writer returns an io.Writer that sends everything written to it to s as text of the given level
+func Writer(s Sink, level Level) io.Writer {
+	return textWriter{sink: s, level: level}
+}
+
+type textWriter struct {
+	sink  Sink
+	level Level
+}
+
+func (w textWriter) Write(p []byte) (int, error) {
+	w.sink.Text(w.level, string(p))
+	return len(p), nil
+}
+
+// lines splits text into complete lines, keeping an incomplete last line in buf until it is finished
+type lines struct {
+	buf []byte
+}
+
+// add appends text and returns the lines it completed, without their newlines
+func (l *lines) add(text string) []string {
+	var done []string
+	for _, b := range []byte(text) {
+		if b == '\n' {
+			done = append(done, string(l.buf))
+			l.buf = l.buf[:0]
+			continue
+		}
+		l.buf = append(l.buf, b)
+	}
+	return done
+}
+
+// flush returns the incomplete last line, if any
+func (l *lines) flush() []string {
+	if len(l.buf) == 0 {
+		return nil
+	}
+	rest := string(l.buf)
+	l.buf = l.buf[:0]
+	return []string{rest}
+}
@@ -0,0 +1,131 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+)
+
+// Terminal writes text to stdout and warnings to stderr as is. Structured events are not shown,
+// since the text already describes them.
+type Terminal struct {
+	Out io.Writer
+	Err io.Writer
+}
+
+// Text writes text to Out, or to Err for warnings
+func (t Terminal) Text(level Level, text string) {
+	if level == LevelWarn {
+		io.WriteString(t.Err, text)
+		return
+	}
+	io.WriteString(t.Out, text)
+}
+
+// Event is a no-op
+func (Terminal) Event(Event) {}
+
+// Close is a no-op
+func (Terminal) Close() error { return nil }
+
+// Log writes text to a log file one timestamped line at a time, e.g.
+// "2025-10-01T12:00:00Z warn  ⚠️  Skipping legacy (could not parse AMI name)". Events are logged by type.
+type Log struct {
+	w      io.WriteCloser
+	clock  clock.Clock
+	levels map[Level]*lines
+}
+
+// NewLog creates a Log sink writing to w, closing it on Close
+func NewLog(w io.WriteCloser, clk clock.Clock) *Log {
+	return &Log{w: w, clock: clock.OrReal(clk), levels: make(map[Level]*lines)}
+}
+
+// Text logs each completed line of text
+func (l *Log) Text(level Level, text string) {
+	buf := l.buffer(level)
+	for _, line := range buf.add(text) {
+		l.writeLine(level, line)
+	}
+}
+
+// Event logs the event type and message
+func (l *Log) Event(e Event) {
+	l.writeLine(e.Level, strings.TrimSpace(fmt.Sprintf("[%s] %s", e.Type, e.Message)))
+}
+
+// Close logs any incomplete lines and closes the file
+func (l *Log) Close() error {
+	for level, buf := range l.levels {
+		for _, line := range buf.flush() {
+			l.writeLine(level, line)
+		}
+	}
+	return l.w.Close()
+}
+
+func (l *Log) buffer(level Level) *lines {
+	if l.levels[level] == nil {
+		l.levels[level] = &lines{}
+	}
+	return l.levels[level]
+}
+
+func (l *Log) writeLine(level Level, line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	fmt.Fprintf(l.w, "%s %-5s %s\n", l.clock.Now().UTC().Format(time.RFC3339), level, line)
+}
+
+// JSONLines writes one JSON object per line: every structured event, and a "message" event per line of text
+type JSONLines struct {
+	w      io.WriteCloser
+	enc    *json.Encoder
+	clock  clock.Clock
+	levels map[Level]*lines
+}
+
+// NewJSONLines creates a JSONLines sink writing to w, closing it on Close
+func NewJSONLines(w io.WriteCloser, clk clock.Clock) *JSONLines {
+	return &JSONLines{w: w, enc: json.NewEncoder(w), clock: clock.OrReal(clk), levels: make(map[Level]*lines)}
+}
+
+// Text emits a message event per completed line
+func (j *JSONLines) Text(level Level, text string) {
+	if j.levels[level] == nil {
+		j.levels[level] = &lines{}
+	}
+	for _, line := range j.levels[level].add(text) {
+		j.message(level, line)
+	}
+}
+
+// Event emits e, stamping it with the current time if it has none
+func (j *JSONLines) Event(e Event) {
+	if e.Time.IsZero() {
+		e.Time = j.clock.Now()
+	}
+	j.enc.Encode(e)
+}
+
+// Close emits any incomplete lines and closes the stream
+func (j *JSONLines) Close() error {
+	for level, buf := range j.levels {
+		for _, line := range buf.flush() {
+			j.message(level, line)
+		}
+	}
+	return j.w.Close()
+}
+
+func (j *JSONLines) message(level Level, line string) {
+	if line = strings.TrimSpace(line); line == "" {
+		return
+	}
+	j.Event(Event{Level: level, Type: "message", Message: line})
+}
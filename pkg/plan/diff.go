@@ -0,0 +1,105 @@
+package plan
+
+import (
+	"sort"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+)
+
+// DiffStatus is how a nodeclass compares to its planned change
+type DiffStatus string
+
+// Diff statuses
+const (
+	DiffApplied  DiffStatus = "applied"  // the nodeclass uses the planned AMI
+	DiffPending  DiffStatus = "pending"  // the nodeclass still uses the AMI the plan changes
+	DiffDiverged DiffStatus = "diverged" // the nodeclass uses neither, or not with the planned amiFamily, so it was changed another way
+	DiffMissing  DiffStatus = "missing"  // the nodeclass no longer exists
+)
+
+// DiffEntry compares one planned change with the cluster
+type DiffEntry struct {
+	NodeClass  string     `json:"nodeClass"`
+	Status     DiffStatus `json:"status"`
+	OldAMI     string     `json:"oldAMI"`
+	NewAMI     string     `json:"newAMI"`
+	CurrentAMI string     `json:"currentAMI,omitempty"`
+}
+
+// Diff compares a plan with the current nodeclasses
+type Diff struct {
+	Entries   []DiffEntry `json:"entries"`
+	Unplanned []string    `json:"unplanned,omitempty"` // nodeclasses neither changed nor skipped by the plan
+}
+
+// Matches reports whether every planned change has been applied
+func (d *Diff) Matches() bool {
+	for _, e := range d.Entries {
+		if e.Status != DiffApplied {
+			return false
+		}
+	}
+	return true
+}
+
+// Count returns the number of entries with the given status
+func (d *Diff) Count(status DiffStatus) int {
+	n := 0
+	for _, e := range d.Entries {
+		if e.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Compare reports which of the plan's changes the nodeclasses already match, which are still
+// pending and which diverged since the plan was written. For a scoped plan only the nodeclasses of its
+// precondition can be unplanned.
+func (p *Plan) Compare(list nodeclasses.NodeClassList) *Diff {
+	if len(p.Precondition.NodeClasses) > 0 {
+		list = scope(list, p.Precondition.NodeClasses)
+	}
+	current := make(map[string]string)  // nodeclass -> AMI selector name
+	families := make(map[string]string) // nodeclass -> amiFamily
+	for _, nc := range list.Items {
+		families[nc.Metadata.Name] = nc.Spec.AMIFamily
+		ami := ""
+		if len(nc.Spec.AMISelectorTerms) > 0 {
+			ami = nc.AMIName()
+		}
+		current[nc.Metadata.Name] = ami
+	}
+
+	d := &Diff{Entries: make([]DiffEntry, 0, len(p.Changes))}
+	planned := make(map[string]bool)
+	for _, ch := range p.Changes {
+		planned[ch.NodeClass] = true
+		entry := DiffEntry{NodeClass: ch.NodeClass, OldAMI: ch.OldAMI, NewAMI: ch.NewAMI}
+
+		ami, ok := current[ch.NodeClass]
+		switch {
+		case !ok:
+			entry.Status = DiffMissing
+		case ami == ch.NewAMI && (ch.NewAMIFamily == "" || families[ch.NodeClass] == ch.NewAMIFamily):
+			entry.Status = DiffApplied
+		case ami == ch.OldAMI && (ch.NewAMIFamily == "" || families[ch.NodeClass] == ch.OldAMIFamily):
+			entry.Status = DiffPending
+		default:
+			entry.Status = DiffDiverged
+		}
+		entry.CurrentAMI = ami
+		d.Entries = append(d.Entries, entry)
+	}
+
+	for _, s := range p.Skipped {
+		planned[s.NodeClass] = true
+	}
+	for name := range current {
+		if !planned[name] {
+			d.Unplanned = append(d.Unplanned, name)
+		}
+	}
+	sort.Strings(d.Unplanned)
+	return d
+}
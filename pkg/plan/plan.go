@@ -0,0 +1,270 @@
+// Package plan defines the versioned upgrade plan document: the set of nodeclass AMI changes to make,
+// and a checksum of the cluster state it was built from. It is the contract between building a plan,
+// approving it and applying it, possibly in separate runs or by external tooling, so its serialization
+// is stable: fields are only added within an API version.
+package plan
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+)
+
+// The apiVersion and kind identifying a plan document
+const (
+	APIVersion = "upgrade-ami.dominodatalab.com/v1"
+	Kind       = "Plan"
+)
+
+// checksumPrefix names the algorithm of a precondition checksum
+const checksumPrefix = "sha256:"
+
+// ErrInvalidPlan is returned for plan documents that are malformed or fail validation
+var ErrInvalidPlan = errors.New("invalid plan")
+
+// ErrUnsupportedVersion is returned for plan documents of another apiVersion or kind
+var ErrUnsupportedVersion = errors.New("unsupported plan apiVersion or kind")
+
+// ErrPreconditionFailed is returned when the cluster no longer matches the state a plan was built from
+var ErrPreconditionFailed = errors.New("nodeclasses changed since the plan was made")
+
+// Change is a single nodeclass AMI update, optionally with an amiFamily transition applied in the same update
+type Change struct {
+	NodeClass    string `json:"nodeClass"`
+	OldAMI       string `json:"oldAMI"`
+	NewAMI       string `json:"newAMI"`
+	NewAMIID     string `json:"newAMIID,omitempty"` // when set, the nodeclass is pinned to this image named NewAMI by ID
+	OldAMIFamily string `json:"oldAMIFamily,omitempty"`
+	NewAMIFamily string `json:"newAMIFamily,omitempty"` // the amiFamily is left unchanged when empty
+	OldOwner     string `json:"oldOwner,omitempty"`
+	NewOwner     string `json:"newOwner,omitempty"` // the selector's owner is left unchanged when empty
+}
+
+// Skipped is a nodeclass left out of a plan
+type Skipped struct {
+	NodeClass string `json:"nodeClass"`
+	Reason    string `json:"reason"`
+}
+
+// Precondition is the cluster state a plan expects when it is applied
+type Precondition struct {
+	NodeClassChecksum string `json:"nodeClassChecksum"` // Checksum of the nodeclasses the plan was built from
+
+	// NodeClasses limits the checksum to these nodeclasses, for a plan built from part of the cluster; the
+	// checksum covers every nodeclass when empty
+	NodeClasses []string `json:"nodeClasses,omitempty"`
+}
+
+// Plan is the set of nodeclass updates that moves the cluster to a version
+type Plan struct {
+	APIVersion   string       `json:"apiVersion"`
+	Kind         string       `json:"kind"`
+	Version      string       `json:"version"`              // without the "v" prefix
+	Variant      string       `json:"variant,omitempty"`    // image variant, e.g. fips; standard when empty
+	K8sVersion   string       `json:"k8sVersion,omitempty"` // Kubernetes version the AMIs move to; unchanged when empty
+	Channel      string       `json:"channel,omitempty"`    // AMI channel the plan's nodeclasses track; the default source when empty
+	CreatedBy    string       `json:"createdBy,omitempty"`  // operator who built the plan
+	Precondition Precondition `json:"precondition"`
+	Changes      []Change     `json:"changes"`
+	Skipped      []Skipped    `json:"skipped,omitempty"`
+}
+
+// New creates an empty plan to version for the given nodeclasses
+func New(version string, list nodeclasses.NodeClassList) *Plan {
+	return &Plan{
+		APIVersion:   APIVersion,
+		Kind:         Kind,
+		Version:      version,
+		Precondition: Precondition{NodeClassChecksum: Checksum(list)},
+	}
+}
+
+// NewScoped creates an empty plan to version whose precondition only covers the given nodeclasses, so
+// changes to the cluster's other nodeclasses, e.g. by the plan for another Kubernetes version, don't
+// invalidate it
+func NewScoped(version string, list nodeclasses.NodeClassList) *Plan {
+	p := New(version, list)
+	for _, nc := range list.Items {
+		p.Precondition.NodeClasses = append(p.Precondition.NodeClasses, nc.Metadata.Name)
+	}
+	sort.Strings(p.Precondition.NodeClasses)
+	return p
+}
+
+// Checksum fingerprints the AMI selectors of the nodeclasses, independent of their order. Status and
+// metadata changes made by controllers do not affect it.
+func Checksum(list nodeclasses.NodeClassList) string {
+	items := append([]nodeclasses.EC2NodeClass(nil), list.Items...)
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Metadata.Name < items[j].Metadata.Name
+	})
+
+	h := sha256.New()
+	for _, nc := range items {
+		fmt.Fprintf(h, "%s\x00", nc.Metadata.Name)
+		for _, term := range nc.Spec.AMISelectorTerms {
+			fmt.Fprintf(h, "%s\x00%s\x00", term.Name, term.Owner)
+			// Only pinned terms have an ID, so the checksums of plans made before pinning existed still match
+			if term.ID != "" {
+				fmt.Fprintf(h, "%s\x00", term.ID)
+			}
+		}
+		fmt.Fprint(h, "\n")
+	}
+	return checksumPrefix + hex.EncodeToString(h.Sum(nil))
+}
+
+// CheckPrecondition returns ErrPreconditionFailed if the nodeclasses differ from those the plan was built from
+func (p *Plan) CheckPrecondition(list nodeclasses.NodeClassList) error {
+	if len(p.Precondition.NodeClasses) > 0 {
+		list = scope(list, p.Precondition.NodeClasses)
+	}
+	if got := Checksum(list); got != p.Precondition.NodeClassChecksum {
+		return fmt.Errorf("%w: checksum %s, plan expects %s", ErrPreconditionFailed, got, p.Precondition.NodeClassChecksum)
+	}
+	return nil
+}
+
+// Rebase sets the precondition to the nodeclasses as they are now, e.g. once the operator reviewed the
+// changes made to them since the plan was made
+func (p *Plan) Rebase(list nodeclasses.NodeClassList) {
+	if len(p.Precondition.NodeClasses) > 0 {
+		list = scope(list, p.Precondition.NodeClasses)
+	}
+	p.Precondition.NodeClassChecksum = Checksum(list)
+}
+
+// scope returns the nodeclasses of list named in names
+func scope(list nodeclasses.NodeClassList, names []string) nodeclasses.NodeClassList {
+	scoped := nodeclasses.NodeClassList{}
+	for _, nc := range list.Items {
+		for _, name := range names {
+			if nc.Metadata.Name == name {
+				scoped.Items = append(scoped.Items, nc)
+				break
+			}
+		}
+	}
+	return scoped
+}
+
+// Validate checks that the plan is complete and consistent
+func (p *Plan) Validate() error {
+	if p.APIVersion != APIVersion || p.Kind != Kind {
+		return fmt.Errorf("%w: %s %s (want %s %s)", ErrUnsupportedVersion, p.APIVersion, p.Kind, APIVersion, Kind)
+	}
+	if p.Version == "" {
+		return fmt.Errorf("%w: version is required", ErrInvalidPlan)
+	}
+	if !strings.HasPrefix(p.Precondition.NodeClassChecksum, checksumPrefix) {
+		return fmt.Errorf("%w: precondition.nodeClassChecksum must start with %q", ErrInvalidPlan, checksumPrefix)
+	}
+
+	seen := make(map[string]bool)
+	for i, ch := range p.Changes {
+		if ch.NodeClass == "" || ch.NewAMI == "" {
+			return fmt.Errorf("%w: change %d needs nodeClass and newAMI", ErrInvalidPlan, i)
+		}
+		if seen[ch.NodeClass] {
+			return fmt.Errorf("%w: nodeclass %s is changed more than once", ErrInvalidPlan, ch.NodeClass)
+		}
+		seen[ch.NodeClass] = true
+	}
+	return nil
+}
+
+// Marshal validates the plan and encodes it as indented JSON
+func Marshal(p *Plan) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Always emit the changes list, so consumers can tell an empty plan from a truncated document
+	out := *p
+	if out.Changes == nil {
+		out.Changes = []Change{}
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode plan: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// Unmarshal decodes and validates a plan document. Unknown fields are rejected, so a document
+// written by a newer release fails instead of being applied partially.
+func Unmarshal(data []byte) (*Plan, error) {
+	// Check the version first, so a newer document reports that rather than its unknown fields
+	var header struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPlan, err)
+	}
+	if header.APIVersion != APIVersion || header.Kind != Kind {
+		return nil, fmt.Errorf("%w: %s %s (want %s %s)", ErrUnsupportedVersion, header.APIVersion, header.Kind, APIVersion, Kind)
+	}
+
+	var p Plan
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPlan, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// UnmarshalYAML decodes and validates a plan document written as YAML, with the same field names and
+// strictness as Unmarshal
+func UnmarshalYAML(data []byte) (*Plan, error) {
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPlan, err)
+	}
+	jsonData, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPlan, err)
+	}
+	return Unmarshal(jsonData)
+}
+
+// MarshalYAML validates the plan and encodes it as YAML
+func MarshalYAML(p *Plan) ([]byte, error) {
+	data, err := Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	// Round-trip through a generic value so the JSON field names are kept
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to encode plan: %w", err)
+	}
+	setBlockStyle(&doc)
+	out, err := yaml.Marshal(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode plan: %w", err)
+	}
+	return out, nil
+}
+
+// setBlockStyle switches the flow style and quoting JSON parses into to plain YAML; strings that
+// would read as another type stay quoted
+func setBlockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, child := range n.Content {
+		setBlockStyle(child)
+	}
+}
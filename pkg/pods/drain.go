@@ -0,0 +1,106 @@
+package pods
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+)
+
+// Drain is the outcome of evicting the pods of one node on paper, with the semantics of
+// kubectl drain --dry-run plus Karpenter's karpenter.sh/do-not-disrupt annotation
+type Drain struct {
+	Node      string    `json:"node"`
+	NodeClaim string    `json:"nodeClaim,omitempty"`
+	Evicted   []string  `json:"evicted"`  // namespace/name of the pods the drain would evict
+	Ignored   []string  `json:"ignored"`  // DaemonSet, mirror and completed pods the drain leaves alone
+	Blockers  []Blocker `json:"blockers"` // pods whose eviction would currently fail
+}
+
+// Blocker is a pod whose eviction would currently fail
+type Blocker struct {
+	Pod    string `json:"pod"` // namespace/name
+	Reason string `json:"reason"`
+}
+
+// Drainable reports whether every pod of the node could be evicted now
+func (d Drain) Drainable() bool {
+	return len(d.Blockers) == 0
+}
+
+// SimulateDrain evicts the pods of the node in turn without touching them. Each eviction a PDB allows uses
+// one of its disruptions, so a node running more pods of a PDB than it allows to be disrupted fails to
+// drain like it would for real. Pods without a controller block the drain as they do kubectl drain
+// without --force.
+func SimulateDrain(node string, pods PodList, pdbs PodDisruptionBudgetList) Drain {
+	d := Drain{Node: node, Evicted: []string{}, Ignored: []string{}, Blockers: []Blocker{}}
+	allowed := make(map[string]int, len(pdbs.Items)) // namespace/name -> disruptions left
+	for _, pdb := range pdbs.Items {
+		allowed[pdb.Metadata.Namespace+"/"+pdb.Metadata.Name] = pdb.Status.DisruptionsAllowed
+	}
+
+	for _, pod := range pods.Items {
+		name := pod.Metadata.Namespace + "/" + pod.Metadata.Name
+		owner := pod.Owner()
+		switch {
+		case pod.Status.Phase == "Succeeded" || pod.Status.Phase == "Failed",
+			strings.HasPrefix(owner, "DaemonSet/"),
+			pod.Metadata.Annotations["kubernetes.io/config.mirror"] != "":
+			d.Ignored = append(d.Ignored, name)
+			continue
+		case pod.Metadata.Annotations["karpenter.sh/do-not-disrupt"] == "true":
+			d.Blockers = append(d.Blockers, Blocker{Pod: name, Reason: "karpenter.sh/do-not-disrupt annotation"})
+			continue
+		case owner == "none":
+			d.Blockers = append(d.Blockers, Blocker{Pod: name, Reason: "not managed by a controller, so it would not be recreated"})
+			continue
+		}
+
+		var matching []string
+		blocked := ""
+		for _, pdb := range pdbs.Items {
+			if pdb.Metadata.Namespace != pod.Metadata.Namespace || !pdb.Spec.Selector.Matches(pod.Metadata.Labels) {
+				continue
+			}
+			key := pdb.Metadata.Namespace + "/" + pdb.Metadata.Name
+			if allowed[key] <= 0 {
+				blocked = fmt.Sprintf("pdb %s allows no more disruptions", pdb.Metadata.Name)
+				break
+			}
+			matching = append(matching, key)
+		}
+		if blocked != "" {
+			d.Blockers = append(d.Blockers, Blocker{Pod: name, Reason: blocked})
+			continue
+		}
+		for _, key := range matching {
+			allowed[key]--
+		}
+		d.Evicted = append(d.Evicted, name)
+	}
+	return d
+}
+
+// GetPodsByNode retrieves the pods of every node in one list, keyed by node name. Pods not scheduled yet
+// are left out.
+func GetPodsByNode(ctx context.Context, kube clients.KubeClient) (map[string]PodList, error) {
+	stream, err := kube.List(ctx, "pods", clients.ListOptions{AllNamespaces: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pods: %w", err)
+	}
+
+	byNode := make(map[string]PodList)
+	err = clients.DecodeItems(stream, func(item Pod) error {
+		if item.Spec.NodeName != "" {
+			list := byNode[item.Spec.NodeName]
+			list.Items = append(list.Items, item)
+			byNode[item.Spec.NodeName] = list
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pods: %w", err)
+	}
+	return byNode, nil
+}
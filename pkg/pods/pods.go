@@ -0,0 +1,355 @@
+package pods
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+)
+
+// Pod represents a Kubernetes Pod
+type Pod struct {
+	Metadata struct {
+		Name            string            `json:"name"`
+		Namespace       string            `json:"namespace"`
+		Labels          map[string]string `json:"labels,omitempty"`
+		Annotations     map[string]string `json:"annotations,omitempty"`
+		OwnerReferences []struct {
+			Kind string `json:"kind"`
+			Name string `json:"name"`
+		} `json:"ownerReferences,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		NodeName string   `json:"nodeName"`
+		Volumes  []Volume `json:"volumes,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		Phase string `json:"phase"`
+	} `json:"status"`
+}
+
+// Validate checks the fields the tool relies on
+func (p Pod) Validate() error {
+	if p.Metadata.Name == "" || p.Metadata.Namespace == "" {
+		return fmt.Errorf("pod without metadata.name or metadata.namespace")
+	}
+	return nil
+}
+
+// Volume represents a pod volume; only the sources relevant to node replacement are decoded
+type Volume struct {
+	Name     string `json:"name"`
+	EmptyDir *struct {
+		Medium string `json:"medium,omitempty"`
+	} `json:"emptyDir,omitempty"`
+	PersistentVolumeClaim *struct {
+		ClaimName string `json:"claimName"`
+	} `json:"persistentVolumeClaim,omitempty"`
+}
+
+// PodList represents a list of Pod resources
+type PodList struct {
+	Items []Pod `json:"items"`
+}
+
+// PodDisruptionBudget represents a Kubernetes PodDisruptionBudget
+type PodDisruptionBudget struct {
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		Selector *LabelSelector `json:"selector,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		DisruptionsAllowed int `json:"disruptionsAllowed"`
+	} `json:"status"`
+}
+
+// PodDisruptionBudgetList represents a list of PodDisruptionBudget resources
+type PodDisruptionBudgetList struct {
+	Items []PodDisruptionBudget `json:"items"`
+}
+
+// LabelSelector represents a Kubernetes label selector
+type LabelSelector struct {
+	MatchLabels      map[string]string `json:"matchLabels,omitempty"`
+	MatchExpressions []struct {
+		Key      string   `json:"key"`
+		Operator string   `json:"operator"`
+		Values   []string `json:"values,omitempty"`
+	} `json:"matchExpressions,omitempty"`
+}
+
+// Matches reports whether labels satisfy the selector. A nil selector matches nothing, an empty one everything.
+func (s *LabelSelector) Matches(labels map[string]string) bool {
+	if s == nil {
+		return false
+	}
+
+	for key, value := range s.MatchLabels {
+		if labels[key] != value {
+			return false
+		}
+	}
+
+	for _, expr := range s.MatchExpressions {
+		value, exists := labels[expr.Key]
+		switch expr.Operator {
+		case "In":
+			if !exists || !contains(expr.Values, value) {
+				return false
+			}
+		case "NotIn":
+			if exists && contains(expr.Values, value) {
+				return false
+			}
+		case "Exists":
+			if !exists {
+				return false
+			}
+		case "DoesNotExist":
+			if exists {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Owner returns the workload owning the pod as "Kind/name", resolving ReplicaSets to their Deployment
+func (p Pod) Owner() string {
+	if len(p.Metadata.OwnerReferences) == 0 {
+		return "none"
+	}
+
+	ref := p.Metadata.OwnerReferences[0]
+	if ref.Kind == "ReplicaSet" {
+		// ReplicaSets created by a Deployment are named <deployment>-<pod-template-hash>
+		if hash, ok := p.Metadata.Labels["pod-template-hash"]; ok && strings.HasSuffix(ref.Name, "-"+hash) {
+			return "Deployment/" + strings.TrimSuffix(ref.Name, "-"+hash)
+		}
+	}
+	return ref.Kind + "/" + ref.Name
+}
+
+// PodInfo describes a pod running on a node and whether it can be evicted
+type PodInfo struct {
+	Namespace    string
+	Name         string
+	Owner        string
+	Evictable    bool
+	Note         string   // why the pod is not evictable
+	StatefulSet  bool     // owned by a StatefulSet
+	LocalStorage []string // node-local volumes whose data is lost on replacement
+}
+
+// NeedsCoordination reports whether replacing the pod's node needs more than a normal drain
+func (p PodInfo) NeedsCoordination() bool {
+	return p.StatefulSet || len(p.LocalStorage) > 0
+}
+
+// LargeEmptyDirBytes is the usage above which an emptyDir volume is flagged as holding significant data
+const LargeEmptyDirBytes = 1 << 30
+
+// StorageInfo holds the cluster storage details used to flag pods with node-local data
+type StorageInfo struct {
+	LocalClaims   map[string]string // "namespace/claim" -> name of the local or hostPath PV it is bound to
+	EmptyDirUsage map[string]int64  // "namespace/pod/volume" -> bytes used, from kubelet stats
+}
+
+// PersistentVolume represents a Kubernetes PersistentVolume
+type PersistentVolume struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		Local    *struct{} `json:"local,omitempty"`
+		HostPath *struct{} `json:"hostPath,omitempty"`
+		ClaimRef *struct {
+			Namespace string `json:"namespace"`
+			Name      string `json:"name"`
+		} `json:"claimRef,omitempty"`
+	} `json:"spec"`
+}
+
+// PersistentVolumeList represents a list of PersistentVolume resources
+type PersistentVolumeList struct {
+	Items []PersistentVolume `json:"items"`
+}
+
+// GetLocalClaims returns the PVCs bound to node-local (local or hostPath) persistent volumes
+func GetLocalClaims(ctx context.Context, kube clients.KubeClient) (map[string]string, error) {
+	stream, err := kube.List(ctx, "persistentvolumes", clients.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get persistentvolumes: %w", err)
+	}
+
+	var pvs PersistentVolumeList
+	err = clients.DecodeItems(stream, func(item PersistentVolume) error {
+		pvs.Items = append(pvs.Items, item)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get persistentvolumes: %w", err)
+	}
+
+	claims := make(map[string]string)
+	for _, pv := range pvs.Items {
+		if (pv.Spec.Local != nil || pv.Spec.HostPath != nil) && pv.Spec.ClaimRef != nil {
+			claims[pv.Spec.ClaimRef.Namespace+"/"+pv.Spec.ClaimRef.Name] = pv.Metadata.Name
+		}
+	}
+	return claims, nil
+}
+
+// statsSummary is the subset of the kubelet stats summary needed for volume usage
+type statsSummary struct {
+	Pods []struct {
+		PodRef struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"podRef"`
+		Volume []struct {
+			Name      string `json:"name"`
+			UsedBytes int64  `json:"usedBytes"`
+		} `json:"volume"`
+	} `json:"pods"`
+}
+
+// GetVolumeUsage returns the bytes used by each pod volume on a node, keyed by "namespace/pod/volume"
+func GetVolumeUsage(ctx context.Context, kube clients.KubeClient, nodeName string) (map[string]int64, error) {
+	output, err := kube.GetRaw(ctx, "/api/v1/nodes/"+nodeName+"/proxy/stats/summary")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stats summary for node %s: %w", nodeName, err)
+	}
+
+	var summary statsSummary
+	if err := json.Unmarshal(output, &summary); err != nil {
+		return nil, fmt.Errorf("failed to parse stats summary: %w", err)
+	}
+
+	usage := make(map[string]int64)
+	for _, pod := range summary.Pods {
+		for _, vol := range pod.Volume {
+			usage[pod.PodRef.Namespace+"/"+pod.PodRef.Name+"/"+vol.Name] = vol.UsedBytes
+		}
+	}
+	return usage, nil
+}
+
+// GetPodsOnNode retrieves the pods scheduled on the named node
+func GetPodsOnNode(ctx context.Context, kube clients.KubeClient, nodeName string) (PodList, error) {
+	stream, err := kube.List(ctx, "pods", clients.ListOptions{
+		AllNamespaces: true,
+		FieldSelector: "spec.nodeName=" + nodeName,
+	})
+	if err != nil {
+		return PodList{}, fmt.Errorf("failed to get pods on node %s: %w", nodeName, err)
+	}
+
+	var pods PodList
+	err = clients.DecodeItems(stream, func(item Pod) error {
+		pods.Items = append(pods.Items, item)
+		return nil
+	})
+	if err != nil {
+		return PodList{}, fmt.Errorf("failed to get pods on node %s: %w", nodeName, err)
+	}
+
+	return pods, nil
+}
+
+// GetPodDisruptionBudgets retrieves all PodDisruptionBudgets in the cluster
+func GetPodDisruptionBudgets(ctx context.Context, kube clients.KubeClient) (PodDisruptionBudgetList, error) {
+	stream, err := kube.List(ctx, "poddisruptionbudgets", clients.ListOptions{AllNamespaces: true})
+	if err != nil {
+		return PodDisruptionBudgetList{}, fmt.Errorf("failed to get poddisruptionbudgets: %w", err)
+	}
+
+	var pdbs PodDisruptionBudgetList
+	err = clients.DecodeItems(stream, func(item PodDisruptionBudget) error {
+		pdbs.Items = append(pdbs.Items, item)
+		return nil
+	})
+	if err != nil {
+		return PodDisruptionBudgetList{}, fmt.Errorf("failed to get poddisruptionbudgets: %w", err)
+	}
+
+	return pdbs, nil
+}
+
+// Describe determines the owner, evictability and node-local storage of each pod that is keeping a node busy.
+// Pods the drain ignores (DaemonSet pods, completed pods) are left out.
+func Describe(pods PodList, pdbs PodDisruptionBudgetList, storage StorageInfo) []PodInfo {
+	var infos []PodInfo
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == "Succeeded" || pod.Status.Phase == "Failed" {
+			continue
+		}
+
+		owner := pod.Owner()
+		if strings.HasPrefix(owner, "DaemonSet/") {
+			continue
+		}
+
+		info := PodInfo{
+			Namespace:   pod.Metadata.Namespace,
+			Name:        pod.Metadata.Name,
+			Owner:       owner,
+			Evictable:   true,
+			StatefulSet: strings.HasPrefix(owner, "StatefulSet/"),
+		}
+
+		for _, vol := range pod.Spec.Volumes {
+			switch {
+			case vol.PersistentVolumeClaim != nil:
+				if pv, ok := storage.LocalClaims[pod.Metadata.Namespace+"/"+vol.PersistentVolumeClaim.ClaimName]; ok {
+					info.LocalStorage = append(info.LocalStorage, fmt.Sprintf("local PV %s", pv))
+				}
+			case vol.EmptyDir != nil && vol.EmptyDir.Medium != "Memory":
+				used := storage.EmptyDirUsage[pod.Metadata.Namespace+"/"+pod.Metadata.Name+"/"+vol.Name]
+				if used >= LargeEmptyDirBytes {
+					info.LocalStorage = append(info.LocalStorage, fmt.Sprintf("emptyDir %s (%.1f GiB)", vol.Name, float64(used)/(1<<30)))
+				}
+			}
+		}
+
+		switch {
+		case pod.Metadata.Annotations["kubernetes.io/config.mirror"] != "":
+			info.Evictable = false
+			info.Note = "static (mirror) pod"
+		case pod.Metadata.Annotations["karpenter.sh/do-not-disrupt"] == "true":
+			info.Evictable = false
+			info.Note = "karpenter.sh/do-not-disrupt annotation"
+		default:
+			for _, pdb := range pdbs.Items {
+				if pdb.Metadata.Namespace == pod.Metadata.Namespace &&
+					pdb.Status.DisruptionsAllowed == 0 &&
+					pdb.Spec.Selector.Matches(pod.Metadata.Labels) {
+					info.Evictable = false
+					info.Note = fmt.Sprintf("pdb %s allows no disruptions", pdb.Metadata.Name)
+					break
+				}
+			}
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos
+}
@@ -0,0 +1,107 @@
+// Package policy evaluates upgrade plans against Rego policies with the opa binary, so organizations can
+// encode rules such as "no production upgrades on Fridays" or "AMI versions must be at least 7 days old"
+// that block or warn about a plan before it is applied.
+//
+// Policies are Rego modules in package upgrade_ami defining deny and warn as sets of messages:
+//
+//	package upgrade_ami
+//
+//	deny contains msg if {
+//		input.weekday == "Friday"
+//		startswith(input.cluster, "prod-")
+//		msg := "no production upgrades on Fridays"
+//	}
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+)
+
+// Query is the Rego document holding the deny and warn rules
+const Query = "data.upgrade_ami"
+
+// ErrDenied is returned when a policy denies a plan
+var ErrDenied = errors.New("denied by policy")
+
+// Input is the document policies evaluate as input
+type Input struct {
+	Plan           *plan.Plan `json:"plan"`
+	Cluster        string     `json:"cluster"`                  // kubeconfig context of the cluster
+	Now            time.Time  `json:"now"`                      // when the plan is evaluated, in UTC
+	Weekday        string     `json:"weekday"`                  // weekday of now, e.g. "Friday"
+	VersionCreated time.Time  `json:"versionCreated,omitzero"`  // creation date of the AMIs of the plan's version
+	VersionAgeDays *int       `json:"versionAgeDays,omitempty"` // whole days since VersionCreated
+}
+
+// NewInput builds the input for evaluating p at now. created is the AMI creation date, left out when it is
+// zero because it isn't known.
+func NewInput(p *plan.Plan, cluster string, now time.Time, created time.Time) Input {
+	now = now.UTC()
+	in := Input{Plan: p, Cluster: cluster, Now: now, Weekday: now.Weekday().String()}
+	if !created.IsZero() {
+		days := int(now.Sub(created).Hours() / 24)
+		in.VersionCreated = created.UTC()
+		in.VersionAgeDays = &days
+	}
+	return in
+}
+
+// Decision is the outcome of evaluating the policies
+type Decision struct {
+	Deny []string `json:"deny"`
+	Warn []string `json:"warn"`
+}
+
+// Err returns ErrDenied listing the deny messages, or nil when nothing was denied
+func (d *Decision) Err() error {
+	if len(d.Deny) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrDenied, strings.Join(d.Deny, "; "))
+}
+
+// Evaluator runs opa eval over the policy files or directories in Paths
+type Evaluator struct {
+	Exec  clients.Executor
+	Paths []string
+}
+
+// Evaluate evaluates the policies with input
+func (e *Evaluator) Evaluate(ctx context.Context, input Input) (*Decision, error) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode policy input: %w", err)
+	}
+	args := []string{"eval", "--format", "json", "--stdin-input"}
+	for _, path := range e.Paths {
+		args = append(args, "--data", path)
+	}
+	output, err := e.Exec.Output(ctx, clients.Command{Name: "opa", Args: append(args, Query), Stdin: data})
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate policies: %w", err)
+	}
+
+	var result struct {
+		Result []struct {
+			Expressions []struct {
+				Value Decision `json:"value"`
+			} `json:"expressions"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse policy decision: %w", err)
+	}
+	// No result means no policy defines package upgrade_ami, which is a misconfiguration rather than an allow
+	if len(result.Result) == 0 || len(result.Result[0].Expressions) == 0 {
+		return nil, fmt.Errorf("failed to evaluate policies: no policy in %s defines package upgrade_ami", strings.Join(e.Paths, ", "))
+	}
+	return &result.Result[0].Expressions[0].Value, nil
+}
@@ -0,0 +1,95 @@
+package preflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+)
+
+// Checks returns the preflight checks for the clients in cs. Tool checks are only included for clients
+// that shell out to a binary (see clients.ToolChecker); AWS clients that call the APIs directly get their
+// credentials checked instead.
+func Checks(cs clients.Set) []Check {
+	var checks []Check
+	if checker, ok := cs.Kube.(clients.ToolChecker); ok {
+		checks = append(checks, Check{Name: "kubectl", Run: toolCheck(checker, "kubectl")})
+	}
+	if checker, ok := cs.EC2.(clients.ToolChecker); ok {
+		checks = append(checks, Check{Name: "aws-cli", Run: toolCheck(checker, "the AWS CLI")})
+	} else if identifier, ok := cs.EC2.(clients.Identifier); ok {
+		checks = append(checks, Check{Name: "aws-credentials", Run: awsCredentialsCheck(identifier)})
+	}
+	return append(checks,
+		Check{Name: "kube-context", Run: kubeContextCheck(cs.Kube)},
+		Check{Name: "karpenter-api", Run: karpenterAPICheck(cs.Kube)},
+	)
+}
+
+// toolCheck checks that a client's binary is installed and reports its version
+func toolCheck(checker clients.ToolChecker, tool string) func(ctx context.Context) Result {
+	return func(ctx context.Context) Result {
+		version, err := checker.CheckTool(ctx)
+		switch {
+		case errors.Is(err, clients.ErrToolNotFound):
+			return fail(err, installHint(tool))
+		case errors.Is(err, clients.ErrVersionSkew):
+			return warn(err, "install a kubectl within one minor version of the cluster")
+		case err != nil:
+			return warn(fmt.Errorf("could not determine version: %w", err), "check that "+tool+" runs on its own")
+		}
+
+		if version.Server != "" {
+			return pass(fmt.Sprintf("%s (server %s)", version.Version, version.Server))
+		}
+		return pass(version.Version)
+	}
+}
+
+// awsCredentialsCheck checks that AWS credentials are configured and accepted. It only warns, as runs that
+// don't call AWS (e.g. monitoring without --verify-termination) can do without them.
+func awsCredentialsCheck(identifier clients.Identifier) func(ctx context.Context) Result {
+	return func(ctx context.Context) Result {
+		arn, err := identifier.WhoAmI(ctx)
+		if err != nil {
+			return warn(err, "check that AWS credentials are configured (aws configure, AWS_PROFILE or an instance role) and STS is reachable")
+		}
+		return pass(arn)
+	}
+}
+
+// kubeContextCheck checks that a kubeconfig context is selected
+func kubeContextCheck(kube clients.KubeClient) func(ctx context.Context) Result {
+	return func(ctx context.Context) Result {
+		name, err := kube.CurrentContext(ctx)
+		if err != nil {
+			return kubeFail(err, "select the cluster to upgrade with kubectl config use-context")
+		}
+		return pass(name)
+	}
+}
+
+// karpenterAPICheck checks that the cluster serves the EC2NodeClass API
+func karpenterAPICheck(kube clients.KubeClient) func(ctx context.Context) Result {
+	return func(ctx context.Context) Result {
+		if _, err := kube.GetRaw(ctx, "/apis/karpenter.k8s.aws"); err != nil {
+			return kubeFail(fmt.Errorf("EC2NodeClass API not reachable: %w", err),
+				"check that Karpenter is installed and that your credentials can reach the cluster")
+		}
+		return pass("karpenter.k8s.aws served")
+	}
+}
+
+// installHint is the remediation for a missing binary
+func installHint(tool string) string {
+	return fmt.Sprintf("install %s and make sure it is on your PATH", tool)
+}
+
+// kubeFail fails a check that needs kubectl, pointing at the installation when kubectl is missing
+func kubeFail(err error, remediation string) Result {
+	if errors.Is(err, clients.ErrToolNotFound) {
+		remediation = installHint("kubectl")
+	}
+	return fail(err, remediation)
+}
@@ -0,0 +1,140 @@
+// Package preflight checks that the environment can run an upgrade before the tool starts talking to the
+// cluster and AWS, so problems surface as actionable errors instead of failures halfway through. Checks run
+// concurrently and produce a structured report with remediation hints.
+package preflight
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/report"
+)
+
+// Status is the outcome of a check
+type Status string
+
+// Check statuses, from best to worst
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn" // a problem that may not stop the tool from working
+	StatusFail Status = "fail" // the tool cannot work until this is fixed
+)
+
+// Result is the outcome of one check
+type Result struct {
+	Check       string        `json:"check"`
+	Status      Status        `json:"status"`
+	Message     string        `json:"message"`
+	Remediation string        `json:"remediation,omitempty"` // how to fix a warning or failure
+	Duration    time.Duration `json:"durationMs"`
+	Err         error         `json:"-"` // the underlying error of a warning or failure
+}
+
+// MarshalJSON renders the duration in milliseconds
+func (r Result) MarshalJSON() ([]byte, error) {
+	type plain Result
+	out := struct {
+		plain
+		Duration int64 `json:"durationMs"`
+	}{plain: plain(r), Duration: r.Duration.Milliseconds()}
+	return json.Marshal(out)
+}
+
+// Check is a single preflight check
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) Result // Check and Duration of the result are filled in by Run
+}
+
+// Report holds the results of a set of checks, in the order the checks were given
+type Report struct {
+	Results []Result `json:"results"`
+}
+
+// Run runs the checks concurrently and collects their results
+func Run(ctx context.Context, checks []Check) *Report {
+	r := &Report{Results: make([]Result, len(checks))}
+
+	var g errgroup.Group
+	for i, check := range checks {
+		g.Go(func() error {
+			start := time.Now()
+			result := check.Run(ctx)
+			result.Check = check.Name
+			result.Duration = time.Since(start)
+			r.Results[i] = result
+			return nil
+		})
+	}
+	g.Wait()
+	return r
+}
+
+// Failed reports whether any check failed
+func (r *Report) Failed() bool {
+	for _, result := range r.Results {
+		if result.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns the errors of the failed checks joined, or nil if none failed
+func (r *Report) Err() error {
+	var errs []error
+	for _, result := range r.Results {
+		if result.Status != StatusFail {
+			continue
+		}
+		err := result.Err
+		if err == nil {
+			err = errors.New(result.Message)
+		}
+		errs = append(errs, fmt.Errorf("preflight check %s failed: %w", result.Check, err))
+	}
+	return errors.Join(errs...)
+}
+
+// Write renders the report as a table or as JSON
+func (r *Report) Write(w io.Writer, format report.Format) error {
+	if format == report.FormatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(r); err != nil {
+			return fmt.Errorf("failed to encode preflight report: %w", err)
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tSTATUS\tDETAILS")
+	for _, result := range r.Results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", result.Check, strings.ToUpper(string(result.Status)), result.Message)
+		if result.Remediation != "" && result.Status != StatusPass {
+			fmt.Fprintf(tw, "\t\tfix: %s\n", result.Remediation)
+		}
+	}
+	return tw.Flush()
+}
+
+// pass, warn and fail build results
+func pass(message string) Result {
+	return Result{Status: StatusPass, Message: message}
+}
+
+func warn(err error, remediation string) Result {
+	return Result{Status: StatusWarn, Message: err.Error(), Remediation: remediation, Err: err}
+}
+
+func fail(err error, remediation string) Result {
+	return Result{Status: StatusFail, Message: err.Error(), Remediation: remediation, Err: err}
+}
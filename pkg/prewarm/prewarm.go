@@ -0,0 +1,361 @@
+// Package prewarm launches a few nodes on the new AMIs of a plan before it is applied and pulls key container
+// images onto them, so pods displaced by the rollout land on nodes that are already up with their images
+// cached. Each changed nodeclass gets a temporary copy selecting the new AMI and a temporary NodePool copied
+// from one using the nodeclass; pull pods pinned to that NodePool make Karpenter launch the nodes.
+package prewarm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+)
+
+// Label marks the temporary objects; its value is the nodeclass they pre-warm
+const Label = "upgrade-ami.dominodatalab.com/prewarm"
+
+// namePrefix prefixes the names of the temporary nodeclasses, NodePools and pods
+const namePrefix = "upgrade-ami-prewarm-"
+
+// pauseImage keeps the pull pods running when no images are configured, so the nodes are not empty
+const pauseImage = "registry.k8s.io/pause:3.10"
+
+// Defaults for Prewarmer
+const (
+	DefaultTimeout      = 10 * time.Minute
+	DefaultPollInterval = 10 * time.Second
+)
+
+// ErrTimeout is returned by Wait when the images were not pulled in time
+var ErrTimeout = errors.New("timed out waiting for pre-warmed nodes")
+
+// ErrUnsupported is returned when the Kubernetes client cannot delete the temporary objects again
+var ErrUnsupported = errors.New("the Kubernetes client cannot delete objects")
+
+// Prewarmer launches pre-warmed nodes for the changes of a plan
+type Prewarmer struct {
+	Kube         clients.KubeClient
+	Clock        clock.Clock
+	Nodes        int      // nodes to launch per changed nodeclass
+	Images       []string // images to pull onto every node
+	PollInterval time.Duration
+}
+
+// New creates a Prewarmer launching nodes per changed nodeclass and pulling images onto them
+func New(kube clients.KubeClient, nodes int, images []string) *Prewarmer {
+	return &Prewarmer{Kube: kube, Clock: clock.Real, Nodes: nodes, Images: images, PollInterval: DefaultPollInterval}
+}
+
+// Pool is the set of temporary objects pre-warming one nodeclass
+type Pool struct {
+	NodeClass     string // the nodeclass the plan changes
+	TempNodeClass string
+	NodePool      string
+	Pods          []string
+
+	manifest map[string]interface{} // of the NodePool, to cap its limits once the nodes are up
+}
+
+// Session is a pre-warming started by Start. Cleanup removes its objects.
+type Session struct {
+	Pools   []Pool
+	Skipped []string // changed nodeclasses no NodePool uses, which have no nodes to replace
+
+	p       *Prewarmer
+	deleter clients.Deleter
+}
+
+// Start creates the temporary nodeclasses, NodePools and pull pods for every change of the plans. If a
+// step fails, the objects created so far are removed again.
+func (p *Prewarmer) Start(ctx context.Context, plans []*plan.Plan) (*Session, error) {
+	deleter, ok := p.Kube.(clients.Deleter)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	nodePools, err := nodeclasses.GetNodePools(ctx, p.Kube)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{p: p, deleter: deleter}
+	for _, pl := range plans {
+		for _, ch := range pl.Changes {
+			source := ""
+			for _, np := range nodePools {
+				if np.Spec.Template.Spec.NodeClassRef.Name == ch.NodeClass {
+					source = np.Metadata.Name
+					break
+				}
+			}
+			if source == "" {
+				s.Skipped = append(s.Skipped, ch.NodeClass)
+				continue
+			}
+
+			pool, err := p.start(ctx, ch, source)
+			if pool != nil {
+				s.Pools = append(s.Pools, *pool)
+			}
+			if err != nil {
+				return nil, errors.Join(err, s.Cleanup(context.WithoutCancel(ctx)))
+			}
+		}
+	}
+	return s, nil
+}
+
+// start creates the objects pre-warming the nodeclass of ch, copying the NodePool source. The returned
+// pool lists the objects created, also on error.
+func (p *Prewarmer) start(ctx context.Context, ch plan.Change, source string) (*Pool, error) {
+	name := namePrefix + ch.NodeClass
+	pool := &Pool{NodeClass: ch.NodeClass}
+
+	nodeclass, err := nodeclasses.CloneNodeClass(ctx, p.Kube, ch.NodeClass, name, ch.NewAMI, ch.NewAMIFamily)
+	if err != nil {
+		return pool, err
+	}
+	nodeclass["metadata"].(map[string]interface{})["labels"] = map[string]interface{}{Label: ch.NodeClass}
+	if err := p.apply(ctx, nodeclass); err != nil {
+		return pool, fmt.Errorf("failed to create nodeclass %s: %w", name, err)
+	}
+	pool.TempNodeClass = name
+
+	manifest, taints, err := p.nodePool(ctx, source, name, ch.NodeClass)
+	if err != nil {
+		return pool, err
+	}
+	if err := p.apply(ctx, manifest); err != nil {
+		return pool, fmt.Errorf("failed to create nodepool %s: %w", name, err)
+	}
+	pool.NodePool = name
+	pool.manifest = manifest
+
+	for i := range max(p.Nodes, 1) {
+		podName := fmt.Sprintf("%s-%d", name, i)
+		if err := p.apply(ctx, p.pod(podName, name, ch.NodeClass, taints)); err != nil {
+			return pool, fmt.Errorf("failed to create pod %s: %w", podName, err)
+		}
+		pool.Pods = append(pool.Pods, podName)
+	}
+	return pool, nil
+}
+
+// nodePool returns the manifest of a temporary NodePool called name with the spec of the NodePool source,
+// launching nodes of the nodeclass of the same name. It also returns the taints of its nodes.
+func (p *Prewarmer) nodePool(ctx context.Context, source, name, nodeClass string) (map[string]interface{}, []interface{}, error) {
+	output, err := p.Kube.Get(ctx, "nodepools.karpenter.sh", source)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get nodepool %s: %w", source, err)
+	}
+	var original struct {
+		APIVersion string                 `json:"apiVersion"`
+		Kind       string                 `json:"kind"`
+		Spec       map[string]interface{} `json:"spec"`
+	}
+	if err := json.Unmarshal(output, &original); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse nodepool JSON: %w", err)
+	}
+	spec := original.Spec
+	template, _ := spec["template"].(map[string]interface{})
+	templateSpec, _ := template["spec"].(map[string]interface{})
+	nodeClassRef, _ := templateSpec["nodeClassRef"].(map[string]interface{})
+	if nodeClassRef == nil {
+		return nil, nil, fmt.Errorf("%w: nodepool %s has no spec.template.spec.nodeClassRef", clients.ErrUnexpectedSchema, source)
+	}
+	nodeClassRef["name"] = name
+
+	// The nodes must outlive their pull pods, and the pool must not grow past them (see Session.Wait)
+	delete(spec, "limits")
+	spec["disruption"] = map[string]interface{}{"consolidationPolicy": "WhenEmpty", "consolidateAfter": "Never"}
+
+	taints, _ := templateSpec["taints"].([]interface{})
+	return map[string]interface{}{
+		"apiVersion": original.APIVersion,
+		"kind":       original.Kind,
+		"metadata":   map[string]interface{}{"name": name, "labels": map[string]interface{}{Label: nodeClass}},
+		"spec":       spec,
+	}, taints, nil
+}
+
+// pod returns the manifest of a pull pod scheduled onto its own node of the NodePool, pulling every image
+func (p *Prewarmer) pod(name, nodePool, nodeClass string, taints []interface{}) map[string]interface{} {
+	var tolerations []interface{}
+	for _, t := range taints {
+		if taint, ok := t.(map[string]interface{}); ok {
+			tolerations = append(tolerations, map[string]interface{}{"key": taint["key"], "operator": "Exists"})
+		}
+	}
+
+	containers := []interface{}{map[string]interface{}{"name": "pause", "image": pauseImage}}
+	if len(p.Images) > 0 {
+		// The pull is what matters: the containers exit right away, or fail to if the image has no shell
+		containers = nil
+		for i, image := range p.Images {
+			containers = append(containers, map[string]interface{}{
+				"name":    fmt.Sprintf("image-%d", i),
+				"image":   image,
+				"command": []string{"sh", "-c", "true"},
+			})
+		}
+	}
+
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   map[string]interface{}{"name": name, "labels": map[string]interface{}{Label: nodeClass}},
+		"spec": map[string]interface{}{
+			"restartPolicy": "Never",
+			"nodeSelector":  map[string]interface{}{"karpenter.sh/nodepool": nodePool},
+			"tolerations":   tolerations,
+			"affinity": map[string]interface{}{
+				"podAntiAffinity": map[string]interface{}{
+					"requiredDuringSchedulingIgnoredDuringExecution": []interface{}{map[string]interface{}{
+						"labelSelector": map[string]interface{}{"matchLabels": map[string]interface{}{Label: nodeClass}},
+						"topologyKey":   "kubernetes.io/hostname",
+					}},
+				},
+			},
+			"containers": containers,
+		},
+	}
+}
+
+// apply creates or updates the object of manifest
+func (p *Prewarmer) apply(ctx context.Context, manifest map[string]interface{}) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	return p.Kube.Apply(ctx, data)
+}
+
+// pod is the part of a pull pod's status Wait looks at
+type pod struct {
+	Status struct {
+		Phase             string `json:"phase"`
+		ContainerStatuses []struct {
+			ImageID string `json:"imageID"`
+		} `json:"containerStatuses"`
+	} `json:"status"`
+}
+
+// pulled reports whether every container of the pod has its image on the node
+func (p pod) pulled() bool {
+	if len(p.Status.ContainerStatuses) == 0 {
+		return false
+	}
+	for _, c := range p.Status.ContainerStatuses {
+		if c.ImageID == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Wait polls the pull pods until every one has pulled its images, returning ErrTimeout after timeout.
+// Either way it then caps the temporary NodePools, so they launch no further nodes during the rollout.
+// progress, if not nil, is called with the number of pods done after each poll.
+func (s *Session) Wait(ctx context.Context, timeout time.Duration, progress func(done, total int)) error {
+	err := s.poll(ctx, timeout, progress)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return errors.Join(err, s.capPools(ctx))
+}
+
+// poll checks the pull pods until all are done, timeout passes or ctx is cancelled
+func (s *Session) poll(ctx context.Context, timeout time.Duration, progress func(done, total int)) error {
+	clk := clock.OrReal(s.p.Clock)
+	deadline := clk.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := clk.NewTicker(max(s.p.PollInterval, time.Second))
+	defer ticker.Stop()
+
+	for {
+		done, total, err := s.count(ctx)
+		if err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(done, total)
+		}
+		if done == total {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C():
+			return fmt.Errorf("%w: %d of %d nodes ready after %s", ErrTimeout, done, total, timeout)
+		case <-ticker.C():
+		}
+	}
+}
+
+// count returns how many pull pods have pulled their images
+func (s *Session) count(ctx context.Context) (done, total int, err error) {
+	for _, pool := range s.Pools {
+		for _, name := range pool.Pods {
+			total++
+			output, err := s.p.Kube.Get(ctx, "pod", name)
+			if err != nil {
+				return 0, 0, fmt.Errorf("failed to get pod %s: %w", name, err)
+			}
+			var status pod
+			if err := json.Unmarshal(output, &status); err != nil {
+				return 0, 0, fmt.Errorf("failed to parse pod JSON: %w", err)
+			}
+			if status.pulled() {
+				done++
+			}
+		}
+	}
+	return done, total, nil
+}
+
+// capPools sets zero CPU limits on the temporary NodePools. Limits only stop new launches, so the
+// pre-warmed nodes stay.
+func (s *Session) capPools(ctx context.Context) error {
+	var errs []error
+	for _, pool := range s.Pools {
+		if pool.manifest == nil {
+			continue
+		}
+		pool.manifest["spec"].(map[string]interface{})["limits"] = map[string]interface{}{"cpu": "0"}
+		if err := s.p.apply(ctx, pool.manifest); err != nil {
+			errs = append(errs, fmt.Errorf("failed to cap nodepool %s: %w", pool.NodePool, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Cleanup deletes the pull pods, temporary NodePools and nodeclasses. Karpenter drains and terminates the
+// pre-warmed nodes once their NodePool is gone. Cleanup can be called more than once.
+func (s *Session) Cleanup(ctx context.Context) error {
+	var errs []error
+	for _, pool := range s.Pools {
+		for _, name := range pool.Pods {
+			if err := s.deleter.Delete(ctx, "pod", name); err != nil {
+				errs = append(errs, fmt.Errorf("failed to delete pod %s: %w", name, err))
+			}
+		}
+		if pool.NodePool != "" {
+			if err := s.deleter.Delete(ctx, "nodepools.karpenter.sh", pool.NodePool); err != nil {
+				errs = append(errs, fmt.Errorf("failed to delete nodepool %s: %w", pool.NodePool, err))
+			}
+		}
+		if pool.TempNodeClass != "" {
+			if err := s.deleter.Delete(ctx, "ec2nodeclass", pool.TempNodeClass); err != nil {
+				errs = append(errs, fmt.Errorf("failed to delete nodeclass %s: %w", pool.TempNodeClass, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
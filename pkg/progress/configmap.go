@@ -0,0 +1,148 @@
+package progress
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/report"
+)
+
+// DefaultConfigMapName is the name of the ConfigMap a run is published to unless another is given
+const DefaultConfigMapName = "upgrade-ami-status"
+
+// DefaultPublishInterval is how often a changed status is written to the ConfigMap
+const DefaultPublishInterval = 15 * time.Second
+
+// ConfigMap publishes the status and plans of a run to a ConfigMap, so teammates with only kubectl access
+// can see that an upgrade is in progress, who started it and how far along it is
+type ConfigMap struct {
+	Kube      clients.KubeClient
+	Namespace string
+	Name      string
+}
+
+// ParseConfigMap parses a ConfigMap reference, NAMESPACE or NAMESPACE/NAME, defaulting the name to
+// DefaultConfigMapName
+func ParseConfigMap(ref string) (namespace, name string, err error) {
+	namespace, name, _ = strings.Cut(ref, "/")
+	if name == "" {
+		name = DefaultConfigMapName
+	}
+	if namespace == "" || strings.Contains(name, "/") {
+		return "", "", fmt.Errorf("invalid ConfigMap %q: want NAMESPACE or NAMESPACE/NAME", ref)
+	}
+	return namespace, name, nil
+}
+
+// Manifest renders the ConfigMap for the status and plans. Besides the full status and plans as JSON, it
+// has a key per headline so `kubectl get configmap -o yaml` reads at a glance.
+func (c ConfigMap) Manifest(s Status, plans []*plan.Plan) ([]byte, error) {
+	status, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode run status: %w", err)
+	}
+	docs := make([]json.RawMessage, 0, len(plans))
+	for _, p := range plans {
+		data, err := plan.Marshal(p)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, data)
+	}
+	planData, err := json.MarshalIndent(docs, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode plans: %w", err)
+	}
+
+	cm := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      c.Name,
+			"namespace": c.Namespace,
+			"labels":    map[string]string{"app.kubernetes.io/managed-by": "upgrade-ami"},
+		},
+		"data": map[string]string{
+			"phase":       s.Phase,
+			"operator":    s.Operator,
+			"startedAt":   s.StartedAt.UTC().Format(time.RFC3339),
+			"updatedAt":   s.UpdatedAt.UTC().Format(time.RFC3339),
+			"progress":    summary(s),
+			"status.json": string(status),
+			"plans.json":  string(planData),
+		},
+	}
+	data, err := json.Marshal(cm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode ConfigMap: %w", err)
+	}
+	return data, nil
+}
+
+// Publish writes the tracker's status and plans to the ConfigMap
+func (c ConfigMap) Publish(ctx context.Context, t *Tracker) error {
+	data, err := c.Manifest(t.Status(), t.Plans())
+	if err != nil {
+		return err
+	}
+	if err := c.Kube.Apply(ctx, data); err != nil {
+		return fmt.Errorf("failed to publish run status to ConfigMap %s/%s: %w", c.Namespace, c.Name, err)
+	}
+	return nil
+}
+
+// Run publishes the tracker every interval while its status changes, until ctx is cancelled. Failures are
+// passed to onErr and retried at the next interval.
+func (c ConfigMap) Run(ctx context.Context, t *Tracker, interval time.Duration, onErr func(error)) {
+	ticker := clock.OrReal(t.Clock).NewTicker(interval)
+	defer ticker.Stop()
+	var published time.Time
+	for {
+		if updated := t.Status().UpdatedAt; !updated.Equal(published) {
+			if err := c.Publish(ctx, t); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				onErr(err)
+			} else {
+				published = updated
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+	}
+}
+
+// summary describes how far along the run is, as in "2/5 nodeclasses updated, 4/20 nodeclaims drifted"
+func summary(s Status) string {
+	var planned, updated, failed int
+	for _, nc := range s.NodeClasses {
+		switch nc.Status {
+		case StatusPlanned, report.StatusNotApplied:
+			planned++
+		case report.StatusUpdated:
+			planned++
+			updated++
+		case report.StatusFailed:
+			planned++
+			failed++
+		}
+	}
+	line := fmt.Sprintf("%d/%d nodeclasses updated", updated, planned)
+	if failed > 0 {
+		line += fmt.Sprintf(", %d failed", failed)
+	}
+	if s.NodeClaims.Total > 0 {
+		line += fmt.Sprintf(", %d/%d nodeclaims drifted", s.NodeClaims.Drifted, s.NodeClaims.Total)
+	}
+	return line
+}
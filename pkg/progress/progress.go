@@ -0,0 +1,228 @@
+// Package progress keeps the state of the run in progress and serves it as JSON over HTTP, so dashboards
+// and colleagues can follow a rollout without attaching to the terminal running it
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/report"
+)
+
+// Phases of a run
+const (
+	PhasePlanning   = "planning"
+	PhaseConfirming = "confirming" // waiting for the go-ahead to apply
+	PhaseValidating = "validating" // trying the version on the validation cluster first
+	PhaseApplying   = "applying"
+	PhaseMonitoring = "monitoring" // waiting for the drifted nodeclaims to be replaced
+	PhaseDone       = "done"
+	PhaseStopped    = "stopped" // the tool exited before the run was done, e.g. when cancelled
+)
+
+// Nodeclass statuses besides the report's updated and failed
+const (
+	StatusPlanned = "planned"
+	StatusSkipped = "skipped"
+)
+
+// Status is the state of the run, as served on /status
+type Status struct {
+	Phase       string      `json:"phase"`
+	Cluster     string      `json:"cluster,omitempty"`
+	Operator    string      `json:"operator,omitempty"`
+	StartedAt   time.Time   `json:"startedAt"`
+	UpdatedAt   time.Time   `json:"updatedAt"`
+	NodeClasses []NodeClass `json:"nodeClasses"`
+	NodeClaims  Counts      `json:"nodeClaims"` // as of the last monitor poll
+}
+
+// NodeClass is the progress of one nodeclass
+type NodeClass struct {
+	Name       string `json:"name"`
+	OldAMI     string `json:"oldAMI,omitempty"`
+	NewAMI     string `json:"newAMI,omitempty"`
+	Status     string `json:"status,omitempty"` // planned, skipped, updated or failed; empty when the nodeclass isn't part of a plan
+	Reason     string `json:"reason,omitempty"` // why it was skipped or failed
+	NodeClaims int    `json:"nodeClaims"`
+	Drifted    int    `json:"drifted"`
+}
+
+// Counts are the nodeclaims of a monitor poll by state
+type Counts struct {
+	Total    int `json:"total"`
+	Drifted  int `json:"drifted"`
+	Ready    int `json:"ready"`
+	Replaced int `json:"replaced"`
+	Blocked  int `json:"blocked"`
+}
+
+// Tracker records the progress of a run. It is safe for concurrent use.
+type Tracker struct {
+	Clock clock.Clock
+
+	mu     sync.Mutex
+	status Status
+	byName map[string]int // index of each nodeclass in status.NodeClasses
+	plans  []*plan.Plan
+}
+
+// New creates a Tracker for a run starting now, in the planning phase
+func New(clk clock.Clock) *Tracker {
+	now := clock.OrReal(clk).Now()
+	return &Tracker{
+		Clock:  clk,
+		status: Status{Phase: PhasePlanning, StartedAt: now, UpdatedAt: now, NodeClasses: []NodeClass{}},
+		byName: make(map[string]int),
+	}
+}
+
+// update applies f to the status under the lock and stamps the time
+func (t *Tracker) update(f func(s *Status)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f(&t.status)
+	t.status.UpdatedAt = clock.OrReal(t.Clock).Now()
+}
+
+// nodeClass returns the entry of the nodeclass, adding it if needed. The lock must be held.
+func (t *Tracker) nodeClass(name string) *NodeClass {
+	i, ok := t.byName[name]
+	if !ok {
+		i = len(t.status.NodeClasses)
+		t.byName[name] = i
+		t.status.NodeClasses = append(t.status.NodeClasses, NodeClass{Name: name})
+	}
+	return &t.status.NodeClasses[i]
+}
+
+// SetPhase moves the run to phase
+func (t *Tracker) SetPhase(phase string) {
+	t.update(func(s *Status) { s.Phase = phase })
+}
+
+// SetRun records the cluster and the operator of the run
+func (t *Tracker) SetRun(cluster, operator string) {
+	t.update(func(s *Status) {
+		if cluster != "" {
+			s.Cluster = cluster
+		}
+		if operator != "" {
+			s.Operator = operator
+		}
+	})
+}
+
+// Planned records the changes and skipped nodeclasses of the plans
+func (t *Tracker) Planned(plans []*plan.Plan) {
+	t.update(func(*Status) {
+		t.plans = append(t.plans, plans...)
+		for _, p := range plans {
+			for _, ch := range p.Changes {
+				nc := t.nodeClass(ch.NodeClass)
+				nc.OldAMI, nc.NewAMI, nc.Status = ch.OldAMI, ch.NewAMI, StatusPlanned
+			}
+			for _, sk := range p.Skipped {
+				nc := t.nodeClass(sk.NodeClass)
+				nc.Status, nc.Reason = StatusSkipped, sk.Reason
+			}
+		}
+	})
+}
+
+// Updated records that the nodeclass was moved to its new AMI
+func (t *Tracker) Updated(nodeClass string) {
+	t.update(func(*Status) { t.nodeClass(nodeClass).Status = report.StatusUpdated })
+}
+
+// Applied records the outcome of each change once the plans were applied
+func (t *Tracker) Applied(items []report.Item) {
+	t.update(func(*Status) {
+		for _, item := range items {
+			nc := t.nodeClass(item.NodeClass)
+			nc.Status, nc.Reason = item.Status, item.Error
+		}
+	})
+}
+
+// Polled records the nodeclaims of a monitor poll, of which replaced were replaced since monitoring started
+func (t *Tracker) Polled(statuses []nodeclasses.NodeClaimStatus, replaced int) {
+	t.update(func(s *Status) {
+		counts := Counts{Total: len(statuses), Replaced: replaced}
+		for i := range s.NodeClasses {
+			s.NodeClasses[i].NodeClaims, s.NodeClasses[i].Drifted = 0, 0
+		}
+		for _, st := range statuses {
+			if st.Drifted {
+				counts.Drifted++
+			}
+			if st.Conditions["Ready"] {
+				counts.Ready++
+			}
+			if st.BlockedBy != "" {
+				counts.Blocked++
+			}
+			if st.NodeClass == "" {
+				continue
+			}
+			nc := t.nodeClass(st.NodeClass)
+			nc.NodeClaims++
+			if st.Drifted {
+				nc.Drifted++
+			}
+		}
+		s.NodeClaims = counts
+	})
+}
+
+// Plans returns the plans of the run
+func (t *Tracker) Plans() []*plan.Plan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*plan.Plan(nil), t.plans...)
+}
+
+// Status returns a copy of the current status, with the nodeclasses sorted by name
+func (t *Tracker) Status() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.status
+	s.NodeClasses = append([]NodeClass{}, t.status.NodeClasses...)
+	sort.Slice(s.NodeClasses, func(i, j int) bool { return s.NodeClasses[i].Name < s.NodeClasses[j].Name })
+	return s
+}
+
+// ServeHTTP writes the status as JSON
+func (t *Tracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(t.Status())
+}
+
+// Serve listens on addr, e.g. localhost:8089, and serves the tracker's status on /status until the
+// returned server is closed
+func Serve(addr string, t *Tracker) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serve run status: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/status", t)
+	srv := &http.Server{Addr: ln.Addr().String(), Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(ln)
+	return srv, nil
+}
@@ -0,0 +1,139 @@
+// Package provenance verifies that AMIs come from a trusted build before they can be selected: either
+// EC2 Image Builder built them from one of our pipelines, or they carry an attestation signed by our key
+package provenance
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/amis"
+)
+
+// Image tags the verification relies on
+const (
+	// TagImageBuilderARN is set by EC2 Image Builder on every image it creates
+	TagImageBuilderARN = "Ec2ImageBuilderArn"
+	// DefaultPipelineTag is the tag our pipelines set to the ARN of the pipeline that built the image
+	DefaultPipelineTag = "SourcePipelineArn"
+	// DefaultAttestationTag holds a base64 ed25519 signature of the image's attestation message
+	DefaultAttestationTag = "upgrade-ami/attestation"
+)
+
+// ErrUnverified is returned when the provenance of an AMI cannot be established
+var ErrUnverified = errors.New("AMI provenance not verified")
+
+// Method is how an AMI's provenance was established
+type Method string
+
+// Verification methods
+const (
+	MethodPipeline    Method = "pipeline"
+	MethodAttestation Method = "attestation"
+)
+
+// Result is the outcome of verifying an AMI or version
+type Result struct {
+	Verified bool
+	Method   Method // set when Verified
+	Reason   string // why verification failed, when not Verified
+}
+
+// Err returns nil for a verified result and an ErrUnverified error otherwise
+func (r Result) Err() error {
+	if r.Verified {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrUnverified, r.Reason)
+}
+
+// Policy defines which AMIs are trusted
+type Policy struct {
+	PipelineARNs   []string          // Image Builder pipelines whose images are trusted
+	PipelineTag    string            // tag naming the source pipeline, DefaultPipelineTag when empty
+	AttestationTag string            // tag holding the attestation, DefaultAttestationTag when empty
+	PublicKey      ed25519.PublicKey // verifies attestations; attestations are not accepted when nil
+}
+
+// New creates a Policy trusting images from pipelineARNs or attested with publicKey, a base64 ed25519
+// public key ("" to accept pipeline provenance only)
+func New(pipelineARNs []string, publicKey string) (*Policy, error) {
+	p := &Policy{PipelineARNs: pipelineARNs}
+	if publicKey != "" {
+		key, err := base64.StdEncoding.DecodeString(publicKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid attestation public key: must be a base64 ed25519 public key")
+		}
+		p.PublicKey = key
+	}
+	if len(p.PipelineARNs) == 0 && p.PublicKey == nil {
+		return nil, fmt.Errorf("provenance policy needs pipeline ARNs or an attestation public key")
+	}
+	return p, nil
+}
+
+// AttestationMessage is the message an attestation signs for an image
+func AttestationMessage(imageID, name string) []byte {
+	return []byte("upgrade-ami/attestation/v1\n" + imageID + "\n" + name + "\n")
+}
+
+// Verify establishes the provenance of a single AMI
+func (p *Policy) Verify(ami amis.AMIInfo) Result {
+	if p.PublicKey != nil {
+		if value, ok := ami.Tags[p.attestationTag()]; ok {
+			sig, err := base64.StdEncoding.DecodeString(value)
+			if err != nil || !ed25519.Verify(p.PublicKey, AttestationMessage(ami.ImageID, ami.Name), sig) {
+				return Result{Reason: fmt.Sprintf("%s (%s) has an invalid attestation", ami.Name, ami.ImageID)}
+			}
+			return Result{Verified: true, Method: MethodAttestation}
+		}
+	}
+
+	if _, ok := ami.Tags[TagImageBuilderARN]; !ok {
+		return Result{Reason: fmt.Sprintf("%s (%s) was not built by EC2 Image Builder and has no attestation", ami.Name, ami.ImageID)}
+	}
+	pipeline := ami.Tags[p.pipelineTag()]
+	if pipeline == "" {
+		return Result{Reason: fmt.Sprintf("%s (%s) has no %s tag", ami.Name, ami.ImageID, p.pipelineTag())}
+	}
+	if !slices.Contains(p.PipelineARNs, pipeline) {
+		return Result{Reason: fmt.Sprintf("%s (%s) was built by untrusted pipeline %s", ami.Name, ami.ImageID, pipeline)}
+	}
+	return Result{Verified: true, Method: MethodPipeline}
+}
+
+// VerifyVersion establishes the provenance of every AMI of a version; the version is verified only
+// if all of them are
+func (p *Policy) VerifyVersion(v amis.VersionItem) Result {
+	if len(v.Images) == 0 {
+		return Result{Reason: fmt.Sprintf("no AMIs found for version %s", v.Version)}
+	}
+
+	var result Result
+	for _, ami := range v.Images {
+		r := p.Verify(ami)
+		if !r.Verified {
+			return r
+		}
+		if result.Method == "" {
+			result = r
+		}
+	}
+	return result
+}
+
+func (p *Policy) pipelineTag() string {
+	if p.PipelineTag != "" {
+		return p.PipelineTag
+	}
+	return DefaultPipelineTag
+}
+
+func (p *Policy) attestationTag() string {
+	if p.AttestationTag != "" {
+		return p.AttestationTag
+	}
+	return DefaultAttestationTag
+}
@@ -0,0 +1,211 @@
+// Package prune finds the AMIs of the naming scheme that no cluster uses any more and removes them together
+// with their snapshots. The newest versions of each Kubernetes version and variant are always kept.
+package prune
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/amis"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/naming"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/retry"
+)
+
+// DefaultKeep is how many of the newest versions of each Kubernetes version and variant are kept
+const DefaultKeep = 5
+
+// Reasons an AMI is kept or pruned
+const (
+	ReasonNewest     = "newest"     // among the newest versions of its Kubernetes version and variant
+	ReasonReferenced = "referenced" // selected by a nodeclass or run by a node of a cluster
+	ReasonUnused     = "unused"     // old and referenced by no cluster
+)
+
+// References are the AMIs the clusters use
+type References struct {
+	IDs      map[string]bool // image IDs nodeclasses resolved or nodeclaims run
+	Names    map[string]bool // AMI names nodeclasses select
+	Owners   map[string]bool // AMI owners nodeclasses select from
+	Clusters []string        // contexts of the clusters collected
+}
+
+// NewReferences creates empty references
+func NewReferences() *References {
+	return &References{IDs: make(map[string]bool), Names: make(map[string]bool), Owners: make(map[string]bool)}
+}
+
+// Collect adds the AMIs the cluster behind kube uses: the AMIs its nodeclasses select and resolved, and
+// the images its nodeclaims run
+func (r *References) Collect(ctx context.Context, kube clients.KubeClient) error {
+	cluster, err := nodeclasses.CurrentContext(ctx, kube)
+	if err != nil {
+		return err
+	}
+	list, err := nodeclasses.GetEC2NodeClasses(ctx, kube)
+	if err != nil {
+		return fmt.Errorf("%s: %w", cluster, err)
+	}
+	for _, nc := range list.Items {
+		for _, term := range nc.Spec.AMISelectorTerms {
+			r.Names[term.Name] = true
+			if term.Owner != "" {
+				r.Owners[term.Owner] = true
+			}
+		}
+		for _, ami := range nc.Status.AMIs {
+			r.IDs[ami.ID] = true
+		}
+	}
+	err = nodeclasses.EachNodeClaim(ctx, kube, func(claim nodeclasses.NodeClaim) error {
+		if claim.Status.ImageID != "" {
+			r.IDs[claim.Status.ImageID] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", cluster, err)
+	}
+	r.Clusters = append(r.Clusters, cluster)
+	return nil
+}
+
+// uses reports whether any cluster references the AMI
+func (r *References) uses(ami amis.AMIInfo) bool {
+	return r.IDs[ami.ImageID] || r.Names[ami.Name]
+}
+
+// Decision is whether an AMI is kept or pruned, and why
+type Decision struct {
+	AMI        amis.AMIInfo
+	K8sVersion string
+	Variant    string
+	Version    string
+	Reason     string
+}
+
+// Selection is the outcome of Select
+type Selection struct {
+	Kept   []Decision
+	Pruned []Decision
+}
+
+// Snapshots returns the snapshots of the pruned AMIs that no kept AMI uses, sorted
+func (s *Selection) Snapshots() []string {
+	kept := make(map[string]bool)
+	for _, d := range s.Kept {
+		for _, id := range d.AMI.Snapshots {
+			kept[id] = true
+		}
+	}
+	seen := make(map[string]bool)
+	var snapshots []string
+	for _, d := range s.Pruned {
+		for _, id := range d.AMI.Snapshots {
+			if !kept[id] && !seen[id] {
+				seen[id] = true
+				snapshots = append(snapshots, id)
+			}
+		}
+	}
+	sort.Strings(snapshots)
+	return snapshots
+}
+
+// Select decides which AMIs named according to the scheme can be pruned: those of versions older than
+// the newest keep of their Kubernetes version and variant that no cluster references. AMIs the scheme
+// cannot parse, or without a version, are left out entirely.
+func Select(scheme naming.Provider, images []amis.AMIInfo, refs *References, keep int) (*Selection, error) {
+	if keep < 1 {
+		return nil, fmt.Errorf("at least the newest version must be kept (got %d)", keep)
+	}
+
+	type series struct{ k8sVersion, variant string }
+	var decisions []Decision
+	versions := make(map[series][]string) // distinct versions of each series
+	for _, ami := range images {
+		fields, ok := scheme.Parse(ami.Name)
+		if !ok || fields.Version == "" {
+			continue
+		}
+		decisions = append(decisions, Decision{AMI: ami, K8sVersion: fields.K8sVersion, Variant: fields.Variant, Version: fields.Version})
+		s := series{fields.K8sVersion, fields.Variant}
+		if !slices.Contains(versions[s], fields.Version) {
+			versions[s] = append(versions[s], fields.Version)
+		}
+	}
+
+	newest := make(map[series]map[string]bool)
+	for s, vs := range versions {
+		sort.Slice(vs, func(i, j int) bool {
+			return amis.CompareVersions(vs[i], vs[j]) > 0
+		})
+		newest[s] = make(map[string]bool)
+		for _, v := range vs[:min(keep, len(vs))] {
+			newest[s][v] = true
+		}
+	}
+
+	selection := &Selection{}
+	for _, d := range decisions {
+		switch {
+		case newest[series{d.K8sVersion, d.Variant}][d.Version]:
+			d.Reason = ReasonNewest
+			selection.Kept = append(selection.Kept, d)
+		case refs.uses(d.AMI):
+			d.Reason = ReasonReferenced
+			selection.Kept = append(selection.Kept, d)
+		default:
+			d.Reason = ReasonUnused
+			selection.Pruned = append(selection.Pruned, d)
+		}
+	}
+	sort.Slice(selection.Pruned, func(i, j int) bool {
+		return selection.Pruned[i].AMI.Name < selection.Pruned[j].AMI.Name
+	})
+	sort.Slice(selection.Kept, func(i, j int) bool {
+		return selection.Kept[i].AMI.Name < selection.Kept[j].AMI.Name
+	})
+	return selection, nil
+}
+
+// Remove deregisters the pruned AMIs, then deletes the snapshots no kept AMI uses. The snapshots of an
+// AMI that fails to deregister are kept. Every AMI is attempted until ctx is cancelled; the failures are joined.
+func Remove(ctx context.Context, remover clients.ImageRemover, selection *Selection) error {
+	var errs []error
+	failed := make(map[string]bool) // snapshots of AMIs that are still registered
+	for _, d := range selection.Pruned {
+		if ctx.Err() != nil {
+			return errors.Join(append(errs, ctx.Err())...)
+		}
+		err := retry.Do(ctx, retry.Default, func(ctx context.Context) error {
+			return remover.DeregisterImage(ctx, d.AMI.ImageID)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to deregister %s (%s): %w", d.AMI.ImageID, d.AMI.Name, err))
+			for _, id := range d.AMI.Snapshots {
+				failed[id] = true
+			}
+		}
+	}
+
+	for _, id := range selection.Snapshots() {
+		if failed[id] {
+			continue
+		}
+		if ctx.Err() != nil {
+			return errors.Join(append(errs, ctx.Err())...)
+		}
+		err := retry.Do(ctx, retry.Default, func(ctx context.Context) error {
+			return remover.DeleteSnapshot(ctx, id)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete snapshot %s: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,58 @@
+// Package release resolves the AMI version a platform release was qualified with from the release
+// manifest the release pipeline publishes
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/remote"
+)
+
+// ErrNotInManifest is returned when the manifest has no AMI version for a release and Kubernetes version
+var ErrNotInManifest = errors.New("not in the release manifest")
+
+// Manifest maps product releases to the AMI version blessed for each Kubernetes minor version, e.g.
+//
+//	{"releases": {"6.2.1": {"1.32": "20251001", "1.33": "20251001"}}}
+type Manifest struct {
+	Releases map[string]map[string]string `json:"releases"` // release -> Kubernetes version -> AMI version
+}
+
+// Parse decodes a manifest document
+func Parse(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse release manifest: %w", err)
+	}
+	if len(m.Releases) == 0 {
+		return nil, fmt.Errorf("failed to parse release manifest: no releases")
+	}
+	return &m, nil
+}
+
+// Load fetches and decodes the manifest at source (see remote.Fetch)
+func Load(ctx context.Context, reader clients.ObjectReader, source string) (*Manifest, error) {
+	data, err := remote.Fetch(ctx, reader, source)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// AMIVersion returns the AMI version of the release for the Kubernetes version, without a "v" prefix
+func (m *Manifest) AMIVersion(release, k8sVersion string) (string, error) {
+	versions, ok := m.Releases[strings.TrimPrefix(release, "v")]
+	if !ok {
+		return "", fmt.Errorf("release %s: %w", release, ErrNotInManifest)
+	}
+	version, ok := versions[k8sVersion]
+	if !ok || version == "" {
+		return "", fmt.Errorf("release %s for Kubernetes %s: %w", release, k8sVersion, ErrNotInManifest)
+	}
+	return strings.TrimPrefix(version, "v"), nil
+}
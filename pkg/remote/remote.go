@@ -0,0 +1,60 @@
+// Package remote reads the documents the tool is configured to fetch, e.g. release manifests, from S3,
+// HTTP(S) or the local filesystem
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+)
+
+// Fetch returns the document at source: an s3://bucket/key URL, read through reader, an http:// or
+// https:// URL, or a file path
+func Fetch(ctx context.Context, reader clients.ObjectReader, source string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(source, "s3://"):
+		if reader == nil {
+			return nil, fmt.Errorf("failed to read %s: the AWS client cannot read S3 objects", source)
+		}
+		data, err := reader.ReadObject(ctx, source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", source, err)
+		}
+		return data, nil
+	case strings.HasPrefix(source, "http://"), strings.HasPrefix(source, "https://"):
+		data, err := get(ctx, source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", source, err)
+		}
+		return data, nil
+	default:
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", source, err)
+		}
+		return data, nil
+	}
+}
+
+// get fetches url and returns the response body
+func get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,236 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Change is a figure of two reports
+type Change struct {
+	Old float64 `json:"old"`
+	New float64 `json:"new"`
+}
+
+// Delta is how much the figure grew from the old report to the new one
+func (c Change) Delta() float64 {
+	return c.New - c.Old
+}
+
+// FleetChange is how the nodeclaims of a nodeclass changed between two reports
+type FleetChange struct {
+	NodeClass  string `json:"nodeClass"`
+	NodeClaims Change `json:"nodeClaims"`
+	Images     Change `json:"images"` // distinct images its nodeclaims run
+}
+
+// Diff summarizes how two runs differ, e.g. the same cluster's upgrades a quarter apart
+type Diff struct {
+	OldRunID           string        `json:"oldRunID,omitempty"`
+	NewRunID           string        `json:"newRunID,omitempty"`
+	OldVersion         string        `json:"oldVersion"`
+	NewVersion         string        `json:"newVersion"`
+	DurationSeconds    *Change       `json:"durationSeconds,omitempty"` // nil when a report has no start or finish
+	Replacements       Change        `json:"replacements"`
+	P50Seconds         Change        `json:"p50Seconds"`
+	P95Seconds         Change        `json:"p95Seconds"`
+	MaxSeconds         Change        `json:"maxSeconds"`
+	Disruptions        Change        `json:"disruptions"`
+	Consolidations     Change        `json:"consolidations"`
+	Failures           Change        `json:"failures"`
+	NewlyFailing       []string      `json:"newlyFailing"`              // nodeclasses failing only in the new report
+	NoLongerFailing    []string      `json:"noLongerFailing"`           // nodeclasses failing only in the old report
+	AddedNodeClasses   []string      `json:"addedNodeClasses"`          // nodeclasses changed only by the new run
+	RemovedNodeClasses []string      `json:"removedNodeClasses"`        // nodeclasses changed only by the old run
+	FleetNodeClaims    *Change       `json:"fleetNodeClaims,omitempty"` // nil when a report has no fleet
+	Fleet              []FleetChange `json:"fleet"`
+}
+
+// Compare returns how the run of r differs from the run of old
+func Compare(old, r *Report) *Diff {
+	d := &Diff{
+		OldRunID:           old.RunID,
+		NewRunID:           r.RunID,
+		OldVersion:         versionOf(old),
+		NewVersion:         versionOf(r),
+		Replacements:       Change{float64(old.Replacements.Count), float64(r.Replacements.Count)},
+		P50Seconds:         Change{old.Replacements.P50Seconds, r.Replacements.P50Seconds},
+		P95Seconds:         Change{old.Replacements.P95Seconds, r.Replacements.P95Seconds},
+		MaxSeconds:         Change{old.Replacements.MaxSeconds, r.Replacements.MaxSeconds},
+		Disruptions:        Change{float64(old.Disruptions), float64(r.Disruptions)},
+		Consolidations:     Change{float64(old.Consolidations), float64(r.Consolidations)},
+		NewlyFailing:       []string{},
+		NoLongerFailing:    []string{},
+		AddedNodeClasses:   []string{},
+		RemovedNodeClasses: []string{},
+		Fleet:              []FleetChange{},
+	}
+	if oldDuration, newDuration := duration(old), duration(r); oldDuration > 0 && newDuration > 0 {
+		d.DurationSeconds = &Change{oldDuration.Seconds(), newDuration.Seconds()}
+	}
+
+	oldFailed, oldItems := itemSets(old)
+	newFailed, newItems := itemSets(r)
+	d.Failures = Change{float64(len(oldFailed)), float64(len(newFailed))}
+	d.NewlyFailing = missingFrom(newFailed, oldFailed)
+	d.NoLongerFailing = missingFrom(oldFailed, newFailed)
+	d.AddedNodeClasses = missingFrom(newItems, oldItems)
+	d.RemovedNodeClasses = missingFrom(oldItems, newItems)
+
+	if len(old.Fleet) > 0 && len(r.Fleet) > 0 {
+		d.FleetNodeClaims = &Change{float64(fleetSize(old.Fleet)), float64(fleetSize(r.Fleet))}
+		oldGroups, newGroups := fleetByNodeClass(old.Fleet), fleetByNodeClass(r.Fleet)
+		var names []string
+		for name := range oldGroups {
+			names = append(names, name)
+		}
+		for name := range newGroups {
+			if _, ok := oldGroups[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			o, n := oldGroups[name], newGroups[name]
+			d.Fleet = append(d.Fleet, FleetChange{
+				NodeClass:  name,
+				NodeClaims: Change{float64(fleetSize(o)), float64(fleetSize(n))},
+				Images:     Change{float64(len(o)), float64(len(n))},
+			})
+		}
+	}
+	return d
+}
+
+// versionOf is the version a report applied, or the versions of a mixed cluster
+func versionOf(r *Report) string {
+	if len(r.Versions) > 0 {
+		return strings.Join(r.Versions, ", v")
+	}
+	return r.Version
+}
+
+// duration is how long the run of r took, or zero if unknown
+func duration(r *Report) time.Duration {
+	if r.StartedAt.IsZero() || r.FinishedAt.IsZero() {
+		return 0
+	}
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// itemSets returns the nodeclasses of r's items that failed, and all of them
+func itemSets(r *Report) (failed, all []string) {
+	for _, item := range r.Items {
+		all = append(all, item.NodeClass)
+		if item.Status == StatusFailed {
+			failed = append(failed, item.NodeClass)
+		}
+	}
+	return failed, all
+}
+
+// missingFrom returns the names of a that are not in b, sorted
+func missingFrom(a, b []string) []string {
+	missing := []string{}
+	for _, name := range a {
+		if !slices.Contains(b, name) && !slices.Contains(missing, name) {
+			missing = append(missing, name)
+		}
+	}
+	slices.Sort(missing)
+	return missing
+}
+
+// fleetSize is the number of nodeclaims of the groups
+func fleetSize(groups []FleetGroup) int {
+	n := 0
+	for _, g := range groups {
+		n += g.NodeClaims
+	}
+	return n
+}
+
+// fleetByNodeClass groups the fleet by nodeclass
+func fleetByNodeClass(fleet []FleetGroup) map[string][]FleetGroup {
+	groups := make(map[string][]FleetGroup)
+	for _, g := range fleet {
+		groups[g.NodeClass] = append(groups[g.NodeClass], g)
+	}
+	return groups
+}
+
+// WriteDiff renders the comparison of two reports
+func WriteDiff(w io.Writer, format Format, d *Diff) error {
+	if format == FormatJSON {
+		return writeJSON(w, d)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "📊 Report Diff (%s → %s)\n", runName(d.OldRunID), runName(d.NewRunID))
+	fmt.Fprintln(&b, strings.Repeat("=", 80))
+	fmt.Fprintf(&b, "Version:         v%s → v%s\n", d.OldVersion, d.NewVersion)
+	if d.DurationSeconds != nil {
+		fmt.Fprintf(&b, "Duration:        %s\n", durationChange(*d.DurationSeconds))
+	} else {
+		fmt.Fprintln(&b, "Duration:        unknown (a report has no start or finish)")
+	}
+	fmt.Fprintf(&b, "Nodes replaced:  %s\n", countChange(d.Replacements))
+	fmt.Fprintf(&b, "  p50:           %s\n", durationChange(d.P50Seconds))
+	fmt.Fprintf(&b, "  p95:           %s\n", durationChange(d.P95Seconds))
+	fmt.Fprintf(&b, "  max:           %s\n", durationChange(d.MaxSeconds))
+	fmt.Fprintf(&b, "Disruptions:     %s, %s from consolidation\n", countChange(d.Disruptions), countChange(d.Consolidations))
+	fmt.Fprintln(&b, strings.Repeat("-", 80))
+	fmt.Fprintf(&b, "Failures:        %s\n", countChange(d.Failures))
+	if len(d.NewlyFailing) > 0 {
+		fmt.Fprintf(&b, "  newly failing: %s\n", strings.Join(d.NewlyFailing, ", "))
+	}
+	if len(d.NoLongerFailing) > 0 {
+		fmt.Fprintf(&b, "  fixed:         %s\n", strings.Join(d.NoLongerFailing, ", "))
+	}
+	if len(d.AddedNodeClasses) > 0 || len(d.RemovedNodeClasses) > 0 {
+		fmt.Fprintf(&b, "NodeClasses:     %d added, %d removed\n", len(d.AddedNodeClasses), len(d.RemovedNodeClasses))
+		if len(d.AddedNodeClasses) > 0 {
+			fmt.Fprintf(&b, "  added:         %s\n", strings.Join(d.AddedNodeClasses, ", "))
+		}
+		if len(d.RemovedNodeClasses) > 0 {
+			fmt.Fprintf(&b, "  removed:       %s\n", strings.Join(d.RemovedNodeClasses, ", "))
+		}
+	}
+	fmt.Fprintln(&b, strings.Repeat("-", 80))
+	if d.FleetNodeClaims == nil {
+		fmt.Fprintln(&b, "Fleet:           unknown (a report has no fleet)")
+	} else {
+		fmt.Fprintf(&b, "Fleet:           %s nodeclaims\n", countChange(*d.FleetNodeClaims))
+		for _, f := range d.Fleet {
+			fmt.Fprintf(&b, "  %-14s %s nodeclaims, %s images\n", f.NodeClass, countChange(f.NodeClaims), countChange(f.Images))
+		}
+	}
+	fmt.Fprintln(&b, strings.Repeat("=", 80))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// runName names a run by its ID for display
+func runName(id string) string {
+	if id == "" {
+		return "unnamed run"
+	}
+	return id
+}
+
+// countChange formats a count's change, e.g. "120 → 131 (+11)"
+func countChange(c Change) string {
+	return fmt.Sprintf("%d → %d (%+d)", int(c.Old), int(c.New), int(c.Delta()))
+}
+
+// durationChange formats a change of seconds, e.g. "4m30s → 4m1s (-29s)"
+func durationChange(c Change) string {
+	sign := "+"
+	if c.Delta() < 0 {
+		sign = "-"
+	}
+	delta := seconds(c.Delta())
+	return fmt.Sprintf("%s → %s (%s%s)", seconds(c.Old), seconds(c.New), sign, strings.TrimPrefix(delta, "-"))
+}
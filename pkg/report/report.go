@@ -0,0 +1,370 @@
+// Package report renders upgrade plans and run reports as plain text or JSON. Rendering is
+// deterministic for a given input so the output can serve as change-record evidence.
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/buildinfo"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/history"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/upgrade"
+)
+
+// Format selects how plans and reports are rendered
+type Format string
+
+// Supported formats
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+)
+
+// ParseFormat validates a format name
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(name); f {
+	case FormatText, FormatJSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown output format %q (want text or json)", name)
+}
+
+// The apiVersion and kind identifying a JSON report. Fields are only ever added to this version, never
+// renamed or removed, so the reports of runs made with different tool versions can be compared.
+const (
+	APIVersion = "upgrade-ami.dominodatalab.com/v1"
+	Kind       = "Report"
+)
+
+// ErrUnsupportedVersion is returned for reports of another apiVersion or kind
+var ErrUnsupportedVersion = errors.New("unsupported report apiVersion or kind")
+
+// Item statuses of a report
+const (
+	StatusUpdated    = "updated"
+	StatusFailed     = "failed"
+	StatusNotApplied = "not-applied"
+)
+
+// Item is the outcome of one nodeclass change
+type Item struct {
+	NodeClass    string `json:"nodeClass"`
+	OldAMI       string `json:"oldAMI"`
+	NewAMI       string `json:"newAMI"`
+	OldAMIFamily string `json:"oldAMIFamily,omitempty"`
+	NewAMIFamily string `json:"newAMIFamily,omitempty"` // set when the change moved the nodeclass to another amiFamily
+	Status       string `json:"status"`
+	Error        string `json:"error,omitempty"`
+}
+
+// RollbackItem is a nodeclass that has to be restored to undo a failed run
+type RollbackItem struct {
+	NodeClass        string `json:"nodeClass"`
+	RestoreAMI       string `json:"restoreAMI"`
+	RestoreAMIFamily string `json:"restoreAMIFamily,omitempty"` // set when the change moved the nodeclass to another amiFamily
+}
+
+// Replacements summarizes how long drifted nodes took to be replaced
+type Replacements struct {
+	Count      int     `json:"count"`
+	P50Seconds float64 `json:"p50Seconds"`
+	P95Seconds float64 `json:"p95Seconds"`
+	MaxSeconds float64 `json:"maxSeconds"`
+}
+
+// FleetGroup is the number of nodeclaims of a nodeclass running an image when the report was made
+type FleetGroup struct {
+	NodeClass  string `json:"nodeClass"`
+	ImageID    string `json:"imageID"` // empty for nodeclaims not launched yet
+	NodeClaims int    `json:"nodeClaims"`
+}
+
+// Report is the final record of an upgrade run
+type Report struct {
+	APIVersion     string         `json:"apiVersion"`
+	Kind           string         `json:"kind"`
+	Tool           buildinfo.Info `json:"tool"`
+	Operator       string         `json:"operator,omitempty"`  // who ran the upgrade
+	RunID          string         `json:"runID,omitempty"`     // the upgrade-ami/run-id set on the nodeclasses, nodeclaims and nodes
+	StartedAt      time.Time      `json:"startedAt,omitzero"`  // when the run started
+	FinishedAt     time.Time      `json:"finishedAt,omitzero"` // when the report was made
+	Version        string         `json:"version"`
+	Versions       []string       `json:"versions,omitempty"` // every version applied, when the plans of a mixed cluster differ
+	Items          []Item         `json:"items"`
+	Skipped        []plan.Skipped `json:"skipped,omitempty"`
+	Rollback       []RollbackItem `json:"rollback,omitempty"` // set when an update failed
+	Replacements   Replacements   `json:"replacements"`
+	Disruptions    int            `json:"disruptions"`
+	Consolidations int            `json:"consolidations"`  // disruptions caused by consolidation rather than drift
+	Fleet          []FleetGroup   `json:"fleet,omitempty"` // the nodeclaims at the end of the run, when they could be listed
+}
+
+// New builds the report of a run from its plan, apply results and monitoring result (nil if monitoring did not run)
+func New(p *plan.Plan, results []upgrade.ChangeResult, monitored *upgrade.Result) *Report {
+	r := &Report{APIVersion: APIVersion, Kind: Kind, Tool: buildinfo.Get(), Version: p.Version, Skipped: p.Skipped}
+
+	for _, res := range results {
+		item := Item{
+			NodeClass:    res.NodeClass,
+			OldAMI:       res.OldAMI,
+			NewAMI:       res.NewAMI,
+			OldAMIFamily: res.OldAMIFamily,
+			NewAMIFamily: res.NewAMIFamily,
+			Status:       StatusUpdated,
+		}
+		switch {
+		case !res.Applied:
+			item.Status = StatusNotApplied
+		case res.Err != nil:
+			item.Status = StatusFailed
+			item.Error = res.Err.Error()
+		}
+		r.Items = append(r.Items, item)
+	}
+	// Sorted so that reports of the same nodeclasses line up whatever order they were applied in
+	sort.SliceStable(r.Items, func(i, j int) bool { return r.Items[i].NodeClass < r.Items[j].NodeClass })
+	r.Rollback = rollbackScope(r.Items)
+
+	if monitored != nil {
+		durations := history.ReplacementDurations(monitored.Resolutions)
+		if len(durations) > 0 {
+			r.Replacements = Replacements{
+				Count:      len(durations),
+				P50Seconds: history.Percentile(durations, 50).Seconds(),
+				P95Seconds: history.Percentile(durations, 95).Seconds(),
+				MaxSeconds: history.Percentile(durations, 100).Seconds(),
+			}
+		}
+		r.Disruptions = len(monitored.Disruptions)
+		for _, d := range monitored.Disruptions {
+			if d.IsConsolidation() {
+				r.Consolidations++
+			}
+		}
+	}
+
+	return r
+}
+
+// NewForPlans builds the report of a run that applied several plans, e.g. one per Kubernetes version of
+// a cluster in the middle of a control plane upgrade. Version is the first plan's version.
+func NewForPlans(plans []*plan.Plan, results []upgrade.ChangeResult, monitored *upgrade.Result) *Report {
+	r := New(plans[0], results, monitored)
+	r.Skipped = nil
+	for _, p := range plans {
+		r.Skipped = append(r.Skipped, p.Skipped...)
+		if !slices.Contains(r.Versions, p.Version) {
+			r.Versions = append(r.Versions, p.Version)
+		}
+	}
+	if len(r.Versions) == 1 {
+		r.Versions = nil
+	}
+	return r
+}
+
+// Fleet groups the nodeclaims that are not being deleted by nodeclass and image
+func Fleet(statuses []nodeclasses.NodeClaimStatus) []FleetGroup {
+	type key struct{ nodeClass, imageID string }
+	counts := make(map[key]int)
+	for _, s := range statuses {
+		if !s.Terminating {
+			counts[key{s.NodeClass, s.ImageID}]++
+		}
+	}
+	fleet := make([]FleetGroup, 0, len(counts))
+	for k, n := range counts {
+		fleet = append(fleet, FleetGroup{NodeClass: k.nodeClass, ImageID: k.imageID, NodeClaims: n})
+	}
+	sort.Slice(fleet, func(i, j int) bool {
+		if fleet[i].NodeClass != fleet[j].NodeClass {
+			return fleet[i].NodeClass < fleet[j].NodeClass
+		}
+		return fleet[i].ImageID < fleet[j].ImageID
+	})
+	return fleet
+}
+
+// ReadFile reads a report written in the JSON format. Reports written before the schema was versioned
+// have no apiVersion and are read as the current version.
+func ReadFile(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report: %w", err)
+	}
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("failed to parse report %s: %w", path, err)
+	}
+	if r.APIVersion == "" && r.Kind == "" {
+		r.APIVersion, r.Kind = APIVersion, Kind
+	}
+	if r.APIVersion != APIVersion || r.Kind != Kind {
+		return nil, fmt.Errorf("%w: %s %s in %s (want %s %s)", ErrUnsupportedVersion, r.APIVersion, r.Kind, path, APIVersion, Kind)
+	}
+	return &r, nil
+}
+
+// rollbackScope lists the nodeclasses to restore if any update failed: every update that was attempted,
+// including the failed ones, since a failed apply may still have reached the API server
+func rollbackScope(items []Item) []RollbackItem {
+	var failed bool
+	for _, item := range items {
+		failed = failed || item.Status == StatusFailed
+	}
+	if !failed {
+		return nil
+	}
+
+	var scope []RollbackItem
+	for _, item := range items {
+		if item.Status != StatusNotApplied {
+			rollback := RollbackItem{NodeClass: item.NodeClass, RestoreAMI: item.OldAMI}
+			if item.NewAMIFamily != "" {
+				rollback.RestoreAMIFamily = item.OldAMIFamily
+			}
+			scope = append(scope, rollback)
+		}
+	}
+	return scope
+}
+
+// WritePlan renders the dry-run summary of a plan. The JSON rendering is the plan document itself.
+func WritePlan(w io.Writer, format Format, p *plan.Plan) error {
+	if format == FormatJSON {
+		data, err := plan.Marshal(p)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	var b strings.Builder
+	fmt.Fprintln(&b, "📋 Dry Run - Changes to be made:")
+	fmt.Fprintln(&b, strings.Repeat("=", 80))
+	if p.CreatedBy != "" || p.Channel != "" {
+		if p.CreatedBy != "" {
+			fmt.Fprintf(&b, "Planned by: %s\n", p.CreatedBy)
+		}
+		if p.Channel != "" {
+			fmt.Fprintf(&b, "AMI channel: %s\n", p.Channel)
+		}
+		fmt.Fprintln(&b, strings.Repeat("-", 80))
+	}
+	for i, ch := range p.Changes {
+		if i > 0 {
+			fmt.Fprintln(&b)
+		}
+		fmt.Fprintf(&b, "NodeClass: %s\n", ch.NodeClass)
+		fmt.Fprintf(&b, "  Old AMI: %s\n", ch.OldAMI)
+		if ch.NewAMIID != "" {
+			fmt.Fprintf(&b, "  New AMI: %s (pinned to %s)\n", ch.NewAMI, ch.NewAMIID)
+		} else {
+			fmt.Fprintf(&b, "  New AMI: %s\n", ch.NewAMI)
+		}
+		if ch.NewAMIFamily != "" {
+			fmt.Fprintf(&b, "  AMI Family: %s → %s\n", unsetOr(ch.OldAMIFamily), ch.NewAMIFamily)
+		}
+		if ch.NewOwner != "" {
+			fmt.Fprintf(&b, "  AMI Owner: %s → %s\n", unsetOr(ch.OldOwner), ch.NewOwner)
+		}
+	}
+	fmt.Fprintln(&b, strings.Repeat("=", 80))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// unsetOr describes an optional selector field, e.g. an amiFamily, for display
+func unsetOr(value string) string {
+	if value == "" {
+		return "(unset)"
+	}
+	return value
+}
+
+// WriteReport renders the final report of a run
+func WriteReport(w io.Writer, format Format, r *Report) error {
+	if format == FormatJSON {
+		if r.Items == nil {
+			r.Items = []Item{}
+		}
+		return writeJSON(w, r)
+	}
+
+	var b strings.Builder
+	if len(r.Versions) > 0 {
+		fmt.Fprintf(&b, "📄 Upgrade Report (v%s)\n", strings.Join(r.Versions, ", v"))
+	} else {
+		fmt.Fprintf(&b, "📄 Upgrade Report (v%s)\n", r.Version)
+	}
+	fmt.Fprintln(&b, strings.Repeat("=", 80))
+	fmt.Fprintf(&b, "Tool: upgrade-ami %s\n", r.Tool)
+	if r.Operator != "" {
+		fmt.Fprintf(&b, "Operator: %s\n", r.Operator)
+	}
+	if r.RunID != "" {
+		fmt.Fprintf(&b, "Run: %s\n", r.RunID)
+	}
+	fmt.Fprintln(&b, strings.Repeat("-", 80))
+	for _, item := range r.Items {
+		fmt.Fprintf(&b, "%-12s %s: %s → %s\n", item.Status, item.NodeClass, item.OldAMI, item.NewAMI)
+		if item.NewAMIFamily != "" {
+			fmt.Fprintf(&b, "             amiFamily: %s → %s\n", unsetOr(item.OldAMIFamily), item.NewAMIFamily)
+		}
+		if item.Error != "" {
+			fmt.Fprintf(&b, "             error: %s\n", item.Error)
+		}
+	}
+	for _, s := range r.Skipped {
+		fmt.Fprintf(&b, "%-12s %s: %s\n", "skipped", s.NodeClass, s.Reason)
+	}
+	if len(r.Rollback) > 0 {
+		fmt.Fprintln(&b, strings.Repeat("-", 80))
+		fmt.Fprintln(&b, "Rollback scope (restore these AMIs to undo the run):")
+		for _, item := range r.Rollback {
+			fmt.Fprintf(&b, "  %s: %s\n", item.NodeClass, item.RestoreAMI)
+			if item.RestoreAMIFamily != "" {
+				fmt.Fprintf(&b, "    amiFamily: %s\n", item.RestoreAMIFamily)
+			}
+		}
+	}
+	fmt.Fprintln(&b, strings.Repeat("-", 80))
+	if r.Replacements.Count > 0 {
+		fmt.Fprintf(&b, "Nodes replaced: %d (p50 %s, p95 %s, max %s)\n", r.Replacements.Count,
+			seconds(r.Replacements.P50Seconds), seconds(r.Replacements.P95Seconds), seconds(r.Replacements.MaxSeconds))
+	} else {
+		fmt.Fprintln(&b, "Nodes replaced: 0")
+	}
+	fmt.Fprintf(&b, "Disruptions:    %d (%d from consolidation)\n", r.Disruptions, r.Consolidations)
+	if !r.StartedAt.IsZero() && !r.FinishedAt.IsZero() {
+		fmt.Fprintf(&b, "Duration:       %s\n", r.FinishedAt.Sub(r.StartedAt).Round(time.Second))
+	}
+	fmt.Fprintln(&b, strings.Repeat("=", 80))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// seconds formats a duration in seconds, e.g. "4m30s"
+func seconds(s float64) string {
+	return (time.Duration(s * float64(time.Second))).Round(time.Second).String()
+}
+
+// writeJSON writes v as indented JSON
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	return nil
+}
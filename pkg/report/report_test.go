@@ -0,0 +1,189 @@
+package report
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/buildinfo"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/history"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/upgrade"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata with the current rendering")
+
+// golden compares got, rendered in format, with the golden file testdata/name.<ext>.golden, rewriting it
+// instead with -update
+func golden(t *testing.T, name string, format Format, got []byte) {
+	t.Helper()
+	ext := "txt"
+	if format == FormatJSON {
+		ext = "json"
+	}
+	path := filepath.Join("testdata", name+"."+ext+".golden")
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file (run go test -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("rendering differs from %s (run go test -update if the change is intended):\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+// testTool is a fixed build, so the renderings don't depend on how the test binary was built
+var testTool = buildinfo.Info{Version: "v1.2.3", Commit: "0123456789abcdef", Date: "2025-10-01T12:00:00Z", GoVersion: "go1.24.4"}
+
+// testPlan moves three nodeclasses to 1.33 v20251101, one of them to another amiFamily and owner
+func testPlan() *plan.Plan {
+	return &plan.Plan{
+		APIVersion:   plan.APIVersion,
+		Kind:         plan.Kind,
+		Version:      "20251101",
+		K8sVersion:   "1.33",
+		Channel:      "stable",
+		CreatedBy:    "alice@example.com",
+		Precondition: plan.Precondition{NodeClassChecksum: "sha256:5d41402abc4b2a76b9719d911017c592"},
+		Changes: []plan.Change{
+			{NodeClass: "default", OldAMI: "domino-eks-1.33-v20251001", NewAMI: "domino-eks-1.33-v20251101"},
+			{NodeClass: "gpu", OldAMI: "domino-eks-gpu-1.33-v20251001", NewAMI: "domino-eks-gpu-1.33-v20251101", NewAMIID: "ami-0abc123def4567890"},
+			{
+				NodeClass: "compute", OldAMI: "domino-eks-1.33-v20251001", NewAMI: "domino-eks-1.33-v20251101",
+				NewAMIFamily: "AL2023", NewOwner: "123456789012",
+			},
+		},
+		Skipped: []plan.Skipped{{NodeClass: "legacy", Reason: "AMI name doesn't match the naming scheme"}},
+	}
+}
+
+// testReport is the report of applying testPlan, replacing three nodes, with results updated by fail
+func testReport(fail func([]upgrade.ChangeResult)) *Report {
+	p := testPlan()
+	results := make([]upgrade.ChangeResult, len(p.Changes))
+	for i, ch := range p.Changes {
+		results[i] = upgrade.ChangeResult{Change: ch, Applied: true}
+	}
+	if fail != nil {
+		fail(results)
+	}
+
+	drifted := time.Date(2025, 11, 2, 10, 0, 0, 0, time.UTC)
+	monitored := &upgrade.Result{
+		StartedAt:  drifted,
+		FinishedAt: drifted.Add(20 * time.Minute),
+		Resolutions: []history.Resolution{
+			{NodeClaim: "default-a", NodeClass: "default", Replaced: true, DriftedAt: drifted, ResolvedAt: drifted.Add(4 * time.Minute)},
+			{NodeClaim: "default-b", NodeClass: "default", Replaced: true, DriftedAt: drifted, ResolvedAt: drifted.Add(6 * time.Minute)},
+			{NodeClaim: "gpu-a", NodeClass: "gpu", Replaced: true, DriftedAt: drifted, ResolvedAt: drifted.Add(15 * time.Minute)},
+			{NodeClaim: "compute-a", NodeClass: "compute", DriftedAt: drifted, ResolvedAt: drifted.Add(time.Minute)},
+		},
+		Disruptions: []nodeclasses.DisruptionEvent{
+			{Time: drifted, Kind: "NodeClaim", Name: "default-a", Reason: "Drifted"},
+			{Time: drifted, Kind: "NodeClaim", Name: "default-c", Reason: "Underutilized"},
+		},
+	}
+
+	r := New(p, results, monitored)
+	r.Tool = testTool
+	r.Operator = "alice@example.com"
+	r.RunID = "20251102-100000-a1b2c3"
+	r.StartedAt = drifted.Add(-2 * time.Minute)
+	r.FinishedAt = drifted.Add(20 * time.Minute)
+	r.Fleet = []FleetGroup{
+		{NodeClass: "default", ImageID: "ami-0def", NodeClaims: 2},
+		{NodeClass: "gpu", ImageID: "ami-0abc123def4567890", NodeClaims: 1},
+	}
+	return r
+}
+
+func TestWritePlan(t *testing.T) {
+	for _, format := range []Format{FormatText, FormatJSON} {
+		t.Run(string(format), func(t *testing.T) {
+			var b bytes.Buffer
+			if err := WritePlan(&b, format, testPlan()); err != nil {
+				t.Fatal(err)
+			}
+			golden(t, "plan", format, b.Bytes())
+		})
+	}
+}
+
+func TestWritePlanInvalid(t *testing.T) {
+	p := testPlan()
+	p.Version = ""
+	if err := WritePlan(&bytes.Buffer{}, FormatJSON, p); !errors.Is(err, plan.ErrInvalidPlan) {
+		t.Errorf("error = %v, want ErrInvalidPlan", err)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	tests := []struct {
+		name   string
+		report *Report
+	}{
+		{"report", testReport(nil)},
+		{"report-failed", testReport(func(results []upgrade.ChangeResult) {
+			results[1].Err = errors.New("nodeclass gpu: the object has been modified")
+			results[2].Applied = false
+		})},
+		{"report-mixed", func() *Report {
+			next := testPlan()
+			next.Version, next.K8sVersion = "20251102", "1.34"
+			next.Changes, next.Skipped = nil, nil
+			p := testPlan()
+			r := NewForPlans([]*plan.Plan{p, next}, nil, nil)
+			r.Tool = testTool
+			return r
+		}()},
+	}
+	for _, tt := range tests {
+		for _, format := range []Format{FormatText, FormatJSON} {
+			t.Run(tt.name+"/"+string(format), func(t *testing.T) {
+				var b bytes.Buffer
+				if err := WriteReport(&b, format, tt.report); err != nil {
+					t.Fatal(err)
+				}
+				golden(t, tt.name, format, b.Bytes())
+			})
+		}
+	}
+}
+
+func TestReadFileRoundTrip(t *testing.T) {
+	want := testReport(nil)
+	var b bytes.Buffer
+	if err := WriteReport(&b, FormatJSON, want); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rendering what was read gives back the same document
+	var again bytes.Buffer
+	if err := WriteReport(&again, FormatJSON, got); err != nil {
+		t.Fatal(err)
+	}
+	if again.String() != b.String() {
+		t.Errorf("round trip changed the report:\n%s\nwant:\n%s", again.String(), b.String())
+	}
+}
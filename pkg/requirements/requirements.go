@@ -0,0 +1,200 @@
+// Package requirements checks that the NodePools of the nodeclasses in a plan can still launch instances
+// their new AMI supports, e.g. that a nodeclass moved to a GPU AMI isn't used by a NodePool allowing no
+// GPU instance families, so the mismatch is caught before applying rather than by failing launches
+package requirements
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/naming"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+)
+
+// ErrMismatch is returned when a NodePool rules out every instance the new AMI of its nodeclass supports
+var ErrMismatch = errors.New("nodepool requirements don't match the new AMI")
+
+// Well-known requirement keys
+const (
+	KeyArch            = "kubernetes.io/arch"
+	KeyCategory        = "karpenter.k8s.aws/instance-category"
+	KeyFamily          = "karpenter.k8s.aws/instance-family"
+	KeyGPUCount        = "karpenter.k8s.aws/instance-gpu-count"
+	KeyGPUManufacturer = "karpenter.k8s.aws/instance-gpu-manufacturer"
+)
+
+// Accelerators an AMI can ship drivers for
+const (
+	AcceleratorNVIDIA = "nvidia"
+	AcceleratorNeuron = "neuron"
+)
+
+// Traits are what an AMI supports, as far as its name tells
+type Traits struct {
+	Arch        string // amd64 or arm64; empty when the name doesn't say
+	Accelerator string // AcceleratorNVIDIA or AcceleratorNeuron; empty for images without accelerator drivers
+}
+
+// ImageTraits reads the traits from the nodegroup field of an AMI name, e.g. gpu, arm64-nvidia or
+// nvidia-aarch64
+func ImageTraits(f naming.Fields) Traits {
+	var t Traits
+	for _, word := range strings.Split(strings.ToLower(f.Nodegroup), "-") {
+		switch word {
+		case "x86_64", "amd64":
+			t.Arch = "amd64"
+		case "arm64", "aarch64":
+			t.Arch = "arm64"
+		case "gpu", "nvidia":
+			t.Accelerator = AcceleratorNVIDIA
+		case "neuron", "inferentia", "trainium":
+			t.Accelerator = AcceleratorNeuron
+		}
+	}
+	return t
+}
+
+// Mismatch is a NodePool whose requirements rule out every instance the new AMI of its nodeclass supports
+type Mismatch struct {
+	NodeClass string `json:"nodeClass"`
+	NodePool  string `json:"nodePool"`
+	NewAMI    string `json:"newAMI"`
+	Reason    string `json:"reason"`
+}
+
+// Check returns the mismatches between the new AMI of each change of the plan, parsed with scheme, and the
+// requirements of the NodePools referencing its nodeclass. AMIs whose names tell neither an architecture
+// nor an accelerator are not checked.
+func Check(p *plan.Plan, scheme naming.Provider, pools []nodeclasses.NodePool) []Mismatch {
+	var mismatches []Mismatch
+	for _, ch := range p.Changes {
+		fields, ok := scheme.Parse(ch.NewAMI)
+		if !ok {
+			continue
+		}
+		traits := ImageTraits(fields)
+		for _, pool := range pools {
+			if pool.Spec.Template.Spec.NodeClassRef.Name != ch.NodeClass {
+				continue
+			}
+			if reason := conflict(traits, pool.Spec.Template.Spec.Requirements); reason != "" {
+				mismatches = append(mismatches, Mismatch{
+					NodeClass: ch.NodeClass,
+					NodePool:  pool.Metadata.Name,
+					NewAMI:    ch.NewAMI,
+					Reason:    reason,
+				})
+			}
+		}
+	}
+	return mismatches
+}
+
+// Err returns ErrMismatch naming the NodePools, or nil when there are no mismatches
+func Err(mismatches []Mismatch) error {
+	if len(mismatches) == 0 {
+		return nil
+	}
+	pools := make([]string, 0, len(mismatches))
+	for _, m := range mismatches {
+		pools = append(pools, m.NodePool)
+	}
+	return fmt.Errorf("%w: %s", ErrMismatch, strings.Join(pools, ", "))
+}
+
+// conflict describes the first requirement that rules out every instance with the traits, or returns ""
+func conflict(t Traits, reqs []nodeclasses.Requirement) string {
+	for _, r := range reqs {
+		if t.Arch != "" && r.Key == KeyArch && !allows(r, t.Arch) {
+			return fmt.Sprintf("%s excludes %s, the architecture of the AMI", describe(r), t.Arch)
+		}
+		if t.Accelerator != "" && excludesAccelerator(r, t.Accelerator) {
+			return fmt.Sprintf("%s allows no %s instances, which the AMI is built for", describe(r), acceleratorName(t.Accelerator))
+		}
+	}
+	return ""
+}
+
+// excludesAccelerator reports whether the requirement rules out every instance with the accelerator
+func excludesAccelerator(r nodeclasses.Requirement, accelerator string) bool {
+	switch r.Key {
+	case KeyCategory:
+		return !slices.ContainsFunc(acceleratorCategories(accelerator), func(c string) bool { return allows(r, c) })
+	case KeyFamily:
+		if r.Operator != "In" {
+			return false
+		}
+		return !slices.ContainsFunc(r.Values, func(family string) bool { return familyHas(family, accelerator) })
+	case KeyGPUCount:
+		return accelerator == AcceleratorNVIDIA && !allowsPositive(r)
+	case KeyGPUManufacturer:
+		return accelerator == AcceleratorNVIDIA && !allows(r, AcceleratorNVIDIA)
+	}
+	return false
+}
+
+// acceleratorCategories are the instance categories with the accelerator
+func acceleratorCategories(accelerator string) []string {
+	if accelerator == AcceleratorNeuron {
+		return []string{"inf", "trn"}
+	}
+	return []string{"g", "p"}
+}
+
+// familyHas reports whether instances of the family, e.g. g5 or inf2, have the accelerator
+func familyHas(family, accelerator string) bool {
+	family = strings.ToLower(family)
+	if accelerator == AcceleratorNeuron {
+		return strings.HasPrefix(family, "inf") || strings.HasPrefix(family, "trn")
+	}
+	return strings.HasPrefix(family, "g") || strings.HasPrefix(family, "p")
+}
+
+// acceleratorName names the instances with the accelerator in messages
+func acceleratorName(accelerator string) string {
+	if accelerator == AcceleratorNeuron {
+		return "Inferentia or Trainium"
+	}
+	return "NVIDIA GPU"
+}
+
+// allows reports whether a label with the value satisfies the requirement
+func allows(r nodeclasses.Requirement, value string) bool {
+	switch r.Operator {
+	case "In":
+		return slices.Contains(r.Values, value)
+	case "NotIn":
+		return !slices.Contains(r.Values, value)
+	case "DoesNotExist":
+		return false
+	}
+	return true
+}
+
+// allowsPositive reports whether a count label above zero can satisfy the requirement
+func allowsPositive(r nodeclasses.Requirement) bool {
+	switch r.Operator {
+	case "DoesNotExist":
+		return false
+	case "In":
+		return slices.ContainsFunc(r.Values, func(v string) bool { n, err := strconv.Atoi(v); return err != nil || n > 0 })
+	case "Lt":
+		if len(r.Values) == 1 {
+			n, err := strconv.Atoi(r.Values[0])
+			return err != nil || n > 1
+		}
+	}
+	return true
+}
+
+// describe renders the requirement as in "karpenter.k8s.aws/instance-family In [m5 c5]"
+func describe(r nodeclasses.Requirement) string {
+	if len(r.Values) == 0 {
+		return r.Key + " " + r.Operator
+	}
+	return fmt.Sprintf("%s %s [%s]", r.Key, r.Operator, strings.Join(r.Values, " "))
+}
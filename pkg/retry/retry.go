@@ -0,0 +1,151 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+)
+
+// Policy controls how an operation is retried
+type Policy struct {
+	InitialDelay time.Duration // delay before the first retry
+	MaxDelay     time.Duration // cap on the delay between attempts
+	Multiplier   float64       // growth factor of the delay per attempt
+	MaxAttempts  int           // total attempts including the first, 0 means unlimited within the budget
+	Budget       time.Duration // total time the operation may spend retrying, 0 means unlimited
+	Clock        clock.Clock   // measures the budget and waits between attempts; nil means the system clock
+}
+
+// Default is a policy suitable for kubectl and AWS API calls
+var Default = Policy{
+	InitialDelay: 500 * time.Millisecond,
+	MaxDelay:     10 * time.Second,
+	Multiplier:   2,
+	MaxAttempts:  5,
+	Budget:       time.Minute,
+}
+
+// WithBudget returns a copy of the policy with a different time budget
+func (p Policy) WithBudget(budget time.Duration) Policy {
+	p.Budget = budget
+	return p
+}
+
+// permanentError marks an error as not retryable
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so that Do returns it immediately instead of retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// retryableMessages are fragments of error output that indicate a transient failure
+var retryableMessages = []string{
+	// Throttling
+	"Throttling",
+	"RequestLimitExceeded",
+	"TooManyRequests",
+	"Too Many Requests",
+	"Rate exceeded",
+	// Optimistic concurrency conflicts
+	"the object has been modified",
+	"Operation cannot be fulfilled",
+	// Transient server and network failures
+	"ServiceUnavailable",
+	"InternalError",
+	"connection refused",
+	"connection reset",
+	"i/o timeout",
+	"TLS handshake timeout",
+	"etcdserver: request timed out",
+	"unexpected EOF",
+}
+
+// IsRetryable reports whether err looks like a throttling, conflict or transient network error
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var permanent permanentError
+	if errors.As(err, &permanent) {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, fragment := range retryableMessages {
+		if strings.Contains(msg, strings.ToLower(fragment)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Do calls fn until it succeeds, fails with a non-retryable error, or the policy's attempts or budget run out.
+// The delay between attempts grows exponentially with jitter.
+func Do(ctx context.Context, policy Policy, fn func(ctx context.Context) error) error {
+	clk := clock.OrReal(policy.Clock)
+	start := clk.Now()
+	delay := policy.InitialDelay
+
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		if !IsRetryable(err) || ctx.Err() != nil {
+			return unwrapPermanent(err)
+		}
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		// Equal jitter: wait between half and the full delay
+		wait := delay/2 + time.Duration(rand.Int64N(int64(delay/2)+1))
+		if policy.Budget > 0 && clk.Since(start)+wait > policy.Budget {
+			return fmt.Errorf("giving up after %d attempts (retry budget %s exhausted): %w", attempt, policy.Budget, err)
+		}
+
+		select {
+		case <-clk.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+
+		delay = time.Duration(float64(delay) * policy.Multiplier)
+		if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+			delay = policy.MaxDelay
+		}
+	}
+}
+
+// unwrapPermanent strips the Permanent marker so callers see the original error
+func unwrapPermanent(err error) error {
+	var permanent permanentError
+	if errors.As(err, &permanent) && err == error(permanent) {
+		return permanent.err
+	}
+	return err
+}
@@ -0,0 +1,107 @@
+// Package rollout spreads applying a plan over several maintenance windows, e.g. a third of its nodeclasses
+// a night for three nights: each window applies the next slice of the plan, and the run state records what
+// was applied so the next window resumes where the last one stopped
+package rollout
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+)
+
+// ErrOutsideWindow is returned when a run is started outside its maintenance window
+var ErrOutsideWindow = errors.New("outside the maintenance window")
+
+// Window is a daily maintenance window in local time. It spans midnight when End is before Start.
+type Window struct {
+	Start time.Duration // since midnight
+	End   time.Duration // since midnight
+}
+
+// ParseWindow parses a window such as 22:00-04:00
+func ParseWindow(s string) (Window, error) {
+	from, to, ok := strings.Cut(strings.TrimSpace(s), "-")
+	if !ok {
+		return Window{}, fmt.Errorf("invalid maintenance window %q (want HH:MM-HH:MM, e.g. 22:00-04:00)", s)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return Window{}, fmt.Errorf("invalid maintenance window %q: %w", s, err)
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return Window{}, fmt.Errorf("invalid maintenance window %q: %w", s, err)
+	}
+	if start == end {
+		return Window{}, fmt.Errorf("invalid maintenance window %q: it starts when it ends", s)
+	}
+	return Window{Start: start, End: end}, nil
+}
+
+// parseClock parses a time of day such as 22:00 into the time since midnight
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time of day (HH:MM)", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// String formats the window as it is parsed, e.g. 22:00-04:00
+func (w Window) String() string {
+	return clockString(w.Start) + "-" + clockString(w.End)
+}
+
+// clockString formats the time since midnight as HH:MM
+func clockString(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// length returns how long the window lasts
+func (w Window) length() time.Duration {
+	if w.End > w.Start {
+		return w.End - w.Start
+	}
+	return 24*time.Hour - w.Start + w.End
+}
+
+// Next returns the start and end of the window t is in, or of the next window when t is outside one
+func (w Window) Next(t time.Time) (time.Time, time.Time) {
+	// A window spanning midnight may have opened the day before
+	for day := -1; ; day++ {
+		midnight := time.Date(t.Year(), t.Month(), t.Day()+day, 0, 0, 0, 0, t.Location())
+		start := midnight.Add(w.Start)
+		end := start.Add(w.length())
+		if t.Before(end) {
+			return start, end
+		}
+	}
+}
+
+// Contains reports whether t is in a window
+func (w Window) Contains(t time.Time) bool {
+	start, _ := w.Next(t)
+	return !start.After(t)
+}
+
+// SliceSize returns how many changes each of slices slices applies for a plan of total changes
+func SliceSize(total, slices int) int {
+	if slices < 1 {
+		return total
+	}
+	return (total + slices - 1) / slices
+}
+
+// Slice returns the first size changes of p, keeping its precondition, so applying the slice leaves the
+// rest of the plan to resume later
+func Slice(p *plan.Plan, size int) *plan.Plan {
+	if size >= len(p.Changes) {
+		return p
+	}
+	slice := *p
+	slice.Changes = append([]plan.Change(nil), p.Changes[:size]...)
+	return &slice
+}
@@ -0,0 +1,248 @@
+// Package runstate persists which changes of a plan a run has applied, so a run that dies partway
+// (a network blip, the bastion running out of memory) can be resumed with the same plan: the changes
+// already applied are skipped and the rest are applied.
+package runstate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+)
+
+// State is the progress of applying one plan to one cluster
+type State struct {
+	PlanID    string    `json:"planID"`
+	Cluster   string    `json:"cluster"`
+	StartedAt time.Time `json:"startedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Completed []string  `json:"completed"` // nodeclasses whose change was applied, in order
+}
+
+// Done reports whether the change of the nodeclass was applied
+func (s *State) Done(nodeClass string) bool {
+	return slices.Contains(s.Completed, nodeClass)
+}
+
+// PlanID fingerprints the plan document, so a state only resumes the exact plan it was recorded for
+func PlanID(p *plan.Plan) (string, error) {
+	data, err := plan.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// DefaultDir returns the default directory of the run states
+func DefaultDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine home directory: %w", err)
+	}
+	return filepath.Join(home, ".upgrade-ami", "runs"), nil
+}
+
+// Store keeps one state file per plan and cluster in Dir
+type Store struct {
+	Dir string
+}
+
+// path names the state file of the plan and cluster
+func (s Store) path(planID, cluster string) string {
+	sum := sha256.Sum256([]byte(cluster + "\x00" + planID))
+	return filepath.Join(s.Dir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// Load reads the state of the plan on the cluster, returning nil if no run recorded one
+func (s Store) Load(planID, cluster string) (*State, error) {
+	data, err := os.ReadFile(s.path(planID, cluster))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run state: %w", err)
+	}
+	var st State
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("failed to parse run state: %w", err)
+	}
+	if st.PlanID != planID || st.Cluster != cluster {
+		return nil, nil
+	}
+	return &st, nil
+}
+
+// List returns the states recorded for the cluster, oldest first: the runs on it that were interrupted or
+// have slices left to apply
+func (s Store) List(cluster string) ([]*State, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run states: %w", err)
+	}
+	var states []*State
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.Dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read run state: %w", err)
+		}
+		var st State
+		if err := json.Unmarshal(data, &st); err != nil {
+			return nil, fmt.Errorf("failed to parse run state %s: %w", entry.Name(), err)
+		}
+		if st.Cluster == cluster {
+			states = append(states, &st)
+		}
+	}
+	slices.SortFunc(states, func(a, b *State) int { return a.StartedAt.Compare(b.StartedAt) })
+	return states, nil
+}
+
+// Save writes the state, replacing the file atomically so a crash never leaves a truncated state
+func (s Store) Save(st *State) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal run state: %w", err)
+	}
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create run state directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(s.Dir, ".run-*")
+	if err != nil {
+		return fmt.Errorf("failed to write run state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write run state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write run state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path(st.PlanID, st.Cluster)); err != nil {
+		return fmt.Errorf("failed to write run state: %w", err)
+	}
+	return nil
+}
+
+// Remove deletes the state of the plan on the cluster, e.g. once every change was applied
+func (s Store) Remove(planID, cluster string) error {
+	if err := os.Remove(s.path(planID, cluster)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove run state: %w", err)
+	}
+	return nil
+}
+
+// Resume returns the part of p that is still to be applied after the run recorded in st, and the
+// nodeclasses skipped because they already carry their planned AMI. The changes st records must have
+// landed, and the others must still be pending, otherwise the nodeclasses were changed another way and
+// plan.ErrPreconditionFailed is returned. The remainder's precondition covers the pending nodeclasses
+// as they are now.
+func Resume(p *plan.Plan, st *State, list nodeclasses.NodeClassList) (*plan.Plan, []string, error) {
+	diff := p.Compare(list)
+	pending := make(map[string]bool)
+	var done []string
+	for _, e := range diff.Entries {
+		switch {
+		case e.Status == plan.DiffApplied:
+			done = append(done, e.NodeClass)
+		case st.Done(e.NodeClass):
+			return nil, nil, fmt.Errorf("%w: %s was updated by the interrupted run but now uses %q", plan.ErrPreconditionFailed, e.NodeClass, e.CurrentAMI)
+		case e.Status == plan.DiffPending:
+			pending[e.NodeClass] = true
+		default:
+			return nil, nil, fmt.Errorf("%w: %s is %s", plan.ErrPreconditionFailed, e.NodeClass, e.Status)
+		}
+	}
+
+	remaining := nodeclasses.NodeClassList{}
+	for _, nc := range list.Items {
+		if pending[nc.Metadata.Name] {
+			remaining.Items = append(remaining.Items, nc)
+		}
+	}
+	rest := plan.NewScoped(p.Version, remaining)
+	rest.Variant, rest.K8sVersion, rest.CreatedBy, rest.Skipped = p.Variant, p.K8sVersion, p.CreatedBy, p.Skipped
+	for _, ch := range p.Changes {
+		if pending[ch.NodeClass] {
+			rest.Changes = append(rest.Changes, ch)
+		}
+	}
+	return rest, done, nil
+}
+
+// Tracker records the changes of several plans as they are applied
+type Tracker struct {
+	Store Store
+	Now   func() time.Time
+
+	mu     sync.Mutex
+	states map[string]*State // nodeclass -> state of the plan changing it
+}
+
+// NewTracker starts tracking the plans on the cluster. states holds the states of resumed plans by plan ID;
+// the others start empty.
+func NewTracker(store Store, now func() time.Time, cluster string, plans map[string]*plan.Plan, states map[string]*State) *Tracker {
+	t := &Tracker{Store: store, Now: now, states: make(map[string]*State)}
+	for id, p := range plans {
+		st := states[id]
+		if st == nil {
+			st = &State{PlanID: id, Cluster: cluster, StartedAt: now()}
+		}
+		for _, ch := range p.Changes {
+			t.states[ch.NodeClass] = st
+		}
+	}
+	return t
+}
+
+// Completed records that the change of the nodeclass was applied and saves its plan's state
+func (t *Tracker) Completed(nodeClass string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	st, ok := t.states[nodeClass]
+	if !ok {
+		return nil
+	}
+	if !st.Done(nodeClass) {
+		st.Completed = append(st.Completed, nodeClass)
+	}
+	st.UpdatedAt = t.Now()
+	return t.Store.Save(st)
+}
+
+// Finish removes the states of the plans all of whose changes were applied, or of every plan when discard
+// is set, e.g. after the run's changes were reverted
+func (t *Tracker) Finish(discard bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	finished := make(map[*State]bool)
+	for nodeClass, st := range t.states {
+		prev, seen := finished[st]
+		finished[st] = (!seen || prev) && (discard || st.Done(nodeClass))
+	}
+	var errs []error
+	for st, ok := range finished {
+		if ok {
+			errs = append(errs, t.Store.Remove(st.PlanID, st.Cluster))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,90 @@
+// Package runtag annotates the nodeclaims and nodes an upgrade run touches with the ID of the run, so node
+// churn can be traced back to the upgrade that caused it, e.g. with
+// kubectl get nodes -o custom-columns=NAME:.metadata.name,RUN:.metadata.annotations.upgrade-ami/run-id
+package runtag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/retry"
+)
+
+// ErrUnsupported is returned when the KubeClient cannot annotate objects
+var ErrUnsupported = errors.New("the Kubernetes client cannot annotate objects")
+
+// Result is the outcome of Tag
+type Result struct {
+	NodeClaims []string // nodeclaims annotated
+	Nodes      []string // nodes of those nodeclaims annotated
+}
+
+// Tagger annotates nodeclaims and their nodes with a run ID
+type Tagger struct {
+	Kube  clients.KubeClient
+	Clock clock.Clock
+}
+
+// New creates a Tagger using kube and the system clock
+func New(kube clients.KubeClient) *Tagger {
+	return &Tagger{Kube: kube, Clock: clock.Real}
+}
+
+// Tag sets the nodeclasses.RunIDAnnotation to id on the nodeclaims of the nodeclasses and on their nodes.
+// Called right after the nodeclasses are updated it tags the nodeclaims the run is about to replace; called
+// again once the rollout settled it tags their replacements. Nodeclaims being deleted and ones tagged with id
+// already are skipped, as are nodes not registered yet. Failures to annotate an object are joined and don't
+// stop the others.
+func (t *Tagger) Tag(ctx context.Context, id string, nodeClasses []string) (*Result, error) {
+	annotator, ok := t.Kube.(clients.Annotator)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	changed := make(map[string]bool, len(nodeClasses))
+	for _, name := range nodeClasses {
+		changed[name] = true
+	}
+
+	statuses, err := nodeclasses.GetNodeClaimStatuses(ctx, t.Kube, clock.OrReal(t.Clock).Now())
+	if err != nil {
+		return nil, err
+	}
+	annotations := map[string]string{nodeclasses.RunIDAnnotation: id}
+	annotate := func(resource, name string) error {
+		return retry.Do(ctx, retry.Default, func(ctx context.Context) error {
+			return annotator.Annotate(ctx, resource, name, annotations)
+		})
+	}
+
+	result := &Result{}
+	var errs []error
+	for _, s := range statuses {
+		if !changed[s.NodeClass] || s.Terminating || s.RunID == id {
+			continue
+		}
+		if err := annotate("nodeclaims", s.Name); err != nil {
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+			errs = append(errs, fmt.Errorf("failed to annotate nodeclaim %s: %w", s.Name, err))
+			continue
+		}
+		result.NodeClaims = append(result.NodeClaims, s.Name)
+		if s.NodeName == "" {
+			continue
+		}
+		if err := annotate("nodes", s.NodeName); err != nil {
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+			errs = append(errs, fmt.Errorf("failed to annotate node %s: %w", s.NodeName, err))
+			continue
+		}
+		result.Nodes = append(result.Nodes, s.NodeName)
+	}
+	return result, errors.Join(errs...)
+}
@@ -0,0 +1,210 @@
+// Package selfupdate replaces the running binary with the latest release after verifying its checksum and,
+// when a public key is configured, the signature of the checksum file
+package selfupdate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// DefaultReleasesURL is the GitHub API endpoint of the latest release
+const DefaultReleasesURL = "https://api.github.com/repos/ddl-r-abdulaziz/upgrade-ami/releases/latest"
+
+// Release assets besides the binaries
+const (
+	checksumsAsset = "checksums.txt"     // sha256sum output covering every binary
+	signatureAsset = "checksums.txt.sig" // base64 ed25519 signature of checksums.txt
+)
+
+var (
+	// ErrChecksumMismatch is returned when a downloaded binary does not match the published checksum
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrBadSignature is returned when the checksum file's signature does not verify
+	ErrBadSignature = errors.New("invalid release signature")
+)
+
+// Release is a published release. The endpoint may be GitHub's releases API or an internal
+// server returning the same JSON shape.
+type Release struct {
+	Tag    string  `json:"tag_name"`
+	Assets []Asset `json:"assets"`
+}
+
+// Asset is a downloadable file of a release
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// asset returns the release asset with the given name
+func (r *Release) asset(name string) (Asset, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Asset{}, false
+}
+
+// BinaryName returns the release asset name of the binary for this platform, e.g. upgrade-ami_linux_amd64
+func BinaryName() string {
+	return fmt.Sprintf("upgrade-ami_%s_%s", runtime.GOOS, runtime.GOARCH)
+}
+
+// Updater checks for and installs releases
+type Updater struct {
+	ReleasesURL string
+	PublicKey   ed25519.PublicKey // when set, checksums.txt must carry a valid signature
+	Client      *http.Client
+}
+
+// New creates an Updater for releasesURL. publicKey is a base64 ed25519 public key, or "" to only verify checksums.
+func New(releasesURL, publicKey string) (*Updater, error) {
+	u := &Updater{ReleasesURL: releasesURL, Client: http.DefaultClient}
+	if u.ReleasesURL == "" {
+		u.ReleasesURL = DefaultReleasesURL
+	}
+	if publicKey != "" {
+		key, err := base64.StdEncoding.DecodeString(publicKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid release public key: must be a base64 ed25519 public key")
+		}
+		u.PublicKey = key
+	}
+	return u, nil
+}
+
+// Latest fetches the latest release
+func (u *Updater) Latest(ctx context.Context) (*Release, error) {
+	data, err := u.get(ctx, u.ReleasesURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch latest release: %w", err)
+	}
+
+	var release Release
+	if err := json.Unmarshal(data, &release); err != nil {
+		return nil, fmt.Errorf("failed to parse release: %w", err)
+	}
+	if release.Tag == "" {
+		return nil, fmt.Errorf("failed to parse release: no tag_name")
+	}
+	return &release, nil
+}
+
+// Install downloads the binary of release for this platform, verifies it and atomically replaces the
+// executable at path with it
+func (u *Updater) Install(ctx context.Context, release *Release, path string) error {
+	binary, ok := release.asset(BinaryName())
+	if !ok {
+		return fmt.Errorf("release %s has no binary for %s/%s", release.Tag, runtime.GOOS, runtime.GOARCH)
+	}
+
+	want, err := u.checksum(ctx, release, binary.Name)
+	if err != nil {
+		return err
+	}
+
+	data, err := u.get(ctx, binary.URL)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", binary.Name, err)
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("%w for %s: got %s, want %s", ErrChecksumMismatch, binary.Name, got, want)
+	}
+
+	return replace(path, data)
+}
+
+// checksum returns the published sha256 of the named asset, verifying the checksum file's signature if required
+func (u *Updater) checksum(ctx context.Context, release *Release, name string) (string, error) {
+	asset, ok := release.asset(checksumsAsset)
+	if !ok {
+		return "", fmt.Errorf("release %s has no %s", release.Tag, checksumsAsset)
+	}
+	checksums, err := u.get(ctx, asset.URL)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", checksumsAsset, err)
+	}
+
+	if u.PublicKey != nil {
+		sigAsset, ok := release.asset(signatureAsset)
+		if !ok {
+			return "", fmt.Errorf("%w: release %s has no %s", ErrBadSignature, release.Tag, signatureAsset)
+		}
+		encoded, err := u.get(ctx, sigAsset.URL)
+		if err != nil {
+			return "", fmt.Errorf("failed to download %s: %w", signatureAsset, err)
+		}
+		sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+		if err != nil || !ed25519.Verify(u.PublicKey, checksums, sig) {
+			return "", fmt.Errorf("%w for %s", ErrBadSignature, checksumsAsset)
+		}
+	}
+
+	// Lines are "<sha256>  <name>" as written by sha256sum
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("%s has no entry for %s", checksumsAsset, name)
+}
+
+// get fetches url and returns the response body
+func (u *Updater) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// replace atomically replaces the file at path with data, keeping it executable
+func replace(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upgrade-ami-update-*")
+	if err != nil {
+		return fmt.Errorf("failed to write update: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write update: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write update: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return fmt.Errorf("failed to write update: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
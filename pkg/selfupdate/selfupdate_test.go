@@ -0,0 +1,293 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testRelease is a release served by an httptest server
+type testRelease struct {
+	binary    []byte          // served as BinaryName()
+	checksums string          // checksums.txt; computed from binary when empty
+	signature string          // checksums.txt.sig; not published when empty
+	omit      map[string]bool // asset names left out of the release
+}
+
+// serve starts a server publishing r as the latest release and returns an Updater for it
+func (r testRelease) serve(t *testing.T) *Updater {
+	t.Helper()
+	if r.checksums == "" {
+		sum := sha256.Sum256(r.binary)
+		r.checksums = fmt.Sprintf("%s  upgrade-ami_other_arch\n%s  %s\n",
+			strings.Repeat("0", 64), hex.EncodeToString(sum[:]), BinaryName())
+	}
+	assets := map[string][]byte{BinaryName(): r.binary, checksumsAsset: []byte(r.checksums)}
+	if r.signature != "" {
+		assets[signatureAsset] = []byte(r.signature)
+	}
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	var list []string
+	for name, data := range assets {
+		if r.omit[name] {
+			continue
+		}
+		list = append(list, fmt.Sprintf(`{"name": %q, "browser_download_url": %q}`, name, srv.URL+"/download/"+name))
+		mux.HandleFunc("/download/"+name, func(w http.ResponseWriter, _ *http.Request) { w.Write(data) })
+	}
+	mux.HandleFunc("/latest", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintf(w, `{"tag_name": "v1.2.3", "assets": [%s]}`, strings.Join(list, ","))
+	})
+
+	u, err := New(srv.URL+"/latest", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Client = srv.Client()
+	return u
+}
+
+// install fetches the latest release from u and installs it over a fake executable, returning its path
+func install(t *testing.T, u *Updater) (string, error) {
+	t.Helper()
+	ctx := context.Background()
+	release, err := u.Latest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "upgrade-ami")
+	if err := os.WriteFile(path, []byte("old binary"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path, u.Install(ctx, release, path)
+}
+
+// assertUnchanged fails unless the executable at path is still the old binary and no update file is left
+func assertUnchanged(t *testing.T, path string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "old binary" {
+		t.Errorf("executable = %q, %v; want it untouched", data, err)
+	}
+	assertNoLeftovers(t, filepath.Dir(path))
+}
+
+// assertNoLeftovers fails if dir holds anything besides the executable
+func assertNoLeftovers(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Name() != "upgrade-ami" {
+			t.Errorf("left %s behind", e.Name())
+		}
+	}
+}
+
+func TestInstall(t *testing.T) {
+	u := testRelease{binary: []byte("new binary")}.serve(t)
+	path, err := install(t, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "new binary" {
+		t.Errorf("executable = %q, %v; want the release binary", data, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0o755 {
+		t.Errorf("executable mode = %v, %v; want 0755", info.Mode(), err)
+	}
+	assertNoLeftovers(t, filepath.Dir(path))
+}
+
+func TestInstallChecksumMismatch(t *testing.T) {
+	u := testRelease{
+		binary:    []byte("tampered binary"),
+		checksums: fmt.Sprintf("%s  %s\n", strings.Repeat("ab", 32), BinaryName()),
+	}.serve(t)
+	path, err := install(t, u)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Install() error = %v, want ErrChecksumMismatch", err)
+	}
+	assertUnchanged(t, path)
+}
+
+func TestInstallNoChecksumEntry(t *testing.T) {
+	u := testRelease{
+		binary:    []byte("new binary"),
+		checksums: fmt.Sprintf("%s  upgrade-ami_other_arch\n", strings.Repeat("ab", 32)),
+	}.serve(t)
+	path, err := install(t, u)
+	if err == nil || !strings.Contains(err.Error(), "no entry for "+BinaryName()) {
+		t.Errorf("Install() error = %v, want a missing checksum entry", err)
+	}
+	assertUnchanged(t, path)
+}
+
+func TestInstallMissingAsset(t *testing.T) {
+	tests := []struct {
+		name  string
+		omit  string
+		error string
+	}{
+		{"binary", BinaryName(), "no binary for"},
+		{"checksums", checksumsAsset, "has no " + checksumsAsset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := testRelease{binary: []byte("new binary"), omit: map[string]bool{tt.omit: true}}.serve(t)
+			path, err := install(t, u)
+			if err == nil || !strings.Contains(err.Error(), tt.error) {
+				t.Errorf("Install() error = %v, want %q", err, tt.error)
+			}
+			assertUnchanged(t, path)
+		})
+	}
+}
+
+func TestInstallSignature(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherPrivate, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := []byte("new binary")
+	sum := sha256.Sum256(binary)
+	checksums := fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), BinaryName())
+	sign := func(key ed25519.PrivateKey, data string) string {
+		return base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(data))) + "\n"
+	}
+
+	tests := []struct {
+		name      string
+		signature string
+		wantErr   bool
+	}{
+		{"valid", sign(private, checksums), false},
+		{"missing", "", true},
+		{"other key", sign(otherPrivate, checksums), true},
+		{"other checksums", sign(private, strings.ToUpper(checksums)), true},
+		{"not base64", "not a signature\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := testRelease{binary: binary, checksums: checksums, signature: tt.signature}.serve(t)
+			u.PublicKey = public
+			path, err := install(t, u)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Install() error = %v", err)
+				}
+				if data, _ := os.ReadFile(path); string(data) != "new binary" {
+					t.Errorf("executable = %q, want the release binary", data)
+				}
+				return
+			}
+			if !errors.Is(err, ErrBadSignature) {
+				t.Errorf("Install() error = %v, want ErrBadSignature", err)
+			}
+			assertUnchanged(t, path)
+		})
+	}
+}
+
+func TestInstallUnsignedWithoutPublicKey(t *testing.T) {
+	// Without a public key a signature isn't required, nor checked when published
+	u := testRelease{binary: []byte("new binary"), signature: "not a signature\n"}.serve(t)
+	if _, err := install(t, u); err != nil {
+		t.Errorf("Install() error = %v", err)
+	}
+}
+
+func TestInstallDownloadError(t *testing.T) {
+	u := testRelease{binary: []byte("new binary")}.serve(t)
+	ctx := context.Background()
+	release, err := u.Latest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, a := range release.Assets {
+		if a.Name == BinaryName() {
+			release.Assets[i].URL += "-gone"
+		}
+	}
+	path := filepath.Join(t.TempDir(), "upgrade-ami")
+	if err := os.WriteFile(path, []byte("old binary"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Install(ctx, release, path); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Install() error = %v, want the download's status", err)
+	}
+	assertUnchanged(t, path)
+}
+
+func TestReplace(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "upgrade-ami")
+	if err := os.WriteFile(path, []byte("old binary"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A process running the old binary keeps reading it after the replacement
+	running, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer running.Close()
+
+	if err := replace(path, []byte("new binary")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "new binary" {
+		t.Errorf("replaced file = %q, %v", data, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o755 {
+		t.Errorf("replaced file mode = %v, %v; want 0755", info.Mode(), err)
+	}
+	old := make([]byte, 32)
+	if n, _ := running.Read(old); string(old[:n]) != "old binary" {
+		t.Errorf("open handle reads %q, want the old binary", old[:n])
+	}
+	assertNoLeftovers(t, dir)
+}
+
+func TestReplaceFailure(t *testing.T) {
+	dir := t.TempDir()
+	// A directory can't be renamed over, so the replacement fails after the update was written
+	path := filepath.Join(dir, "upgrade-ami")
+	if err := os.Mkdir(path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(path, "keep"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := replace(path, []byte("new binary")); err == nil {
+		t.Fatal("replace() succeeded over a directory")
+	}
+	assertNoLeftovers(t, dir)
+
+	if err := replace(filepath.Join(dir, "missing", "upgrade-ami"), []byte("new binary")); err == nil {
+		t.Error("replace() succeeded in a missing directory")
+	}
+}
@@ -0,0 +1,51 @@
+// Package share grants other AWS accounts launch permission on the AMIs a plan moves nodeclasses to, so
+// clusters in those accounts can run the same upgrade without a separate sharing pipeline
+package share
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/amis"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/retry"
+)
+
+// Images returns the AMIs of version v that the plan's changes select, sorted by name
+func Images(p *plan.Plan, v amis.VersionItem) []amis.AMIInfo {
+	selected := make(map[string]bool, len(p.Changes))
+	for _, ch := range p.Changes {
+		selected[ch.NewAMI] = true
+	}
+	var images []amis.AMIInfo
+	for _, image := range v.Images {
+		if selected[image.Name] {
+			images = append(images, image)
+		}
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].Name < images[j].Name
+	})
+	return images
+}
+
+// Grant gives the accounts launch permission on every image, retrying throttling and transient failures.
+// Every image is attempted; the failures are joined.
+func Grant(ctx context.Context, sharer clients.ImageSharer, images []amis.AMIInfo, accounts []string) error {
+	var errs []error
+	for _, image := range images {
+		err := retry.Do(ctx, retry.Default, func(ctx context.Context) error {
+			return sharer.ShareImage(ctx, image.ImageID, accounts)
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			errs = append(errs, fmt.Errorf("failed to share %s (%s): %w", image.ImageID, image.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,332 @@
+// Package simulate estimates what applying plans would do to a cluster: which nodeclaims would be replaced,
+// in which NodePools, and how long the rollout would take given the NodePools' disruption budgets and the
+// replacement times of past runs. It only reads; nothing is changed.
+package simulate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/history"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/naming"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/pods"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/report"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/requirements"
+)
+
+// DefaultReplacement is how long replacing one nodeclaim is assumed to take when no past run on the cluster
+// recorded a replacement
+const DefaultReplacement = 5 * time.Minute
+
+// DefaultBudget is the disruption budget Karpenter applies to NodePools that set none
+const DefaultBudget = "10%"
+
+// reasonDrifted is the disruption reason of nodeclaims replaced after their nodeclass's AMI changed
+const reasonDrifted = "Drifted"
+
+// Input is what a simulation is run on
+type Input struct {
+	Cluster    string
+	Plans      []*plan.Plan
+	Naming     naming.Provider // parses the new AMI names for the NodePool requirement check
+	NodeClaims []nodeclasses.NodeClaimStatus
+	NodePools  []nodeclasses.NodePool
+	History    []history.Run // past runs; only those on Cluster are used
+
+	// Pods by node and the PDBs, to simulate draining the nodes replaced; no drain is simulated when Pods
+	// is nil
+	Pods map[string]pods.PodList
+	PDBs pods.PodDisruptionBudgetList
+}
+
+// Pool is the impact of the plans on one NodePool
+type Pool struct {
+	Name            string   `json:"name"`        // empty for nodeclaims without a karpenter.sh/nodepool label
+	NodeClasses     []string `json:"nodeClasses"` // the changed nodeclasses with nodeclaims in the NodePool
+	NodeClaims      int      `json:"nodeClaims"`  // all nodeclaims of the NodePool
+	Replaced        int      `json:"replaced"`    // nodeclaims that drift once the plans are applied
+	Blocked         int      `json:"blocked"`     // of those, nodeclaims Karpenter currently cannot disrupt
+	Budget          string   `json:"budget"`      // the budget limiting drift replacements, e.g. 10%; empty when none does
+	Parallel        int      `json:"parallel"`    // nodeclaims replaced at once under the budget
+	Waves           int      `json:"waves"`       // rounds of Parallel replacements needed
+	EstimateSeconds float64  `json:"estimateSeconds"`
+	Stalled         bool     `json:"stalled,omitempty"` // the budget allows no drift replacements, so the rollout can't finish
+}
+
+// Report is the outcome of a simulation
+type Report struct {
+	Cluster            string                  `json:"cluster,omitempty"`
+	Plans              []*plan.Plan            `json:"plans"`
+	Pools              []Pool                  `json:"pools"`
+	Mismatches         []requirements.Mismatch `json:"mismatches"`
+	NodeClaims         int                     `json:"nodeClaims"` // replaced across NodePools
+	Blocked            int                     `json:"blocked"`
+	ReplacementSeconds float64                 `json:"replacementSeconds"` // per nodeclaim: the median of past replacements, or DefaultReplacement
+	ReplacementSamples int                     `json:"replacementSamples"` // past replacements the median is taken from
+	EstimateSeconds    float64                 `json:"estimateSeconds"`    // of the slowest NodePool, as NodePools are replaced concurrently
+	Stalled            []string                `json:"stalled,omitempty"`  // NodePools whose budgets allow no drift replacements
+	Drains             []pods.Drain            `json:"drains,omitempty"`   // of the nodes replaced, when simulated
+	Undrainable        int                     `json:"undrainable"`        // nodes that would currently fail to drain
+}
+
+// Simulate estimates the impact and duration of applying the plans of in. Terminating nodeclaims are
+// already on their way out and are not counted.
+func Simulate(in Input) *Report {
+	r := &Report{Cluster: in.Cluster, Plans: in.Plans, Pools: []Pool{}, Mismatches: []requirements.Mismatch{}}
+	for _, p := range in.Plans {
+		r.Mismatches = append(r.Mismatches, requirements.Check(p, in.Naming, in.NodePools)...)
+	}
+
+	replacement := DefaultReplacement
+	if past := pastReplacements(in.History, in.Cluster); len(past) > 0 {
+		replacement = history.Median(past)
+		r.ReplacementSamples = len(past)
+	}
+	r.ReplacementSeconds = replacement.Seconds()
+
+	changed := make(map[string]bool)
+	for _, p := range in.Plans {
+		for _, ch := range p.Changes {
+			changed[ch.NodeClass] = true
+		}
+	}
+	byName := make(map[string]*Pool)
+	var names []string
+	for _, st := range in.NodeClaims {
+		pool, ok := byName[st.NodePool]
+		if !ok {
+			pool = &Pool{Name: st.NodePool, NodeClasses: []string{}}
+			byName[st.NodePool] = pool
+			names = append(names, st.NodePool)
+		}
+		pool.NodeClaims++
+		if st.Terminating || !changed[st.NodeClass] {
+			continue
+		}
+		pool.Replaced++
+		if st.BlockedBy != "" {
+			pool.Blocked++
+		}
+		if !slices.Contains(pool.NodeClasses, st.NodeClass) {
+			pool.NodeClasses = append(pool.NodeClasses, st.NodeClass)
+		}
+	}
+	sort.Strings(names)
+
+	var slowest time.Duration
+	for _, name := range names {
+		pool := byName[name]
+		if pool.Replaced == 0 {
+			continue
+		}
+		sort.Strings(pool.NodeClasses)
+		np := nodeclasses.NodePool{}
+		np.Metadata.Name = name
+		for _, candidate := range in.NodePools {
+			if candidate.Metadata.Name == name {
+				np = candidate
+				break
+			}
+		}
+		pool.Parallel, pool.Budget = Parallel(np, pool.NodeClaims)
+		if pool.Parallel == 0 {
+			pool.Stalled = true
+			r.Stalled = append(r.Stalled, name)
+		} else {
+			pool.Waves = (pool.Replaced + pool.Parallel - 1) / pool.Parallel
+			estimate := time.Duration(pool.Waves) * replacement
+			pool.EstimateSeconds = estimate.Seconds()
+			slowest = max(slowest, estimate)
+		}
+		r.NodeClaims += pool.Replaced
+		r.Blocked += pool.Blocked
+		r.Pools = append(r.Pools, *pool)
+	}
+	r.EstimateSeconds = slowest.Seconds()
+
+	if in.Pods != nil {
+		r.Drains = Drains(in.Plans, in.NodeClaims, in.Pods, in.PDBs)
+		for _, d := range r.Drains {
+			if !d.Drainable() {
+				r.Undrainable++
+			}
+		}
+	}
+	return r
+}
+
+// Drains simulates draining the node of each nodeclaim the plans would replace, with the pods on it now
+func Drains(plans []*plan.Plan, statuses []nodeclasses.NodeClaimStatus, podsByNode map[string]pods.PodList, pdbs pods.PodDisruptionBudgetList) []pods.Drain {
+	changed := make(map[string]bool)
+	for _, p := range plans {
+		for _, ch := range p.Changes {
+			changed[ch.NodeClass] = true
+		}
+	}
+	drains := []pods.Drain{}
+	for _, st := range statuses {
+		if st.Terminating || st.NodeName == "" || !changed[st.NodeClass] {
+			continue
+		}
+		d := pods.SimulateDrain(st.NodeName, podsByNode[st.NodeName], pdbs)
+		d.NodeClaim = st.Name
+		drains = append(drains, d)
+	}
+	sort.Slice(drains, func(i, j int) bool { return drains[i].Node < drains[j].Node })
+	return drains
+}
+
+// Parallel returns how many of the NodePool's nodes, of which there are n, Karpenter replaces at once for
+// drift, and the budget that limits it. Budgets for other disruption reasons or only active in a scheduled
+// window don't limit it; a NodePool setting no budget gets Karpenter's DefaultBudget.
+func Parallel(np nodeclasses.NodePool, n int) (int, string) {
+	budgets := np.Spec.Disruption.Budgets
+	if len(budgets) == 0 {
+		budgets = []nodeclasses.Budget{{Nodes: DefaultBudget}}
+	}
+	parallel, limit := n, ""
+	for _, b := range budgets {
+		if b.Schedule != "" || (len(b.Reasons) > 0 && !slices.Contains(b.Reasons, reasonDrifted)) {
+			continue
+		}
+		allowed, ok := allowedNodes(b.Nodes, n)
+		if ok && (limit == "" || allowed < parallel) {
+			parallel, limit = allowed, b.Nodes
+		}
+	}
+	return parallel, limit
+}
+
+// allowedNodes resolves the nodes of a budget, a count or a percentage of n rounded up as Karpenter does
+func allowedNodes(nodes string, n int) (int, bool) {
+	if percent, ok := strings.CutSuffix(strings.TrimSpace(nodes), "%"); ok {
+		p, err := strconv.Atoi(percent)
+		if err != nil || p < 0 {
+			return 0, false
+		}
+		return int(math.Ceil(float64(p) * float64(n) / 100)), true
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(nodes))
+	if err != nil || count < 0 {
+		return 0, false
+	}
+	return count, true
+}
+
+// pastReplacements returns the replacement durations recorded by the runs on cluster
+func pastReplacements(runs []history.Run, cluster string) []time.Duration {
+	var durations []time.Duration
+	for _, run := range runs {
+		if run.Cluster == cluster {
+			durations = append(durations, history.ReplacementDurations(run.Resolutions)...)
+		}
+	}
+	return durations
+}
+
+// Write renders the report; the text rendering leaves the plans out, as they are printed on their own
+func Write(w io.Writer, format report.Format, r *Report) error {
+	if format == report.FormatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(r); err != nil {
+			return fmt.Errorf("failed to encode simulation: %w", err)
+		}
+		return nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintln(&b, "🧪 Simulation - Impact of applying the plans:")
+	fmt.Fprintln(&b, strings.Repeat("=", 80))
+	if r.Cluster != "" {
+		fmt.Fprintf(&b, "Cluster: %s\n", r.Cluster)
+	}
+	if r.ReplacementSamples > 0 {
+		fmt.Fprintf(&b, "Replacement time: %s per nodeclaim (median of %d past replacements)\n", duration(r.ReplacementSeconds), r.ReplacementSamples)
+	} else {
+		fmt.Fprintf(&b, "Replacement time: %s per nodeclaim (assumed; no past replacements recorded)\n", duration(r.ReplacementSeconds))
+	}
+	fmt.Fprintln(&b, strings.Repeat("-", 80))
+	if len(r.Pools) == 0 {
+		fmt.Fprintln(&b, "No nodeclaims would be replaced")
+	} else {
+		tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NODEPOOL\tNODECLASSES\tNODECLAIMS\tREPLACED\tBLOCKED\tBUDGET\tPARALLEL\tESTIMATE")
+		for _, pool := range r.Pools {
+			estimate := "never"
+			if !pool.Stalled {
+				estimate = fmt.Sprintf("%s (%d waves)", duration(pool.EstimateSeconds), pool.Waves)
+			}
+			budget := pool.Budget
+			if budget == "" {
+				budget = "none"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%s\t%d\t%s\n", unlabelled(pool.Name), strings.Join(pool.NodeClasses, ","),
+				pool.NodeClaims, pool.Replaced, pool.Blocked, budget, pool.Parallel, estimate)
+		}
+		tw.Flush()
+	}
+	if len(r.Mismatches) > 0 {
+		fmt.Fprintln(&b, strings.Repeat("-", 80))
+		for _, m := range r.Mismatches {
+			fmt.Fprintf(&b, "🛑 NodePool %s (nodeclass %s): %s\n", m.NodePool, m.NodeClass, m.Reason)
+		}
+	}
+	for _, name := range r.Stalled {
+		fmt.Fprintf(&b, "⚠️  The budgets of NodePool %s allow no drift replacements; its nodeclaims won't be replaced\n", unlabelled(name))
+	}
+	if r.Drains != nil {
+		fmt.Fprintln(&b, strings.Repeat("-", 80))
+		WriteDrains(&b, r.Drains)
+	}
+	fmt.Fprintln(&b, strings.Repeat("-", 80))
+	fmt.Fprintf(&b, "Nodeclaims replaced: %d (%d currently blocked from disruption)\n", r.NodeClaims, r.Blocked)
+	fmt.Fprintf(&b, "Estimated duration:  %s (NodePools are replaced concurrently)\n", duration(r.EstimateSeconds))
+	fmt.Fprintln(&b, strings.Repeat("=", 80))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteDrains summarizes simulated drains, detailing the nodes that would fail to drain
+func WriteDrains(w io.Writer, drains []pods.Drain) {
+	var failing []pods.Drain
+	for _, d := range drains {
+		if !d.Drainable() {
+			failing = append(failing, d)
+		}
+	}
+	if len(failing) == 0 {
+		fmt.Fprintf(w, "✅ All %d nodes replaced would drain now\n", len(drains))
+		return
+	}
+	fmt.Fprintf(w, "🛑 %d of %d nodes replaced would currently fail to drain:\n", len(failing), len(drains))
+	for _, d := range failing {
+		fmt.Fprintf(w, "  %s (nodeclaim %s):\n", d.Node, d.NodeClaim)
+		for _, b := range d.Blockers {
+			fmt.Fprintf(w, "    %s: %s\n", b.Pod, b.Reason)
+		}
+	}
+}
+
+// duration formats a duration in seconds, e.g. "27m0s"
+func duration(s float64) string {
+	return time.Duration(s * float64(time.Second)).Round(time.Second).String()
+}
+
+// unlabelled names the pseudo NodePool of nodeclaims without a karpenter.sh/nodepool label
+func unlabelled(name string) string {
+	if name == "" {
+		return "(unlabelled)"
+	}
+	return name
+}
@@ -0,0 +1,203 @@
+// Package status reconciles the AMIs each EC2NodeClass selects with the AMIs its nodes actually run, to
+// find pools whose spec was updated but whose nodes never rolled
+package status
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/amis"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+)
+
+// DefaultStaleAfter is how long nodes may keep running a replaced AMI before their pool is flagged stale
+const DefaultStaleAfter = 24 * time.Hour
+
+// State is how the nodes of a nodeclass compare with the AMIs it selects
+type State string
+
+// Nodeclass states
+const (
+	StateInSync     State = "in-sync"    // every node runs a selected AMI
+	StateRolling    State = "rolling"    // nodes on other AMIs are drifted and were flagged recently
+	StateStale      State = "stale"      // nodes run other AMIs long after drift was flagged, or without being flagged at all
+	StateNoNodes    State = "no-nodes"   // the nodeclass has no nodeclaims
+	StateUnresolved State = "unresolved" // the selected AMIs are unknown, so the nodes cannot be compared
+)
+
+// NodeClass compares one nodeclass's selected AMIs with its nodes
+type NodeClass struct {
+	Name         string         `json:"name"`
+	State        State          `json:"state"`
+	AMISelector  string         `json:"amiSelector"`
+	SelectedAMIs []string       `json:"selectedAMIs"`          // image IDs the selector resolves to
+	Nodes        int            `json:"nodes"`                 // nodeclaims with a known image
+	OutdatedAMIs map[string]int `json:"outdatedAMIs"`          // image ID -> nodeclaims running it although it isn't selected
+	Outdated     int            `json:"outdated"`              // nodeclaims running an AMI that isn't selected
+	Undrifted    int            `json:"undrifted"`             // outdated nodeclaims Karpenter has not flagged as drifted
+	DriftedSince time.Time      `json:"driftedSince,omitzero"` // earliest drift of an outdated nodeclaim
+}
+
+// Status is the reconciliation of every nodeclass of a cluster
+type Status struct {
+	Cluster           string            `json:"cluster"`
+	GeneratedAt       time.Time         `json:"generatedAt"`
+	StaleAfter        time.Duration     `json:"-"`
+	StaleAfterSeconds float64           `json:"staleAfterSeconds"`
+	NodeClasses       []NodeClass       `json:"nodeClasses"`
+	AMINames          map[string]string `json:"amiNames,omitempty"` // image ID -> name, where known
+	Warnings          []string          `json:"warnings,omitempty"` // information that could not be collected
+}
+
+// Stale returns the names of the nodeclasses whose nodes never rolled
+func (s *Status) Stale() []string {
+	var names []string
+	for _, nc := range s.NodeClasses {
+		if nc.State == StateStale {
+			names = append(names, nc.Name)
+		}
+	}
+	return names
+}
+
+// Collect compares the AMIs each nodeclass selects with the images its nodeclaims report, as of now.
+// The selected AMIs come from the nodeclass status; when Karpenter has not resolved them, a selector
+// naming a single AMI is looked up in EC2. Nodes on other AMIs are stale when they were flagged as drifted
+// more than staleAfter ago, or not flagged at all.
+func Collect(ctx context.Context, cs clients.Set, now time.Time, staleAfter time.Duration) (*Status, error) {
+	cluster, err := nodeclasses.CurrentContext(ctx, cs.Kube)
+	if err != nil {
+		return nil, err
+	}
+	list, err := nodeclasses.GetEC2NodeClasses(ctx, cs.Kube)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Status{
+		Cluster:           cluster,
+		GeneratedAt:       now,
+		StaleAfter:        staleAfter,
+		StaleAfterSeconds: staleAfter.Seconds(),
+		AMINames:          make(map[string]string),
+	}
+	images, warnings := ownerImages(ctx, cs.EC2, list)
+	s.Warnings = warnings
+	for _, image := range images {
+		s.AMINames[image.ImageID] = image.Name
+	}
+
+	byName := make(map[string]*NodeClass)
+	selected := make(map[string]map[string]bool) // nodeclass -> selected image IDs
+	for _, nc := range list.Items {
+		item := NodeClass{Name: nc.Metadata.Name, SelectedAMIs: []string{}, OutdatedAMIs: make(map[string]int)}
+		ids := make(map[string]bool)
+		for _, ami := range nc.Status.AMIs {
+			ids[ami.ID] = true
+			s.AMINames[ami.ID] = ami.Name
+		}
+		if len(nc.Spec.AMISelectorTerms) > 0 {
+			item.AMISelector = nc.AMIName()
+			if len(ids) == 0 {
+				for _, image := range images {
+					if image.Name == item.AMISelector {
+						ids[image.ImageID] = true
+					}
+				}
+			}
+		}
+		for id := range ids {
+			item.SelectedAMIs = append(item.SelectedAMIs, id)
+		}
+		sort.Strings(item.SelectedAMIs)
+		s.NodeClasses = append(s.NodeClasses, item)
+		selected[item.Name] = ids
+	}
+	sort.Slice(s.NodeClasses, func(i, j int) bool {
+		return s.NodeClasses[i].Name < s.NodeClasses[j].Name
+	})
+	for i := range s.NodeClasses {
+		byName[s.NodeClasses[i].Name] = &s.NodeClasses[i]
+	}
+
+	err = nodeclasses.EachNodeClaim(ctx, cs.Kube, func(claim nodeclasses.NodeClaim) error {
+		item, ok := byName[claim.Spec.NodeClassRef.Name]
+		if !ok || claim.Status.ImageID == "" || claim.Metadata.DeletionTimestamp != nil {
+			return nil
+		}
+		item.Nodes++
+		if selected[item.Name][claim.Status.ImageID] {
+			return nil
+		}
+		item.Outdated++
+		item.OutdatedAMIs[claim.Status.ImageID]++
+		if since, ok := driftedSince(claim); ok {
+			if item.DriftedSince.IsZero() || since.Before(item.DriftedSince) {
+				item.DriftedSince = since
+			}
+		} else {
+			item.Undrifted++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range s.NodeClasses {
+		s.NodeClasses[i].State = state(s.NodeClasses[i], now, staleAfter)
+	}
+	return s, nil
+}
+
+// state classifies a nodeclass as of now
+func state(nc NodeClass, now time.Time, staleAfter time.Duration) State {
+	switch {
+	case nc.Nodes == 0:
+		return StateNoNodes
+	case len(nc.SelectedAMIs) == 0:
+		return StateUnresolved
+	case nc.Outdated == 0:
+		return StateInSync
+	case nc.Undrifted > 0 || now.Sub(nc.DriftedSince) > staleAfter:
+		return StateStale
+	}
+	return StateRolling
+}
+
+// driftedSince returns when the nodeclaim was flagged as drifted, if it is
+func driftedSince(claim nodeclasses.NodeClaim) (time.Time, bool) {
+	for _, condition := range claim.Status.Conditions {
+		if (condition.Type == "Drifted" || condition.Type == "Drift") && condition.Status == "True" {
+			return condition.LastTransitionTime, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ownerImages returns the images of the AMI owners the nodeclasses select from, reporting owners whose
+// images cannot be listed as warnings
+func ownerImages(ctx context.Context, ec2 clients.EC2Client, list nodeclasses.NodeClassList) ([]amis.AMIInfo, []string) {
+	owners := make(map[string]bool)
+	for _, nc := range list.Items {
+		if len(nc.Spec.AMISelectorTerms) > 0 && nc.AMIOwner() != "" {
+			owners[nc.AMIOwner()] = true
+		}
+	}
+
+	var images []amis.AMIInfo
+	var warnings []string
+	for owner := range owners {
+		found, err := amis.GetAvailableAMIs(ctx, ec2, owner)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("AMIs of owner %s unavailable: %v", owner, err))
+			continue
+		}
+		images = append(images, found...)
+	}
+	sort.Strings(warnings)
+	return images, warnings
+}
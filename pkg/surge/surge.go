@@ -0,0 +1,174 @@
+// Package surge temporarily raises the limits of the NodePools a rollout replaces nodes in, so replacement
+// capacity can come up before the old nodes drain instead of leaving pods Pending on tightly-packed clusters
+package surge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/retry"
+)
+
+// ErrLimitsChanged is returned by Restore for NodePools whose limits were changed while they were raised;
+// they are left as they are
+var ErrLimitsChanged = errors.New("nodepool limits changed during the surge")
+
+// ParsePercent parses a surge such as "20%" or "20"
+func ParsePercent(s string) (float64, error) {
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil || percent <= 0 || math.IsInf(percent, 0) {
+		return 0, fmt.Errorf("invalid surge %q (want a positive percentage, e.g. 20%%)", s)
+	}
+	return percent, nil
+}
+
+// Scale multiplies a Kubernetes resource quantity such as 1000, 500m or 2000Gi by factor, keeping its
+// suffix. Whole quantities are rounded up, so a surge never rounds down to no surge.
+func Scale(quantity string, factor float64) (string, error) {
+	number := strings.TrimRightFunc(quantity, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	suffix := quantity[len(number):]
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || !validSuffix(suffix) {
+		return "", fmt.Errorf("unsupported quantity %q", quantity)
+	}
+
+	scaled := value * factor
+	if value == math.Trunc(value) {
+		scaled = math.Ceil(scaled)
+	} else {
+		scaled = math.Round(scaled*1000) / 1000 // quantities have milli precision
+	}
+	return strconv.FormatFloat(scaled, 'f', -1, 64) + suffix, nil
+}
+
+// validSuffix reports whether suffix is a decimal or binary SI suffix of a resource quantity
+func validSuffix(suffix string) bool {
+	switch suffix {
+	case "", "m", "k", "M", "G", "T", "P", "E", "Ki", "Mi", "Gi", "Ti", "Pi", "Ei":
+		return true
+	}
+	return false
+}
+
+// Raised is a NodePool whose limits were raised
+type Raised struct {
+	NodePool string
+	Original map[string]string // resource -> limit before the surge
+	Surged   map[string]string // resource -> limit during the surge
+}
+
+// Surge is a raise of NodePool limits in effect until Restore
+type Surge struct {
+	Kube    clients.KubeClient
+	Percent float64
+	Raised  []Raised
+}
+
+// Raise raises the limits of every NodePool launching nodes of the given nodeclasses by percent. NodePools
+// without limits can already grow and are left alone. If a NodePool fails, the ones raised so far are
+// still returned so they can be restored.
+func Raise(ctx context.Context, kube clients.KubeClient, nodeClasses []string, percent float64) (*Surge, error) {
+	nodePools, err := nodeclasses.GetNodePools(ctx, kube)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Surge{Kube: kube, Percent: percent}
+	for _, np := range nodePools {
+		if !slices.Contains(nodeClasses, np.Spec.Template.Spec.NodeClassRef.Name) {
+			continue
+		}
+		raised := Raised{NodePool: np.Metadata.Name}
+		err := updateLimits(ctx, kube, np.Metadata.Name, func(limits map[string]string) (map[string]string, error) {
+			if len(limits) == 0 {
+				return nil, nil
+			}
+			surged := make(map[string]string, len(limits))
+			for resource, limit := range limits {
+				scaled, err := Scale(limit, 1+percent/100)
+				if err != nil {
+					return nil, fmt.Errorf("limit %s: %w", resource, err)
+				}
+				surged[resource] = scaled
+			}
+			raised.Original, raised.Surged = limits, surged
+			return surged, nil
+		})
+		if err != nil {
+			return s, err
+		}
+		if raised.Surged != nil {
+			s.Raised = append(s.Raised, raised)
+		}
+	}
+	return s, nil
+}
+
+// Restore sets the raised NodePools back to their original limits. NodePools whose limits were changed by
+// someone else in the meantime keep them and are reported with ErrLimitsChanged.
+func (s *Surge) Restore(ctx context.Context) error {
+	var errs []error
+	for _, r := range s.Raised {
+		err := updateLimits(ctx, s.Kube, r.NodePool, func(limits map[string]string) (map[string]string, error) {
+			if !maps.Equal(limits, r.Surged) {
+				return nil, fmt.Errorf("%w: %s", ErrLimitsChanged, r.NodePool)
+			}
+			return r.Original, nil
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// updateLimits replaces spec.limits of the NodePool with the limits update returns for the current ones,
+// retrying conflicts and transient failures. A nil result leaves the NodePool unchanged.
+func updateLimits(ctx context.Context, kube clients.KubeClient, name string, update func(map[string]string) (map[string]string, error)) error {
+	return retry.Do(ctx, retry.Default, func(ctx context.Context) error {
+		output, err := kube.Get(ctx, "nodepools.karpenter.sh", name)
+		if err != nil {
+			return fmt.Errorf("failed to get nodepool %s: %w", name, err)
+		}
+		var nodePool map[string]interface{}
+		if err := json.Unmarshal(output, &nodePool); err != nil {
+			return fmt.Errorf("failed to parse nodepool JSON: %w", err)
+		}
+		spec, ok := nodePool["spec"].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%w: nodepool %s has no spec", clients.ErrUnexpectedSchema, name)
+		}
+
+		limits := make(map[string]string)
+		if current, ok := spec["limits"].(map[string]interface{}); ok {
+			for resource, limit := range current {
+				limits[resource] = fmt.Sprint(limit)
+			}
+		}
+		updated, err := update(limits)
+		if err != nil || updated == nil {
+			return err
+		}
+		spec["limits"] = updated
+
+		data, err := json.Marshal(nodePool)
+		if err != nil {
+			return fmt.Errorf("failed to marshal updated JSON: %w", err)
+		}
+		if err := kube.Apply(ctx, data); err != nil {
+			return fmt.Errorf("failed to update nodepool %s: %w", name, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,106 @@
+// Package throttle replaces the drifted nodeclaims of the nodeclasses an upgrade changed itself, deleting them
+// a few at a time per nodeclass, so a single number sets how aggressive a rollout is. Karpenter still replaces
+// drifted nodeclaims within its NodePools' disruption budgets; its replacements count towards the limit, so
+// the throttle only adds deletions while a nodeclass has room.
+package throttle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/retry"
+)
+
+// ErrUnsupported is returned when the KubeClient cannot delete nodeclaims
+var ErrUnsupported = errors.New("the Kubernetes client cannot delete nodeclaims")
+
+// Throttle deletes the drifted nodeclaims of nodeclasses while fewer than MaxUnavailable of each nodeclass's
+// nodeclaims are unavailable
+type Throttle struct {
+	Kube           clients.KubeClient
+	MaxUnavailable int       // nodeclaims per nodeclass that may be replaced at once
+	NodeClasses    []string  // nodeclasses whose nodeclaims are replaced
+	Since          time.Time // when the nodeclasses were updated; nodeclaims launched since are replacements
+
+	deleted map[string]bool // nodeclaims deleted and not yet seen terminating or gone
+}
+
+// New creates a Throttle replacing up to maxUnavailable nodeclaims of each of the nodeclasses at once
+func New(kube clients.KubeClient, maxUnavailable int, nodeClasses []string, since time.Time) *Throttle {
+	return &Throttle{Kube: kube, MaxUnavailable: maxUnavailable, NodeClasses: nodeClasses, Since: since}
+}
+
+// Step deletes drifted nodeclaims, oldest first, until each nodeclass has MaxUnavailable nodeclaims
+// unavailable: being deleted, or launched since Since and not ready yet. It is given the nodeclaims of each
+// poll and returns the nodeclaims it deleted. Failures to delete a nodeclaim are joined and don't stop the
+// others.
+func (t *Throttle) Step(ctx context.Context, statuses []nodeclasses.NodeClaimStatus) ([]string, error) {
+	deleter, ok := t.Kube.(clients.Deleter)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	changed := make(map[string]bool, len(t.NodeClasses))
+	for _, name := range t.NodeClasses {
+		changed[name] = true
+	}
+	if t.deleted == nil {
+		t.deleted = make(map[string]bool)
+	}
+
+	present := make(map[string]bool, len(statuses))
+	unavailable := make(map[string]int)
+	candidates := make(map[string][]nodeclasses.NodeClaimStatus)
+	for _, s := range statuses {
+		present[s.Name] = true
+		if s.Terminating {
+			delete(t.deleted, s.Name)
+		}
+		if !changed[s.NodeClass] {
+			continue
+		}
+		switch {
+		case s.Terminating || t.deleted[s.Name]:
+			unavailable[s.NodeClass]++
+		case s.Created.After(t.Since) && !s.Conditions["Ready"]:
+			unavailable[s.NodeClass]++
+		case s.Drifted:
+			candidates[s.NodeClass] = append(candidates[s.NodeClass], s)
+		}
+	}
+	for name := range t.deleted {
+		if !present[name] {
+			delete(t.deleted, name)
+		}
+	}
+
+	var deleted []string
+	var errs []error
+	for _, nodeClass := range t.NodeClasses {
+		drifted := candidates[nodeClass]
+		sort.Slice(drifted, func(i, j int) bool { return drifted[i].Created.Before(drifted[j].Created) })
+		for _, s := range drifted {
+			if unavailable[nodeClass] >= t.MaxUnavailable {
+				break
+			}
+			err := retry.Do(ctx, retry.Default, func(ctx context.Context) error {
+				return deleter.Delete(ctx, "nodeclaims.karpenter.sh", s.Name)
+			})
+			if err != nil {
+				if ctx.Err() != nil {
+					return deleted, ctx.Err()
+				}
+				errs = append(errs, fmt.Errorf("failed to delete nodeclaim %s: %w", s.Name, err))
+				continue
+			}
+			t.deleted[s.Name] = true
+			unavailable[nodeClass]++
+			deleted = append(deleted, s.Name)
+		}
+	}
+	return deleted, errors.Join(errs...)
+}
@@ -0,0 +1,160 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+)
+
+// DefaultConcurrency is how many nodeclasses are updated at once by default
+const DefaultConcurrency = 5
+
+// Applier applies upgrade plans to the cluster
+type Applier struct {
+	Kube            clients.KubeClient
+	Concurrency     int  // maximum simultaneous updates; values below 1 mean one at a time
+	ContinueOnError bool // keep starting updates after one failed instead of stopping
+
+	// Overwrite updates nodeclasses that no longer select the OldAMI of their change, e.g. to revert;
+	// otherwise such updates fail with nodeclasses.ErrConflict, leaving the change made another way
+	Overwrite bool
+
+	// Annotations are set on every nodeclass the Applier updates, e.g. nodeclasses.UpdatedByAnnotation
+	Annotations map[string]string
+
+	// OnApplied, when set, is called after each successful update, possibly from several goroutines at once
+	OnApplied func(plan.Change)
+}
+
+// NewApplier creates an Applier using the given Kubernetes client
+func NewApplier(kube clients.KubeClient) *Applier {
+	return &Applier{Kube: kube, Concurrency: DefaultConcurrency}
+}
+
+// ChangeResult is the outcome of applying one change
+type ChangeResult struct {
+	plan.Change
+	Err     error // nil on success
+	Applied bool  // false if the change was not attempted because ctx was cancelled or an earlier change failed
+}
+
+// ApplyAll applies several plans, e.g. one per Kubernetes version of the cluster, as if they were one:
+// results are returned in plan order, and a failure in one plan stops the changes of the others
+func (a *Applier) ApplyAll(ctx context.Context, plans []*plan.Plan) ([]ChangeResult, error) {
+	combined := &plan.Plan{}
+	for _, p := range plans {
+		combined.Changes = append(combined.Changes, p.Changes...)
+	}
+	return a.Apply(ctx, combined)
+}
+
+// Apply updates the nodeclasses of the plan concurrently, returning one result per change in plan order.
+// After a failed update, changes not yet started are skipped unless ContinueOnError is set; updates
+// already in flight still finish. Failures are returned together as a *nodeclasses.ApplyError (matching
+// nodeclasses.ErrPartialApply); nodeclasses changed another way since the plan was made fail with
+// nodeclasses.ErrConflict unless Overwrite is set. If ctx is cancelled, changes not yet started are skipped
+// and ctx's error is returned.
+func (a *Applier) Apply(ctx context.Context, p *plan.Plan) ([]ChangeResult, error) {
+	results := make([]ChangeResult, len(p.Changes))
+	var failed atomic.Bool
+
+	var g errgroup.Group
+	g.SetLimit(max(a.Concurrency, 1))
+	for i, ch := range p.Changes {
+		results[i].Change = ch
+		g.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				results[i].Err = err
+				return nil
+			}
+			if failed.Load() && !a.ContinueOnError {
+				return nil
+			}
+			results[i].Applied = true
+			u := nodeclasses.Update{
+				NewAMI:      ch.NewAMI,
+				NewAMIID:    ch.NewAMIID,
+				AMIFamily:   ch.NewAMIFamily,
+				Owner:       ch.NewOwner,
+				Annotations: a.Annotations,
+			}
+			if !a.Overwrite {
+				u.ExpectAMI = ch.OldAMI
+				if ch.NewAMIFamily != "" {
+					u.ExpectAMIFamily = ch.OldAMIFamily
+				}
+			}
+			results[i].Err = nodeclasses.UpdateNodeClassWith(ctx, a.Kube, ch.NodeClass, u)
+			if results[i].Err != nil {
+				failed.Store(true)
+			} else if a.OnApplied != nil {
+				a.OnApplied(ch)
+			}
+			return nil
+		})
+	}
+	g.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return results, err
+	}
+	return results, ResultsError(results)
+}
+
+// ResultsError returns the failed updates of results as a *nodeclasses.ApplyError, or nil when none failed
+func ResultsError(results []ChangeResult) error {
+	applyErr := &nodeclasses.ApplyError{}
+	for _, r := range results {
+		if !r.Applied {
+			applyErr.NotAttempted++
+			continue
+		}
+		if r.Err != nil {
+			applyErr.Failed = append(applyErr.Failed, nodeclasses.ItemError{NodeClass: r.NodeClass, Err: r.Err})
+			continue
+		}
+		applyErr.Succeeded++
+	}
+
+	if len(applyErr.Failed) > 0 {
+		return applyErr
+	}
+	return nil
+}
+
+// Revert undoes the changes of a partially failed apply: every nodeclass whose update was attempted is moved
+// back to its old AMI, and amiFamily and owner if the change set them. Failed updates are reverted too, since
+// a failure may have been reported after the API server accepted the change; reverting a nodeclass that was
+// never changed leaves it as it is. Updates that failed with nodeclasses.ErrConflict are not reverted. Every
+// revert is attempted; results are in the order of results.
+func (a *Applier) Revert(ctx context.Context, results []ChangeResult) ([]ChangeResult, error) {
+	inverse := &plan.Plan{}
+	for _, r := range results {
+		// An update that failed with a conflict left the other change in place
+		if !r.Applied || errors.Is(r.Err, nodeclasses.ErrConflict) {
+			continue
+		}
+		inverse.Changes = append(inverse.Changes, plan.Change{
+			NodeClass:    r.NodeClass,
+			OldAMI:       r.NewAMI,
+			NewAMI:       r.OldAMI,
+			OldAMIFamily: r.NewAMIFamily,
+			NewAMIFamily: r.OldAMIFamily,
+			OldOwner:     r.NewOwner,
+			NewOwner:     r.OldOwner,
+		})
+	}
+	reverter := NewApplier(a.Kube)
+	reverter.Concurrency = a.Concurrency
+	reverter.ContinueOnError = true
+	// A failed update may have left the nodeclass on its old AMI, which the inverse change doesn't expect
+	reverter.Overwrite = true
+	reverter.Annotations = a.Annotations
+	return reverter.Apply(ctx, inverse)
+}
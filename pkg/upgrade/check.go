@@ -0,0 +1,87 @@
+package upgrade
+
+import (
+	"sort"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/amis"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+)
+
+// NodeClassCheck is how far a nodeclass is behind the newest eligible version of its Kubernetes version
+type NodeClassCheck struct {
+	NodeClass  string `json:"nodeClass"`
+	K8sVersion string `json:"k8sVersion"`
+	Channel    string `json:"channel,omitempty"` // AMI channel the nodeclass tracks; the default source when empty
+	Current    string `json:"current,omitempty"` // version the nodeclass runs; empty when it cannot be determined
+	Newest     string `json:"newest,omitempty"`  // newest eligible version; empty when none is eligible
+	Newer      int    `json:"newer"`             // eligible versions newer than Current
+}
+
+// UpToDate reports whether the nodeclass runs the newest eligible version (or one newer)
+func (c NodeClassCheck) UpToDate() bool {
+	return c.Newest == "" || (c.Current != "" && c.Newer == 0)
+}
+
+// CheckResult is the outcome of comparing the nodeclasses with the eligible versions
+type CheckResult struct {
+	NodeClasses []NodeClassCheck `json:"nodeClasses"`
+}
+
+// UpToDate reports whether every nodeclass runs the newest eligible version
+func (r *CheckResult) UpToDate() bool {
+	for _, c := range r.NodeClasses {
+		if !c.UpToDate() {
+			return false
+		}
+	}
+	return true
+}
+
+// Check compares the version each discovered nodeclass runs with the eligible versions of its Kubernetes
+// version, e.g. those returned by AllVersions that pass the provenance and findings policies. Wildcard
+// selectors are judged by the AMIs Karpenter resolved them to; nodeclasses whose version cannot be
+// determined count as behind. Nodeclasses with unparseable AMI names are left out.
+func (p *Planner) Check(d *Discovery, eligible []amis.VersionItem) *CheckResult {
+	result := &CheckResult{NodeClasses: []NodeClassCheck{}}
+	for _, nc := range d.NodeClasses.Items {
+		k8sVersion, ok := d.K8sVersions[nc.Metadata.Name]
+		if !ok {
+			continue
+		}
+
+		c := NodeClassCheck{NodeClass: nc.Metadata.Name, K8sVersion: k8sVersion, Channel: d.Channel, Current: p.currentVersion(nc)}
+		for _, v := range eligible {
+			if v.K8sVersion != k8sVersion {
+				continue
+			}
+			if c.Newest == "" || amis.CompareVersions(v.Version, c.Newest) > 0 {
+				c.Newest = v.Version
+			}
+			if c.Current == "" || amis.CompareVersions(v.Version, c.Current) > 0 {
+				c.Newer++
+			}
+		}
+		result.NodeClasses = append(result.NodeClasses, c)
+	}
+
+	sort.Slice(result.NodeClasses, func(i, j int) bool {
+		return result.NodeClasses[i].NodeClass < result.NodeClasses[j].NodeClass
+	})
+	return result
+}
+
+// currentVersion returns the version of the nodeclass's AMI selector or, for a wildcard, the newest
+// version among the AMIs it resolved to
+func (p *Planner) currentVersion(nc nodeclasses.EC2NodeClass) string {
+	if pattern, err := nodeclasses.ParseAMIName(p.Naming, nc.AMIName()); err == nil && pattern.Version != "" {
+		return pattern.Version
+	}
+	var current string
+	for _, ami := range nc.Status.AMIs {
+		fields, ok := p.Naming.Parse(ami.Name)
+		if ok && fields.Version != "" && (current == "" || amis.CompareVersions(fields.Version, current) > 0) {
+			current = fields.Version
+		}
+	}
+	return current
+}
@@ -0,0 +1,315 @@
+//go:build envtest
+
+// The envtest suite runs the plan/apply/monitor workflow against a real API server with the Karpenter CRDs,
+// through both Kubernetes clients. It needs the kube-apiserver and etcd binaries of envtest: run it with
+// make test-envtest, which downloads them and sets KUBEBUILDER_ASSETS.
+package upgrade_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/cadence"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients/fake"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/naming"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/upgrade"
+)
+
+const owner = "123456789012"
+
+var (
+	ec2NodeClasses = schema.GroupVersionResource{Group: "karpenter.k8s.aws", Version: "v1", Resource: "ec2nodeclasses"}
+	nodeClaims     = schema.GroupVersionResource{Group: "karpenter.sh", Version: "v1", Resource: "nodeclaims"}
+)
+
+// cluster is the dynamic client of the envtest API server, used to seed objects and inspect the outcome;
+// nil when the envtest binaries are not available
+var cluster dynamic.Interface
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	assets := os.Getenv("KUBEBUILDER_ASSETS")
+	if assets == "" {
+		fmt.Println("KUBEBUILDER_ASSETS is not set; skipping the envtest suite (run make test-envtest)")
+		return m.Run()
+	}
+
+	env := &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("testdata", "crds")},
+		ErrorIfCRDPathMissing: true,
+	}
+	cfg, err := env.Start()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to start envtest: %v\n", err)
+		return 1
+	}
+	defer env.Stop()
+
+	cluster, err = dynamic.NewForConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create the dynamic client: %v\n", err)
+		return 1
+	}
+
+	// Both Kubernetes clients read the kubeconfig kubectl would, so point KUBECONFIG at an admin of the
+	// envtest API server. The envtest assets include a kubectl matching the API server.
+	user, err := env.AddUser(envtest.User{Name: "upgrade-ami", Groups: []string{"system:masters"}}, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to add the envtest user: %v\n", err)
+		return 1
+	}
+	kubeconfig, err := user.KubeConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write the kubeconfig: %v\n", err)
+		return 1
+	}
+	dir, err := os.MkdirTemp("", "upgrade-ami-envtest")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "kubeconfig")
+	if err := os.WriteFile(path, kubeconfig, 0o600); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	os.Setenv("KUBECONFIG", path)
+	os.Setenv("PATH", assets+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	return m.Run()
+}
+
+// kubeClients are the Kubernetes clients the workflow is exercised with
+func kubeClients(t *testing.T) map[string]clients.KubeClient {
+	if cluster == nil {
+		t.Skip("KUBEBUILDER_ASSETS is not set")
+	}
+	kubes := map[string]clients.KubeClient{"client-go": clients.NewKubernetes()}
+	if _, err := exec.LookPath("kubectl"); err == nil {
+		kubes["kubectl"] = clients.NewKubectl()
+	}
+	return kubes
+}
+
+func TestPlanApplyMonitor(t *testing.T) {
+	for name, kube := range kubeClients(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+			defer cancel()
+
+			seedNodeClass(ctx, t, name+"-default", "domino-eks-1.33-v20250901")
+			seedNodeClass(ctx, t, name+"-gpu", "domino-eks-gpu-large-1.33-v20250901")
+			seedNodeClaim(ctx, t, name+"-claim-default", name+"-default", true)
+			seedNodeClaim(ctx, t, name+"-claim-gpu", name+"-gpu", true)
+
+			ec2 := fake.NewEC2Client()
+			ec2.Images[owner] = []clients.Image{
+				{Name: "domino-eks-1.33-v20250901", ImageID: "ami-0000000000000001", CreationDate: "2025-09-01T00:00:00Z"},
+				{Name: "domino-eks-gpu-large-1.33-v20250901", ImageID: "ami-0000000000000002", CreationDate: "2025-09-01T00:00:00Z"},
+				{Name: "domino-eks-1.33-v20251001", ImageID: "ami-0000000000000003", CreationDate: "2025-10-01T00:00:00Z"},
+				{Name: "domino-eks-gpu-large-1.33-v20251001", ImageID: "ami-0000000000000004", CreationDate: "2025-10-01T00:00:00Z"},
+			}
+			cs := clients.Set{Kube: kube, EC2: ec2}
+
+			// Plan
+			planner := upgrade.NewPlanner(cs, naming.Default)
+			d, err := planner.Discover(ctx)
+			if err != nil {
+				t.Fatalf("Discover: %v", err)
+			}
+			versions, err := planner.AvailableVersions(ctx, d)
+			if err != nil {
+				t.Fatalf("AvailableVersions: %v", err)
+			}
+			if versions[0].Version != "20251001" {
+				t.Fatalf("newest version = %s, want 20251001", versions[0].Version)
+			}
+			p := planner.Plan(d, versions[0].Version)
+			want := map[string]string{
+				name + "-default": "domino-eks-1.33-v20251001",
+				name + "-gpu":     "domino-eks-gpu-large-1.33-v20251001",
+			}
+			for _, ch := range p.Changes {
+				if w, ok := want[ch.NodeClass]; ok && ch.NewAMI != w {
+					t.Errorf("planned %s -> %s, want %s", ch.NodeClass, ch.NewAMI, w)
+				}
+			}
+			if err := planner.Verify(ctx, p); err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+
+			// Apply
+			applier := upgrade.NewApplier(kube)
+			applier.Annotations = map[string]string{nodeclasses.RunIDAnnotation: "envtest"}
+			if _, err := applier.Apply(ctx, p); err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			for nc, ami := range want {
+				obj := getNodeClass(ctx, t, nc)
+				terms, _, _ := unstructured.NestedSlice(obj.Object, "spec", "amiSelectorTerms")
+				if got := terms[0].(map[string]interface{})["name"]; got != ami {
+					t.Errorf("nodeclass %s selects %v, want %s", nc, got, ami)
+				}
+				if role, _, _ := unstructured.NestedString(obj.Object, "spec", "role"); role != "KarpenterNodeRole" {
+					t.Errorf("nodeclass %s lost its role: %q", nc, role)
+				}
+				if got := obj.GetAnnotations()[nodeclasses.RunIDAnnotation]; got != "envtest" {
+					t.Errorf("nodeclass %s run ID = %q, want envtest", nc, got)
+				}
+			}
+
+			// Applying the same plan again conflicts, since the nodeclasses no longer select the old AMIs
+			if _, err := applier.Apply(ctx, p); !errors.Is(err, nodeclasses.ErrConflict) {
+				t.Errorf("second Apply error = %v, want ErrConflict", err)
+			}
+
+			// Monitor until Karpenter (played by the test) replaced the drifted nodeclaims
+			polled := make(chan upgrade.Snapshot, 16)
+			done := make(chan error, 1)
+			var result *upgrade.Result
+			go func() {
+				var err error
+				result, err = upgrade.NewMonitor(cs).Run(ctx, nodeclasses.MonitorOptions{
+					Cadence:     cadence.Fixed{Interval: 200 * time.Millisecond},
+					NodeClasses: []string{name + "-default", name + "-gpu"},
+					UntilClean:  true,
+				}, func(s upgrade.Snapshot) {
+					select {
+					case polled <- s:
+					default:
+					}
+				})
+				done <- err
+			}()
+			select {
+			case s := <-polled:
+				if drifted := countDrifted(s.Statuses); drifted != 2 {
+					t.Errorf("first poll saw %d drifted nodeclaims, want 2", drifted)
+				}
+			case <-ctx.Done():
+				t.Fatal("the monitor never polled")
+			}
+			deleteNodeClaim(ctx, t, name+"-claim-default")
+			seedNodeClaim(ctx, t, name+"-claim-default-2", name+"-default", false)
+			deleteNodeClaim(ctx, t, name+"-claim-gpu")
+
+			if err := <-done; err != nil {
+				t.Fatalf("Monitor.Run: %v", err)
+			}
+			if len(result.Resolutions) != 2 {
+				t.Errorf("resolutions = %+v, want one per replaced nodeclaim", result.Resolutions)
+			}
+		})
+	}
+}
+
+// seedNodeClass creates an EC2NodeClass selecting the AMI named ami, deleting it when the test ends
+func seedNodeClass(ctx context.Context, t *testing.T, name, ami string) {
+	t.Helper()
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "karpenter.k8s.aws/v1",
+		"kind":       "EC2NodeClass",
+		"metadata":   map[string]interface{}{"name": name},
+		"spec": map[string]interface{}{
+			"amiFamily":                  "AL2023",
+			"role":                       "KarpenterNodeRole",
+			"amiSelectorTerms":           []interface{}{map[string]interface{}{"name": ami, "owner": owner}},
+			"subnetSelectorTerms":        []interface{}{map[string]interface{}{"tags": map[string]interface{}{"karpenter.sh/discovery": "envtest"}}},
+			"securityGroupSelectorTerms": []interface{}{map[string]interface{}{"tags": map[string]interface{}{"karpenter.sh/discovery": "envtest"}}},
+		},
+	}}
+	if _, err := cluster.Resource(ec2NodeClasses).Create(ctx, obj, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("failed to create nodeclass %s: %v", name, err)
+	}
+	t.Cleanup(func() {
+		cluster.Resource(ec2NodeClasses).Delete(context.Background(), name, metav1.DeleteOptions{})
+	})
+}
+
+// seedNodeClaim creates a launched NodeClaim of nodeClass with the given drift status, deleting it when
+// the test ends
+func seedNodeClaim(ctx context.Context, t *testing.T, name, nodeClass string, drifted bool) {
+	t.Helper()
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "karpenter.sh/v1",
+		"kind":       "NodeClaim",
+		"metadata": map[string]interface{}{
+			"name":   name,
+			"labels": map[string]interface{}{nodeclasses.LabelNodePool: "general"},
+		},
+		"spec": map[string]interface{}{
+			"nodeClassRef": map[string]interface{}{"group": "karpenter.k8s.aws", "kind": "EC2NodeClass", "name": nodeClass},
+			"requirements": []interface{}{map[string]interface{}{
+				"key": "kubernetes.io/arch", "operator": "In", "values": []interface{}{"amd64"},
+			}},
+		},
+	}}
+	created, err := cluster.Resource(nodeClaims).Create(ctx, obj, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("failed to create nodeclaim %s: %v", name, err)
+	}
+	t.Cleanup(func() {
+		cluster.Resource(nodeClaims).Delete(context.Background(), name, metav1.DeleteOptions{})
+	})
+
+	now := metav1.Now().UTC().Format(time.RFC3339)
+	conditions := []interface{}{
+		map[string]interface{}{"type": "Launched", "status": "True", "reason": "Launched", "message": "", "lastTransitionTime": now},
+		map[string]interface{}{"type": "Ready", "status": "True", "reason": "Ready", "message": "", "lastTransitionTime": now},
+	}
+	if drifted {
+		conditions = append(conditions, map[string]interface{}{
+			"type": "Drifted", "status": "True", "reason": "NodeClassDrift", "message": "", "lastTransitionTime": now,
+		})
+	}
+	unstructured.SetNestedSlice(created.Object, conditions, "status", "conditions")
+	unstructured.SetNestedField(created.Object, "node-"+name, "status", "nodeName")
+	if _, err := cluster.Resource(nodeClaims).UpdateStatus(ctx, created, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("failed to set the status of nodeclaim %s: %v", name, err)
+	}
+}
+
+// deleteNodeClaim deletes a nodeclaim, as Karpenter does once it replaced it
+func deleteNodeClaim(ctx context.Context, t *testing.T, name string) {
+	t.Helper()
+	if err := cluster.Resource(nodeClaims).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("failed to delete nodeclaim %s: %v", name, err)
+	}
+}
+
+func getNodeClass(ctx context.Context, t *testing.T, name string) *unstructured.Unstructured {
+	t.Helper()
+	obj, err := cluster.Resource(ec2NodeClasses).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get nodeclass %s: %v", name, err)
+	}
+	return obj
+}
+
+func countDrifted(statuses []nodeclasses.NodeClaimStatus) int {
+	n := 0
+	for _, s := range statuses {
+		if s.Drifted {
+			n++
+		}
+	}
+	return n
+}
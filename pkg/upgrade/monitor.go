@@ -0,0 +1,352 @@
+package upgrade
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/buildinfo"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/cadence"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/history"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/instances"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+)
+
+// Snapshot is the state observed by one monitor poll
+type Snapshot struct {
+	At          time.Time // when the nodeclaims were polled
+	Statuses    []nodeclasses.NodeClaimStatus
+	Resolutions []history.Resolution          // drift resolutions seen so far
+	Disruptions []nodeclasses.DisruptionEvent // Karpenter disruptions since monitoring started
+}
+
+// Result is the outcome of a monitoring run
+type Result struct {
+	StartedAt   time.Time
+	FinishedAt  time.Time
+	Resolutions []history.Resolution
+	Disruptions []nodeclasses.DisruptionEvent
+}
+
+// Monitor follows nodeclaim drift after an upgrade
+type Monitor struct {
+	Kube  clients.KubeClient
+	EC2   clients.EC2Client
+	Clock clock.Clock // drives polling, timeouts and nodeclaim ages
+}
+
+// NewMonitor creates a Monitor using the given clients and the system clock
+func NewMonitor(cs clients.Set) *Monitor {
+	return &Monitor{Kube: cs.Kube, EC2: cs.EC2, Clock: clock.Real}
+}
+
+// Run monitors nodeclaims according to opts, calling onPoll with a snapshot after each nodeclaim poll,
+// until the nodeclaims are clean (with UntilClean), the timeout elapses or ctx is cancelled. The result
+// holds everything observed even when an error is returned, e.g. nodeclasses.ErrMonitorStopped after ctx
+// is cancelled.
+//
+// Nodeclaims and disruption events are fetched by separate goroutines that send their results to a single
+// event loop; only the loop touches the monitoring state and calls onPoll, so onPoll needs no locking.
+// opts.Cadence decides how often they poll; with cadence.Watch, a nodeclaim watch triggers the polls.
+func (m *Monitor) Run(ctx context.Context, opts nodeclasses.MonitorOptions, onPoll func(Snapshot)) (*Result, error) {
+	clk := clock.OrReal(m.Clock)
+	tracker := history.NewTracker()
+	result := &Result{StartedAt: clk.Now()}
+	defer func() {
+		result.FinishedAt = clk.Now()
+		result.Resolutions = tracker.Resolutions()
+	}()
+
+	pollCtx, stopPolling := context.WithCancel(ctx)
+	var pollers sync.WaitGroup
+	// Stop the pollers and wait for them so nothing is fetched after Run returns
+	defer pollers.Wait()
+	defer stopPolling()
+
+	strategy := opts.Cadence
+	if strategy == nil {
+		strategy = cadence.Fixed{Interval: opts.UpdateInterval}
+	}
+	var statusTriggers, disruptionTriggers chan struct{}
+	var minInterval time.Duration
+	if w, ok := strategy.(cadence.Watch); ok {
+		if watcher, ok := m.Kube.(clients.Watcher); ok {
+			statusTriggers, disruptionTriggers = make(chan struct{}, 1), make(chan struct{}, 1)
+			minInterval = w.MinInterval
+			pollers.Add(1)
+			go func() {
+				defer pollers.Done()
+				watchNodeClaims(pollCtx, clk, watcher, w.Resync, statusTriggers, disruptionTriggers)
+			}()
+		}
+	}
+
+	events := make(chan monitorEvent)
+	pollers.Add(2)
+	go func() {
+		defer pollers.Done()
+		poll(pollCtx, clk, strategy, minInterval, statusTriggers, events, func() monitorEvent {
+			statuses, err := nodeclasses.GetNodeClaimStatuses(pollCtx, m.Kube, clk.Now())
+			return statusesEvent{statuses: opts.Filter(statuses), err: err}
+		})
+	}()
+	go func() {
+		defer pollers.Done()
+		poll(pollCtx, clk, strategy, minInterval, disruptionTriggers, events, func() monitorEvent {
+			disruptions, err := nodeclasses.GetDisruptionEvents(pollCtx, m.Kube, result.StartedAt)
+			return disruptionsEvent{disruptions: disruptions, err: err}
+		})
+	}()
+
+	var deadline <-chan time.Time
+	if opts.Timeout > 0 {
+		timer := clk.NewTimer(opts.Timeout)
+		defer timer.Stop()
+		deadline = timer.C()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return result, nodeclasses.ErrMonitorStopped
+
+		case <-deadline:
+			if !opts.UntilClean {
+				return result, nil
+			}
+			return result, nodeclasses.ErrMonitorTimeout
+
+		case event := <-events:
+			switch e := event.(type) {
+			case disruptionsEvent:
+				// The timeline is best effort; keep the last known events if the lookup fails
+				if e.err == nil {
+					result.Disruptions = e.disruptions
+				}
+
+			case statusesEvent:
+				if ctx.Err() != nil {
+					return result, nodeclasses.ErrMonitorStopped
+				}
+				if e.err != nil {
+					return result, fmt.Errorf("failed to get nodeclaim statuses: %w", e.err)
+				}
+
+				now := clk.Now()
+				tracker.Observe(e.statuses, now)
+				if onPoll != nil {
+					onPoll(Snapshot{
+						At:          now,
+						Statuses:    e.statuses,
+						Resolutions: tracker.Resolutions(),
+						Disruptions: result.Disruptions,
+					})
+				}
+				if opts.UntilClean && nodeclasses.AllUndrifted(e.statuses) {
+					return result, nil
+				}
+			}
+		}
+	}
+}
+
+// monitorEvent is a message to the monitor's event loop
+type monitorEvent interface {
+	// fingerprint summarizes the polled state, so pollers can tell whether it changed
+	fingerprint() string
+}
+
+// statusesEvent carries the result of a nodeclaim poll
+type statusesEvent struct {
+	statuses []nodeclasses.NodeClaimStatus
+	err      error
+}
+
+func (e statusesEvent) fingerprint() string {
+	if e.err != nil {
+		return "error: " + e.err.Error()
+	}
+	var b strings.Builder
+	for _, s := range e.statuses {
+		fmt.Fprintf(&b, "%s %t %t %t %s\n", s.Name, s.Drifted, s.Conditions["Ready"], s.Terminating, s.BlockedBy)
+	}
+	return b.String()
+}
+
+// disruptionsEvent carries the result of a disruption events poll
+type disruptionsEvent struct {
+	disruptions []nodeclasses.DisruptionEvent
+	err         error
+}
+
+func (e disruptionsEvent) fingerprint() string {
+	if e.err != nil {
+		return "error: " + e.err.Error()
+	}
+	return strconv.Itoa(len(e.disruptions))
+}
+
+// poll calls fetch immediately and then as often as strategy says, sending each result to events until
+// ctx is done. A trigger (from a watch) starts the next fetch early, but not sooner than minInterval after
+// the previous one. The next fetch starts only after the loop has taken the previous result.
+func poll(ctx context.Context, clk clock.Clock, strategy cadence.Strategy, minInterval time.Duration,
+	triggers <-chan struct{}, events chan<- monitorEvent, fetch func() monitorEvent) {
+	var wait time.Duration
+	var last string
+	for {
+		event := fetch()
+		fetchedAt := clk.Now()
+		select {
+		case events <- event:
+		case <-ctx.Done():
+			return
+		}
+
+		current := event.fingerprint()
+		wait = strategy.Next(wait, current != last)
+		last = current
+
+		timer := clk.NewTimer(wait)
+		select {
+		case <-timer.C():
+		case <-triggers:
+			timer.Stop()
+			// Coalesce bursts of watch events into one fetch
+			if d := minInterval - clk.Since(fetchedAt); d > 0 {
+				select {
+				case <-clk.After(d):
+				case <-ctx.Done():
+					return
+				}
+			}
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// watchNodeClaims signals each trigger channel whenever a nodeclaim changes, until ctx is done.
+// Polling carries on at the resync interval while the watch is down.
+func watchNodeClaims(ctx context.Context, clk clock.Clock, watcher clients.Watcher, resync time.Duration, triggers ...chan struct{}) {
+	for ctx.Err() == nil {
+		changes := 0
+		stream, err := watcher.Watch(ctx, "nodeclaims.karpenter.sh")
+		if err == nil {
+			dec := json.NewDecoder(stream)
+			for {
+				var change json.RawMessage
+				if dec.Decode(&change) != nil {
+					break
+				}
+				changes++
+				for _, t := range triggers {
+					// A pending trigger already covers this change
+					select {
+					case t <- struct{}{}:
+					default:
+					}
+				}
+			}
+			err = stream.Close()
+		}
+		// A watch the server ended after delivering changes is resumed at once; one that failed or
+		// ended straight away is retried later, so a broken watch doesn't spawn kubectl in a loop
+		if err == nil && changes > 0 {
+			continue
+		}
+
+		select {
+		case <-clk.After(resync):
+		case <-ctx.Done():
+		}
+	}
+}
+
+// Record appends run to the history file at path, tagged with the current cluster, with the drift
+// resolutions of result when monitoring ran (result is nil otherwise). run's start defaults to the start
+// of monitoring. Runs that neither applied changes nor observed resolutions are not recorded.
+func (m *Monitor) Record(ctx context.Context, path string, run history.Run, result *Result) error {
+	if len(run.Changes) == 0 && (result == nil || len(result.Resolutions) == 0) {
+		return nil
+	}
+
+	cluster, err := nodeclasses.CurrentContext(ctx, m.Kube)
+	if err != nil {
+		cluster = "unknown"
+	}
+
+	run.Cluster = cluster
+	run.ToolVersion = buildinfo.Get().String()
+	run.FinishedAt = clock.OrReal(m.Clock).Now()
+	if result != nil {
+		if run.StartedAt.IsZero() {
+			run.StartedAt = result.StartedAt
+		}
+		run.FinishedAt = result.FinishedAt
+		run.Resolutions = result.Resolutions
+		run.Monitored = true
+	}
+	if run.StartedAt.IsZero() {
+		run.StartedAt = run.FinishedAt
+	}
+	if err := history.Append(path, run); err != nil {
+		return fmt.Errorf("failed to record run history: %w", err)
+	}
+	return nil
+}
+
+// Orphan is a replaced instance that did not reach the terminated state
+type Orphan struct {
+	InstanceID string
+	State      string
+	NodeClaim  string
+}
+
+// TerminationReport is the outcome of verifying that replaced instances terminated
+type TerminationReport struct {
+	Checked int      // replaced instances that were verified
+	Orphans []Orphan // instances still not terminated, sorted by ID
+	Skipped []error  // resolutions whose provider ID could not be parsed
+}
+
+// VerifyTermination waits up to timeout for the EC2 instances behind replaced nodeclaims to terminate
+func (m *Monitor) VerifyTermination(ctx context.Context, resolutions []history.Resolution, timeout, interval time.Duration) (*TerminationReport, error) {
+	report := &TerminationReport{}
+
+	var replaced []instances.Instance
+	claimByInstance := make(map[string]string)
+	for _, r := range resolutions {
+		if !r.Replaced || r.ProviderID == "" {
+			continue
+		}
+		inst, err := instances.ParseProviderID(r.ProviderID)
+		if err != nil {
+			report.Skipped = append(report.Skipped, fmt.Errorf("%s: %w", r.NodeClaim, err))
+			continue
+		}
+		replaced = append(replaced, inst)
+		claimByInstance[inst.ID] = r.NodeClaim
+	}
+
+	report.Checked = len(replaced)
+	if len(replaced) == 0 {
+		return report, nil
+	}
+
+	remaining, err := instances.WaitForTermination(ctx, clock.OrReal(m.Clock), m.EC2, replaced, timeout, interval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify instance termination: %w", err)
+	}
+
+	for _, id := range instances.SortedIDs(remaining) {
+		report.Orphans = append(report.Orphans, Orphan{InstanceID: id, State: remaining[id], NodeClaim: claimByInstance[id]})
+	}
+	return report, nil
+}
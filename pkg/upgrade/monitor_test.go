@@ -0,0 +1,202 @@
+package upgrade_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients/fake"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clock"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/upgrade"
+)
+
+// The monitor tests drive Monitor.Run with a fake clock while its pollers run concurrently with the
+// test, so they are meant to be run with the race detector: go test -race ./pkg/upgrade/...
+
+const nodeClaims = "nodeclaims.karpenter.sh"
+
+var monitorStart = time.Date(2025, 11, 2, 10, 0, 0, 0, time.UTC)
+
+// addNodeClaim stores a nodeclaim of the default nodeclass, drifted since monitorStart if drifted
+func addNodeClaim(t *testing.T, kube *fake.KubeClient, name string, drifted bool) {
+	t.Helper()
+	condition := "False"
+	if drifted {
+		condition = "True"
+	}
+	err := kube.Add(nodeClaims, fmt.Sprintf(`{
+		"metadata": {"name": %q, "creationTimestamp": %q},
+		"spec": {"nodeClassRef": {"name": "default"}},
+		"status": {
+			"providerID": "aws:///us-west-2a/i-%s",
+			"conditions": [
+				{"type": "Ready", "status": "True"},
+				{"type": "Drifted", "status": %q, "lastTransitionTime": %q}
+			]
+		}
+	}`, name, monitorStart.Add(-24*time.Hour).Format(time.RFC3339), name, condition, monitorStart.Format(time.RFC3339)))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// monitorRun is a Monitor.Run in progress, handing each snapshot to the test
+type monitorRun struct {
+	clock     *clock.Fake
+	snapshots chan upgrade.Snapshot
+	done      chan struct{}
+	result    *upgrade.Result
+	err       error
+}
+
+// startMonitor runs a monitor over kube with a fake clock, polling every 10s for at most an hour
+func startMonitor(ctx context.Context, kube *fake.KubeClient) *monitorRun {
+	run := &monitorRun{
+		clock:     clock.NewFake(monitorStart),
+		snapshots: make(chan upgrade.Snapshot),
+		done:      make(chan struct{}),
+	}
+	m := &upgrade.Monitor{Kube: kube, EC2: fake.NewEC2Client(), Clock: run.clock}
+	opts := nodeclasses.MonitorOptions{UpdateInterval: 10 * time.Second, UntilClean: true, Timeout: time.Hour}
+	go func() {
+		defer close(run.done)
+		run.result, run.err = m.Run(ctx, opts, func(s upgrade.Snapshot) {
+			select {
+			case run.snapshots <- s:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	return run
+}
+
+// next returns the next snapshot
+func (r *monitorRun) next(t *testing.T) upgrade.Snapshot {
+	t.Helper()
+	select {
+	case s := <-r.snapshots:
+		return s
+	case <-r.done:
+		t.Fatalf("monitor returned early: %v", r.err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for a poll")
+	}
+	return upgrade.Snapshot{}
+}
+
+// tick waits for both pollers and the timeout to be waiting on the clock, then moves it to the next poll
+func (r *monitorRun) tick(t *testing.T) {
+	t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); r.clock.Waiters() < 3; runtime.Gosched() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the pollers to wait")
+		}
+	}
+	r.clock.Advance(10 * time.Second)
+}
+
+// wait returns the result of Run
+func (r *monitorRun) wait(t *testing.T) (*upgrade.Result, error) {
+	t.Helper()
+	select {
+	case <-r.done:
+		return r.result, r.err
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the monitor to return")
+	}
+	return nil, nil
+}
+
+func TestMonitorRunUntilClean(t *testing.T) {
+	kube := fake.NewKubeClient()
+	addNodeClaim(t, kube, "a", true)
+	addNodeClaim(t, kube, "b", true)
+	addNodeClaim(t, kube, "c", false)
+	err := kube.Add("events", fmt.Sprintf(`{
+		"involvedObject": {"kind": "NodeClaim", "name": "a"},
+		"reason": "DisruptionTerminating",
+		"message": "Disrupting NodeClaim: Drifted/Delete",
+		"lastTimestamp": %q
+	}`, monitorStart.Add(time.Minute).Format(time.RFC3339)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := startMonitor(context.Background(), kube)
+	first := run.next(t)
+	if got := len(first.Statuses); got != 3 {
+		t.Fatalf("first poll saw %d nodeclaims, want 3", got)
+	}
+
+	// Karpenter replaces a, then b
+	kube.Delete(context.Background(), nodeClaims, "a")
+	addNodeClaim(t, kube, "a2", false)
+	run.tick(t)
+	second := run.next(t)
+	if len(second.Resolutions) != 1 || second.Resolutions[0].NodeClaim != "a" {
+		t.Errorf("second poll resolutions = %+v, want a", second.Resolutions)
+	}
+	if len(second.Disruptions) != 1 || second.Disruptions[0].Reason != "Drifted" {
+		t.Errorf("second poll disruptions = %+v, want a drift of a", second.Disruptions)
+	}
+
+	kube.Delete(context.Background(), nodeClaims, "b")
+	addNodeClaim(t, kube, "b2", false)
+	run.tick(t)
+	run.next(t)
+
+	result, err := run.wait(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v, want the nodeclaims clean", err)
+	}
+	if len(result.Resolutions) != 2 {
+		t.Fatalf("resolutions = %+v, want a and b", result.Resolutions)
+	}
+	for i, name := range []string{"a", "b"} {
+		r := result.Resolutions[i]
+		if r.NodeClaim != name || !r.Replaced {
+			t.Errorf("resolution %d = %+v, want %s replaced", i, r, name)
+		}
+		if want := time.Duration(i+1) * 10 * time.Second; r.Duration() != want {
+			t.Errorf("%s was replaced in %s, want %s", name, r.Duration(), want)
+		}
+	}
+	if len(result.Disruptions) != 1 {
+		t.Errorf("disruptions = %+v, want 1", result.Disruptions)
+	}
+	if !result.FinishedAt.Equal(monitorStart.Add(20 * time.Second)) {
+		t.Errorf("finished at %s, want after two polls", result.FinishedAt)
+	}
+}
+
+func TestMonitorRunCancelled(t *testing.T) {
+	kube := fake.NewKubeClient()
+	addNodeClaim(t, kube, "a", true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	run := startMonitor(ctx, kube)
+	run.next(t)
+	cancel()
+
+	result, err := run.wait(t)
+	if !errors.Is(err, nodeclasses.ErrMonitorStopped) {
+		t.Errorf("Run() error = %v, want ErrMonitorStopped", err)
+	}
+	if result == nil || !result.StartedAt.Equal(monitorStart) {
+		t.Errorf("result = %+v, want what was observed before the cancellation", result)
+	}
+}
+
+func TestMonitorRunPollError(t *testing.T) {
+	kube := fake.NewKubeClient()
+	kube.Err = errors.New("connection refused")
+
+	_, err := startMonitor(context.Background(), kube).wait(t)
+	if err == nil || !errors.Is(err, kube.Err) {
+		t.Errorf("Run() error = %v, want the nodeclaim poll's error", err)
+	}
+}
@@ -0,0 +1,619 @@
+// Package upgrade implements the AMI upgrade workflow independently of any UI: a Planner
+// discovers the nodeclasses and available AMI versions and builds a Plan, an Applier applies
+// it, and a Monitor follows the resulting drift until the nodeclaims are replaced.
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/amis"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/naming"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/provenance"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/vulns"
+)
+
+// ErrMixedVariants is returned when the nodeclasses use different image variants and none was requested
+var ErrMixedVariants = errors.New("nodeclasses use different image variants")
+
+// Discovery is the cluster state a plan is built from
+type Discovery struct {
+	NodeClasses nodeclasses.NodeClassList
+	K8sVersion  string            // newest Kubernetes version of the nodeclasses' AMIs
+	K8sVersions map[string]string // nodeclass -> Kubernetes version of its AMI, for parseable AMI names
+	OwnerID     string            // AMI owner of the first nodeclass
+	Variant     string            // image variant to upgrade to: the requested one, or the one all nodeclasses use
+	Scoped      bool              // NodeClasses is part of the cluster's nodeclasses (see Group and ForChannel)
+
+	// Channel is the AMI channel of the nodeclasses (see ForChannel); empty for the default source
+	Channel string
+	// Channels maps the nodeclasses tracking a configured channel (see Planner.Channels) to it, and
+	// ChannelOwners each channel with nodeclasses to the AMI owner publishing it
+	Channels      map[string]string
+	ChannelOwners map[string]string
+
+	// MixedOwners maps the nodeclasses whose selector terms name different AMI owners to those owners. Only
+	// the first term is upgraded and versions are looked up under OwnerID, so the version chosen may not
+	// be published by every owner.
+	MixedOwners map[string][]string
+}
+
+// KubernetesVersions returns the Kubernetes versions the nodeclasses' AMIs are built for, newest first.
+// A cluster in the middle of a control plane upgrade has more than one.
+func (d *Discovery) KubernetesVersions() []string {
+	seen := make(map[string]bool)
+	var versions []string
+	for _, v := range d.K8sVersions {
+		if !seen[v] {
+			seen[v] = true
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return amis.CompareK8sVersions(versions[i], versions[j]) > 0
+	})
+	return versions
+}
+
+// Group returns the discovery restricted to the nodeclasses whose AMIs are built for k8sVersion, so each
+// Kubernetes version of a mixed cluster gets its own plan. Plans built from a group only check the
+// group's nodeclasses before they are applied.
+func (d *Discovery) Group(k8sVersion string) *Discovery {
+	group := &Discovery{
+		K8sVersion:  k8sVersion,
+		K8sVersions: make(map[string]string),
+		OwnerID:     d.OwnerID,
+		Variant:     d.Variant,
+		Scoped:      true,
+		Channel:     d.Channel,
+	}
+	for _, nc := range d.NodeClasses.Items {
+		if v, ok := d.K8sVersions[nc.Metadata.Name]; ok && v == k8sVersion {
+			group.NodeClasses.Items = append(group.NodeClasses.Items, nc)
+			group.K8sVersions[nc.Metadata.Name] = v
+			if owners, ok := d.MixedOwners[nc.Metadata.Name]; ok {
+				if group.MixedOwners == nil {
+					group.MixedOwners = make(map[string][]string)
+				}
+				group.MixedOwners[nc.Metadata.Name] = owners
+			}
+		}
+	}
+	return group
+}
+
+// ChannelNames returns the AMI channels the nodeclasses track, sorted, after the default source ("") when
+// some nodeclasses track none. It returns only the default source when no channel is configured.
+func (d *Discovery) ChannelNames() []string {
+	var names []string
+	for _, nc := range d.NodeClasses.Items {
+		if _, ok := d.Channels[nc.Metadata.Name]; !ok && len(nc.Spec.AMISelectorTerms) > 0 {
+			names = append(names, "")
+			break
+		}
+	}
+	return append(names, slices.Sorted(maps.Keys(d.ChannelOwners))...)
+}
+
+// ForChannel returns the discovery restricted to the nodeclasses tracking the channel, or tracking none for
+// "", with the owner publishing it, so each channel is planned against its own AMI versions. Without
+// configured channels the discovery itself is returned.
+func (d *Discovery) ForChannel(name string) *Discovery {
+	if len(d.ChannelOwners) == 0 {
+		return d
+	}
+	ch := &Discovery{
+		K8sVersions: make(map[string]string),
+		OwnerID:     d.OwnerID,
+		Variant:     d.Variant,
+		Scoped:      true,
+		Channel:     name,
+	}
+	if name != "" {
+		ch.OwnerID = d.ChannelOwners[name]
+	}
+	for _, nc := range d.NodeClasses.Items {
+		if d.Channels[nc.Metadata.Name] != name {
+			continue
+		}
+		ch.NodeClasses.Items = append(ch.NodeClasses.Items, nc)
+		if v, ok := d.K8sVersions[nc.Metadata.Name]; ok {
+			ch.K8sVersions[nc.Metadata.Name] = v
+			if ch.K8sVersion == "" || amis.CompareK8sVersions(v, ch.K8sVersion) > 0 {
+				ch.K8sVersion = v
+			}
+		}
+		if owners, ok := d.MixedOwners[nc.Metadata.Name]; ok {
+			if ch.MixedOwners == nil {
+				ch.MixedOwners = make(map[string][]string)
+			}
+			ch.MixedOwners[nc.Metadata.Name] = owners
+		}
+	}
+	return ch
+}
+
+// Channel is an AMI source a set of nodeclasses is planned against instead of the owner the other
+// nodeclasses use, e.g. beta GPU images published by another account
+type Channel struct {
+	Name        string
+	Owner       string
+	NodeClasses []string
+}
+
+// Planner discovers nodeclasses and available AMI versions and builds upgrade plans
+type Planner struct {
+	Kube       clients.KubeClient
+	EC2        clients.EC2Client
+	Naming     naming.Provider
+	Provenance *provenance.Policy // when set, VerifyProvenance checks candidate versions against it
+	Findings   vulns.Source       // when set, ScanVersions reports vulnerability findings of candidate versions
+	Dates      amis.DateRange     // creation dates of the versions offered, e.g. to enforce a soak period
+
+	// AMIFamilies maps an image variant to the spec.amiFamily nodeclasses moved to images of that variant
+	// must use, e.g. AL2023 when the images switch from AL2. Nodeclasses keep their amiFamily for variants
+	// without an entry.
+	AMIFamilies map[string]string
+
+	// Variant is the image variant to move the nodeclasses to (see naming.ParseVariant); nil keeps the
+	// variant the nodeclasses use. Nodeclasses are never moved off a compliance variant.
+	Variant *string
+	// Channels are the AMI channels some nodeclasses track; the others use the owner of the first of them
+	Channels []Channel
+	// IncludeSkipped plans nodeclasses annotated with nodeclasses.SkipAnnotation like any other instead of
+	// reporting them in Plan.Skipped
+	IncludeSkipped bool
+}
+
+// NewPlanner creates a Planner using the given clients and naming provider
+func NewPlanner(cs clients.Set, provider naming.Provider) *Planner {
+	return &Planner{Kube: cs.Kube, EC2: cs.EC2, Naming: provider}
+}
+
+// Discover collects the EC2NodeClasses and detects the Kubernetes versions, AMI owner and image variant
+// they use, and the nodeclasses whose selector terms mix owners. It returns nodeclasses.ErrNoNodeClasses if the cluster has none,
+// nodeclasses.ErrAMIPatternUnrecognized if no AMI name matches the naming scheme and ErrMixedVariants if
+// the nodeclasses use different variants and no variant was requested.
+func (p *Planner) Discover(ctx context.Context) (*Discovery, error) {
+	list, err := nodeclasses.GetEC2NodeClasses(ctx, p.Kube)
+	if err != nil {
+		return nil, err
+	}
+	if len(list.Items) == 0 {
+		return nil, nodeclasses.ErrNoNodeClasses
+	}
+
+	d := &Discovery{NodeClasses: list, K8sVersions: make(map[string]string)}
+	channels := make(map[string]Channel)
+	for _, ch := range p.Channels {
+		for _, name := range ch.NodeClasses {
+			channels[name] = ch
+		}
+	}
+	variants := make(map[string]bool)
+	for _, nc := range list.Items {
+		if len(nc.Spec.AMISelectorTerms) == 0 {
+			continue
+		}
+		if ch, ok := channels[nc.Metadata.Name]; ok {
+			if d.Channels == nil {
+				d.Channels, d.ChannelOwners = make(map[string]string), make(map[string]string)
+			}
+			d.Channels[nc.Metadata.Name] = ch.Name
+			d.ChannelOwners[ch.Name] = ch.Owner
+		} else if d.OwnerID == "" {
+			d.OwnerID = nc.AMIOwner()
+		}
+		if owners := nc.Owners(); len(owners) > 1 {
+			if d.MixedOwners == nil {
+				d.MixedOwners = make(map[string][]string)
+			}
+			d.MixedOwners[nc.Metadata.Name] = owners
+		}
+		if pattern, err := nodeclasses.ParseAMIName(p.Naming, nc.AMIName()); err == nil {
+			d.K8sVersions[nc.Metadata.Name] = pattern.K8sVersion
+			if d.K8sVersion == "" || amis.CompareK8sVersions(pattern.K8sVersion, d.K8sVersion) > 0 {
+				d.K8sVersion = pattern.K8sVersion
+			}
+			variants[pattern.Variant] = true
+		}
+	}
+
+	if d.K8sVersion == "" {
+		return nil, fmt.Errorf("could not determine k8s version from AMI names: %w", nodeclasses.ErrAMIPatternUnrecognized)
+	}
+
+	switch {
+	case p.Variant != nil:
+		d.Variant = *p.Variant
+	case len(variants) > 1:
+		return nil, fmt.Errorf("%w; choose one explicitly", ErrMixedVariants)
+	default:
+		for variant := range variants {
+			d.Variant = variant
+		}
+	}
+	return d, nil
+}
+
+// AvailableVersions returns the AMI versions published for the discovered Kubernetes version and variant, newest first
+func (p *Planner) AvailableVersions(ctx context.Context, d *Discovery) ([]amis.VersionItem, error) {
+	available, err := amis.GetAvailableAMIs(ctx, p.EC2, d.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	return amis.ExtractVersions(p.Naming, available, d.K8sVersion, d.Variant, p.Dates)
+}
+
+// AllVersions returns the AMI versions published for the discovered variant across all Kubernetes versions,
+// grouped by Kubernetes version, newest first, for planning a Kubernetes minor version upgrade
+func (p *Planner) AllVersions(ctx context.Context, d *Discovery) ([]amis.VersionItem, error) {
+	available, err := amis.GetAvailableAMIs(ctx, p.EC2, d.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	return amis.ExtractVersions(p.Naming, available, "", d.Variant, p.Dates)
+}
+
+// VerifyProvenance checks that every AMI of v comes from a trusted build. It returns nil when no
+// provenance policy is configured.
+func (p *Planner) VerifyProvenance(v amis.VersionItem) *provenance.Result {
+	if p.Provenance == nil {
+		return nil
+	}
+	result := p.Provenance.VerifyVersion(v)
+	return &result
+}
+
+// PlanVersion returns the version pl moves to with the images its changes select: those published under each
+// new AMI name by the owner the change moves to, or the image a change is pinned to. It lets a plan made
+// elsewhere, e.g. with the plan subcommand, be held to the provenance policy and finding limits a picked
+// version is. It fails when a new AMI is not published.
+func (p *Planner) PlanVersion(ctx context.Context, pl *plan.Plan) (amis.VersionItem, error) {
+	v := amis.VersionItem{Version: pl.Version, K8sVersion: pl.K8sVersion}
+	list, err := nodeclasses.GetEC2NodeClasses(ctx, p.Kube)
+	if err != nil {
+		return v, err
+	}
+	owners := make(map[string]string, len(list.Items)) // nodeclass -> owner of its AMI
+	for _, nc := range list.Items {
+		owners[nc.Metadata.Name] = nc.AMIOwner()
+	}
+
+	published := make(map[string][]amis.AMIInfo) // owner -> images
+	seen := make(map[string]bool)                // image IDs already in v
+	for _, ch := range pl.Changes {
+		owner := ch.NewOwner
+		if owner == "" {
+			owner = owners[ch.NodeClass]
+		}
+		images, ok := published[owner]
+		if !ok {
+			if images, err = amis.GetAvailableAMIs(ctx, p.EC2, owner); err != nil {
+				return v, err
+			}
+			published[owner] = images
+		}
+		found := false
+		for _, image := range images {
+			if image.Name != ch.NewAMI || (ch.NewAMIID != "" && image.ImageID != ch.NewAMIID) {
+				continue
+			}
+			found = true
+			if !seen[image.ImageID] {
+				seen[image.ImageID] = true
+				v.Images = append(v.Images, image)
+			}
+		}
+		if !found {
+			return v, fmt.Errorf("no AMI named %s is published for v%s", ch.NewAMI, pl.Version)
+		}
+		if v.K8sVersion == "" {
+			if pattern, err := nodeclasses.ParseAMIName(p.Naming, ch.NewAMI); err == nil {
+				v.K8sVersion = pattern.K8sVersion
+			}
+		}
+	}
+	return v, nil
+}
+
+// ScanVersions summarizes the vulnerability findings of each version, by VersionItem.Key. It returns nil
+// when no findings source is configured.
+func (p *Planner) ScanVersions(ctx context.Context, versions []amis.VersionItem) (map[string]vulns.Summary, error) {
+	if p.Findings == nil {
+		return nil, nil
+	}
+	findings, err := p.Findings.Findings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make(map[string]vulns.Summary, len(versions))
+	for _, v := range versions {
+		summaries[v.Key()] = vulns.Summarize(v, findings)
+	}
+	return summaries, nil
+}
+
+// Plan builds the changes that move every discovered nodeclass to version in the discovered variant,
+// keeping the Kubernetes version of its AMI. Nodeclasses whose AMI name cannot be parsed or rendered in
+// the variant, whose new AMI name does not parse back to the fields it was rendered from, that would be
+// moved off their compliance variant, or that opted out of upgrades with nodeclasses.SkipAnnotation
+// (unless IncludeSkipped is set), are reported in Plan.Skipped. The
+// plan's precondition captures the discovered nodeclasses, so Verify can detect changes made before it
+// is applied.
+func (p *Planner) Plan(d *Discovery, version string) *plan.Plan {
+	return p.PlanTo(d, "", version)
+}
+
+// PlanTo is like Plan, but moves the nodeclasses to AMIs built for k8sVersion, e.g. to upgrade the nodes
+// after the control plane. An empty k8sVersion keeps the Kubernetes version of each nodeclass's AMI.
+func (p *Planner) PlanTo(d *Discovery, k8sVersion, version string) *plan.Plan {
+	result := plan.New(version, d.NodeClasses)
+	if d.Scoped {
+		result = plan.NewScoped(version, d.NodeClasses)
+	}
+	result.Variant = d.Variant
+	result.K8sVersion = k8sVersion
+	result.Channel = d.Channel
+	nodeclassMap := nodeclasses.BuildNodeClassMap(p.Naming, d.NodeClasses)
+
+	for _, nc := range d.NodeClasses.Items {
+		if len(nc.Spec.AMISelectorTerms) == 0 {
+			continue
+		}
+		if reason, ok := nc.OptedOut(); ok && !p.IncludeSkipped {
+			if reason == "" {
+				reason = "no reason given"
+			}
+			result.Skipped = append(result.Skipped, plan.Skipped{
+				NodeClass: nc.Metadata.Name,
+				Reason:    fmt.Sprintf("opted out with %s: %s", nodeclasses.SkipAnnotation, reason),
+			})
+			continue
+		}
+
+		oldAMI := nc.AMIName()
+		pattern, err := nodeclasses.ParseAMIName(p.Naming, oldAMI)
+		if err != nil {
+			result.Skipped = append(result.Skipped, plan.Skipped{NodeClass: nc.Metadata.Name, Reason: "could not parse AMI name"})
+			continue
+		}
+
+		if pattern.Variant != naming.VariantStandard && pattern.Variant != d.Variant {
+			result.Skipped = append(result.Skipped, plan.Skipped{
+				NodeClass: nc.Metadata.Name,
+				Reason:    fmt.Sprintf("uses %s images; not moving it to %s", pattern.Variant, naming.VariantName(d.Variant)),
+			})
+			continue
+		}
+
+		// Get the nodeclass info to determine if it should have a nodegroup
+		info, ok := nodeclassMap[nc.Metadata.Name]
+		if !ok {
+			result.Skipped = append(result.Skipped, plan.Skipped{NodeClass: nc.Metadata.Name, Reason: "no nodeclass info found"})
+			continue
+		}
+
+		fields := naming.Fields{K8sVersion: pattern.K8sVersion, Variant: d.Variant, Version: version}
+		if k8sVersion != "" {
+			fields.K8sVersion = k8sVersion
+		}
+		if info.HasNodegroup {
+			fields.Nodegroup = info.Nodegroup
+		}
+		newAMI, err := p.Naming.Render(fields)
+		if err != nil {
+			result.Skipped = append(result.Skipped, plan.Skipped{NodeClass: nc.Metadata.Name, Reason: err.Error()})
+			continue
+		}
+		// Guard against a render template and parse pattern that disagree: the new name must parse back to
+		// the fields it was rendered from, or the nodeclass would get a selector that matches nothing
+		rendered, ok := p.Naming.Parse(newAMI)
+		switch {
+		case ok && rendered.Variant != d.Variant:
+			// A naming scheme without a variant group renders every variant as a standard name
+			result.Skipped = append(result.Skipped, plan.Skipped{
+				NodeClass: nc.Metadata.Name,
+				Reason:    fmt.Sprintf("naming scheme cannot render %s images", naming.VariantName(d.Variant)),
+			})
+			continue
+		case !ok:
+			result.Skipped = append(result.Skipped, plan.Skipped{
+				NodeClass: nc.Metadata.Name,
+				Reason:    fmt.Sprintf("rendered AMI name %q does not match the naming scheme", newAMI),
+			})
+			continue
+		case rendered != fields:
+			result.Skipped = append(result.Skipped, plan.Skipped{
+				NodeClass: nc.Metadata.Name,
+				Reason:    fmt.Sprintf("rendered AMI name %q parses back as %s", newAMI, describeFields(rendered, fields)),
+			})
+			continue
+		}
+
+		change := plan.Change{
+			NodeClass: nc.Metadata.Name,
+			OldAMI:    oldAMI,
+			NewAMI:    newAMI,
+		}
+		if family, ok := p.AMIFamilies[d.Variant]; ok && family != nc.Spec.AMIFamily {
+			change.OldAMIFamily, change.NewAMIFamily = nc.Spec.AMIFamily, family
+		}
+		// A nodeclass newly tracking a channel moves to the images its owner publishes
+		if d.Channel != "" && d.OwnerID != nc.AMIOwner() {
+			change.OldOwner, change.NewOwner = nc.AMIOwner(), d.OwnerID
+		}
+		result.Changes = append(result.Changes, change)
+	}
+
+	return result
+}
+
+// describeFields names the fields of got that differ from want
+func describeFields(got, want naming.Fields) string {
+	var diffs []string
+	if got.Nodegroup != want.Nodegroup {
+		diffs = append(diffs, fmt.Sprintf("nodegroup %q instead of %q", got.Nodegroup, want.Nodegroup))
+	}
+	if got.K8sVersion != want.K8sVersion {
+		diffs = append(diffs, fmt.Sprintf("Kubernetes %q instead of %q", got.K8sVersion, want.K8sVersion))
+	}
+	if got.Version != want.Version {
+		diffs = append(diffs, fmt.Sprintf("version %q instead of %q", got.Version, want.Version))
+	}
+	return strings.Join(diffs, ", ")
+}
+
+// CheckPublished moves the changes of pl whose new AMI is not among the images published for version v to
+// pl.Skipped, e.g. when a version was not built for every nodegroup, so no nodeclass is pointed at a
+// selector that resolves to no image
+func (p *Planner) CheckPublished(pl *plan.Plan, v amis.VersionItem) {
+	published := make(map[string]bool, len(v.Images))
+	for _, image := range v.Images {
+		published[image.Name] = true
+	}
+	changes := pl.Changes[:0]
+	for _, ch := range pl.Changes {
+		if !published[ch.NewAMI] {
+			pl.Skipped = append(pl.Skipped, plan.Skipped{
+				NodeClass: ch.NodeClass,
+				Reason:    fmt.Sprintf("no AMI named %s is published for v%s", ch.NewAMI, v.Version),
+			})
+			continue
+		}
+		changes = append(changes, ch)
+	}
+	pl.Changes = changes
+}
+
+// PinNewest is the Pin choice selecting the newest image of each duplicated name
+const PinNewest = "newest"
+
+// Duplicate is a new AMI name more than one published image has, e.g. an image rebuilt the same day.
+// Karpenter selects the newest of them unless the nodeclass is pinned to one by ID.
+type Duplicate struct {
+	Name        string         `json:"name"`
+	Images      []amis.AMIInfo `json:"images"`      // newest first
+	NodeClasses []string       `json:"nodeClasses"` // nodeclasses the plan moves to the name
+}
+
+// Duplicates returns the new AMI names of the plan that more than one image of v has, in plan order
+func Duplicates(pl *plan.Plan, v amis.VersionItem) []Duplicate {
+	images := make(map[string][]amis.AMIInfo, len(v.Images))
+	for _, image := range v.Images {
+		images[image.Name] = append(images[image.Name], image)
+	}
+	var dups []Duplicate
+	index := make(map[string]int)
+	for _, ch := range pl.Changes {
+		if len(images[ch.NewAMI]) < 2 {
+			continue
+		}
+		i, ok := index[ch.NewAMI]
+		if !ok {
+			named := append([]amis.AMIInfo(nil), images[ch.NewAMI]...)
+			sort.SliceStable(named, func(i, j int) bool {
+				ti, _ := named[i].Created()
+				tj, _ := named[j].Created()
+				return ti.After(tj)
+			})
+			i = len(dups)
+			index[ch.NewAMI] = i
+			dups = append(dups, Duplicate{Name: ch.NewAMI, Images: named})
+		}
+		dups[i].NodeClasses = append(dups[i].NodeClasses, ch.NodeClass)
+	}
+	return dups
+}
+
+// Pin pins the changes moving to a duplicated name to one of its images by ID: the newest when choice is
+// PinNewest, otherwise the image among the comma-separated IDs of choice. Names none of the IDs belongs
+// to are left unpinned. It returns the IDs pinned.
+func Pin(pl *plan.Plan, dups []Duplicate, choice string) []string {
+	pins := make(map[string]string, len(dups)) // name -> image ID
+	for _, d := range dups {
+		for _, image := range d.Images {
+			if choice == PinNewest || slices.Contains(PinIDs(choice), image.ImageID) {
+				pins[d.Name] = image.ImageID
+				break
+			}
+		}
+	}
+	var pinned []string
+	for i, ch := range pl.Changes {
+		if id, ok := pins[ch.NewAMI]; ok {
+			pl.Changes[i].NewAMIID = id
+			if !slices.Contains(pinned, id) {
+				pinned = append(pinned, id)
+			}
+		}
+	}
+	return pinned
+}
+
+// PinIDs returns the image IDs of a Pin choice, none for PinNewest
+func PinIDs(choice string) []string {
+	if choice == PinNewest {
+		return nil
+	}
+	var ids []string
+	for _, id := range strings.Split(choice, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Verify checks that the cluster's nodeclasses still match the state p was built from, returning
+// plan.ErrPreconditionFailed if they were changed in the meantime
+func (p *Planner) Verify(ctx context.Context, pl *plan.Plan) error {
+	list, err := nodeclasses.GetEC2NodeClasses(ctx, p.Kube)
+	if err != nil {
+		return err
+	}
+	return pl.CheckPrecondition(list)
+}
+
+// Retake plans the change of pl to the nodeclass again from its current state, after it was changed another
+// way since pl was made: the AMI it selects now is moved to pl's version, variant and Kubernetes version, and
+// the owner is only changed if the planned change changed it. It returns nil and the reason when the
+// nodeclass needs no change, e.g. because it already selects the AMI or now opts out of upgrades.
+func (p *Planner) Retake(pl *plan.Plan, planned plan.Change, nc nodeclasses.EC2NodeClass) (*plan.Change, string) {
+	if len(nc.Spec.AMISelectorTerms) == 0 {
+		return nil, "no AMI selector terms"
+	}
+	owner := nc.AMIOwner()
+	if planned.NewOwner != "" {
+		owner = planned.NewOwner
+	}
+	d := &Discovery{
+		NodeClasses: nodeclasses.NodeClassList{Items: []nodeclasses.EC2NodeClass{nc}},
+		OwnerID:     owner,
+		Variant:     pl.Variant,
+		Scoped:      true,
+		Channel:     pl.Channel,
+	}
+	retaken := p.PlanTo(d, pl.K8sVersion, pl.Version)
+	if len(retaken.Skipped) > 0 {
+		return nil, retaken.Skipped[0].Reason
+	}
+	change := retaken.Changes[0]
+	if change.NewAMI == planned.NewAMI {
+		// Keep the image a duplicate AMI name was pinned to
+		change.NewAMIID = planned.NewAMIID
+	}
+	if change.NewAMI == change.OldAMI && change.NewAMIID == "" && change.NewAMIFamily == "" && change.NewOwner == "" {
+		return nil, "already selects " + change.NewAMI
+	}
+	return &change, ""
+}
@@ -0,0 +1,135 @@
+package upgrade_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients/fake"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/naming"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/nodeclasses"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/plan"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/upgrade"
+)
+
+// nodeClassList decodes nodeclasses given as name -> AMI name
+func nodeClassList(t *testing.T, amis map[string]string) nodeclasses.NodeClassList {
+	t.Helper()
+	var items []string
+	for name, ami := range amis {
+		items = append(items, fmt.Sprintf(`{"metadata": {"name": %q}, "spec": {"amiSelectorTerms": [{"name": %q, "owner": "123456789012"}]}}`, name, ami))
+	}
+	var list nodeclasses.NodeClassList
+	if err := json.Unmarshal([]byte(`{"items": [`+strings.Join(items, ",")+`]}`), &list); err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func TestPlanHyphenatedNodegroups(t *testing.T) {
+	list := nodeClassList(t, map[string]string{
+		"default":            "domino-eks-1.33-v20251001",
+		"domino-eks-compute": "domino-eks-1.33-v20251001", // no nodegroup, whatever the nodeclass is called
+		"gpu":                "domino-eks-gpu-1.33-v20251001",
+		"gpu-large":          "domino-eks-gpu-large-1.33-v20251001",
+		"mem":                "domino-eks-mem-opt-x2-1.33-v20251001",
+		"fips":               "domino-eks-gpu-large-1.33-fips-v20251001",
+	})
+	planner := &upgrade.Planner{Naming: naming.Default}
+
+	tests := []struct {
+		k8sVersion string
+		want       map[string]string // nodeclass -> new AMI
+	}{
+		{"", map[string]string{
+			"default":            "domino-eks-1.33-v20251101",
+			"domino-eks-compute": "domino-eks-1.33-v20251101",
+			"gpu":                "domino-eks-gpu-1.33-v20251101",
+			"gpu-large":          "domino-eks-gpu-large-1.33-v20251101",
+			"mem":                "domino-eks-mem-opt-x2-1.33-v20251101",
+		}},
+		{"1.34", map[string]string{
+			"default":            "domino-eks-1.34-v20251101",
+			"domino-eks-compute": "domino-eks-1.34-v20251101",
+			"gpu":                "domino-eks-gpu-1.34-v20251101",
+			"gpu-large":          "domino-eks-gpu-large-1.34-v20251101",
+			"mem":                "domino-eks-mem-opt-x2-1.34-v20251101",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run("k8s "+tt.k8sVersion, func(t *testing.T) {
+			p := planner.PlanTo(&upgrade.Discovery{NodeClasses: list}, tt.k8sVersion, "20251101")
+			got := make(map[string]string)
+			for _, ch := range p.Changes {
+				got[ch.NodeClass] = ch.NewAMI
+			}
+			for nodeClass, want := range tt.want {
+				if got[nodeClass] != want {
+					t.Errorf("%s: new AMI %q, want %q", nodeClass, got[nodeClass], want)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("changes = %v, want %v", got, tt.want)
+			}
+			// The FIPS nodeclass isn't moved to the standard variant, but still parses
+			if len(p.Skipped) != 1 || p.Skipped[0].NodeClass != "fips" || strings.Contains(p.Skipped[0].Reason, "parse") {
+				t.Errorf("skipped = %+v, want fips for its variant", p.Skipped)
+			}
+		})
+	}
+}
+
+func TestPlanVersion(t *testing.T) {
+	kube := fake.NewKubeClient()
+	for name, ami := range map[string]string{"default": "domino-eks-1.33-v20251001", "gpu": "domino-eks-gpu-1.33-v20251001"} {
+		nc := fmt.Sprintf(`{"metadata": {"name": %q}, "spec": {"amiSelectorTerms": [{"name": %q, "owner": "123456789012"}]}}`, name, ami)
+		if err := kube.Add("ec2nodeclass", nc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ec2 := fake.NewEC2Client()
+	ec2.Images["123456789012"] = []clients.Image{
+		{Name: "domino-eks-1.33-v20251101", ImageID: "ami-default"},
+		{Name: "domino-eks-gpu-1.33-v20251101", ImageID: "ami-gpu-1"},
+		{Name: "domino-eks-gpu-1.33-v20251101", ImageID: "ami-gpu-2"},
+	}
+	ec2.Images["210987654321"] = []clients.Image{{Name: "domino-eks-1.33-v20251101", ImageID: "ami-other-owner"}}
+	planner := &upgrade.Planner{Kube: kube, EC2: ec2, Naming: naming.Default}
+
+	tests := []struct {
+		name    string
+		changes []plan.Change
+		want    []string // image IDs
+		wantErr bool
+	}{
+		{"every image of the new names", []plan.Change{
+			{NodeClass: "default", NewAMI: "domino-eks-1.33-v20251101"},
+			{NodeClass: "gpu", NewAMI: "domino-eks-gpu-1.33-v20251101"},
+		}, []string{"ami-default", "ami-gpu-1", "ami-gpu-2"}, false},
+		{"pinned", []plan.Change{{NodeClass: "gpu", NewAMI: "domino-eks-gpu-1.33-v20251101", NewAMIID: "ami-gpu-2"}}, []string{"ami-gpu-2"}, false},
+		{"new owner", []plan.Change{{NodeClass: "default", NewAMI: "domino-eks-1.33-v20251101", NewOwner: "210987654321"}}, []string{"ami-other-owner"}, false},
+		{"unpublished", []plan.Change{{NodeClass: "default", NewAMI: "domino-eks-1.33-v20251201"}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := planner.PlanVersion(context.Background(), &plan.Plan{Version: "20251101", Changes: tt.changes})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PlanVersion() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var got []string
+			for _, image := range v.Images {
+				got = append(got, image.ImageID)
+			}
+			if !slices.Equal(got, tt.want) || v.K8sVersion != "1.33" {
+				t.Errorf("PlanVersion() = %v for kubernetes %q, want %v for 1.33", got, v.K8sVersion, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+// Package validation runs the smoke test of the validation cluster an upgrade is tried on before the cluster
+// being upgraded. The smoke test is a shell command that passes when it exits with status 0; it learns
+// which cluster, version and run it validates from UPGRADE_AMI_* environment variables.
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// DefaultTimeout is how long the rollout of the validation cluster and the smoke test may each take
+const DefaultTimeout = time.Hour
+
+// ErrFailed is returned when the validation cluster did not roll or its smoke test did not pass
+var ErrFailed = errors.New("validation failed")
+
+// Environment variables set for the smoke test
+const (
+	EnvContext = "UPGRADE_AMI_CONTEXT" // kubeconfig context of the validation cluster
+	EnvVersion = "UPGRADE_AMI_VERSION" // AMI version applied, e.g. v20251001
+	EnvRunID   = "UPGRADE_AMI_RUN_ID"  // run ID the validation cluster's nodes are annotated with
+)
+
+// SmokeTest is the command checking the validation cluster once it rolled
+type SmokeTest struct {
+	Command string        // run with sh -c
+	Env     []string      // added to the tool's environment, see Env
+	Timeout time.Duration // DefaultTimeout when zero
+	Stdout  io.Writer     // the command's output; discarded when nil
+	Stderr  io.Writer
+}
+
+// Env returns the environment variables describing the validation to the smoke test
+func Env(kubeContext, version, runID string) []string {
+	return []string{
+		EnvContext + "=" + kubeContext,
+		EnvVersion + "=v" + version,
+		EnvRunID + "=" + runID,
+	}
+}
+
+// Run runs the smoke test. It fails with ErrFailed when the command exits non-zero or runs out of time, and
+// with ctx's error when ctx is cancelled.
+func (t SmokeTest) Run(ctx context.Context) error {
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(runCtx, "sh", "-c", t.Command)
+	cmd.Env = append(os.Environ(), t.Env...)
+	cmd.Stdout, cmd.Stderr = t.Stdout, t.Stderr
+	// Interrupt rather than kill the smoke test so it can clean up, then kill it if it doesn't stop
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = 10 * time.Second
+
+	err := cmd.Run()
+	switch {
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case runCtx.Err() != nil:
+		return fmt.Errorf("%w: the smoke test did not finish within %s", ErrFailed, timeout)
+	case err != nil:
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("%w: the smoke test exited with status %d", ErrFailed, exitErr.ExitCode())
+		}
+		return fmt.Errorf("failed to run the smoke test: %w", err)
+	}
+	return nil
+}
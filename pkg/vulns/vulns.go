@@ -0,0 +1,141 @@
+// Package vulns gates AMI versions on vulnerability scan results, from Amazon Inspector or from a
+// findings file published by the image pipeline
+package vulns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/amis"
+	"github.com/ddl-r-abdulaziz/upgrade-ami/pkg/clients"
+)
+
+// ErrAboveThreshold is returned for versions with more findings than the policy allows
+var ErrAboveThreshold = errors.New("AMI vulnerability findings above threshold")
+
+// ErrNotScanned is returned by a policy with thresholds for versions that have AMIs without scan results
+var ErrNotScanned = errors.New("AMI has no vulnerability scan results")
+
+// Counts are the numbers of critical and high severity findings
+type Counts = clients.SeverityCounts
+
+// Source provides finding counts by image ID
+type Source interface {
+	Findings(ctx context.Context) (map[string]Counts, error)
+}
+
+// Inspector reads finding counts from Amazon Inspector
+type Inspector struct {
+	Scanner clients.FindingsScanner
+}
+
+// Findings returns Inspector's finding counts per AMI
+func (i Inspector) Findings(ctx context.Context) (map[string]Counts, error) {
+	findings, err := i.Scanner.AMIFindings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Inspector findings: %w", err)
+	}
+	return findings, nil
+}
+
+// File reads finding counts from a JSON file published by the image pipeline:
+//
+//	{"images": {"ami-0123456789abcdef0": {"critical": 0, "high": 2}}}
+type File struct {
+	Path string
+}
+
+// Findings reads the findings file
+func (f File) Findings(_ context.Context) (map[string]Counts, error) {
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read findings file: %w", err)
+	}
+
+	var doc struct {
+		Images map[string]struct {
+			Critical int `json:"critical"`
+			High     int `json:"high"`
+		} `json:"images"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse findings file %s: %w", f.Path, err)
+	}
+
+	findings := make(map[string]Counts, len(doc.Images))
+	for id, c := range doc.Images {
+		findings[id] = Counts{Critical: c.Critical, High: c.High}
+	}
+	return findings, nil
+}
+
+// Summary is the scan result of a version: the highest counts among its AMIs, since each nodegroup
+// runs one of them
+type Summary struct {
+	Counts
+	Scanned   int      // AMIs of the version with scan results
+	Unscanned []string // AMIs of the version without scan results
+}
+
+// Summarize combines the findings of a version's AMIs
+func Summarize(v amis.VersionItem, findings map[string]Counts) Summary {
+	var s Summary
+	for _, ami := range v.Images {
+		c, ok := findings[ami.ImageID]
+		if !ok {
+			s.Unscanned = append(s.Unscanned, ami.Name)
+			continue
+		}
+		s.Scanned++
+		s.Critical = max(s.Critical, c.Critical)
+		s.High = max(s.High, c.High)
+	}
+	return s
+}
+
+// String renders the counts, e.g. "0 critical, 3 high"
+func (s Summary) String() string {
+	if s.Scanned == 0 {
+		return "not scanned"
+	}
+	str := fmt.Sprintf("%d critical, %d high", s.Critical, s.High)
+	if len(s.Unscanned) > 0 {
+		str += fmt.Sprintf(" (%d AMIs not scanned)", len(s.Unscanned))
+	}
+	return str
+}
+
+// Policy limits the findings of a selectable version. A negative maximum means no limit.
+type Policy struct {
+	MaxCritical int
+	MaxHigh     int
+}
+
+// NoLimit is a Policy that allows any number of findings
+var NoLimit = Policy{MaxCritical: -1, MaxHigh: -1}
+
+// Enforced reports whether the policy limits anything
+func (p Policy) Enforced() bool {
+	return p.MaxCritical >= 0 || p.MaxHigh >= 0
+}
+
+// Check returns ErrAboveThreshold if s exceeds the policy, and ErrNotScanned if an AMI without scan
+// results prevents enforcing it
+func (p Policy) Check(s Summary) error {
+	if !p.Enforced() {
+		return nil
+	}
+	if len(s.Unscanned) > 0 {
+		return fmt.Errorf("%w: %s", ErrNotScanned, s.Unscanned[0])
+	}
+	if p.MaxCritical >= 0 && s.Critical > p.MaxCritical {
+		return fmt.Errorf("%w: %d critical findings (max %d)", ErrAboveThreshold, s.Critical, p.MaxCritical)
+	}
+	if p.MaxHigh >= 0 && s.High > p.MaxHigh {
+		return fmt.Errorf("%w: %d high findings (max %d)", ErrAboveThreshold, s.High, p.MaxHigh)
+	}
+	return nil
+}